@@ -0,0 +1,234 @@
+// Package admin provides an HTTP API to inspect and manage the connections and groups of a signalr.Server.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// maxBodySize limits the request bodies of the API
+const maxBodySize = 1 << 20
+
+// DisconnectRequest is the optional body of DELETE connections/{id}
+type DisconnectRequest struct {
+	Reason         string `json:"reason"`
+	AllowReconnect bool   `json:"allowReconnect"`
+}
+
+// SendRequest is the body of POST send. The message goes to the connection with ConnectionID,
+// the members of Group, or to all connections if both are empty.
+type SendRequest struct {
+	Target       string        `json:"target"`
+	Arguments    []interface{} `json:"arguments"`
+	ConnectionID string        `json:"connectionId,omitempty"`
+	Group        string        `json:"group,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns the handler of the API below prefix:
+//
+//	GET    {prefix}/connections                      all connections with their groups
+//	GET    {prefix}/connections/{id}                 one connection
+//	DELETE {prefix}/connections/{id}                 disconnect with a close message, body DisconnectRequest (optional)
+//	GET    {prefix}/groups                           the members of all non-empty groups
+//	PUT    {prefix}/groups/{group}/{connectionId}    add a connection to a group
+//	DELETE {prefix}/groups/{group}/{connectionId}    remove a connection from a group
+//	POST   {prefix}/send                             send a message to clients, body SendRequest
+//	GET    {prefix}/logging/debug                    the connections and hub methods with debug logging
+//	PUT    {prefix}/logging/debug/all                enable debug logging for all events, DELETE disables it
+//	PUT    {prefix}/logging/debug/connections/{id}   enable debug logging for a connection, DELETE disables it
+//	PUT    {prefix}/logging/debug/methods/{method}   enable debug logging for a hub method, DELETE disables it
+//
+// The logging routes need a server with the signalr.LoggerWithDebugFilter option.
+// The handler does no authentication, the caller has to wrap it.
+func NewHandler(server signalr.Server, prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/")
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			unescaped, err := url.PathUnescape(segment)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			segments[i] = unescaped
+		}
+		switch {
+		case len(segments) == 1 && segments[0] == "connections":
+			if allowMethods(w, r, http.MethodGet) {
+				writeJSON(w, http.StatusOK, server.Connections())
+			}
+		case len(segments) == 2 && segments[0] == "connections":
+			if allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+				serveConnection(w, r, server, segments[1])
+			}
+		case len(segments) == 1 && segments[0] == "groups":
+			if allowMethods(w, r, http.MethodGet) {
+				writeJSON(w, http.StatusOK, server.GroupMembers())
+			}
+		case len(segments) == 3 && segments[0] == "groups":
+			if allowMethods(w, r, http.MethodPut, http.MethodDelete) {
+				serveGroupMember(w, r, server, segments[1], segments[2])
+			}
+		case len(segments) == 1 && segments[0] == "send":
+			if allowMethods(w, r, http.MethodPost) {
+				serveSend(w, r, server)
+			}
+		case len(segments) >= 2 && segments[0] == "logging" && segments[1] == "debug":
+			serveDebugLogging(w, r, server, segments[2:])
+		default:
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+		}
+	})
+}
+
+func serveConnection(w http.ResponseWriter, r *http.Request, server signalr.Server, connectionID string) {
+	status, ok := findConnection(server, connectionID)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("connection not found"))
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+	request := DisconnectRequest{Reason: "Disconnected by administrator"}
+	if err := readJSON(r, &request, true); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := server.Disconnect(connectionID, request.Reason, request.AllowReconnect); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func serveGroupMember(w http.ResponseWriter, r *http.Request, server signalr.Server, group string, connectionID string) {
+	if group == "" {
+		writeError(w, http.StatusBadRequest, errors.New("group is empty"))
+		return
+	}
+	if r.Method == http.MethodPut {
+		// Leaving is possible after disconnect, but only connected connections can join
+		if _, ok := findConnection(server, connectionID); !ok {
+			writeError(w, http.StatusNotFound, errors.New("connection not found"))
+			return
+		}
+		server.Groups().AddToGroup(group, connectionID)
+	} else {
+		server.Groups().RemoveFromGroup(group, connectionID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func serveSend(w http.ResponseWriter, r *http.Request, server signalr.Server) {
+	var request SendRequest
+	if err := readJSON(r, &request, false); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Target == "" {
+		writeError(w, http.StatusBadRequest, errors.New("target is empty"))
+		return
+	}
+	if request.ConnectionID != "" && request.Group != "" {
+		writeError(w, http.StatusBadRequest, errors.New("connectionId and group are exclusive"))
+		return
+	}
+	var proxy signalr.ClientProxy
+	switch {
+	case request.ConnectionID != "":
+		if _, ok := findConnection(server, request.ConnectionID); !ok {
+			writeError(w, http.StatusNotFound, errors.New("connection not found"))
+			return
+		}
+		proxy = server.HubClients().Client(request.ConnectionID)
+	case request.Group != "":
+		proxy = server.HubClients().Group(request.Group)
+	default:
+		proxy = server.HubClients().All()
+	}
+	proxy.Send(request.Target, request.Arguments...)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func serveDebugLogging(w http.ResponseWriter, r *http.Request, server signalr.Server, segments []string) {
+	filter := server.DebugFilter()
+	if filter == nil {
+		writeError(w, http.StatusNotFound, errors.New("debug logging is not configured"))
+		return
+	}
+	if len(segments) == 0 {
+		if allowMethods(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, filter.Status())
+		}
+		return
+	}
+	var set func(enabled bool)
+	switch {
+	case len(segments) == 1 && segments[0] == "all":
+		set = filter.SetAll
+	case len(segments) == 2 && segments[0] == "connections" && segments[1] != "":
+		set = func(enabled bool) { filter.SetConnection(segments[1], enabled) }
+	case len(segments) == 2 && segments[0] == "methods" && segments[1] != "":
+		set = func(enabled bool) { filter.SetMethod(segments[1], enabled) }
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if allowMethods(w, r, http.MethodPut, http.MethodDelete) {
+		set(r.Method == http.MethodPut)
+		writeJSON(w, http.StatusOK, filter.Status())
+	}
+}
+
+func findConnection(server signalr.Server, connectionID string) (signalr.ConnectionStatus, bool) {
+	for _, status := range server.Connections() {
+		if status.ConnectionID == connectionID {
+			return status, true
+		}
+	}
+	return signalr.ConnectionStatus{}, false
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+// readJSON decodes the request body into v. If optional, an empty body leaves v unchanged.
+func readJSON(r *http.Request, v interface{}, optional bool) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	err := decoder.Decode(v)
+	if optional && errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
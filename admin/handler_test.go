@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+type testHub struct {
+	signalr.Hub
+}
+
+func (t *testHub) Join(group string) {
+	t.Groups().AddToGroup(group, t.ConnectionID())
+}
+
+type testReceiver struct {
+	signalr.Receiver
+	received chan string
+}
+
+func (t *testReceiver) Notify(text string) {
+	t.received <- text
+}
+
+// call sends a request to the admin API and decodes a JSON response into v, if v is not nil
+func call(method string, url string, body string, v interface{}) int {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	resp, err := http.DefaultClient.Do(request)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+	if v != nil {
+		Expect(json.NewDecoder(resp.Body).Decode(v)).To(Succeed())
+	}
+	return resp.StatusCode
+}
+
+var _ = Describe("Handler", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var testServer *httptest.Server
+	var client signalr.Client
+	var receiver *testReceiver
+	var api string
+	var filter *signalr.DebugFilter
+
+	BeforeEach(func(done Done) {
+		ctx, cancel = context.WithCancel(context.Background())
+		filter = &signalr.DebugFilter{}
+		server, err := signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}),
+			signalr.HTTPTransports(signalr.TransportWebSockets),
+			signalr.LoggerWithDebugFilter(signalr.SlogLogger(slog.NewTextHandler(io.Discard, nil)), filter))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), "/hub")
+		router.Handle("/admin/", NewHandler(server, "/admin"))
+		testServer = httptest.NewServer(router)
+		api = testServer.URL + "/admin"
+
+		conn, err := signalr.NewHTTPConnection(ctx, testServer.URL+"/hub")
+		Expect(err).NotTo(HaveOccurred())
+		receiver = &testReceiver{received: make(chan string, 1)}
+		client, err = signalr.NewClient(ctx, signalr.WithConnection(conn), signalr.WithReceiver(receiver))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		Expect((<-client.Invoke("join", "line1")).Error).NotTo(HaveOccurred())
+		close(done)
+	}, 5.0)
+
+	AfterEach(func() {
+		cancel()
+		testServer.Close()
+	})
+
+	connectionID := func() string {
+		var connections []signalr.ConnectionStatus
+		Expect(call(http.MethodGet, api+"/connections", "", &connections)).To(Equal(http.StatusOK))
+		Expect(connections).To(HaveLen(1))
+		return connections[0].ConnectionID
+	}
+
+	It("should list connections and groups", func() {
+		var connections []signalr.ConnectionStatus
+		Expect(call(http.MethodGet, api+"/connections", "", &connections)).To(Equal(http.StatusOK))
+		Expect(connections).To(HaveLen(1))
+		Expect(connections[0].Transport).To(Equal("WebSockets"))
+		Expect(connections[0].Protocol).To(Equal("json"))
+		Expect(connections[0].RemoteAddress).To(HavePrefix("127.0.0.1:"))
+		Expect(connections[0].Groups).To(Equal([]string{"line1"}))
+		var status signalr.ConnectionStatus
+		Expect(call(http.MethodGet, api+"/connections/"+connections[0].ConnectionID, "", &status)).To(Equal(http.StatusOK))
+		Expect(status.ConnectionID).To(Equal(connections[0].ConnectionID))
+		var groups map[string][]string
+		Expect(call(http.MethodGet, api+"/groups", "", &groups)).To(Equal(http.StatusOK))
+		Expect(groups).To(Equal(map[string][]string{"line1": {connections[0].ConnectionID}}))
+	})
+
+	It("should add and remove group members", func() {
+		id := connectionID()
+		Expect(call(http.MethodPut, api+"/groups/line%2F2/"+id, "", nil)).To(Equal(http.StatusNoContent))
+		Expect(call(http.MethodDelete, api+"/groups/line1/"+id, "", nil)).To(Equal(http.StatusNoContent))
+		var groups map[string][]string
+		Expect(call(http.MethodGet, api+"/groups", "", &groups)).To(Equal(http.StatusOK))
+		Expect(groups).To(Equal(map[string][]string{"line/2": {id}}))
+		Expect(call(http.MethodPut, api+"/groups/line1/unknown", "", nil)).To(Equal(http.StatusNotFound))
+	})
+
+	It("should send test messages", func(done Done) {
+		id := connectionID()
+		Expect(call(http.MethodPost, api+"/send", `{"target":"notify","arguments":["all"]}`, nil)).To(Equal(http.StatusAccepted))
+		Expect(<-receiver.received).To(Equal("all"))
+		Expect(call(http.MethodPost, api+"/send", `{"target":"notify","arguments":["group"],"group":"line1"}`, nil)).To(Equal(http.StatusAccepted))
+		Expect(<-receiver.received).To(Equal("group"))
+		Expect(call(http.MethodPost, api+"/send", `{"target":"notify","arguments":["client"],"connectionId":"`+id+`"}`, nil)).To(Equal(http.StatusAccepted))
+		Expect(<-receiver.received).To(Equal("client"))
+		Expect(call(http.MethodPost, api+"/send", `{"arguments":[]}`, nil)).To(Equal(http.StatusBadRequest))
+		close(done)
+	}, 5.0)
+
+	It("should disconnect connections", func(done Done) {
+		id := connectionID()
+		Expect(call(http.MethodDelete, api+"/connections/"+id, `{"reason":"maintenance"}`, nil)).To(Equal(http.StatusNoContent))
+		Eventually(func() []signalr.ConnectionStatus {
+			var connections []signalr.ConnectionStatus
+			call(http.MethodGet, api+"/connections", "", &connections)
+			return connections
+		}).Should(BeEmpty())
+		Expect(call(http.MethodDelete, api+"/connections/"+id, "", nil)).To(Equal(http.StatusNotFound))
+		close(done)
+	}, 5.0)
+
+	It("should switch debug logging", func() {
+		id := connectionID()
+		var status signalr.DebugStatus
+		Expect(call(http.MethodGet, api+"/logging/debug", "", &status)).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(signalr.DebugStatus{Connections: []string{}, Methods: []string{}}))
+		Expect(call(http.MethodPut, api+"/logging/debug/connections/"+id, "", nil)).To(Equal(http.StatusOK))
+		Expect(call(http.MethodPut, api+"/logging/debug/methods/Join", "", nil)).To(Equal(http.StatusOK))
+		Expect(call(http.MethodPut, api+"/logging/debug/all", "", &status)).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(signalr.DebugStatus{All: true, Connections: []string{id}, Methods: []string{"join"}}))
+		Expect(filter.Enabled(id, "")).To(BeTrue())
+		Expect(call(http.MethodDelete, api+"/logging/debug/all", "", nil)).To(Equal(http.StatusOK))
+		Expect(call(http.MethodDelete, api+"/logging/debug/connections/"+id, "", &status)).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(signalr.DebugStatus{Connections: []string{}, Methods: []string{"join"}}))
+		Expect(call(http.MethodPost, api+"/logging/debug/all", "", nil)).To(Equal(http.StatusMethodNotAllowed))
+		Expect(call(http.MethodPut, api+"/logging/debug/unknown", "", nil)).To(Equal(http.StatusNotFound))
+	})
+
+	It("should not switch debug logging without filter", func() {
+		server, err := signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}))
+		Expect(err).NotTo(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		NewHandler(server, "/admin").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/logging/debug", nil))
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should reject unknown routes and methods", func() {
+		Expect(call(http.MethodGet, api+"/unknown", "", nil)).To(Equal(http.StatusNotFound))
+		Expect(call(http.MethodPost, api+"/connections", "", nil)).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,287 @@
+// Package audit provides sinks which persist the AuditEvents of a signalr server.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// DefaultMaxSize is the size of an audit file in bytes after which it is rotated, if no MaxSize is given
+const DefaultMaxSize = 10 * 1024 * 1024
+
+// DefaultMaxFiles is the number of rotated audit files which are kept, if no MaxFiles is given
+const DefaultMaxFiles = 5
+
+// Options configure a FileSink
+type Options struct {
+	// MaxSize is the size in bytes after which the file is rotated
+	MaxSize int64
+	// MaxFiles is the number of rotated files (path.1 ... path.MaxFiles) which are kept
+	MaxFiles int
+	// HashChain makes the file tamper-evident. Every record contains the hash of the record before it
+	// and its own hash, so changing, removing or reordering records breaks the chain. See Verify.
+	HashChain bool
+	// Key is the secret of the HMAC-SHA256 hashes of the chain, required with HashChain. Without the key,
+	// modified records can't be given valid hashes, so it must not be readable by whoever can write the files.
+	Key []byte
+}
+
+// ErrNoKey is returned by NewFileSink and Verify for a hash chain without a key
+var ErrNoKey = errors.New("audit hash chain needs a key")
+
+// Record is one line of an audit file
+type Record struct {
+	signalr.AuditEvent
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// FileSink is a signalr.AuditSink which writes the events as JSON lines to a file.
+// When the file would grow beyond MaxSize, it is renamed to path.1, path.1 to path.2 and so on,
+// and the oldest file is removed. In hash chain mode, the chain continues across rotated files
+// and across restarts.
+type FileSink struct {
+	mu       sync.Mutex
+	path     string
+	options  Options
+	file     *os.File
+	size     int64
+	lastHash string
+}
+
+// NewFileSink opens or creates the audit file at path
+func NewFileSink(path string, options Options) (*FileSink, error) {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultMaxSize
+	}
+	if options.MaxFiles <= 0 {
+		options.MaxFiles = DefaultMaxFiles
+	}
+	f := &FileSink{path: path, options: options}
+	if options.HashChain {
+		if len(options.Key) == 0 {
+			return nil, ErrNoKey
+		}
+		lastHash, err := f.readLastHash()
+		if err != nil {
+			return nil, err
+		}
+		f.lastHash = lastHash
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Audit writes the event as one line
+func (f *FileSink) Audit(event signalr.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	record := Record{AuditEvent: event}
+	if f.options.HashChain {
+		record.PrevHash = f.lastHash
+		hash, err := recordHash(record, f.options.Key)
+		if err != nil {
+			return err
+		}
+		record.Hash = hash
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if f.size > 0 && f.size+int64(len(line)) > f.options.MaxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	f.lastHash = record.Hash
+	return nil
+}
+
+// Close closes the audit file
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *FileSink) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *FileSink) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := os.Remove(rotatedPath(f.path, f.options.MaxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := f.options.MaxFiles - 1; i > 0; i-- {
+		if err := os.Rename(rotatedPath(f.path, i), rotatedPath(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, rotatedPath(f.path, 1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// readLastHash finds the hash of the last record, in the current file or, if it is empty, in the last rotated file
+func (f *FileSink) readLastHash() (string, error) {
+	for _, path := range []string{f.path, rotatedPath(f.path, 1)} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+		last := lines[len(lines)-1]
+		if len(last) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(last, &record); err != nil {
+			return "", fmt.Errorf("audit file %s: last record is corrupt: %w", path, err)
+		}
+		return record.Hash, nil
+	}
+	return "", nil
+}
+
+func rotatedPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// recordHash is the hex encoded HMAC-SHA256 with key of the JSON encoding of the record without its hash
+func recordHash(record Record, key []byte) (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ChainError describes where the hash chain of an audit file is broken
+type ChainError struct {
+	Path   string
+	Line   int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit chain broken in %s line %d: %s", e.Path, e.Line, e.Reason)
+}
+
+// Verify checks the hash chain of the audit file at path and its rotated files, from the oldest to the current,
+// with the key of the FileSink which wrote them.
+// As the oldest files are removed by rotation, the prevHash of the first record of the oldest file is not checked.
+// It returns the number of verified records.
+func Verify(path string, maxFiles int, key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrNoKey
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	paths := make([]string, 0, maxFiles+1)
+	for i := maxFiles; i > 0; i-- {
+		paths = append(paths, rotatedPath(path, i))
+	}
+	paths = append(paths, path)
+	count := 0
+	prevHash := ""
+	first := true
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		n, lastHash, err := verifyFile(file, p, prevHash, first, key)
+		_ = file.Close()
+		count += n
+		if err != nil {
+			return count, err
+		}
+		if n > 0 {
+			prevHash = lastHash
+			first = false
+		}
+	}
+	return count, nil
+}
+
+func verifyFile(file *os.File, path string, prevHash string, first bool, key []byte) (int, string, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return count, prevHash, &ChainError{Path: path, Line: line, Reason: err.Error()}
+		}
+		// Fields which are not part of a Record would not be covered by the hash
+		if canonical, err := json.Marshal(record); err != nil || !bytes.Equal(canonical, scanner.Bytes()) {
+			return count, prevHash, &ChainError{Path: path, Line: line, Reason: "record has been modified"}
+		}
+		if record.Hash == "" {
+			return count, prevHash, &ChainError{Path: path, Line: line, Reason: "record has no hash"}
+		}
+		if !first && record.PrevHash != prevHash {
+			return count, prevHash, &ChainError{Path: path, Line: line, Reason: "previous hash does not match"}
+		}
+		if hash, _ := recordHash(record, key); !hmac.Equal([]byte(hash), []byte(record.Hash)) {
+			return count, prevHash, &ChainError{Path: path, Line: line, Reason: "hash does not match"}
+		}
+		prevHash = record.Hash
+		first = false
+		count++
+	}
+	return count, prevHash, scanner.Err()
+}
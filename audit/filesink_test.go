@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+func testEvent(i int) signalr.AuditEvent {
+	return signalr.AuditEvent{
+		Time:         time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+		Kind:         signalr.AuditInvocation,
+		ConnectionID: fmt.Sprintf("conn%d", i),
+		Method:       "send",
+		Outcome:      signalr.AuditOK,
+	}
+}
+
+func readRecords(path string) []Record {
+	data, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	records := make([]Record, 0)
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var record Record
+		Expect(json.Unmarshal(line, &record)).To(Succeed())
+		records = append(records, record)
+	}
+	return records
+}
+
+var _ = Describe("FileSink", func() {
+	var dir string
+	var path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "audit")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "audit.log")
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("should write one JSON line per event", func() {
+		sink, err := NewFileSink(path, Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Audit(testEvent(1))).To(Succeed())
+		Expect(sink.Audit(testEvent(2))).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+		records := readRecords(path)
+		Expect(records).To(HaveLen(2))
+		Expect(records[1].ConnectionID).To(Equal("conn2"))
+		Expect(records[1].Hash).To(BeEmpty())
+		Expect(sink.Audit(testEvent(3))).To(MatchError(os.ErrClosed))
+	})
+
+	It("should rotate the file and keep MaxFiles rotated files", func() {
+		sink, err := NewFileSink(path, Options{MaxSize: 300, MaxFiles: 2})
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 20; i++ {
+			Expect(sink.Audit(testEvent(i))).To(Succeed())
+		}
+		Expect(sink.Close()).To(Succeed())
+		Expect(path + ".1").To(BeAnExistingFile())
+		Expect(path + ".2").To(BeAnExistingFile())
+		Expect(path + ".3").NotTo(BeAnExistingFile())
+		for _, p := range []string{path, path + ".1", path + ".2"} {
+			info, err := os.Stat(p)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically("<=", 300))
+		}
+		records := readRecords(path)
+		Expect(records[len(records)-1].ConnectionID).To(Equal("conn19"))
+	})
+
+	Context("in hash chain mode", func() {
+		key := []byte("audit-secret")
+
+		It("should chain the records and verify them", func() {
+			sink, err := NewFileSink(path, Options{HashChain: true, Key: key})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				Expect(sink.Audit(testEvent(i))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+			records := readRecords(path)
+			Expect(records[0].PrevHash).To(BeEmpty())
+			for i := 1; i < len(records); i++ {
+				Expect(records[i].PrevHash).To(Equal(records[i-1].Hash))
+			}
+			Expect(Verify(path, 0, key)).To(Equal(5))
+		})
+
+		It("should continue the chain across rotation and restarts", func() {
+			sink, err := NewFileSink(path, Options{HashChain: true, Key: key, MaxSize: 600, MaxFiles: 3})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 4; i++ {
+				Expect(sink.Audit(testEvent(i))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+			sink, err = NewFileSink(path, Options{HashChain: true, Key: key, MaxSize: 600, MaxFiles: 3})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 4; i < 8; i++ {
+				Expect(sink.Audit(testEvent(i))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+			Expect(path + ".1").To(BeAnExistingFile())
+			Expect(Verify(path, 3, key)).To(Equal(8))
+		})
+
+		It("should verify when the oldest files have been removed by rotation", func() {
+			sink, err := NewFileSink(path, Options{HashChain: true, Key: key, MaxSize: 600, MaxFiles: 1})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 10; i++ {
+				Expect(sink.Audit(testEvent(i))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+			n, err := Verify(path, 1, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(BeNumerically("<", 10))
+		})
+
+		It("should detect modified, removed and reordered records", func() {
+			sink, err := NewFileSink(path, Options{HashChain: true, Key: key})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 4; i++ {
+				Expect(sink.Audit(testEvent(i))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+			tamper := func(lines []string) error {
+				Expect(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)).To(Succeed())
+				_, err := Verify(path, 0, key)
+				return err
+			}
+			modified := append([]string{}, lines...)
+			modified[2] = strings.Replace(modified[2], `"conn2"`, `"conn9"`, 1)
+			Expect(tamper(modified)).To(MatchError(&ChainError{Path: path, Line: 3, Reason: "hash does not match"}))
+
+			added := append([]string{}, lines...)
+			added[1] = strings.Replace(added[1], `{"time"`, `{"note":"x","time"`, 1)
+			Expect(tamper(added)).To(MatchError(&ChainError{Path: path, Line: 2, Reason: "record has been modified"}))
+
+			removed := append(append([]string{}, lines[:1]...), lines[2:]...)
+			Expect(tamper(removed)).To(MatchError(&ChainError{Path: path, Line: 2, Reason: "previous hash does not match"}))
+
+			reordered := []string{lines[0], lines[2], lines[1], lines[3]}
+			Expect(tamper(reordered)).To(MatchError(&ChainError{Path: path, Line: 2, Reason: "previous hash does not match"}))
+
+			Expect(tamper(lines)).To(Succeed())
+		})
+
+		It("should detect records rehashed without the key", func() {
+			sink, err := NewFileSink(path, Options{HashChain: true, Key: key})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				Expect(sink.Audit(testEvent(i))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+			records := readRecords(path)
+			// rewrite the chain from the second record with another key, as a forger would have to
+			records[1].ConnectionID = "conn9"
+			var lines []string
+			for i, record := range records {
+				if i > 0 {
+					if i > 1 {
+						record.PrevHash = records[i-1].Hash
+					}
+					record.Hash, err = recordHash(record, []byte("guessed"))
+					Expect(err).NotTo(HaveOccurred())
+					records[i] = record
+				}
+				line, err := json.Marshal(record)
+				Expect(err).NotTo(HaveOccurred())
+				lines = append(lines, string(line))
+			}
+			Expect(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)).To(Succeed())
+			_, err = Verify(path, 0, key)
+			Expect(err).To(MatchError(&ChainError{Path: path, Line: 2, Reason: "hash does not match"}))
+		})
+
+		It("should need a key", func() {
+			_, err := NewFileSink(path, Options{HashChain: true})
+			Expect(err).To(MatchError(ErrNoKey))
+			_, err = Verify(path, 0, nil)
+			Expect(err).To(MatchError(ErrNoKey))
+		})
+	})
+})
@@ -0,0 +1,155 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxBodySize limits the request bodies of the API
+const maxBodySize = 1 << 16
+
+// sseKeepAlive is the interval of comments sent on an idle live stream
+const sseKeepAlive = 15 * time.Second
+
+// StartRequest is the body of POST rules
+type StartRequest struct {
+	ConnectionID string `json:"connectionId,omitempty"`
+	Group        string `json:"group,omitempty"`
+	Method       string `json:"method,omitempty"`
+	Seconds      int    `json:"seconds"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler returns the handler of the capture API below prefix:
+//
+//	GET    {prefix}/rules       the rules which are capturing
+//	POST   {prefix}/rules       capture for a connection, group or hub method, body StartRequest
+//	DELETE {prefix}/rules       stop capturing
+//	GET    {prefix}/messages    download the recorded messages as JSON lines
+//	DELETE {prefix}/messages    clear the recorded messages
+//	GET    {prefix}/stream      follow the recorded messages live as server-sent events
+//
+// The handler does no authentication, the caller has to wrap it.
+func (r *Recorder) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch strings.Trim(strings.TrimPrefix(req.URL.Path, prefix), "/") {
+		case "rules":
+			if allowMethods(w, req, http.MethodGet, http.MethodPost, http.MethodDelete) {
+				r.serveRules(w, req)
+			}
+		case "messages":
+			if allowMethods(w, req, http.MethodGet, http.MethodDelete) {
+				r.serveMessages(w, req)
+			}
+		case "stream":
+			if allowMethods(w, req, http.MethodGet) {
+				r.serveStream(w, req)
+			}
+		default:
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+		}
+	})
+}
+
+func (r *Recorder) serveRules(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.Rules())
+	case http.MethodDelete:
+		r.Stop()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		var request StartRequest
+		if err := json.NewDecoder(io.LimitReader(req.Body, maxBodySize)).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rule, err := r.Start(Rule{ConnectionID: request.ConnectionID, Group: request.Group, Method: request.Method},
+			time.Duration(request.Seconds)*time.Second)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, rule)
+	}
+}
+
+func (r *Recorder) serveMessages(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodDelete {
+		r.Clear()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="capture.jsonl"`)
+	encoder := json.NewEncoder(w)
+	for _, message := range r.Messages() {
+		if err := encoder.Encode(message); err != nil {
+			return
+		}
+	}
+}
+
+func (r *Recorder) serveStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	ch, unsubscribe := r.subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case message := <-ch:
+			b, err := json.Marshal(message)
+			if err != nil {
+				continue
+			}
+			if _, err := io.WriteString(w, "data: "+string(b)+"\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,229 @@
+// Package capture records the hub messages of selected connections, groups or hub methods for a limited time,
+// to see what was actually sent and received. The Recorder is a signalr.Tap. It keeps the redacted messages
+// in a ring buffer, which is downloaded as JSON lines or followed live over server-sent events.
+package capture
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// groupCacheTime is how long the group members are cached for group rules
+const groupCacheTime = time.Second
+
+// Rule selects the messages to capture until Until. Exactly one of ConnectionID, Group and Method is set.
+// Method matches the invocations of the hub method in both directions, so a topic sent to the clients
+// is captured by the name of the client method.
+type Rule struct {
+	ConnectionID string    `json:"connectionId,omitempty"`
+	Group        string    `json:"group,omitempty"`
+	Method       string    `json:"method,omitempty"`
+	Until        time.Time `json:"until"`
+}
+
+// Options configure a Recorder
+type Options struct {
+	// Size is the number of messages kept in the ring buffer, default 10000
+	Size int
+	// MaxDuration is the longest time a Rule can capture, default 10m
+	MaxDuration time.Duration
+	// Redact are the rules of the Redactor applied to all captured messages
+	Redact []string
+}
+
+// Recorder captures the messages selected by its rules
+type Recorder struct {
+	options      Options
+	redactor     *Redactor
+	mx           sync.RWMutex
+	rules        []Rule
+	ring         []signalr.TapMessage
+	next         int
+	full         bool
+	subscribers  map[chan signalr.TapMessage]struct{}
+	groupMembers func() map[string][]string
+	groupsMx     sync.Mutex
+	groups       map[string]map[string]bool // connection ids by group, cached for group rules
+	groupsAt     time.Time
+	now          func() time.Time
+}
+
+// New creates a Recorder without rules
+func New(options Options) *Recorder {
+	if options.Size <= 0 {
+		options.Size = 10000
+	}
+	if options.MaxDuration <= 0 {
+		options.MaxDuration = 10 * time.Minute
+	}
+	return &Recorder{
+		options:     options,
+		redactor:    NewRedactor(options.Redact),
+		ring:        make([]signalr.TapMessage, options.Size),
+		subscribers: make(map[chan signalr.TapMessage]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Attach tells the Recorder the server whose group members are matched by group rules
+func (r *Recorder) Attach(server signalr.Server) {
+	r.groupsMx.Lock()
+	defer r.groupsMx.Unlock()
+	r.groupMembers = server.GroupMembers
+}
+
+// Start adds a rule which captures for duration, at most MaxDuration. It returns the rule with its end.
+func (r *Recorder) Start(rule Rule, duration time.Duration) (Rule, error) {
+	set := 0
+	for _, value := range []string{rule.ConnectionID, rule.Group, rule.Method} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return rule, errors.New("exactly one of connectionId, group and method is needed")
+	}
+	if duration <= 0 {
+		return rule, errors.New("duration must be positive")
+	}
+	if duration > r.options.MaxDuration {
+		duration = r.options.MaxDuration
+	}
+	rule.Until = r.now().Add(duration).UTC()
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.rules = append(r.activeRules(), rule)
+	return rule, nil
+}
+
+// Stop removes all rules
+func (r *Recorder) Stop() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.rules = nil
+}
+
+// Rules returns the rules which are still capturing
+func (r *Recorder) Rules() []Rule {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.rules = r.activeRules()
+	return append([]Rule{}, r.rules...)
+}
+
+// activeRules returns the rules which have not ended. The caller holds mx.
+func (r *Recorder) activeRules() []Rule {
+	now := r.now()
+	active := make([]Rule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		if now.Before(rule.Until) {
+			active = append(active, rule)
+		}
+	}
+	return active
+}
+
+// Enabled tells if one of the rules selects messages of the connection with the target
+func (r *Recorder) Enabled(connectionID string, target string) bool {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	if len(r.rules) == 0 {
+		return false
+	}
+	now := r.now()
+	for _, rule := range r.rules {
+		if !now.Before(rule.Until) {
+			continue
+		}
+		switch {
+		case rule.ConnectionID != "":
+			if rule.ConnectionID == connectionID {
+				return true
+			}
+		case rule.Method != "":
+			if target != "" && strings.EqualFold(rule.Method, target) {
+				return true
+			}
+		case rule.Group != "":
+			if r.isMember(rule.Group, connectionID, now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isMember tells if the connection is a member of the group, with the members cached for groupCacheTime
+func (r *Recorder) isMember(group string, connectionID string, now time.Time) bool {
+	r.groupsMx.Lock()
+	defer r.groupsMx.Unlock()
+	if r.groupMembers == nil {
+		return false
+	}
+	if r.groups == nil || now.Sub(r.groupsAt) > groupCacheTime {
+		r.groups = make(map[string]map[string]bool)
+		for name, members := range r.groupMembers() {
+			r.groups[name] = make(map[string]bool, len(members))
+			for _, member := range members {
+				r.groups[name][member] = true
+			}
+		}
+		r.groupsAt = now
+	}
+	return r.groups[group][connectionID]
+}
+
+// Message records the redacted message and passes it to the live subscribers.
+// Subscribers which can't keep up miss messages.
+func (r *Recorder) Message(message signalr.TapMessage) {
+	message = r.redactor.Message(message)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.ring[r.next] = message
+	r.next = (r.next + 1) % len(r.ring)
+	if r.next == 0 {
+		r.full = true
+	}
+	for ch := range r.subscribers {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+}
+
+// Messages returns the recorded messages, the oldest first
+func (r *Recorder) Messages() []signalr.TapMessage {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	if !r.full {
+		return append([]signalr.TapMessage{}, r.ring[:r.next]...)
+	}
+	return append(append([]signalr.TapMessage{}, r.ring[r.next:]...), r.ring[:r.next]...)
+}
+
+// Clear removes the recorded messages
+func (r *Recorder) Clear() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.ring = make([]signalr.TapMessage, len(r.ring))
+	r.next = 0
+	r.full = false
+}
+
+// subscribe returns a channel which receives the messages recorded from now on, until unsubscribe is called
+func (r *Recorder) subscribe() (ch chan signalr.TapMessage, unsubscribe func()) {
+	ch = make(chan signalr.TapMessage, 100)
+	r.mx.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mx.Unlock()
+	return ch, func() {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		delete(r.subscribers, ch)
+	}
+}
@@ -0,0 +1,200 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+type testHub struct {
+	signalr.Hub
+}
+
+func (t *testHub) Join(group string) {
+	t.Groups().AddToGroup(group, t.ConnectionID())
+}
+
+func (t *testHub) Publish(topic string, message string) {
+	t.Clients().All().Send(topic, message)
+}
+
+type testReceiver struct {
+	signalr.Receiver
+	received chan string
+}
+
+func (t *testReceiver) Line1(message string) {
+	t.received <- message
+}
+
+var _ = Describe("Recorder", func() {
+	var recorder *Recorder
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		recorder = New(Options{Size: 3, MaxDuration: time.Minute})
+		recorder.now = func() time.Time { return now }
+	})
+
+	It("should validate rules and limit their duration", func() {
+		_, err := recorder.Start(Rule{}, time.Second)
+		Expect(err).To(HaveOccurred())
+		_, err = recorder.Start(Rule{ConnectionID: "c1", Method: "m"}, time.Second)
+		Expect(err).To(HaveOccurred())
+		_, err = recorder.Start(Rule{Method: "m"}, 0)
+		Expect(err).To(HaveOccurred())
+		rule, err := recorder.Start(Rule{Method: "m"}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rule.Until).To(Equal(now.Add(time.Minute)))
+	})
+
+	It("should select messages by connection and case-insensitive method until the rules end", func() {
+		Expect(recorder.Enabled("c1", "Publish")).To(BeFalse())
+		_, _ = recorder.Start(Rule{ConnectionID: "c1"}, 10*time.Second)
+		_, _ = recorder.Start(Rule{Method: "publish"}, 20*time.Second)
+		Expect(recorder.Enabled("c1", "")).To(BeTrue())
+		Expect(recorder.Enabled("c2", "Publish")).To(BeTrue())
+		Expect(recorder.Enabled("c2", "")).To(BeFalse())
+		now = now.Add(15 * time.Second)
+		Expect(recorder.Enabled("c1", "")).To(BeFalse())
+		Expect(recorder.Rules()).To(HaveLen(1))
+		now = now.Add(15 * time.Second)
+		Expect(recorder.Enabled("c2", "Publish")).To(BeFalse())
+		Expect(recorder.Rules()).To(BeEmpty())
+	})
+
+	It("should keep the latest messages in the ring buffer", func() {
+		for _, id := range []string{"1", "2", "3", "4"} {
+			recorder.Message(signalr.TapMessage{InvocationID: id})
+		}
+		var ids []string
+		for _, message := range recorder.Messages() {
+			ids = append(ids, message.InvocationID)
+		}
+		Expect(ids).To(Equal([]string{"2", "3", "4"}))
+		recorder.Clear()
+		Expect(recorder.Messages()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Capture", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var recorder *Recorder
+	var testServer *httptest.Server
+	var client signalr.Client
+	var receiver *testReceiver
+	var api string
+
+	BeforeEach(func(done Done) {
+		ctx, cancel = context.WithCancel(context.Background())
+		recorder = New(Options{Redact: []string{"password"}})
+		server, err := signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}),
+			signalr.HTTPTransports(signalr.TransportWebSockets), signalr.WithTap(recorder))
+		Expect(err).NotTo(HaveOccurred())
+		recorder.Attach(server)
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), "/hub")
+		router.Handle("/capture/", recorder.Handler("/capture"))
+		testServer = httptest.NewServer(router)
+		api = testServer.URL + "/capture"
+
+		conn, err := signalr.NewHTTPConnection(ctx, testServer.URL+"/hub")
+		Expect(err).NotTo(HaveOccurred())
+		receiver = &testReceiver{received: make(chan string, 1)}
+		client, err = signalr.NewClient(ctx, signalr.WithConnection(conn), signalr.WithReceiver(receiver))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		Expect((<-client.Invoke("join", "line1")).Error).NotTo(HaveOccurred())
+		close(done)
+	}, 5.0)
+
+	AfterEach(func() {
+		cancel()
+		testServer.Close()
+	})
+
+	post := func(body string) int {
+		resp, err := http.Post(api+"/rules", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	It("should capture the messages of a group and download them redacted", func(done Done) {
+		Expect(post(`{"group":"line1","seconds":60}`)).To(Equal(http.StatusCreated))
+		Expect(post(`{"seconds":60}`)).To(Equal(http.StatusBadRequest))
+		Expect((<-client.Invoke("publish", "line1", `{"password":"secret"}`)).Error).NotTo(HaveOccurred())
+		Expect(<-receiver.received).To(Equal(`{"password":"secret"}`))
+		var messages []signalr.TapMessage
+		Eventually(func() int {
+			resp, err := http.Get(api + "/messages")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+			messages = nil
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var message signalr.TapMessage
+				Expect(json.Unmarshal(scanner.Bytes(), &message)).To(Succeed())
+				messages = append(messages, message)
+			}
+			return len(messages)
+		}).Should(Equal(3))
+		Expect(messages[0].Direction).To(Equal(signalr.TapInbound))
+		Expect(messages[0].Target).To(Equal("publish"))
+		Expect(messages[0].Arguments).To(Equal([]interface{}{"line1", `{"password":"***"}`}))
+		// The order of the send to the client and the completion is not defined
+		targets := []string{messages[1].Target + messages[1].Type, messages[2].Target + messages[2].Type}
+		Expect(targets).To(ConsistOf("line1invocation", "completion"))
+		close(done)
+	}, 5.0)
+
+	It("should stream the messages live", func(done Done) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/stream", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+		Expect(post(`{"method":"line1","seconds":60}`)).To(Equal(http.StatusCreated))
+		Expect((<-client.Invoke("publish", "line1", "hello")).Error).NotTo(HaveOccurred())
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(HavePrefix("data: "))
+		var message signalr.TapMessage
+		Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message)).To(Succeed())
+		Expect(message.Direction).To(Equal(signalr.TapOutbound))
+		Expect(message.Target).To(Equal("line1"))
+		Expect(message.Arguments).To(Equal([]interface{}{"hello"}))
+		close(done)
+	}, 5.0)
+
+	It("should list and stop the rules", func() {
+		Expect(post(`{"method":"line1","seconds":60}`)).To(Equal(http.StatusCreated))
+		resp, err := http.Get(api + "/rules")
+		Expect(err).NotTo(HaveOccurred())
+		var rules []Rule
+		Expect(json.NewDecoder(resp.Body).Decode(&rules)).To(Succeed())
+		resp.Body.Close()
+		Expect(rules).To(HaveLen(1))
+		req, _ := http.NewRequest(http.MethodDelete, api+"/rules", nil)
+		resp, err = http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(recorder.Rules()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,119 @@
+package capture
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// Redacted replaces the values of redacted fields
+const Redacted = "***"
+
+// Redactor replaces the values of fields in captured messages. A rule is either a field name, which matches
+// the field at any depth, or a dotted path like "order.customer.email", which matches from the root of an argument,
+// item or result. Array indices are not part of paths. Rules are case-insensitive and also match header names.
+// Strings which contain a JSON object or array, like the messages of the IAC message bus, are redacted inside.
+type Redactor struct {
+	names map[string]bool
+	paths map[string]bool
+}
+
+// NewRedactor creates a Redactor with the rules
+func NewRedactor(rules []string) *Redactor {
+	r := &Redactor{names: make(map[string]bool), paths: make(map[string]bool)}
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch {
+		case rule == "":
+		case strings.Contains(rule, "."):
+			r.paths[rule] = true
+		default:
+			r.names[rule] = true
+		}
+	}
+	return r
+}
+
+// Message returns the message with the redacted headers, arguments, item and result
+func (r *Redactor) Message(m signalr.TapMessage) signalr.TapMessage {
+	if len(r.names) == 0 && len(r.paths) == 0 {
+		return m
+	}
+	if m.Headers != nil {
+		headers := make(map[string]string, len(m.Headers))
+		for key, value := range m.Headers {
+			if r.names[strings.ToLower(key)] {
+				value = Redacted
+			}
+			headers[key] = value
+		}
+		m.Headers = headers
+	}
+	if m.Arguments != nil {
+		arguments := make([]interface{}, len(m.Arguments))
+		for i, argument := range m.Arguments {
+			arguments[i] = r.Value(argument)
+		}
+		m.Arguments = arguments
+	}
+	m.Item = r.Value(m.Item)
+	m.Result = r.Value(m.Result)
+	return m
+}
+
+// Value returns a generic copy of value with the redacted fields
+func (r *Redactor) Value(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	// Normalize structs and typed maps to generic JSON values
+	b, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return value
+	}
+	return r.redact(generic, "")
+}
+
+func (r *Redactor) redact(value interface{}, path string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			fieldPath := strings.ToLower(key)
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			if r.names[strings.ToLower(key)] || r.paths[fieldPath] {
+				v[key] = Redacted
+			} else {
+				v[key] = r.redact(field, fieldPath)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redact(item, path)
+		}
+		return v
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+			return v
+		}
+		var embedded interface{}
+		if err := json.Unmarshal([]byte(trimmed), &embedded); err != nil {
+			return v
+		}
+		b, err := json.Marshal(r.redact(embedded, path))
+		if err != nil {
+			return v
+		}
+		return string(b)
+	default:
+		return v
+	}
+}
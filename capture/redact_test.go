@@ -0,0 +1,55 @@
+package capture
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+var _ = Describe("Redactor", func() {
+	redactor := NewRedactor([]string{"Password", "order.customer.email", " "})
+
+	It("should redact fields by name at any depth", func() {
+		Expect(redactor.Value(map[string]interface{}{
+			"user":  map[string]interface{}{"name": "a", "password": "secret"},
+			"items": []interface{}{map[string]interface{}{"PASSWORD": "x"}},
+		})).To(Equal(map[string]interface{}{
+			"user":  map[string]interface{}{"name": "a", "password": Redacted},
+			"items": []interface{}{map[string]interface{}{"PASSWORD": Redacted}},
+		}))
+	})
+
+	It("should redact fields by path from the root", func() {
+		Expect(redactor.Value(map[string]interface{}{
+			"order":    map[string]interface{}{"customer": map[string]interface{}{"email": "a@b.c", "name": "a"}},
+			"customer": map[string]interface{}{"email": "kept"},
+		})).To(Equal(map[string]interface{}{
+			"order":    map[string]interface{}{"customer": map[string]interface{}{"email": Redacted, "name": "a"}},
+			"customer": map[string]interface{}{"email": "kept"},
+		}))
+	})
+
+	It("should redact inside strings with JSON and normalize structs", func() {
+		type login struct {
+			User     string `json:"user"`
+			Password string `json:"password"`
+		}
+		Expect(redactor.Value(`{"password":"secret","n":1}`)).To(Equal(`{"n":1,"password":"***"}`))
+		Expect(redactor.Value("{not json")).To(Equal("{not json"))
+		Expect(redactor.Value(login{User: "a", Password: "b"})).To(Equal(map[string]interface{}{"user": "a", "password": Redacted}))
+	})
+
+	It("should redact headers, arguments, item and result of messages", func() {
+		message := redactor.Message(signalr.TapMessage{
+			Headers:   map[string]string{"Password": "h", "traceparent": "t"},
+			Arguments: []interface{}{"topic", map[string]interface{}{"password": "a"}},
+			Item:      map[string]interface{}{"password": "i"},
+			Result:    map[string]interface{}{"password": "r"},
+		})
+		Expect(message.Headers).To(Equal(map[string]string{"Password": Redacted, "traceparent": "t"}))
+		Expect(message.Arguments).To(Equal([]interface{}{"topic", map[string]interface{}{"password": Redacted}}))
+		Expect(message.Item).To(Equal(map[string]interface{}{"password": Redacted}))
+		Expect(message.Result).To(Equal(map[string]interface{}{"password": Redacted}))
+	})
+})
@@ -0,0 +1,181 @@
+// Package dashboard serves an operations dashboard for the message bus. The page gets its data from a dedicated
+// admin hub, which pushes the connection counts, topic rates, groups and recent errors, and the live tail of a topic.
+package dashboard
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// Snapshot is the state of the message bus shown by the dashboard
+type Snapshot struct {
+	Time        time.Time           `json:"time"`
+	Connections int                 `json:"connections"`
+	Transports  map[string]int      `json:"transports"`
+	Topics      []TopicStats        `json:"topics"`
+	Groups      map[string][]string `json:"groups"`
+	Errors      []Error             `json:"errors"`
+}
+
+// Options configure a Dashboard
+type Options struct {
+	// Interval is the interval the Snapshot is pushed to the dashboards, default 1s
+	Interval time.Duration
+	// Authorize decides if a request to the admin hub is allowed. If nil, all requests are allowed.
+	Authorize func(r *http.Request) bool
+}
+
+// Dashboard serves the dashboard page and its admin hub for the message bus served by bus.
+type Dashboard struct {
+	bus     signalr.Server
+	monitor *Monitor
+	hub     signalr.Server
+	options Options
+	mx      sync.Mutex
+	tails   map[string]string // topic tailed by each admin hub connection
+}
+
+// New creates a Dashboard for bus with the topics and errors collected by monitor.
+// hubOptions are the options of the admin hub server, e.g. its logger. The Snapshot is pushed until ctx is canceled.
+func New(ctx context.Context, bus signalr.Server, monitor *Monitor, options Options, hubOptions ...func(signalr.Party) error) (*Dashboard, error) {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	d := &Dashboard{
+		bus:     bus,
+		monitor: monitor,
+		options: options,
+		tails:   make(map[string]string),
+	}
+	hub, err := signalr.NewServer(ctx, append([]func(signalr.Party) error{
+		signalr.HubFactory(func() signalr.HubInterface { return &adminHub{dashboard: d} }),
+	}, hubOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	d.hub = hub
+	monitor.setTail(d.tailed, d.sendTail)
+	go d.push(ctx)
+	return d, nil
+}
+
+// Snapshot returns the current state of the message bus
+func (d *Dashboard) Snapshot() Snapshot {
+	connections := d.bus.Connections()
+	transports := make(map[string]int)
+	for _, status := range connections {
+		transports[status.Transport]++
+	}
+	return Snapshot{
+		Time:        time.Now().UTC(),
+		Connections: len(connections),
+		Transports:  transports,
+		Topics:      d.monitor.Topics(),
+		Groups:      d.bus.GroupMembers(),
+		Errors:      d.monitor.Errors(),
+	}
+}
+
+// Handler serves the dashboard page at prefix and the admin hub at prefix/hub
+func (d *Dashboard) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	hubPath := prefix + "/hub"
+	hubMux := http.NewServeMux()
+	d.hub.MapHTTP(signalr.WithHTTPServeMux(hubMux), hubPath)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == hubPath || strings.HasPrefix(r.URL.Path, hubPath+"/"):
+			if d.options.Authorize != nil && !d.options.Authorize(r) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			hubMux.ServeHTTP(w, r)
+		case r.URL.Path == prefix:
+			// The page uses relative URLs
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		case r.URL.Path == prefix+"/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write(indexHTML)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// push sends the Snapshot to all dashboards every Interval
+func (d *Dashboard) push(ctx context.Context) {
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if len(d.hub.Connections()) > 0 {
+				d.hub.HubClients().All().Send("stats", d.Snapshot())
+			}
+		}
+	}
+}
+
+// sendTail sends the message to all dashboards which tail its topic
+func (d *Dashboard) sendTail(message Message) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	for connectionID, topic := range d.tails {
+		if topic == message.Topic {
+			d.hub.HubClients().Client(connectionID).Send("tail", message)
+		}
+	}
+}
+
+// tailed tells if a dashboard tails the topic
+func (d *Dashboard) tailed(topic string) bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	for _, tailed := range d.tails {
+		if tailed == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dashboard) setTail(connectionID string, topic string) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if topic == "" {
+		delete(d.tails, connectionID)
+	} else {
+		d.tails[connectionID] = topic
+	}
+}
+
+// adminHub is the hub of the dashboard page
+type adminHub struct {
+	signalr.Hub
+	dashboard *Dashboard
+}
+
+// Snapshot returns the current state, so the page doesn't need to wait for the next push
+func (a *adminHub) Snapshot() Snapshot {
+	return a.dashboard.Snapshot()
+}
+
+// Tail sends the messages on topic to the caller, replacing the topic tailed before. An empty topic stops the tail.
+func (a *adminHub) Tail(topic string) {
+	a.dashboard.setTail(a.ConnectionID(), topic)
+}
+
+func (a *adminHub) OnDisconnected(connectionID string) {
+	a.dashboard.setTail(connectionID, "")
+}
@@ -0,0 +1,137 @@
+package dashboard
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+type busHub struct {
+	signalr.Hub
+	monitor *Monitor
+}
+
+func (b *busHub) Send(topic string, message string) {
+	b.Clients().All().Send(topic, message)
+	b.monitor.Message("Send", topic, message, b.ConnectionID())
+}
+
+func (b *busHub) OnConnected(connectionID string) {
+	b.Groups().AddToGroup("bus", connectionID)
+}
+
+type dashboardReceiver struct {
+	signalr.Receiver
+	stats chan Snapshot
+	tail  chan Message
+}
+
+func (d *dashboardReceiver) Stats(snapshot Snapshot) {
+	select {
+	case d.stats <- snapshot:
+	default:
+	}
+}
+
+func (d *dashboardReceiver) Tail(message Message) {
+	d.tail <- message
+}
+
+func connect(ctx context.Context, address string, receiver interface{}) signalr.Client {
+	conn, err := signalr.NewHTTPConnection(ctx, address)
+	Expect(err).NotTo(HaveOccurred())
+	client, err := signalr.NewClient(ctx, signalr.WithConnection(conn), signalr.WithReceiver(receiver))
+	Expect(err).NotTo(HaveOccurred())
+	client.Start()
+	Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+	return client
+}
+
+var _ = Describe("Dashboard", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var testServer *httptest.Server
+	var busClient signalr.Client
+	var receiver *dashboardReceiver
+	var admin signalr.Client
+
+	BeforeEach(func(done Done) {
+		ctx, cancel = context.WithCancel(context.Background())
+		monitor := NewMonitor(MonitorOptions{})
+		bus, err := signalr.NewServer(ctx,
+			signalr.HubFactory(func() signalr.HubInterface { return &busHub{monitor: monitor} }),
+			signalr.WithMetrics(monitor))
+		Expect(err).NotTo(HaveOccurred())
+		board, err := New(ctx, bus, monitor, Options{
+			Interval:  50 * time.Millisecond,
+			Authorize: func(r *http.Request) bool { return r.URL.Query().Get("access_token") != "wrong" },
+		})
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		bus.MapHTTP(signalr.WithHTTPServeMux(router), "/bus")
+		router.Handle("/dashboard/", board.Handler("/dashboard"))
+		testServer = httptest.NewServer(router)
+
+		busClient = connect(ctx, testServer.URL+"/bus", &struct{ signalr.Receiver }{})
+		receiver = &dashboardReceiver{stats: make(chan Snapshot, 1), tail: make(chan Message, 10)}
+		admin = connect(ctx, testServer.URL+"/dashboard/hub", receiver)
+		close(done)
+	}, 5.0)
+
+	AfterEach(func() {
+		cancel()
+		testServer.Close()
+	})
+
+	It("should return and push the snapshot of the bus", func(done Done) {
+		Expect((<-busClient.Invoke("send", "line1", "hello")).Error).NotTo(HaveOccurred())
+		Expect((<-busClient.Invoke("missing")).Error).To(HaveOccurred())
+		result := <-admin.Invoke("snapshot")
+		Expect(result.Error).NotTo(HaveOccurred())
+		snapshot := result.Value.(map[string]interface{})
+		Expect(snapshot["connections"]).To(BeEquivalentTo(1))
+		Expect(snapshot["transports"]).To(HaveKeyWithValue("WebSockets", BeEquivalentTo(1)))
+		Expect(snapshot["groups"]).To(HaveKey("bus"))
+		Expect(snapshot["topics"]).To(HaveLen(1))
+		Expect(snapshot["errors"]).To(HaveLen(1))
+		var pushed Snapshot
+		Eventually(receiver.stats).Should(Receive(&pushed))
+		Expect(pushed.Topics[0].Topic).To(Equal("line1"))
+		Expect(pushed.Topics[0].Total).To(BeEquivalentTo(1))
+		close(done)
+	}, 5.0)
+
+	It("should tail the messages of a topic", func(done Done) {
+		Expect((<-admin.Invoke("tail", "line2")).Error).NotTo(HaveOccurred())
+		Expect((<-busClient.Invoke("send", "line1", "other")).Error).NotTo(HaveOccurred())
+		Expect((<-busClient.Invoke("send", "line2", "tailed")).Error).NotTo(HaveOccurred())
+		var message Message
+		Eventually(receiver.tail).Should(Receive(&message))
+		Expect(message.Topic).To(Equal("line2"))
+		Expect(message.Message).To(Equal("tailed"))
+		Expect(message.Method).To(Equal("Send"))
+		Expect((<-admin.Invoke("tail", "")).Error).NotTo(HaveOccurred())
+		Expect((<-busClient.Invoke("send", "line2", "not tailed")).Error).NotTo(HaveOccurred())
+		Consistently(receiver.tail, 200*time.Millisecond).ShouldNot(Receive())
+		close(done)
+	}, 5.0)
+
+	It("should serve the page and authorize the hub", func() {
+		resp, err := http.Get(testServer.URL + "/dashboard/")
+		Expect(err).NotTo(HaveOccurred())
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		Expect(string(body)).To(ContainSubstring("IAC SignalR Dashboard"))
+		resp, err = http.Post(testServer.URL+"/dashboard/hub/negotiate?access_token=wrong", "text/plain", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_ = resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,277 @@
+package dashboard
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mdaxf/iac-signalr/capture"
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+const (
+	// rateWindow is the number of seconds the message rate of a topic is averaged over
+	rateWindow = 10
+	// maxErrors is the number of recent errors which are kept
+	maxErrors = 50
+	// maxTailMessage is the number of bytes of a message which are sent to the live tail
+	maxTailMessage = 4096
+)
+
+// DefaultMaxTopics is the number of topics which are counted separately, if no MaxTopics is given
+const DefaultMaxTopics = 1000
+
+// DefaultTopicTTL is the time after its last message a topic is no longer counted, if no TopicTTL is given
+const DefaultTopicTTL = time.Hour
+
+// OtherTopics counts the messages of the topics beyond MaxTopics
+const OtherTopics = "(other)"
+
+// MonitorOptions configure a Monitor
+type MonitorOptions struct {
+	// MaxTopics is the number of topics which are counted separately, the messages of further topics are counted
+	// as OtherTopics
+	MaxTopics int
+	// TopicTTL is the time after its last message a topic is removed to make room for new topics
+	TopicTTL time.Duration
+	// Redact are the rules of a capture.Redactor applied to the messages of the live tail
+	Redact []string
+}
+
+// TopicStats are the message counts of one topic
+type TopicStats struct {
+	Topic       string    `json:"topic"`
+	Total       uint64    `json:"total"`
+	Rate        float64   `json:"rate"` // messages per second over the last rateWindow seconds
+	LastMessage time.Time `json:"lastMessage"`
+}
+
+// Error is one of the recent errors
+type Error struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Text   string    `json:"text"`
+}
+
+// Message is a message sent on a topic, as shown in the live tail
+type Message struct {
+	Time      time.Time `json:"time"`
+	Topic     string    `json:"topic"`
+	Method    string    `json:"method"`
+	Sender    string    `json:"sender"`
+	Message   string    `json:"message"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// topicCounter counts the messages of a topic per second in a ring of rateWindow+1 buckets.
+// The bucket of the current second is not complete, so it is not part of the rate.
+type topicCounter struct {
+	total   uint64
+	last    time.Time
+	buckets [rateWindow + 1]uint64
+	seconds [rateWindow + 1]int64
+}
+
+func (t *topicCounter) add(now time.Time) {
+	second := now.Unix()
+	i := second % int64(len(t.buckets))
+	if t.seconds[i] != second {
+		t.seconds[i] = second
+		t.buckets[i] = 0
+	}
+	t.buckets[i]++
+	t.total++
+	t.last = now
+}
+
+func (t *topicCounter) rate(now time.Time) float64 {
+	second := now.Unix()
+	var n uint64
+	for i, s := range t.seconds {
+		if s < second && s >= second-rateWindow {
+			n += t.buckets[i]
+		}
+	}
+	return float64(n) / rateWindow
+}
+
+func (t *topicCounter) stats(topic string, now time.Time) TopicStats {
+	return TopicStats{Topic: topic, Total: t.total, Rate: t.rate(now), LastMessage: t.last.UTC()}
+}
+
+// Monitor collects the message counts per topic and the recent errors of the message bus.
+// It is a signalr.Metrics to record the failed handshakes, invocations and connections of the server.
+// All methods are safe for concurrent use, and on a nil *Monitor, they do nothing.
+type Monitor struct {
+	mx       sync.Mutex
+	options  MonitorOptions
+	topics   map[string]*topicCounter
+	other    *topicCounter // the topics beyond MaxTopics
+	expired  time.Time     // when idle topics were removed last
+	errors   []Error
+	tailed   func(topic string) bool // tells if the live tail shows the topic
+	tail     func(Message)
+	redactor *capture.Redactor
+	now      func() time.Time
+}
+
+// NewMonitor creates an empty Monitor
+func NewMonitor(options MonitorOptions) *Monitor {
+	if options.MaxTopics <= 0 {
+		options.MaxTopics = DefaultMaxTopics
+	}
+	if options.TopicTTL <= 0 {
+		options.TopicTTL = DefaultTopicTTL
+	}
+	m := &Monitor{
+		options: options,
+		topics:  make(map[string]*topicCounter),
+		now:     time.Now,
+	}
+	if len(options.Redact) > 0 {
+		m.redactor = capture.NewRedactor(options.Redact)
+	}
+	return m
+}
+
+// Message records a message sent on a topic by a method of the message bus
+func (m *Monitor) Message(method string, topic string, message string, sender string) {
+	if m == nil {
+		return
+	}
+	now := m.now()
+	m.mx.Lock()
+	m.counter(topic, now).add(now)
+	tailed, tail := m.tailed, m.tail
+	m.mx.Unlock()
+	if tail == nil || !tailed(topic) {
+		return
+	}
+	if m.redactor != nil {
+		if redacted, ok := m.redactor.Value(message).(string); ok {
+			message = redacted
+		}
+	}
+	msg := Message{Time: now.UTC(), Topic: topic, Method: method, Sender: sender, Message: message}
+	if len(msg.Message) > maxTailMessage {
+		// cut at the start of a rune, so the tail stays valid UTF-8
+		end := maxTailMessage
+		for end > 0 && !utf8.RuneStart(msg.Message[end]) {
+			end--
+		}
+		msg.Message = msg.Message[:end]
+		msg.Truncated = true
+	}
+	tail(msg)
+}
+
+// counter returns the counter of the topic. Beyond MaxTopics, the topics which had no message for TopicTTL are
+// removed, at most once a second, and the messages of new topics are counted as OtherTopics if that is not enough.
+func (m *Monitor) counter(topic string, now time.Time) *topicCounter {
+	if counter, ok := m.topics[topic]; ok {
+		return counter
+	}
+	if len(m.topics) >= m.options.MaxTopics && now.Sub(m.expired) >= time.Second {
+		m.expired = now
+		for name, counter := range m.topics {
+			if now.Sub(counter.last) >= m.options.TopicTTL {
+				delete(m.topics, name)
+			}
+		}
+	}
+	if len(m.topics) >= m.options.MaxTopics {
+		if m.other == nil {
+			m.other = &topicCounter{}
+		}
+		return m.other
+	}
+	counter := &topicCounter{}
+	m.topics[topic] = counter
+	return counter
+}
+
+// Error records an error. source tells where it happened, e.g. the hub method
+func (m *Monitor) Error(source string, err error) {
+	if m == nil || err == nil {
+		return
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.errors = append(m.errors, Error{Time: m.now().UTC(), Source: source, Text: err.Error()})
+	if len(m.errors) > maxErrors {
+		m.errors = m.errors[len(m.errors)-maxErrors:]
+	}
+}
+
+// Topics returns the stats of the counted topics and OtherTopics, ordered by topic
+func (m *Monitor) Topics() []TopicStats {
+	if m == nil {
+		return nil
+	}
+	now := m.now()
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	stats := make([]TopicStats, 0, len(m.topics)+1)
+	for topic, counter := range m.topics {
+		stats = append(stats, counter.stats(topic, now))
+	}
+	if m.other != nil {
+		stats = append(stats, m.other.stats(OtherTopics, now))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Topic < stats[j].Topic })
+	return stats
+}
+
+// Errors returns the recent errors, the latest first
+func (m *Monitor) Errors() []Error {
+	if m == nil {
+		return nil
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	errs := make([]Error, len(m.errors))
+	for i, e := range m.errors {
+		errs[len(errs)-1-i] = e
+	}
+	return errs
+}
+
+// setTail sets the function which receives the messages of the topics for which tailed returns true.
+// The messages of the other topics are neither redacted nor truncated.
+func (m *Monitor) setTail(tailed func(topic string) bool, tail func(Message)) {
+	if m == nil {
+		return
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.tailed = tailed
+	m.tail = tail
+}
+
+func (m *Monitor) ConnectionOpened(string, string) {}
+
+// ConnectionClosed records connections closed because of a timeout, a failed ping or an invalid message
+func (m *Monitor) ConnectionClosed(transport string, _ string, reason string) {
+	switch reason {
+	case signalr.DisconnectTimeout, signalr.DisconnectPing, signalr.DisconnectProtocol:
+		m.Error("connection", fmt.Errorf("%s connection closed: %s", transport, reason))
+	}
+}
+
+func (m *Monitor) HandshakeFailed(transport string, reason string) {
+	m.Error("handshake", fmt.Errorf("%s handshake failed: %s", transport, reason))
+}
+
+func (m *Monitor) InvocationDone(method string, _ time.Duration, err error) {
+	if method == "" {
+		method = "(unknown)"
+	}
+	m.Error("invocation "+method, err)
+}
+
+func (m *Monitor) BytesReceived(string, int) {}
+func (m *Monitor) BytesSent(string, int)     {}
+func (m *Monitor) Broadcast(string, int)     {}
+func (m *Monitor) GroupsChanged(int, int)    {}
@@ -0,0 +1,146 @@
+package dashboard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+var _ = Describe("Monitor", func() {
+	var monitor *Monitor
+	var now time.Time
+
+	BeforeEach(func() {
+		monitor = NewMonitor(MonitorOptions{})
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		monitor.now = func() time.Time { return now }
+	})
+
+	It("should count the messages per topic and average the rate over the complete seconds", func() {
+		for i := 0; i < 20; i++ {
+			monitor.Message("Send", "b", "m", "c1")
+			if i%2 == 1 {
+				now = now.Add(time.Second)
+			}
+		}
+		monitor.Message("Send", "a", "m", "c1")
+		topics := monitor.Topics()
+		Expect(topics).To(HaveLen(2))
+		Expect(topics[0].Topic).To(Equal("a"))
+		Expect(topics[0].Rate).To(BeZero())
+		Expect(topics[1].Topic).To(Equal("b"))
+		Expect(topics[1].Total).To(BeEquivalentTo(20))
+		Expect(topics[1].Rate).To(BeNumerically("~", 2.0))
+		now = now.Add(time.Minute)
+		Expect(monitor.Topics()[1].Rate).To(BeZero())
+		Expect(monitor.Topics()[1].Total).To(BeEquivalentTo(20))
+	})
+
+	It("should keep the latest errors", func() {
+		for i := 0; i < maxErrors+5; i++ {
+			monitor.Error("test", fmt.Errorf("error %d", i))
+		}
+		monitor.Error("test", nil)
+		errs := monitor.Errors()
+		Expect(errs).To(HaveLen(maxErrors))
+		Expect(errs[0].Text).To(Equal(fmt.Sprintf("error %d", maxErrors+4)))
+		Expect(errs[maxErrors-1].Text).To(Equal("error 5"))
+	})
+
+	It("should record failures reported as signalr.Metrics", func() {
+		var metrics signalr.Metrics = monitor
+		metrics.InvocationDone("send", time.Millisecond, nil)
+		metrics.InvocationDone("", time.Millisecond, errors.New("unknown method x"))
+		metrics.ConnectionClosed("WebSockets", "json", signalr.DisconnectClosed)
+		metrics.ConnectionClosed("WebSockets", "json", signalr.DisconnectTimeout)
+		metrics.HandshakeFailed("WebSockets", signalr.HandshakeFailureProtocol)
+		errs := monitor.Errors()
+		Expect(errs).To(HaveLen(3))
+		Expect(errs[0].Source).To(Equal("handshake"))
+		Expect(errs[1].Text).To(Equal("WebSockets connection closed: timeout"))
+		Expect(errs[2].Source).To(Equal("invocation (unknown)"))
+	})
+
+	// tailTopic tails the messages of topic into tailed
+	tailTopic := func(topic string, tailed *[]Message) {
+		monitor.setTail(func(t string) bool { return t == topic }, func(m Message) { *tailed = append(*tailed, m) })
+	}
+
+	It("should truncate messages for the tail", func() {
+		var tailed []Message
+		tailTopic("a", &tailed)
+		monitor.Message("Send", "a", strings.Repeat("x", maxTailMessage+1), "c1")
+		monitor.Message("Send", "a", "short", "c1")
+		Expect(tailed).To(HaveLen(2))
+		Expect(tailed[0].Message).To(HaveLen(maxTailMessage))
+		Expect(tailed[0].Truncated).To(BeTrue())
+		Expect(tailed[1].Message).To(Equal("short"))
+	})
+
+	It("should truncate messages for the tail at the start of a rune", func() {
+		var tailed []Message
+		tailTopic("a", &tailed)
+		monitor.Message("Send", "a", "x"+strings.Repeat("ä", maxTailMessage/2), "c1")
+		Expect(tailed).To(HaveLen(1))
+		Expect(tailed[0].Message).To(HaveLen(maxTailMessage - 1))
+		Expect(utf8.ValidString(tailed[0].Message)).To(BeTrue())
+		Expect(tailed[0].Truncated).To(BeTrue())
+	})
+
+	It("should tail only the tailed topics", func() {
+		var tailed []Message
+		tailTopic("a", &tailed)
+		monitor.Message("Send", "b", "not tailed", "c1")
+		monitor.Message("Send", "a", "tailed", "c1")
+		Expect(tailed).To(HaveLen(1))
+		Expect(tailed[0].Topic).To(Equal("a"))
+		Expect(monitor.Topics()).To(HaveLen(2))
+	})
+
+	It("should count the topics beyond MaxTopics as other until idle topics expire", func() {
+		monitor = NewMonitor(MonitorOptions{MaxTopics: 2, TopicTTL: time.Minute})
+		monitor.now = func() time.Time { return now }
+		monitor.Message("Send", "a", "m", "c1")
+		monitor.Message("Send", "b", "m", "c1")
+		for i := 0; i < 100; i++ {
+			monitor.Message("Send", fmt.Sprintf("t%d", i), "m", "c1")
+		}
+		topics := monitor.Topics()
+		Expect(topics).To(HaveLen(3))
+		Expect(topics[0].Topic).To(Equal(OtherTopics))
+		Expect(topics[0].Total).To(BeEquivalentTo(100))
+		now = now.Add(30 * time.Second)
+		monitor.Message("Send", "a", "m", "c1")
+		now = now.Add(45 * time.Second)
+		monitor.Message("Send", "c", "m", "c1")
+		topics = monitor.Topics()
+		Expect(topics).To(HaveLen(3))
+		Expect([]string{topics[0].Topic, topics[1].Topic, topics[2].Topic}).To(Equal([]string{OtherTopics, "a", "c"}))
+	})
+
+	It("should redact the messages for the tail", func() {
+		monitor = NewMonitor(MonitorOptions{Redact: []string{"password"}})
+		var tailed []Message
+		tailTopic("a", &tailed)
+		monitor.Message("Send", "a", `{"user":"u1","password":"secret"}`, "c1")
+		monitor.Message("Send", "a", "plain", "c1")
+		Expect(tailed).To(HaveLen(2))
+		Expect(tailed[0].Message).To(MatchJSON(`{"user":"u1","password":"***"}`))
+		Expect(tailed[1].Message).To(Equal("plain"))
+	})
+
+	It("should do nothing when nil", func() {
+		var nilMonitor *Monitor
+		nilMonitor.Message("Send", "a", "m", "c1")
+		nilMonitor.Error("test", errors.New("e"))
+		Expect(nilMonitor.Topics()).To(BeNil())
+		Expect(nilMonitor.Errors()).To(BeNil())
+	})
+})
@@ -0,0 +1,299 @@
+// Package delivery provides at-least-once delivery of messages to groups of competing consumers.
+//
+// Every consumer group receives every message. Within a group, one consumer receives it, and the message stays
+// pending until that consumer acknowledges it. A message which is not acknowledged within the visibility timeout
+// is delivered again, possibly to another consumer of the group, and dead-lettered after a number of attempts.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultVisibilityTimeout is the time a consumer has to acknowledge a message, if no VisibilityTimeout is given
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// DefaultMaxAttempts is the number of deliveries after which a message is dead-lettered, if no MaxAttempts is given
+const DefaultMaxAttempts = 5
+
+// ErrUnknownMessage is returned by Ack for messages which are not pending for the consumer, because they were not
+// delivered to it, were acknowledged already or were delivered to another consumer after the visibility timeout
+var ErrUnknownMessage = errors.New("message is not pending for this consumer")
+
+// Message is a message delivered to the consumer groups
+type Message struct {
+	ID      string    `json:"messageId"`
+	Topic   string    `json:"topic"`
+	Payload string    `json:"message"`
+	Sender  string    `json:"sender"`
+	Time    time.Time `json:"time"`
+	// Headers are the invocation headers of the sender, which are sent with the deliveries, not in the message
+	Headers map[string]string `json:"-"`
+}
+
+// Delivery is one delivery of a message to a consumer
+type Delivery struct {
+	Message
+	Group   string `json:"group"`
+	Attempt int    `json:"attempt"`
+}
+
+// Options configure a Queue
+type Options struct {
+	// VisibilityTimeout is the time a consumer has to acknowledge a message before it is delivered again
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the number of deliveries after which an unacknowledged message is dead-lettered
+	MaxAttempts int
+	// Deliver sends the delivery to the consumer connection
+	Deliver func(connectionID string, delivery Delivery)
+	// Groups are consumer groups which keep the messages published before their first consumer joins,
+	// like the backend group of a server which is restarting. Other groups exist from their first Join until their
+	// last consumer leaves, then their unacknowledged messages are dead-lettered.
+	Groups []string
+	// DeadLetter receives the messages which were not acknowledged after MaxAttempts deliveries
+	DeadLetter func(delivery Delivery)
+}
+
+// pending is a message which has not been acknowledged by its consumer group
+type pending struct {
+	delivery Delivery
+	consumer string    // the connection it was delivered to last, empty if it is waiting for a consumer
+	due      time.Time // when it is delivered again
+}
+
+// group is a consumer group
+type group struct {
+	consumers []string // connection ids in the order they joined
+	next      int      // index of the consumer which receives the next message
+	pending   map[string]*pending
+}
+
+// Queue keeps the pending messages of the consumer groups. It is safe for concurrent use.
+type Queue struct {
+	mx      sync.Mutex
+	options Options
+	groups  map[string]*group
+	durable map[string]bool  // the groups of Options.Groups
+	now     func() time.Time // replaced in tests
+}
+
+// New creates a Queue with the consumer groups of Options.Groups
+func New(options Options) *Queue {
+	if options.VisibilityTimeout <= 0 {
+		options.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+	q := &Queue{options: options, groups: make(map[string]*group), durable: make(map[string]bool), now: time.Now}
+	for _, name := range options.Groups {
+		q.groups[name] = &group{pending: make(map[string]*pending)}
+		q.durable[name] = true
+	}
+	return q
+}
+
+// Join adds the connection to the consumer group. Messages waiting for a consumer of the group are delivered.
+func (q *Queue) Join(groupName string, connectionID string) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	g, ok := q.groups[groupName]
+	if !ok {
+		g = &group{pending: make(map[string]*pending)}
+		q.groups[groupName] = g
+	}
+	for _, consumer := range g.consumers {
+		if consumer == connectionID {
+			return
+		}
+	}
+	g.consumers = append(g.consumers, connectionID)
+	for _, p := range g.sorted() {
+		if p.consumer == "" {
+			q.deliver(g, p)
+		}
+	}
+}
+
+// Leave removes the connection from all consumer groups.
+// The messages delivered to it and not acknowledged are delivered to the other consumers of their group.
+// A group which is not in Options.Groups is removed with its last consumer and its messages are dead-lettered.
+func (q *Queue) Leave(connectionID string) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	for _, name := range q.groupNames() {
+		g := q.groups[name]
+		if !g.has(connectionID) {
+			continue
+		}
+		for i, consumer := range g.consumers {
+			if consumer == connectionID {
+				g.consumers = append(g.consumers[:i], g.consumers[i+1:]...)
+				break
+			}
+		}
+		if len(g.consumers) == 0 && !q.durable[name] {
+			delete(q.groups, name)
+			for _, p := range g.sorted() {
+				if q.options.DeadLetter != nil {
+					q.options.DeadLetter(p.delivery)
+				}
+			}
+			continue
+		}
+		for _, p := range g.sorted() {
+			if p.consumer == connectionID {
+				q.retry(g, p)
+			}
+		}
+	}
+}
+
+// Publish gives the message an id and delivers it to one consumer of every group.
+// It returns the message with its id.
+func (q *Queue) Publish(topic string, payload string, sender string, headers map[string]string) Message {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	message := Message{ID: uuid.NewString(), Topic: topic, Payload: payload, Sender: sender, Time: q.now().UTC(),
+		Headers: headers}
+	for _, name := range q.groupNames() {
+		g := q.groups[name]
+		p := &pending{delivery: Delivery{Message: message, Group: name}}
+		g.pending[message.ID] = p
+		q.deliver(g, p)
+	}
+	return message
+}
+
+// Ack acknowledges the delivery of the message to the connection, so it is not delivered to its group again.
+// The message has the same id in every group, so a connection which received it in several groups acknowledges
+// each delivery.
+func (q *Queue) Ack(connectionID string, messageID string) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	for _, name := range q.groupNames() {
+		g := q.groups[name]
+		if p, ok := g.pending[messageID]; ok && p.consumer == connectionID {
+			delete(g.pending, messageID)
+			return nil
+		}
+	}
+	return ErrUnknownMessage
+}
+
+// Run delivers the messages whose visibility timeout has passed again, until ctx is done
+func (q *Queue) Run(ctx context.Context) {
+	interval := q.options.VisibilityTimeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.redeliver()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// redeliver delivers the messages whose visibility timeout has passed again, or dead-letters them
+func (q *Queue) redeliver() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	now := q.now()
+	for _, name := range q.groupNames() {
+		g := q.groups[name]
+		for _, p := range g.sorted() {
+			if p.consumer != "" && !now.Before(p.due) {
+				q.retry(g, p)
+			}
+		}
+	}
+}
+
+// retry delivers the message again, or dead-letters it if it has been delivered MaxAttempts times
+func (q *Queue) retry(g *group, p *pending) {
+	if p.delivery.Attempt >= q.options.MaxAttempts {
+		delete(g.pending, p.delivery.ID)
+		if q.options.DeadLetter != nil {
+			q.options.DeadLetter(p.delivery)
+		}
+		return
+	}
+	q.deliver(g, p)
+}
+
+// deliver sends the message to the next consumer of the group. Without consumers, it waits for one to join.
+func (q *Queue) deliver(g *group, p *pending) {
+	if len(g.consumers) == 0 {
+		p.consumer = ""
+		return
+	}
+	g.next %= len(g.consumers)
+	p.consumer = g.consumers[g.next]
+	g.next++
+	p.delivery.Attempt++
+	p.due = q.now().Add(q.options.VisibilityTimeout)
+	if q.options.Deliver != nil {
+		q.options.Deliver(p.consumer, p.delivery)
+	}
+}
+
+// Stats is the number of consumers and pending messages of a consumer group
+type Stats struct {
+	Consumers int `json:"consumers"`
+	Pending   int `json:"pending"`
+}
+
+// Stats returns the Stats of all consumer groups
+func (q *Queue) Stats() map[string]Stats {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	stats := make(map[string]Stats, len(q.groups))
+	for name, g := range q.groups {
+		stats[name] = Stats{Consumers: len(g.consumers), Pending: len(g.pending)}
+	}
+	return stats
+}
+
+func (q *Queue) groupNames() []string {
+	names := make([]string, 0, len(q.groups))
+	for name := range q.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *group) has(connectionID string) bool {
+	for _, consumer := range g.consumers {
+		if consumer == connectionID {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted returns the pending messages in the order they were published
+func (g *group) sorted() []*pending {
+	messages := make([]*pending, 0, len(g.pending))
+	for _, p := range g.pending {
+		messages = append(messages, p)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		a, b := messages[i].delivery, messages[j].delivery
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.ID < b.ID
+	})
+	return messages
+}
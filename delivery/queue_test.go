@@ -0,0 +1,191 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recorder collects the deliveries and dead letters of a Queue
+type recorder struct {
+	mx         sync.Mutex
+	deliveries map[string][]Delivery
+	dead       []Delivery
+}
+
+func (r *recorder) deliver(connectionID string, delivery Delivery) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.deliveries[connectionID] = append(r.deliveries[connectionID], delivery)
+}
+
+func (r *recorder) deadLetter(delivery Delivery) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.dead = append(r.dead, delivery)
+}
+
+func (r *recorder) count(connectionID string) int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.deliveries[connectionID])
+}
+
+var _ = Describe("Queue", func() {
+	var queue *Queue
+	var rec *recorder
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		rec = &recorder{deliveries: make(map[string][]Delivery)}
+		queue = New(Options{
+			VisibilityTimeout: time.Minute,
+			MaxAttempts:       3,
+			Groups:            []string{"backend"},
+			Deliver:           rec.deliver,
+			DeadLetter:        rec.deadLetter,
+		})
+		queue.now = func() time.Time { return now }
+	})
+
+	It("should deliver each message to one consumer of every group", func() {
+		queue.Join("backend", "a")
+		queue.Join("backend", "b")
+		queue.Join("audit", "c")
+		for i := 0; i < 4; i++ {
+			queue.Publish("orders", "new", "ui", nil)
+		}
+		Expect(rec.count("a")).To(Equal(2))
+		Expect(rec.count("b")).To(Equal(2))
+		Expect(rec.count("c")).To(Equal(4))
+		Expect(rec.deliveries["c"][0].Group).To(Equal("audit"))
+		Expect(rec.deliveries["c"][0].Attempt).To(Equal(1))
+	})
+
+	It("should not deliver acknowledged messages again", func() {
+		queue.Join("backend", "a")
+		message := queue.Publish("orders", "new", "ui", nil)
+		Expect(queue.Ack("a", message.ID)).To(Succeed())
+		now = now.Add(2 * time.Minute)
+		queue.redeliver()
+		Expect(rec.count("a")).To(Equal(1))
+		Expect(queue.Stats()["backend"]).To(Equal(Stats{Consumers: 1, Pending: 0}))
+	})
+
+	It("should reject acknowledgements of unknown messages and of other groups", func() {
+		queue.Join("backend", "a")
+		queue.Join("audit", "c")
+		Expect(queue.Ack("a", "unknown")).To(Equal(ErrUnknownMessage))
+		message := queue.Publish("orders", "new", "ui", nil)
+		Expect(queue.Ack("c", message.ID)).To(Succeed())
+		Expect(queue.Ack("c", message.ID)).To(Equal(ErrUnknownMessage))
+		Expect(queue.Stats()["backend"].Pending).To(Equal(1))
+	})
+
+	It("should acknowledge only the deliveries to the connection", func() {
+		queue.Join("backend", "a")
+		queue.Join("backend", "b")
+		queue.Join("audit", "a")
+		first := queue.Publish("orders", "new", "ui", nil)
+		second := queue.Publish("orders", "new", "ui", nil)
+		Expect(queue.Ack("a", second.ID)).To(Succeed())
+		Expect(queue.Ack("a", second.ID)).To(Equal(ErrUnknownMessage))
+		Expect(queue.Stats()).To(Equal(map[string]Stats{
+			"backend": {Consumers: 2, Pending: 2},
+			"audit":   {Consumers: 1, Pending: 1}}))
+		Expect(queue.Ack("b", first.ID)).To(Equal(ErrUnknownMessage))
+		Expect(queue.Ack("a", first.ID)).To(Succeed())
+		Expect(queue.Ack("a", first.ID)).To(Succeed())
+		Expect(queue.Stats()).To(Equal(map[string]Stats{
+			"backend": {Consumers: 2, Pending: 1},
+			"audit":   {Consumers: 1, Pending: 0}}))
+	})
+
+	It("should deliver unacknowledged messages again after the visibility timeout", func() {
+		queue.Join("backend", "a")
+		queue.Join("backend", "b")
+		message := queue.Publish("orders", "new", "ui", nil)
+		now = now.Add(30 * time.Second)
+		queue.redeliver()
+		Expect(rec.count("b")).To(Equal(0))
+		now = now.Add(30 * time.Second)
+		queue.redeliver()
+		Expect(rec.count("b")).To(Equal(1))
+		Expect(rec.deliveries["b"][0].ID).To(Equal(message.ID))
+		Expect(rec.deliveries["b"][0].Attempt).To(Equal(2))
+	})
+
+	It("should dead-letter messages after the maximum attempts", func() {
+		queue.Join("backend", "a")
+		message := queue.Publish("orders", "new", "ui", nil)
+		for i := 0; i < 3; i++ {
+			now = now.Add(time.Minute)
+			queue.redeliver()
+		}
+		Expect(rec.count("a")).To(Equal(3))
+		Expect(rec.dead).To(HaveLen(1))
+		Expect(rec.dead[0].ID).To(Equal(message.ID))
+		Expect(rec.dead[0].Attempt).To(Equal(3))
+		Expect(queue.Stats()["backend"].Pending).To(Equal(0))
+	})
+
+	It("should keep the messages of configured groups until a consumer joins", func() {
+		message := queue.Publish("orders", "new", "ui", nil)
+		now = now.Add(time.Hour)
+		queue.redeliver()
+		Expect(rec.dead).To(BeEmpty())
+		queue.Join("backend", "a")
+		Expect(rec.count("a")).To(Equal(1))
+		Expect(rec.deliveries["a"][0].ID).To(Equal(message.ID))
+	})
+
+	It("should deliver the messages of a consumer which leaves to the others", func() {
+		queue.Join("backend", "a")
+		queue.Join("backend", "b")
+		message := queue.Publish("orders", "new", "ui", nil)
+		Expect(rec.count("a")).To(Equal(1))
+		queue.Leave("a")
+		Expect(rec.count("b")).To(Equal(1))
+		Expect(rec.deliveries["b"][0].ID).To(Equal(message.ID))
+		queue.Leave("b")
+		Expect(queue.Stats()["backend"]).To(Equal(Stats{Consumers: 0, Pending: 1}))
+		queue.Join("backend", "c")
+		Expect(rec.count("c")).To(Equal(1))
+	})
+
+	It("should remove other groups with their last consumer and dead-letter their messages", func() {
+		queue.Join("backend", "a")
+		queue.Join("audit", "b")
+		message := queue.Publish("orders", "new", "ui", nil)
+		queue.Leave("b")
+		Expect(rec.dead).To(HaveLen(1))
+		Expect(rec.dead[0].ID).To(Equal(message.ID))
+		Expect(rec.dead[0].Group).To(Equal("audit"))
+		for i := 0; i < 10; i++ {
+			queue.Publish("orders", "new", "ui", nil)
+		}
+		Expect(queue.Stats()).To(Equal(map[string]Stats{"backend": {Consumers: 1, Pending: 11}}))
+		queue.Leave("a")
+		Expect(queue.Stats()).To(HaveKey("backend"))
+		Expect(rec.dead).To(HaveLen(1))
+	})
+
+	It("should redeliver in the background until the context is done", func() {
+		queue = New(Options{VisibilityTimeout: 20 * time.Millisecond, MaxAttempts: 100, Deliver: rec.deliver})
+		queue.Join("backend", "a")
+		queue.Publish("orders", "new", "ui", nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			queue.Run(ctx)
+			close(done)
+		}()
+		Eventually(func() int { return rec.count("a") }).Should(BeNumerically(">=", 3))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+})
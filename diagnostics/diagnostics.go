@@ -0,0 +1,150 @@
+// Package diagnostics serves the net/http/pprof profiles and a report of the goroutines of each connection
+// of a signalr.Server. The report is built from the pprof labels which signalr sets on the goroutines
+// of connections and hub invocations.
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// Report lists the goroutines of the process by connection
+type Report struct {
+	Time        time.Time          `json:"time"`
+	Goroutines  int64              `json:"goroutines"`
+	Unlabeled   int64              `json:"unlabeled"` // goroutines not started by a connection
+	Connections []ConnectionReport `json:"connections"`
+}
+
+// ConnectionReport counts the goroutines carrying the labels of one connection
+type ConnectionReport struct {
+	ConnectionID string `json:"connectionId"`
+	Transport    string `json:"transport,omitempty"`
+	// Open is false if the connection is not connected to the server anymore.
+	// Goroutines of closed connections have leaked.
+	Open       bool             `json:"open"`
+	Goroutines int64            `json:"goroutines"`
+	Methods    map[string]int64 `json:"methods,omitempty"` // goroutines started by invocations of each hub method
+	// Functions counts the goroutines by the function they are blocked in,
+	// which is the innermost function outside the runtime, sync and reflect packages.
+	Functions map[string]int64 `json:"functions"`
+}
+
+// GoroutineReport builds the Report from the goroutine profile.
+// Connections with the most goroutines come first.
+func GoroutineReport(server signalr.Server) (Report, error) {
+	var buf bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		return Report{}, err
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		return Report{}, err
+	}
+	open := make(map[string]bool)
+	for _, status := range server.Connections() {
+		open[status.ConnectionID] = true
+	}
+	report := Report{Time: time.Now().UTC(), Connections: []ConnectionReport{}}
+	connections := make(map[string]*ConnectionReport)
+	for _, sample := range p.Sample {
+		count := sample.Value[0]
+		report.Goroutines += count
+		connectionID := label(sample, signalr.LabelConnection)
+		if connectionID == "" {
+			report.Unlabeled += count
+			continue
+		}
+		connection, ok := connections[connectionID]
+		if !ok {
+			connection = &ConnectionReport{
+				ConnectionID: connectionID,
+				Transport:    label(sample, signalr.LabelTransport),
+				Open:         open[connectionID],
+				Functions:    make(map[string]int64),
+			}
+			connections[connectionID] = connection
+		}
+		connection.Goroutines += count
+		if method := label(sample, signalr.LabelMethod); method != "" {
+			if connection.Methods == nil {
+				connection.Methods = make(map[string]int64)
+			}
+			connection.Methods[method] += count
+		}
+		connection.Functions[blockedIn(sample)] += count
+	}
+	for _, connection := range connections {
+		report.Connections = append(report.Connections, *connection)
+	}
+	sort.Slice(report.Connections, func(i, j int) bool {
+		a, b := report.Connections[i], report.Connections[j]
+		if a.Goroutines != b.Goroutines {
+			return a.Goroutines > b.Goroutines
+		}
+		return a.ConnectionID < b.ConnectionID
+	})
+	return report, nil
+}
+
+func label(sample *profile.Sample, key string) string {
+	if values := sample.Label[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// blockedIn returns the innermost function of the stack outside the runtime, sync and reflect packages
+func blockedIn(sample *profile.Sample) string {
+	name := ""
+	for _, location := range sample.Location {
+		for _, line := range location.Line {
+			if line.Function == nil {
+				continue
+			}
+			name = line.Function.Name
+			if !strings.HasPrefix(name, "runtime.") && !strings.HasPrefix(name, "sync.") &&
+				!strings.HasPrefix(name, "reflect.") {
+				return name
+			}
+		}
+	}
+	return name
+}
+
+// NewHandler returns the handler of the diagnostics listener:
+//
+//	GET /debug/pprof/...        the net/http/pprof index, profiles and traces
+//	GET /debug/goroutines       the Report of the server
+func NewHandler(server signalr.Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := GoroutineReport(server)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	})
+	return mux
+}
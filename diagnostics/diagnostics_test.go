@@ -0,0 +1,114 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+var release = make(chan struct{})
+
+type testHub struct {
+	signalr.Hub
+}
+
+func (t *testHub) Block() {
+	<-release
+}
+
+var _ = Describe("Handler", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var testServer *httptest.Server
+	var client signalr.Client
+	var server signalr.Server
+
+	BeforeEach(func(done Done) {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		server, err = signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}),
+			signalr.HTTPTransports(signalr.TransportWebSockets),
+			signalr.Logger(signalr.SlogLogger(slog.NewTextHandler(io.Discard, nil)), false))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), "/hub")
+		router.Handle("/debug/", NewHandler(server))
+		testServer = httptest.NewServer(router)
+		conn, err := signalr.NewHTTPConnection(ctx, testServer.URL+"/hub")
+		Expect(err).NotTo(HaveOccurred())
+		client, err = signalr.NewClient(ctx, signalr.WithConnection(conn),
+			signalr.Logger(signalr.SlogLogger(slog.NewTextHandler(io.Discard, nil)), false))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		close(done)
+	}, 5.0)
+
+	AfterEach(func() {
+		cancel()
+		testServer.Close()
+	})
+
+	report := func() Report {
+		resp, err := http.Get(testServer.URL + "/debug/goroutines")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var r Report
+		Expect(json.NewDecoder(resp.Body).Decode(&r)).To(Succeed())
+		return r
+	}
+
+	serverConnection := func(r Report) *ConnectionReport {
+		connections := server.Connections()
+		Expect(connections).To(HaveLen(1))
+		for i := range r.Connections {
+			if r.Connections[i].ConnectionID == connections[0].ConnectionID {
+				return &r.Connections[i]
+			}
+		}
+		return nil
+	}
+
+	It("should count the goroutines of connections and hub methods", func(done Done) {
+		result := client.Invoke("Block")
+		var connection *ConnectionReport
+		Eventually(func() map[string]int64 {
+			connection = serverConnection(report())
+			if connection == nil {
+				return nil
+			}
+			return connection.Methods
+		}).Should(HaveKeyWithValue("block", int64(1)))
+		Expect(connection.Open).To(BeTrue())
+		Expect(connection.Transport).To(Equal("WebSockets"))
+		Expect(connection.Goroutines).To(BeNumerically(">", 1))
+		Expect(connection.Functions).To(HaveKey(ContainSubstring("testHub).Block")))
+		r := report()
+		Expect(r.Goroutines).To(BeNumerically(">", r.Unlabeled))
+		release <- struct{}{}
+		Expect((<-result).Error).NotTo(HaveOccurred())
+		close(done)
+	}, 5.0)
+
+	It("should serve the pprof profiles", func() {
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline"} {
+			resp, err := http.Get(testServer.URL + path)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK), path)
+		}
+		resp, err := http.Post(testServer.URL+"/debug/goroutines", "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
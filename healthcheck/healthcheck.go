@@ -0,0 +1,220 @@
+// Package healthcheck runs in-process liveness and readiness checks and serves their reports over HTTP.
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// Check returns an error if the checked part is not healthy. It should return when ctx is done.
+type Check func(ctx context.Context) error
+
+// Status values of Report and Result
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"durationMs"`
+}
+
+// Report is the outcome of all checks of a probe. Status is StatusDown if one of the checks failed.
+type Report struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Checks []Result  `json:"checks"`
+}
+
+// Up tells if all checks succeeded
+func (r Report) Up() bool {
+	return r.Status == StatusUp
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker holds the liveness and readiness checks.
+// Liveness checks detect states which only a restart can resolve, e.g. a deadlock.
+// Readiness checks detect states in which the server should get no new connections.
+// The readiness probe runs the liveness checks, too.
+type Checker struct {
+	mx      sync.RWMutex
+	live    []namedCheck
+	ready   []namedCheck
+	timeout time.Duration
+}
+
+// New creates a Checker which fails checks that take longer than timeout
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// AddLiveness adds a liveness check
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.live = append(c.live, namedCheck{name, check})
+}
+
+// AddReadiness adds a readiness check
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.ready = append(c.ready, namedCheck{name, check})
+}
+
+// Liveness runs the liveness checks
+func (c *Checker) Liveness(ctx context.Context) Report {
+	c.mx.RLock()
+	checks := append([]namedCheck{}, c.live...)
+	c.mx.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// Readiness runs the liveness and readiness checks
+func (c *Checker) Readiness(ctx context.Context) Report {
+	c.mx.RLock()
+	checks := append(append([]namedCheck{}, c.live...), c.ready...)
+	c.mx.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// run runs the checks in parallel. A check which does not return in the timeout is reported as failed,
+// but keeps running, because it can't be stopped.
+func (c *Checker) run(ctx context.Context, checks []namedCheck) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	report := Report{Status: StatusUp, Time: time.Now().UTC(), Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+			start := time.Now()
+			done := make(chan error, 1)
+			go func() { done <- nc.check(ctx) }()
+			var err error
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				err = fmt.Errorf("no result after %v", c.timeout)
+			}
+			result := Result{Name: nc.name, Status: StatusUp, Duration: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+			report.Checks[i] = result
+		}(i, nc)
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// LivenessHandler serves the liveness Report with status 200 if up and 503 if down
+func (c *Checker) LivenessHandler() http.Handler {
+	return reportHandler(c.Liveness)
+}
+
+// ReadinessHandler serves the readiness Report with status 200 if up and 503 if down
+func (c *Checker) ReadinessHandler() http.Handler {
+	return reportHandler(c.Readiness)
+}
+
+func reportHandler(probe func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report := probe(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Up() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(report)
+		}
+	})
+}
+
+// Goroutines fails if there are more than max goroutines, which indicates a leak
+func Goroutines(max int) Check {
+	return func(context.Context) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return fmt.Errorf("%d goroutines, more than %d", n, max)
+		}
+		return nil
+	}
+}
+
+// LifetimeManager fails if the server can't list its connections, which needs the locks
+// of its lifetime manager. A deadlock there is reported by the timeout of the Checker.
+func LifetimeManager(server signalr.Server) Check {
+	return func(context.Context) error {
+		_ = server.Connections()
+		return nil
+	}
+}
+
+// Connections fails if the server has more than max connections
+func Connections(server signalr.Server, max int) Check {
+	return func(context.Context) error {
+		if n := len(server.Connections()); n > max {
+			return fmt.Errorf("%d connections, more than %d", n, max)
+		}
+		return nil
+	}
+}
+
+// Flag fails with err until it is set. It is used for states like a bound listener.
+type Flag struct {
+	mx  sync.RWMutex
+	set bool
+}
+
+// Set sets or clears the flag
+func (f *Flag) Set(set bool) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.set = set
+}
+
+// Check returns a Check which fails with err while the flag is not set
+func (f *Flag) Check(err error) Check {
+	if err == nil {
+		err = errors.New("not set")
+	}
+	return func(context.Context) error {
+		f.mx.RLock()
+		defer f.mx.RUnlock()
+		if !f.set {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+type testHub struct {
+	signalr.Hub
+}
+
+func up(context.Context) error { return nil }
+
+func down(context.Context) error { return errors.New("broken") }
+
+// get requests the handler and decodes the Report
+func get(handler http.Handler) (int, Report) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report Report
+	Expect(json.Unmarshal(recorder.Body.Bytes(), &report)).To(Succeed())
+	Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+	return recorder.Code, report
+}
+
+var _ = Describe("Checker", func() {
+	var checker *Checker
+
+	BeforeEach(func() {
+		checker = New(100 * time.Millisecond)
+		checker.AddLiveness("live", up)
+	})
+
+	It("should be up without failed checks", func() {
+		checker.AddReadiness("ready", up)
+		code, report := get(checker.ReadinessHandler())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Status).To(Equal(StatusUp))
+		Expect(report.Checks).To(HaveLen(2))
+	})
+
+	It("should not run readiness checks for liveness", func() {
+		checker.AddReadiness("ready", down)
+		code, report := get(checker.LivenessHandler())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Checks).To(HaveLen(1))
+		Expect(report.Checks[0].Name).To(Equal("live"))
+	})
+
+	It("should be down with status 503 if a check fails", func() {
+		checker.AddReadiness("ready", down)
+		code, report := get(checker.ReadinessHandler())
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Status).To(Equal(StatusDown))
+		Expect(report.Checks[1].Name).To(Equal("ready"))
+		Expect(report.Checks[1].Status).To(Equal(StatusDown))
+		Expect(report.Checks[1].Error).To(Equal("broken"))
+	})
+
+	It("should fail checks which don't return in the timeout", func(done Done) {
+		block := make(chan struct{})
+		defer close(block)
+		checker.AddLiveness("stuck", func(context.Context) error { <-block; return nil })
+		report := checker.Liveness(context.Background())
+		Expect(report.Up()).To(BeFalse())
+		Expect(report.Checks[1].Status).To(Equal(StatusDown))
+		Expect(report.Checks[1].Error).To(ContainSubstring("no result"))
+		close(done)
+	}, 1.0)
+
+	It("should answer HEAD without body and reject other methods", func() {
+		recorder := httptest.NewRecorder()
+		checker.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "/", nil))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.Len()).To(BeZero())
+		recorder = httptest.NewRecorder()
+		checker.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
+
+var _ = Describe("Checks", func() {
+	It("should check the goroutine count", func() {
+		Expect(Goroutines(1000000)(context.Background())).To(Succeed())
+		Expect(Goroutines(1)(context.Background())).NotTo(Succeed())
+	})
+
+	It("should check the flag", func() {
+		flag := &Flag{}
+		check := flag.Check(errors.New("listener not bound"))
+		Expect(check(context.Background())).To(MatchError("listener not bound"))
+		flag.Set(true)
+		Expect(check(context.Background())).To(Succeed())
+	})
+
+	It("should check the lifetime manager and the connection count of the server", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		server, err := signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(LifetimeManager(server)(ctx)).To(Succeed())
+		Expect(Connections(server, 0)(ctx)).To(Succeed())
+	})
+})
@@ -0,0 +1,192 @@
+// Package heartbeat registers a node with the IAC app server. It posts the status of the node in an interval,
+// retries failed posts with a jittered backoff, and deregisters the node on shutdown.
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// Options configure a Service
+type Options struct {
+	// URL is the heartbeat endpoint of the app server. The payload is posted to it.
+	URL string
+	// DeregisterURL receives the payload with method DELETE when the Service stops, default URL
+	DeregisterURL string
+	// APIKey is sent in the "apikey <key>" Authorization header
+	APIKey string
+	// Interval between two heartbeats, default 5m
+	Interval time.Duration
+	// MinBackoff is the wait before the first retry of a failed heartbeat, default 1s.
+	// It doubles with every failed retry up to MaxBackoff, default 1m, but never exceeds Interval.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Timeout of each request, default 10s
+	Timeout time.Duration
+	// Client sends the requests, default http.DefaultClient
+	Client *http.Client
+	// OnError is called with the errors of failed heartbeats and of the deregistration
+	OnError func(err error)
+}
+
+// Payload returns the body of a heartbeat
+type Payload func() map[string]interface{}
+
+// Service sends the heartbeats
+type Service struct {
+	options Options
+	payload Payload
+	mx      sync.Mutex
+	rand    *rand.Rand
+}
+
+// New creates a Service which sends the payload to options.URL
+func New(options Options, payload Payload) (*Service, error) {
+	if options.URL == "" {
+		return nil, errors.New("heartbeat URL not set")
+	}
+	if payload == nil {
+		return nil, errors.New("heartbeat payload not set")
+	}
+	if options.DeregisterURL == "" {
+		options.DeregisterURL = options.URL
+	}
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Minute
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = time.Second
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = time.Minute
+	}
+	if options.MaxBackoff > options.Interval {
+		options.MaxBackoff = options.Interval
+	}
+	if options.MinBackoff > options.MaxBackoff {
+		options.MinBackoff = options.MaxBackoff
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	return &Service{
+		options: options,
+		payload: payload,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Run sends a heartbeat immediately and then every Interval until ctx is canceled.
+// Failed heartbeats are retried after the backoff. When ctx is canceled, Run deregisters the node and returns.
+func (s *Service) Run(ctx context.Context) {
+	defer s.deregister()
+	backoff := s.options.MinBackoff
+	for {
+		wait := s.options.Interval
+		if err := s.send(ctx, http.MethodPost, s.options.URL); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.onError(err)
+			wait = s.jitter(backoff)
+			if backoff *= 2; backoff > s.options.MaxBackoff {
+				backoff = s.options.MaxBackoff
+			}
+		} else {
+			backoff = s.options.MinBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// deregister tells the app server that the node stops. The ctx of Run is done, so it uses its own.
+func (s *Service) deregister() {
+	if err := s.send(context.Background(), http.MethodDelete, s.options.DeregisterURL); err != nil {
+		s.onError(fmt.Errorf("deregistration: %w", err))
+	}
+}
+
+// jitter returns a random duration between d/2 and d, so nodes which failed together don't retry together
+func (s *Service) jitter(d time.Duration) time.Duration {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return d/2 + time.Duration(s.rand.Int63n(int64(d/2)+1))
+}
+
+func (s *Service) send(ctx context.Context, method string, url string) error {
+	body, err := json.Marshal(s.payload())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.options.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.options.APIKey != "" {
+		req.Header.Set("Authorization", "apikey "+s.options.APIKey)
+	}
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return nil
+}
+
+func (s *Service) onError(err error) {
+	if s.options.OnError != nil {
+		s.options.OnError(err)
+	}
+}
+
+// Stats are the connection and group statistics of a server sent with the heartbeat
+type Stats struct {
+	Connections  int            `json:"connections"`
+	Transports   map[string]int `json:"transports"`
+	Groups       int            `json:"groups"`
+	GroupMembers map[string]int `json:"groupMembers"`
+}
+
+// ServerStats returns the current Stats of server
+func ServerStats(server signalr.Server) Stats {
+	connections := server.Connections()
+	stats := Stats{
+		Connections:  len(connections),
+		Transports:   make(map[string]int),
+		GroupMembers: make(map[string]int),
+	}
+	for _, status := range connections {
+		stats.Transports[status.Transport]++
+	}
+	for group, members := range server.GroupMembers() {
+		stats.GroupMembers[group] = len(members)
+	}
+	stats.Groups = len(stats.GroupMembers)
+	return stats
+}
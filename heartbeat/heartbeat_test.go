@@ -0,0 +1,181 @@
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+type request struct {
+	method        string
+	authorization string
+	body          map[string]interface{}
+}
+
+// appServer records the requests and fails the first failures of them with status 503
+type appServer struct {
+	*httptest.Server
+	mx       sync.Mutex
+	requests []request
+	failures int
+}
+
+func newAppServer(failures int) *appServer {
+	a := &appServer{failures: failures}
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		a.mx.Lock()
+		defer a.mx.Unlock()
+		a.requests = append(a.requests, request{method: r.Method, authorization: r.Header.Get("Authorization"), body: body})
+		if a.failures > 0 {
+			a.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return a
+}
+
+func (a *appServer) received() []request {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return append([]request{}, a.requests...)
+}
+
+func (a *appServer) methods() []string {
+	var methods []string
+	for _, r := range a.received() {
+		methods = append(methods, r.method)
+	}
+	return methods
+}
+
+type testHub struct {
+	signalr.Hub
+}
+
+func (t *testHub) Join(group string) {
+	t.Groups().AddToGroup(group, t.ConnectionID())
+}
+
+var _ = Describe("Service", func() {
+	payload := func() map[string]interface{} { return map[string]interface{}{"Node": "node1"} }
+
+	It("should not be created without URL", func() {
+		_, err := New(Options{}, payload)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should send heartbeats in the interval and deregister when canceled", func(done Done) {
+		app := newAppServer(0)
+		defer app.Close()
+		service, err := New(Options{URL: app.URL + "/heartbeat", APIKey: "secret", Interval: 20 * time.Millisecond}, payload)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			service.Run(ctx)
+			close(stopped)
+		}()
+		Eventually(func() int { return len(app.received()) }).Should(BeNumerically(">=", 3))
+		cancel()
+		<-stopped
+		requests := app.received()
+		last := requests[len(requests)-1]
+		Expect(last.method).To(Equal(http.MethodDelete))
+		for _, r := range requests[:len(requests)-1] {
+			Expect(r.method).To(Equal(http.MethodPost))
+		}
+		Expect(last.authorization).To(Equal("apikey secret"))
+		Expect(last.body).To(HaveKeyWithValue("Node", "node1"))
+		close(done)
+	}, 2.0)
+
+	It("should retry failed heartbeats with backoff before the interval", func(done Done) {
+		app := newAppServer(2)
+		defer app.Close()
+		var mx sync.Mutex
+		var errs []error
+		service, err := New(Options{
+			URL:        app.URL,
+			Interval:   time.Hour,
+			MinBackoff: 10 * time.Millisecond,
+			OnError: func(err error) {
+				mx.Lock()
+				defer mx.Unlock()
+				errs = append(errs, err)
+			},
+		}, payload)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			service.Run(ctx)
+			close(stopped)
+		}()
+		Eventually(func() int { return len(app.received()) }).Should(Equal(3))
+		Consistently(func() int { return len(app.received()) }, 100*time.Millisecond).Should(Equal(3))
+		cancel()
+		<-stopped
+		Expect(app.methods()).To(Equal([]string{http.MethodPost, http.MethodPost, http.MethodPost, http.MethodDelete}))
+		mx.Lock()
+		defer mx.Unlock()
+		Expect(errs).To(HaveLen(2))
+		close(done)
+	}, 2.0)
+
+	It("should keep the jitter between half the backoff and the backoff", func() {
+		service, err := New(Options{URL: "http://localhost"}, payload)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 100; i++ {
+			Expect(service.jitter(time.Second)).To(And(
+				BeNumerically(">=", 500*time.Millisecond),
+				BeNumerically("<=", time.Second)))
+		}
+	})
+
+	It("should limit the backoff to the interval", func() {
+		service, err := New(Options{URL: "http://localhost", Interval: time.Second, MaxBackoff: time.Minute}, payload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.options.MaxBackoff).To(Equal(time.Second))
+	})
+})
+
+var _ = Describe("ServerStats", func() {
+	It("should count the connections and group members", func(done Done) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		server, err := signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}),
+			signalr.HTTPTransports(signalr.TransportWebSockets))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ServerStats(server)).To(Equal(Stats{Transports: map[string]int{}, GroupMembers: map[string]int{}}))
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), "/hub")
+		testServer := httptest.NewServer(router)
+		defer testServer.Close()
+		conn, err := signalr.NewHTTPConnection(ctx, testServer.URL+"/hub")
+		Expect(err).NotTo(HaveOccurred())
+		client, err := signalr.NewClient(ctx, signalr.WithConnection(conn), signalr.WithReceiver(&struct{}{}))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		Expect((<-client.Invoke("join", "line1")).Error).NotTo(HaveOccurred())
+		Expect(ServerStats(server)).To(Equal(Stats{
+			Connections:  1,
+			Transports:   map[string]int{"WebSockets": 1},
+			Groups:       1,
+			GroupMembers: map[string]int{"line1": 1},
+		}))
+		close(done)
+	}, 5.0)
+})
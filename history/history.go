@@ -0,0 +1,351 @@
+// Package history keeps a log of the messages of message bus topics, so clients which reconnect can receive
+// the messages they missed. Every topic has its own sequence numbers, starting at 1. The log keeps the latest
+// messages of each topic up to a count, an age and a size, and is persisted in append-only segment files.
+package history
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+// DefaultMaxCount is the number of messages kept per topic, if no MaxCount is given
+const DefaultMaxCount = 1000
+
+// DefaultSegmentSize is the size in bytes after which a new segment file is started, if no SegmentSize is given
+const DefaultSegmentSize = 4 * 1024 * 1024
+
+// DefaultFollowBuffer is the number of live messages buffered for a follower, if no FollowBuffer is given
+const DefaultFollowBuffer = 256
+
+// Entry is a message in the history of a topic
+type Entry struct {
+	Topic   string    `json:"topic"`
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Payload string    `json:"payload"`
+}
+
+// Options configure a History
+type Options struct {
+	// Dir keeps the segment files. The history is kept in memory only if it is empty.
+	Dir string
+	// Topics are the topic filters whose messages are kept
+	Topics []string
+	// MaxCount is the number of messages kept per topic
+	MaxCount int
+	// MaxAge is the age after which messages are removed, zero keeps them regardless of their age
+	MaxAge time.Duration
+	// MaxBytes is the size of the payloads kept per topic, zero does not limit the size
+	MaxBytes int64
+	// SegmentSize is the size in bytes after which a new segment file is started
+	SegmentSize int64
+	// FollowBuffer is the number of live messages buffered for a follower. A follower which falls further
+	// behind is ended and has to follow again from its last sequence number.
+	FollowBuffer int
+}
+
+// stored is an entry with the segment which holds it
+type stored struct {
+	Entry
+	segment uint64
+}
+
+// topicLog is the history of one topic
+type topicLog struct {
+	entries     []stored // oldest first
+	bytes       int64    // size of the payloads of entries
+	last        uint64   // last sequence number, also after its entry has been removed
+	lastSegment uint64   // segment holding the record of the last sequence number
+	followers   map[*follower]struct{}
+}
+
+// follower receives the live entries of a topic
+type follower struct {
+	entries chan Entry
+}
+
+// History keeps the messages of the topics matching Options.Topics. It is safe for concurrent use.
+type History struct {
+	mx       sync.Mutex
+	options  Options
+	topics   map[string]*topicLog
+	segments *segments        // nil if the history is kept in memory only
+	now      func() time.Time // replaced in tests
+}
+
+// Open creates the History and loads the segment files in Options.Dir
+func Open(options Options) (*History, error) {
+	if options.MaxCount <= 0 {
+		options.MaxCount = DefaultMaxCount
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = DefaultSegmentSize
+	}
+	if options.FollowBuffer <= 0 {
+		options.FollowBuffer = DefaultFollowBuffer
+	}
+	h := &History{
+		options: options,
+		topics:  make(map[string]*topicLog),
+		now:     time.Now,
+	}
+	if options.Dir == "" {
+		return h, nil
+	}
+	s, err := openSegments(options.Dir, options.SegmentSize, h.load)
+	if err != nil {
+		return nil, err
+	}
+	h.segments = s
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	for _, t := range h.topics {
+		h.evict(t)
+	}
+	if err := h.compact(); err != nil {
+		_ = s.close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// load applies a record read from the segment files
+func (h *History) load(segmentID uint64, r record) {
+	t := h.topic(r.Topic)
+	if r.Seq <= t.last {
+		return
+	}
+	t.last = r.Seq
+	t.lastSegment = segmentID
+	if r.Marker {
+		return
+	}
+	t.entries = append(t.entries, stored{Entry: r.Entry, segment: segmentID})
+	t.bytes += int64(len(r.Payload))
+}
+
+func (h *History) topic(name string) *topicLog {
+	t, ok := h.topics[name]
+	if !ok {
+		t = &topicLog{followers: make(map[*follower]struct{})}
+		h.topics[name] = t
+	}
+	return t
+}
+
+// Enabled reports whether the messages of the topic are kept. A nil *History keeps no topics.
+func (h *History) Enabled(topicName string) bool {
+	if h == nil {
+		return false
+	}
+	for _, filter := range h.options.Topics {
+		if topic.Match(filter, topicName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Append adds the payload to the history of the topic and passes the entry to the followers of the topic.
+// The entry gets the next sequence number of the topic.
+func (h *History) Append(topicName string, payload string) (Entry, error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	t := h.topic(topicName)
+	entry := Entry{Topic: topicName, Seq: t.last + 1, Time: h.now().UTC(), Payload: payload}
+	var segmentID uint64
+	rotated := false
+	if h.segments != nil {
+		var err error
+		if segmentID, rotated, err = h.segments.append(record{Entry: entry}); err != nil {
+			return Entry{}, err
+		}
+	}
+	t.entries = append(t.entries, stored{Entry: entry, segment: segmentID})
+	t.bytes += int64(len(payload))
+	t.last = entry.Seq
+	t.lastSegment = segmentID
+	h.evict(t)
+	for f := range t.followers {
+		select {
+		case f.entries <- entry:
+		default:
+			// the follower is too slow, it follows again from its last sequence number
+			close(f.entries)
+			delete(t.followers, f)
+		}
+	}
+	if rotated {
+		if err := h.compact(); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// evict removes the oldest entries of the topic which exceed the count, size or age
+func (h *History) evict(t *topicLog) {
+	var oldest time.Time
+	if h.options.MaxAge > 0 {
+		oldest = h.now().Add(-h.options.MaxAge)
+	}
+	n := 0
+	bytes := t.bytes
+	for n < len(t.entries) {
+		e := t.entries[n]
+		if len(t.entries)-n <= h.options.MaxCount &&
+			(h.options.MaxBytes <= 0 || bytes <= h.options.MaxBytes) &&
+			(oldest.IsZero() || !e.Time.Before(oldest)) {
+			break
+		}
+		bytes -= int64(len(e.Payload))
+		n++
+	}
+	if n > 0 {
+		t.entries = append([]stored(nil), t.entries[n:]...)
+		t.bytes = bytes
+	}
+}
+
+// Since returns the entries of the topic with a sequence number after seq, oldest first
+func (h *History) Since(topicName string, seq uint64) []Entry {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.since(topicName, seq)
+}
+
+func (h *History) since(topicName string, seq uint64) []Entry {
+	t, ok := h.topics[topicName]
+	if !ok {
+		return []Entry{}
+	}
+	h.evict(t)
+	entries := []Entry{}
+	for _, e := range t.entries {
+		if e.Seq > seq {
+			entries = append(entries, e.Entry)
+		}
+	}
+	return entries
+}
+
+// Follow returns the entries of the topic after seq, followed by the live entries of the topic as they are
+// appended. The channel is closed when ctx is done or the receiver falls more than Options.FollowBuffer
+// entries behind. The receiver has to read from the channel until it is closed or ctx is done.
+func (h *History) Follow(ctx context.Context, topicName string, seq uint64) <-chan Entry {
+	h.mx.Lock()
+	missed := h.since(topicName, seq)
+	f := &follower{entries: make(chan Entry, h.options.FollowBuffer)}
+	t := h.topic(topicName)
+	t.followers[f] = struct{}{}
+	h.mx.Unlock()
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+		defer h.unfollow(t, f)
+		for _, e := range missed {
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case e, ok := <-f.entries:
+				if !ok {
+					return
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (h *History) unfollow(t *topicLog, f *follower) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	delete(t.followers, f)
+}
+
+// Compact removes the segment files whose records are not needed anymore
+// and rewrites those of which less than half of the records are needed.
+func (h *History) Compact() error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	for _, t := range h.topics {
+		h.evict(t)
+	}
+	return h.compact()
+}
+
+func (h *History) compact() error {
+	if h.segments == nil {
+		return nil
+	}
+	for _, seg := range append([]*segment(nil), h.segments.sealed()...) {
+		records := h.needed(seg.id)
+		switch {
+		case len(records) == 0:
+			if err := h.segments.remove(seg); err != nil {
+				return err
+			}
+		case 2*len(records) <= seg.records:
+			if err := h.segments.rewrite(seg, records); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// needed returns the records of the segment which are still needed: the entries which are kept and markers
+// for the topics whose last sequence number is in the segment, but whose last entry has been removed
+func (h *History) needed(segmentID uint64) []record {
+	var records []record
+	for name, t := range h.topics {
+		for _, e := range t.entries {
+			if e.segment == segmentID {
+				records = append(records, record{Entry: e.Entry})
+			}
+		}
+		if t.lastSegment == segmentID && (len(t.entries) == 0 || t.entries[len(t.entries)-1].Seq != t.last) {
+			records = append(records, record{Entry: Entry{Topic: name, Seq: t.last}, Marker: true})
+		}
+	}
+	// keep the order of the sequence numbers within each topic
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Topic != records[j].Topic {
+			return records[i].Topic < records[j].Topic
+		}
+		return records[i].Seq < records[j].Seq
+	})
+	return records
+}
+
+// Close ends all followers and closes the segment files
+func (h *History) Close() error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	for _, t := range h.topics {
+		for f := range t.followers {
+			close(f.entries)
+			delete(t.followers, f)
+		}
+	}
+	if h.segments == nil {
+		return nil
+	}
+	return h.segments.close()
+}
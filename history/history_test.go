@@ -0,0 +1,270 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func payloads(entries []Entry) []string {
+	result := []string{}
+	for _, e := range entries {
+		result = append(result, e.Payload)
+	}
+	return result
+}
+
+func seqs(entries []Entry) []uint64 {
+	result := []uint64{}
+	for _, e := range entries {
+		result = append(result, e.Seq)
+	}
+	return result
+}
+
+func appendAll(h *History, topicName string, payloads ...string) {
+	for _, payload := range payloads {
+		_, err := h.Append(topicName, payload)
+		Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+func segmentFiles(dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	Expect(err).NotTo(HaveOccurred())
+	return files
+}
+
+var _ = Describe("History", func() {
+	var now time.Time
+
+	open := func(options Options) *History {
+		h, err := Open(options)
+		Expect(err).NotTo(HaveOccurred())
+		h.now = func() time.Time { return now }
+		return h
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	})
+
+	It("should number the messages of each topic", func() {
+		h := open(Options{Topics: []string{"plant1/#"}})
+		Expect(h.Enabled("plant1/line3/status")).To(BeTrue())
+		Expect(h.Enabled("plant2/line3/status")).To(BeFalse())
+		Expect((*History)(nil).Enabled("plant1/line3/status")).To(BeFalse())
+		appendAll(h, "a", "1", "2", "3")
+		appendAll(h, "b", "4")
+		Expect(seqs(h.Since("a", 0))).To(Equal([]uint64{1, 2, 3}))
+		Expect(payloads(h.Since("a", 1))).To(Equal([]string{"2", "3"}))
+		Expect(seqs(h.Since("b", 0))).To(Equal([]uint64{1}))
+		Expect(h.Since("c", 0)).To(BeEmpty())
+		Expect(h.Since("a", 0)[0].Time).To(Equal(now))
+	})
+
+	It("should keep the messages up to a count, an age and a size", func() {
+		h := open(Options{MaxCount: 3})
+		appendAll(h, "a", "1", "2", "3", "4", "5")
+		Expect(payloads(h.Since("a", 0))).To(Equal([]string{"3", "4", "5"}))
+
+		h = open(Options{MaxBytes: 10})
+		appendAll(h, "a", "aaaa", "bbbb", "cccc")
+		Expect(payloads(h.Since("a", 0))).To(Equal([]string{"bbbb", "cccc"}))
+
+		h = open(Options{MaxAge: time.Minute})
+		appendAll(h, "a", "old")
+		now = now.Add(45 * time.Second)
+		appendAll(h, "a", "new")
+		now = now.Add(30 * time.Second)
+		Expect(payloads(h.Since("a", 0))).To(Equal([]string{"new"}))
+		Expect(seqs(h.Since("a", 0))).To(Equal([]uint64{2}))
+	})
+
+	It("should follow the missed and then the live messages", func(done Done) {
+		h := open(Options{})
+		appendAll(h, "a", "1", "2", "3")
+		ctx, cancel := context.WithCancel(context.Background())
+		entries := h.Follow(ctx, "a", 1)
+		appendAll(h, "a", "4")
+		Expect((<-entries).Payload).To(Equal("2"))
+		Expect((<-entries).Payload).To(Equal("3"))
+		Expect((<-entries).Payload).To(Equal("4"))
+		appendAll(h, "b", "other topic")
+		appendAll(h, "a", "5")
+		Expect(<-entries).To(MatchAllKeys("a", 5, "5"))
+		cancel()
+		Eventually(entries).Should(BeClosed())
+		close(done)
+	}, 2.0)
+
+	It("should end followers which fall behind", func(done Done) {
+		h := open(Options{FollowBuffer: 2})
+		entries := h.Follow(context.Background(), "a", 0)
+		appendAll(h, "a", "1", "2", "3", "4")
+		var received []Entry
+		for e := range entries {
+			received = append(received, e)
+		}
+		Expect(len(received)).To(BeNumerically("<", 4))
+		// the follower continues from its last sequence number
+		last := uint64(0)
+		if len(received) > 0 {
+			last = received[len(received)-1].Seq
+		}
+		Expect(seqs(h.Since("a", last))).To(Equal(seqs(h.Since("a", 0))[len(received):]))
+		close(done)
+	}, 2.0)
+
+	Context("in segment files", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "signalr-history")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(dir)
+		})
+
+		It("should restore the messages and continue their numbers", func() {
+			h := open(Options{Dir: dir})
+			appendAll(h, "a", "1", "2")
+			appendAll(h, "b", "3")
+			Expect(h.Close()).To(Succeed())
+			h = open(Options{Dir: dir})
+			defer h.Close()
+			Expect(payloads(h.Since("a", 0))).To(Equal([]string{"1", "2"}))
+			appendAll(h, "a", "4")
+			Expect(seqs(h.Since("a", 0))).To(Equal([]uint64{1, 2, 3}))
+			Expect(payloads(h.Since("b", 0))).To(Equal([]string{"3"}))
+		})
+
+		It("should cut off an incomplete last record", func() {
+			h := open(Options{Dir: dir})
+			appendAll(h, "a", "1", "2")
+			Expect(h.Close()).To(Succeed())
+			files := segmentFiles(dir)
+			Expect(files).To(HaveLen(1))
+			info, err := os.Stat(files[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Truncate(files[0], info.Size()-3)).To(Succeed())
+
+			h = open(Options{Dir: dir})
+			defer h.Close()
+			Expect(payloads(h.Since("a", 0))).To(Equal([]string{"1"}))
+			appendAll(h, "a", "3")
+			Expect(h.Close()).To(Succeed())
+			h = open(Options{Dir: dir})
+			Expect(payloads(h.Since("a", 0))).To(Equal([]string{"1", "3"}))
+			Expect(seqs(h.Since("a", 0))).To(Equal([]uint64{1, 2}))
+		})
+
+		It("should cut off a last record with a wrong checksum", func() {
+			h := open(Options{Dir: dir})
+			appendAll(h, "a", "1", "2")
+			Expect(h.Close()).To(Succeed())
+			files := segmentFiles(dir)
+			data, err := os.ReadFile(files[0])
+			Expect(err).NotTo(HaveOccurred())
+			data[len(data)-2] ^= 0xff
+			Expect(os.WriteFile(files[0], data, 0644)).To(Succeed())
+
+			h = open(Options{Dir: dir})
+			defer h.Close()
+			Expect(payloads(h.Since("a", 0))).To(Equal([]string{"1"}))
+		})
+
+		It("should fail on a corrupt sealed segment", func() {
+			h := open(Options{Dir: dir, SegmentSize: 1})
+			appendAll(h, "a", "1", "2")
+			Expect(h.Close()).To(Succeed())
+			files := segmentFiles(dir)
+			Expect(files).To(HaveLen(2))
+			data, err := os.ReadFile(files[0])
+			Expect(err).NotTo(HaveOccurred())
+			data[len(data)-2] ^= 0xff
+			Expect(os.WriteFile(files[0], data, 0644)).To(Succeed())
+			_, err = Open(Options{Dir: dir})
+			Expect(err).To(MatchError(ContainSubstring(files[0])))
+		})
+
+		It("should remove segments which are not needed anymore", func() {
+			h := open(Options{Dir: dir, MaxCount: 2, SegmentSize: 1})
+			appendAll(h, "a", "1", "2", "3", "4", "5")
+			// every record has its own segment, the segments of the removed messages are deleted
+			Expect(segmentFiles(dir)).To(HaveLen(2))
+			Expect(h.Close()).To(Succeed())
+			h = open(Options{Dir: dir, MaxCount: 2, SegmentSize: 1})
+			defer h.Close()
+			Expect(payloads(h.Since("a", 0))).To(Equal([]string{"4", "5"}))
+		})
+
+		It("should rewrite segments of which most records are not needed", func() {
+			h := open(Options{Dir: dir, MaxCount: 1, SegmentSize: 1 << 20})
+			for i := 0; i < 10; i++ {
+				appendAll(h, fmt.Sprintf("t%d", i), "x")
+			}
+			appendAll(h, "t0", "y")
+			appendAll(h, "t1", "y")
+			appendAll(h, "t2", "y")
+			Expect(h.Close()).To(Succeed())
+			files := segmentFiles(dir)
+			Expect(files).To(HaveLen(1))
+			before, err := os.Stat(files[0])
+			Expect(err).NotTo(HaveOccurred())
+
+			// a small segment size seals the segment on the next append, so it is compacted
+			h = open(Options{Dir: dir, MaxCount: 1, SegmentSize: 1})
+			appendAll(h, "t3", "y")
+			appendAll(h, "t4", "y")
+			appendAll(h, "t5", "y")
+			appendAll(h, "t6", "y")
+			Expect(h.Compact()).To(Succeed())
+			after, err := os.Stat(files[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(after.Size()).To(BeNumerically("<", before.Size()))
+			Expect(h.Close()).To(Succeed())
+
+			h = open(Options{Dir: dir, MaxCount: 1})
+			defer h.Close()
+			for i := 0; i < 10; i++ {
+				expected := "x"
+				if i < 7 {
+					expected = "y"
+				}
+				Expect(payloads(h.Since(fmt.Sprintf("t%d", i), 0))).To(Equal([]string{expected}), fmt.Sprint(i))
+			}
+		})
+
+		It("should continue the numbers of topics whose messages have all been removed", func() {
+			h := open(Options{Dir: dir, MaxAge: time.Minute, SegmentSize: 1})
+			appendAll(h, "a", "1", "2", "3")
+			now = now.Add(2 * time.Minute)
+			appendAll(h, "b", "4")
+			Expect(h.Compact()).To(Succeed())
+			Expect(h.Since("a", 0)).To(BeEmpty())
+			Expect(h.Close()).To(Succeed())
+
+			h = open(Options{Dir: dir, MaxAge: time.Minute, SegmentSize: 1})
+			defer h.Close()
+			appendAll(h, "a", "5")
+			Expect(seqs(h.Since("a", 0))).To(Equal([]uint64{4}))
+		})
+	})
+})
+
+// MatchAllKeys matches an Entry by topic, sequence number and payload
+func MatchAllKeys(topicName string, seq uint64, payload string) OmegaMatcher {
+	return And(
+		WithTransform(func(e Entry) string { return e.Topic }, Equal(topicName)),
+		WithTransform(func(e Entry) uint64 { return e.Seq }, Equal(seq)),
+		WithTransform(func(e Entry) string { return e.Payload }, Equal(payload)))
+}
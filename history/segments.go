@@ -0,0 +1,287 @@
+package history
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentExt is the file extension of segment files
+const segmentExt = ".seg"
+
+// headerSize is the size of the record header: the length and the CRC-32 of the record data
+const headerSize = 8
+
+// maxRecordSize rejects record lengths which can only come from a corrupt header
+const maxRecordSize = 64 << 20
+
+// record is the data of one record in a segment. Markers keep the last sequence number of a topic
+// whose entries have all been removed, so the numbers continue after a restart.
+type record struct {
+	Entry
+	Marker bool `json:"marker,omitempty"`
+}
+
+// segment is one file of the log
+type segment struct {
+	id      uint64
+	path    string
+	size    int64
+	records int
+}
+
+// segments is an append-only log of records in numbered files. Records are appended to the last segment
+// until it reaches maxSize, then a new segment is started. Every record is framed with its length and CRC-32.
+type segments struct {
+	dir     string
+	maxSize int64
+	list    []*segment // sorted by id, the last one is active
+	file    *os.File   // the active segment
+	writer  *bufio.Writer
+}
+
+func segmentPath(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// openSegments reads all segments in dir and passes their records to apply, in the order they were written.
+// An incomplete or corrupt record at the end of the last segment, as left by a crash while writing,
+// is cut off. Corrupt records in other segments are reported as error, as those are never written in place.
+func openSegments(dir string, maxSize int64, apply func(segmentID uint64, r record)) (*segments, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &segments{dir: dir, maxSize: maxSize}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.list = append(s.list, &segment{id: id, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(s.list, func(i, j int) bool { return s.list[i].id < s.list[j].id })
+	for i, seg := range s.list {
+		last := i == len(s.list)-1
+		if err := s.read(seg, last, apply); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.list) == 0 {
+		s.list = append(s.list, &segment{id: 1, path: segmentPath(dir, 1)})
+	}
+	if err := s.openActive(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// read applies the records of seg. If truncate is set, a corrupt tail is cut off instead of failing.
+func (s *segments) read(seg *segment, truncate bool, apply func(segmentID uint64, r record)) error {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		r, n, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !truncate {
+				return fmt.Errorf("%s at offset %d: %w", seg.path, offset, err)
+			}
+			if err := os.Truncate(seg.path, offset); err != nil {
+				return err
+			}
+			break
+		}
+		apply(seg.id, r)
+		offset += n
+		seg.records++
+	}
+	seg.size = offset
+	return nil
+}
+
+// errCorrupt is returned by readRecord for records with a wrong length or checksum
+var errCorrupt = errors.New("corrupt record")
+
+// readRecord reads one record and returns it with its size in bytes.
+// It returns io.EOF at the end of the data, and an error for an incomplete or corrupt record.
+func readRecord(reader io.Reader) (record, int64, error) {
+	var header [headerSize]byte
+	if n, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return record{}, 0, io.EOF
+		}
+		return record{}, 0, io.ErrUnexpectedEOF
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return record{}, 0, errCorrupt
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return record{}, 0, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return record{}, 0, errCorrupt
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return record{}, 0, errCorrupt
+	}
+	return r, int64(headerSize + length), nil
+}
+
+func writeRecord(w io.Writer, r record) (int64, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return 0, err
+	}
+	var header [headerSize]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(data))
+	if _, err := w.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return 0, err
+	}
+	return int64(headerSize + len(data)), nil
+}
+
+func (s *segments) active() *segment {
+	return s.list[len(s.list)-1]
+}
+
+func (s *segments) openActive() error {
+	file, err := os.OpenFile(s.active().path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	return nil
+}
+
+// append writes the record to the active segment and returns the id of the segment.
+// A new segment is started first if the record would not fit anymore. rotated reports whether this happened.
+func (s *segments) append(r record) (segmentID uint64, rotated bool, err error) {
+	if s.file == nil {
+		return 0, false, errors.New("history is closed")
+	}
+	if active := s.active(); active.size > 0 && active.size >= s.maxSize {
+		if err := s.closeActive(); err != nil {
+			return 0, false, err
+		}
+		s.list = append(s.list, &segment{id: active.id + 1, path: segmentPath(s.dir, active.id+1)})
+		if err := s.openActive(); err != nil {
+			return 0, false, err
+		}
+		rotated = true
+	}
+	active := s.active()
+	n, err := writeRecord(s.writer, r)
+	if err == nil {
+		err = s.writer.Flush()
+	}
+	if err != nil {
+		return 0, rotated, err
+	}
+	active.size += n
+	active.records++
+	return active.id, rotated, nil
+}
+
+func (s *segments) closeActive() error {
+	err := s.writer.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
+
+// sealed returns the segments which are not written anymore
+func (s *segments) sealed() []*segment {
+	return s.list[:len(s.list)-1]
+}
+
+// remove deletes the sealed segment
+func (s *segments) remove(seg *segment) error {
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i, other := range s.list {
+		if other == seg {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// rewrite replaces the sealed segment with one which only contains records.
+// The new file replaces the old one by rename, so a crash leaves either of them.
+func (s *segments) rewrite(seg *segment, records []record) error {
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(seg.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	var size int64
+	for _, r := range records {
+		var n int64
+		if n, err = writeRecord(writer, r); err != nil {
+			break
+		}
+		size += n
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), seg.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	seg.size = size
+	seg.records = len(records)
+	return nil
+}
+
+func (s *segments) close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.closeActive()
+}
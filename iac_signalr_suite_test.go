@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/logger"
+	"github.com/mdaxf/iac-signalr/reply"
+	"github.com/mdaxf/iac-signalr/retain"
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+func TestIACSignalR(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IAC SignalR Suite")
+}
+
+var _ = BeforeSuite(func() {
+	logger.Init(map[string]interface{}{})
+})
+
+// newTestHub returns a prototype hub with subscriptions, retained messages in memory and a request router,
+// whose newInstance is passed to signalr.HubFactory like the server does
+func newTestHub() *IACMessageBus {
+	return &IACMessageBus{
+		ilog:     ilog,
+		topics:   topic.NewSubscriptions(),
+		retained: retain.New(retain.NewMemoryStore(), retain.Options{}),
+		requests: reply.New(reply.Options{}),
+	}
+}
@@ -2,9 +2,12 @@ package logger
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/mdaxf/iac/framework/logs"
 )
@@ -30,6 +33,37 @@ const (
 	SignalR   string = "SignalR"
 )
 
+// logFiles are the files written by the file and multifile adapters, checked by Writable
+var (
+	logFilesMx sync.Mutex
+	logFiles   []string
+)
+
+// Writable checks if the loggers can write: the log files can be opened for appending, or stdout is open
+// for the console adapter. It returns an error if Init has not been called.
+func Writable() error {
+	if SignalRLogger == nil {
+		return errors.New("logger not initialized")
+	}
+	logFilesMx.Lock()
+	files := append([]string{}, logFiles...)
+	logFilesMx.Unlock()
+	if len(files) == 0 {
+		if _, err := os.Stdout.Stat(); err != nil {
+			return fmt.Errorf("stdout: %w", err)
+		}
+		return nil
+	}
+	for _, name := range files {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+	}
+	return nil
+}
+
 type Log struct {
 	ModuleName     string
 	ControllerName string
@@ -152,6 +186,9 @@ func setLogger(loger *logs.IACLogger, config map[string]interface{}, logtype str
 		if adapterconfig["maxsize"] != nil {
 			maxsize = adapterconfig["maxsize"].(int)
 		}
+		logFilesMx.Lock()
+		logFiles = append(logFiles, fullfilename)
+		logFilesMx.Unlock()
 	} else if logadapter == "documentdb" {
 		conn := "mongodb://localhost:27017"
 		db := "IAC_Cache"
@@ -186,7 +223,7 @@ func setLogger(loger *logs.IACLogger, config map[string]interface{}, logtype str
 		//	logs.SetLogger(logs.AdapterFile, `{"filename":"test.log"}`)
 		loger.SetLogger(logs.AdapterFile, fmt.Sprintf(`{"level":"%d","filename":"%s","maxlines":"%d","maxsize":"%d"}`, level, fullfilename, maxlines, maxsize))
 	case "multifile":
-		loger.SetLogger(logs.AdapterMultiFile, fmt.Sprintf(`{"filename":"%s","level":"%s", }`, fullfilename, level))
+		loger.SetLogger(logs.AdapterMultiFile, fmt.Sprintf(`{"filename":"%s","level":%d}`, fullfilename, level))
 	case "smtp":
 		loger.SetLogger(logs.AdapterMail, fmt.Sprintf(`{"username":"%s","password":"%s","host":"%s","subject":"%s","sendTos":"%s","level":"%d"}`, config["username"], config["password"], config["host"], config["subject"], config["sendTos"], level))
 	case "conn":
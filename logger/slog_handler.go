@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// SlogHandler is a slog.Handler which writes records to a Log as "message key=value ..." lines.
+// Attributes keep their order, the keys of groups are prefixed with the group name.
+// Debug records are written as info with level=debug, because they only reach the handler when debug logging
+// is switched on for them, e.g. by a signalr.DebugFilter, and the level of the IAC logger would drop them.
+type SlogHandler struct {
+	log    Log
+	attrs  string
+	prefix string
+}
+
+// NewSlogHandler creates a SlogHandler which writes to log
+func NewSlogHandler(log Log) *SlogHandler {
+	return &SlogHandler{log: log}
+}
+
+// Enabled returns true, the level is filtered by the IAC logger
+func (h *SlogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *SlogHandler) Handle(_ context.Context, record slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(record.Message)
+	if record.Level < slog.LevelInfo {
+		sb.WriteString(" level=debug")
+	}
+	sb.WriteString(h.attrs)
+	record.Attrs(func(a slog.Attr) bool {
+		appendAttr(&sb, h.prefix, a)
+		return true
+	})
+	line := strings.TrimSpace(sb.String())
+	switch {
+	case record.Level >= slog.LevelError:
+		h.log.Error(line)
+	case record.Level >= slog.LevelWarn:
+		h.log.Warn(line)
+	default:
+		h.log.Info(line)
+	}
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var sb strings.Builder
+	sb.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&sb, h.prefix, a)
+	}
+	return &SlogHandler{log: h.log, attrs: sb.String(), prefix: h.prefix}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{log: h.log, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+func appendAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(sb, prefix, ga)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+		value = strconv.Quote(value)
+	}
+	sb.WriteString(" ")
+	sb.WriteString(prefix + a.Key)
+	sb.WriteString("=")
+	sb.WriteString(value)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-kit/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// ordersReceiver receives the messages of the orders topic with the headers they were sent with
+type ordersReceiver struct {
+	signalr.Receiver
+	messages chan string
+	headers  chan map[string]string
+}
+
+func newOrdersReceiver() *ordersReceiver {
+	return &ordersReceiver{messages: make(chan string, 10), headers: make(chan map[string]string, 10)}
+}
+
+func (r *ordersReceiver) Orders(ctx context.Context, message string) {
+	r.headers <- signalr.HeadersFromContext(ctx)
+	r.messages <- message
+}
+
+var _ = Describe("IACMessageBus", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var httpServer *httptest.Server
+	var hub *IACMessageBus
+
+	BeforeEach(func() {
+		hub = newTestHub()
+	})
+
+	JustBeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		server, err := signalr.NewServer(ctx, signalr.HubFactory(hub.newInstance),
+			signalr.Logger(log.NewNopLogger(), false))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), IACMessageBusName)
+		httpServer = httptest.NewServer(router)
+	})
+
+	AfterEach(func() {
+		cancel()
+		httpServer.Close()
+	})
+
+	connect := func(receiver interface{}) signalr.Client {
+		client, err := signalr.NewClient(ctx,
+			signalr.WithConnector(func() (signalr.Connection, error) {
+				return signalr.NewHTTPConnection(ctx, httpServer.URL+IACMessageBusName)
+			}),
+			signalr.WithReceiver(receiver),
+			signalr.Logger(log.NewNopLogger(), false))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		return client
+	}
+
+	subscribers := func() []string {
+		return hub.topics.Subscribers("orders")
+	}
+
+	It("should send the headers of the sender to the subscribers", func() {
+		receiver := newOrdersReceiver()
+		subscriber := connect(receiver)
+		Expect((<-subscriber.Invoke("Subscribe", "orders", "subscriber")).Error).NotTo(HaveOccurred())
+
+		sender := connect(&signalr.Receiver{})
+		sendCtx := signalr.ContextWithHeaders(ctx, map[string]string{"correlation-id": "42"})
+		Expect((<-sender.InvokeContext(sendCtx, "Send", "orders", "new", "sender")).Error).NotTo(HaveOccurred())
+		Eventually(receiver.headers).Should(Receive(HaveKeyWithValue("correlation-id", "42")))
+	})
+
+	It("should send the messages of Send and AddMessage only to the subscribers", func() {
+		subscribed := newOrdersReceiver()
+		subscriber := connect(subscribed)
+		Expect((<-subscriber.Invoke("Subscribe", "orders", "subscriber")).Error).NotTo(HaveOccurred())
+		unsubscribed := newOrdersReceiver()
+		connect(unsubscribed)
+
+		sender := connect(&signalr.Receiver{})
+		Expect((<-sender.Invoke("Send", "orders", "sent", "sender")).Error).NotTo(HaveOccurred())
+		Expect((<-sender.Invoke("AddMessage", "added", "orders", "sender")).Error).NotTo(HaveOccurred())
+		Eventually(subscribed.messages).Should(Receive(Equal("sent")))
+		Eventually(subscribed.messages).Should(Receive(Equal("added")))
+		Consistently(unsubscribed.messages, 200*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should remove the subscriptions of a connection when it disconnects", func() {
+		subscriber := connect(newOrdersReceiver())
+		Expect((<-subscriber.Invoke("Subscribe", "orders", "subscriber")).Error).NotTo(HaveOccurred())
+		Expect(subscribers()).To(HaveLen(1))
+		subscriber.Stop()
+		Eventually(subscribers).Should(BeEmpty())
+	})
+
+	Context("in broadcast mode", func() {
+		BeforeEach(func() {
+			hub.broadcast = true
+		})
+
+		It("should send the messages of Send and AddMessage to all connections", func() {
+			receiver := newOrdersReceiver()
+			connect(receiver)
+			Expect(subscribers()).To(BeEmpty())
+
+			sender := connect(&signalr.Receiver{})
+			Expect((<-sender.Invoke("Send", "orders", "sent", "sender")).Error).NotTo(HaveOccurred())
+			Expect((<-sender.Invoke("AddMessage", "added", "orders", "sender")).Error).NotTo(HaveOccurred())
+			Eventually(receiver.messages).Should(Receive(Equal("sent")))
+			Eventually(receiver.messages).Should(Receive(Equal("added")))
+		})
+	})
+})
@@ -0,0 +1,156 @@
+// Package metrics provides a Prometheus implementation of signalr.Metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// Namespace prefixes the names of all metrics
+const Namespace = "iac_signalr"
+
+// unknownMethod is the method label of invocations of methods the hub doesn't have.
+// The names of these are not used as label, because any client could create unlimited label values with them.
+const unknownMethod = "(unknown)"
+
+// Prometheus is a signalr.Metrics which keeps the measurements in Prometheus collectors
+type Prometheus struct {
+	registry            *prometheus.Registry
+	connections         *prometheus.GaugeVec
+	disconnects         *prometheus.CounterVec
+	handshakeFailures   *prometheus.CounterVec
+	invocations         *prometheus.CounterVec
+	invocationDuration  *prometheus.HistogramVec
+	receivedBytes       *prometheus.CounterVec
+	sentBytes           *prometheus.CounterVec
+	broadcastRecipients *prometheus.HistogramVec
+	groups              prometheus.Gauge
+	groupMembers        prometheus.Gauge
+}
+
+// NewPrometheus creates the collectors and registers them, together with the Go runtime and process
+// collectors, in a new registry which is served by Handler.
+func NewPrometheus() *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "connections",
+			Help:      "Number of open hub connections.",
+		}, []string{"transport", "protocol"}),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "disconnects_total",
+			Help:      "Number of closed hub connections by reason (closed, timeout, ping, server, protocol, error).",
+		}, []string{"transport", "protocol", "reason"}),
+		handshakeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "handshake_failures_total",
+			Help:      "Number of connections which failed before the hub protocol handshake was completed.",
+		}, []string{"transport", "reason"}),
+		invocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "invocations_total",
+			Help:      "Number of hub method invocations by outcome (ok, error).",
+		}, []string{"method", "outcome"}),
+		invocationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "invocation_duration_seconds",
+			Help:      "Duration of hub method invocations.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10), // 0.5ms to ~2min
+		}, []string{"method"}),
+		receivedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "received_bytes_total",
+			Help:      "Bytes received on hub connections.",
+		}, []string{"transport"}),
+		sentBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "sent_bytes_total",
+			Help:      "Bytes sent on hub connections.",
+		}, []string{"transport"}),
+		broadcastRecipients: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "broadcast_recipients",
+			Help:      "Number of connections a message sent to all clients, a group or a client is fanned out to.",
+			Buckets:   []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+		}, []string{"kind"}),
+		groups: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "groups",
+			Help:      "Number of groups with at least one member.",
+		}),
+		groupMembers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "group_members",
+			Help:      "Number of group memberships over all groups.",
+		}),
+	}
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.connections, p.disconnects, p.handshakeFailures,
+		p.invocations, p.invocationDuration,
+		p.receivedBytes, p.sentBytes,
+		p.broadcastRecipients, p.groups, p.groupMembers,
+	)
+	return p
+}
+
+// Registry returns the registry of the collectors, to register additional collectors
+func (p *Prometheus) Registry() *prometheus.Registry {
+	return p.registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) ConnectionOpened(transport string, protocol string) {
+	p.connections.WithLabelValues(transport, protocol).Inc()
+}
+
+func (p *Prometheus) ConnectionClosed(transport string, protocol string, reason string) {
+	p.connections.WithLabelValues(transport, protocol).Dec()
+	p.disconnects.WithLabelValues(transport, protocol, reason).Inc()
+}
+
+func (p *Prometheus) HandshakeFailed(transport string, reason string) {
+	p.handshakeFailures.WithLabelValues(transport, reason).Inc()
+}
+
+func (p *Prometheus) InvocationDone(method string, duration time.Duration, err error) {
+	if method == "" {
+		method = unknownMethod
+	}
+	outcome := signalr.AuditOK
+	if err != nil {
+		outcome = signalr.AuditError
+	}
+	p.invocations.WithLabelValues(method, outcome).Inc()
+	p.invocationDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) BytesReceived(transport string, n int) {
+	p.receivedBytes.WithLabelValues(transport).Add(float64(n))
+}
+
+func (p *Prometheus) BytesSent(transport string, n int) {
+	p.sentBytes.WithLabelValues(transport).Add(float64(n))
+}
+
+func (p *Prometheus) Broadcast(kind string, recipients int) {
+	p.broadcastRecipients.WithLabelValues(kind).Observe(float64(recipients))
+}
+
+func (p *Prometheus) GroupsChanged(groups int, members int) {
+	p.groups.Set(float64(groups))
+	p.groupMembers.Set(float64(members))
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+type testHub struct {
+	signalr.Hub
+}
+
+func (t *testHub) Add2(i int) int {
+	return i + 2
+}
+
+func scrape(url string) string {
+	resp, err := http.Get(url)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	body, err := io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+	return string(body)
+}
+
+var _ = Describe("Prometheus", func() {
+	It("should serve the measurements of a server", func(done Done) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		metrics := NewPrometheus()
+		server, err := signalr.NewServer(ctx, signalr.SimpleHubFactory(&testHub{}), signalr.WithMetrics(metrics),
+			signalr.HTTPTransports(signalr.TransportWebSockets))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), "/hub")
+		router.Handle("/metrics", metrics.Handler())
+		testServer := httptest.NewServer(router)
+		defer testServer.Close()
+
+		conn, err := signalr.NewHTTPConnection(ctx, testServer.URL+"/hub")
+		Expect(err).NotTo(HaveOccurred())
+		client, err := signalr.NewClient(ctx, signalr.WithConnection(conn))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		result := <-client.Invoke("add2", 1)
+		Expect(result.Error).NotTo(HaveOccurred())
+		result = <-client.Invoke("missing")
+		Expect(result.Error).To(HaveOccurred())
+
+		body := scrape(testServer.URL + "/metrics")
+		Expect(body).To(ContainSubstring(`iac_signalr_connections{protocol="json",transport="WebSockets"} 1`))
+		Expect(body).To(ContainSubstring(`iac_signalr_invocations_total{method="add2",outcome="ok"} 1`))
+		Expect(body).To(ContainSubstring(`iac_signalr_invocations_total{method="(unknown)",outcome="error"} 1`))
+		Expect(body).To(ContainSubstring(`iac_signalr_invocation_duration_seconds_count{method="add2"} 1`))
+		Expect(body).To(MatchRegexp(`iac_signalr_received_bytes_total{transport="WebSockets"} [1-9]`))
+		Expect(body).To(MatchRegexp(`iac_signalr_sent_bytes_total{transport="WebSockets"} [1-9]`))
+
+		client.Stop()
+		Eventually(func() string { return scrape(testServer.URL + "/metrics") }).Should(
+			ContainSubstring(`iac_signalr_disconnects_total{protocol="json",reason="closed",transport="WebSockets"} 1`))
+		close(done)
+	}, 5.0)
+
+	It("should count handshake failures", func() {
+		metrics := NewPrometheus()
+		metrics.HandshakeFailed("WebSockets", signalr.HandshakeFailureUpgrade)
+		testServer := httptest.NewServer(metrics.Handler())
+		defer testServer.Close()
+		Expect(scrape(testServer.URL)).To(ContainSubstring(`iac_signalr_handshake_failures_total{reason="upgrade",transport="WebSockets"} 1`))
+	})
+})
@@ -14,13 +14,6 @@ var silentPaths = map[string]bool{
 	"/status": true,
 }
 
-func EnableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "http://127.0.0.1:8080")
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-requested-with")
-	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
-}
-
 // LogRequests writes simple request logs to STDOUT.
 // Successful (2xx) requests to health-check paths (/, /health, /status) are
 // suppressed to avoid flooding logs with heartbeat noise.
@@ -29,7 +22,6 @@ func LogRequests(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		wrappedWriter := wrapResponseWriter(w)
 		start := time.Now()
-		EnableCors(&w)
 		h.ServeHTTP(wrappedWriter, r)
 
 		status := wrappedWriter.status
@@ -0,0 +1,284 @@
+// Package mqttbridge connects the message bus to an MQTT broker. Inbound rules subscribe to MQTT topic filters and
+// republish the messages to bus topics, outbound rules forward the messages of bus topics to MQTT. Both rewrite
+// the topics with the wildcards of their filter, see topic.Rewrite.
+package mqttbridge
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+// DefaultQueueSize is the number of outbound messages waiting to be published, if no QueueSize is given
+const DefaultQueueSize = 1000
+
+// DefaultPublishTimeout is the time to wait for the broker to accept an outbound message, if no PublishTimeout is given
+const DefaultPublishTimeout = 10 * time.Second
+
+// Rule maps the topics matching Filter to Topic
+type Rule struct {
+	// Filter is an MQTT topic filter for inbound rules and a bus topic filter for outbound rules
+	Filter string
+	// Topic is the template of the target topic, with {1}, {2}... for the levels matched by the wildcards of Filter.
+	// The topic is kept if it is empty.
+	Topic string
+	// QoS is the quality of service of the subscription for inbound rules and of the published messages for
+	// outbound rules. The bus itself delivers messages at most once to the connected clients.
+	QoS byte
+	// Retain publishes the outbound messages as retained messages of the broker
+	Retain bool
+}
+
+// rewrite returns the target topic of the rule for the topic, and false if the rule does not match
+func (r Rule) rewrite(topicName string) (string, bool) {
+	return topic.Rewrite(r.Filter, r.Topic, topicName)
+}
+
+// Options configure a Bridge
+type Options struct {
+	// Broker is the URL of the broker, like tcp://broker:1883, ssl://broker:8883 or ws://broker/mqtt
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	TLS      *tls.Config
+	// CleanSession discards the session of the client at the broker on connect. Without it, the broker keeps the
+	// subscriptions and QoS 1 and 2 messages while the bridge is disconnected.
+	CleanSession bool
+	KeepAlive    time.Duration
+	// MaxReconnectInterval is the longest wait between reconnect attempts
+	MaxReconnectInterval time.Duration
+	Inbound              []Rule
+	Outbound             []Rule
+	// QueueSize is the number of outbound messages waiting to be published, further messages are dropped
+	QueueSize int
+	// PublishTimeout is the time to wait for the broker to accept an outbound message
+	PublishTimeout time.Duration
+	// Publish sends an inbound message to the bus. retained reports whether the broker sent it as retained message.
+	Publish func(topic string, payload string, retained bool) error
+	// Logf logs connection changes and failed messages
+	Logf func(format string, args ...interface{})
+}
+
+// Bridge is the connection to the broker. It is safe for concurrent use.
+type Bridge struct {
+	options Options
+	client  mqtt.Client
+	queue   chan outbound
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mx      sync.Mutex
+	status  Status
+}
+
+// outbound is a message waiting to be published to the broker
+type outbound struct {
+	topic   string
+	payload string
+	rule    Rule
+}
+
+// Status is the state of the bridge
+type Status struct {
+	Broker    string    `json:"broker"`
+	Connected bool      `json:"connected"`
+	Since     time.Time `json:"since"` // of the last connect or disconnect
+	LastError string    `json:"lastError,omitempty"`
+	Inbound   uint64    `json:"inbound"`  // messages received from the broker
+	Outbound  uint64    `json:"outbound"` // messages published to the broker
+	Dropped   uint64    `json:"dropped"`  // outbound messages dropped because the queue was full
+	Failed    uint64    `json:"failed"`   // messages which could not be passed on
+}
+
+// New checks the rules and creates the Bridge. It does not connect before Start.
+func New(options Options) (*Bridge, error) {
+	if options.Broker == "" {
+		return nil, errors.New("mqtt bridge has no broker")
+	}
+	for _, rules := range [][]Rule{options.Inbound, options.Outbound} {
+		for _, rule := range rules {
+			if err := topic.ValidateRewrite(rule.Filter, rule.Topic); err != nil {
+				return nil, err
+			}
+			if rule.QoS > 2 {
+				return nil, fmt.Errorf("rule %s: qos %d is not 0, 1 or 2", rule.Filter, rule.QoS)
+			}
+		}
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.PublishTimeout <= 0 {
+		options.PublishTimeout = DefaultPublishTimeout
+	}
+	if options.Logf == nil {
+		options.Logf = func(string, ...interface{}) {}
+	}
+	b := &Bridge{
+		options: options,
+		queue:   make(chan outbound, options.QueueSize),
+		done:    make(chan struct{}),
+		status:  Status{Broker: options.Broker},
+	}
+	clientOptions := mqtt.NewClientOptions().
+		AddBroker(options.Broker).
+		SetClientID(options.ClientID).
+		SetUsername(options.Username).
+		SetPassword(options.Password).
+		SetCleanSession(options.CleanSession).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetAutoAckDisabled(true).
+		SetOrderMatters(false).
+		SetDefaultPublishHandler(b.receive).
+		SetOnConnectHandler(b.connected).
+		SetConnectionLostHandler(b.lost)
+	if options.TLS != nil {
+		clientOptions.SetTLSConfig(options.TLS)
+	}
+	if options.KeepAlive > 0 {
+		clientOptions.SetKeepAlive(options.KeepAlive)
+	}
+	if options.MaxReconnectInterval > 0 {
+		clientOptions.SetMaxReconnectInterval(options.MaxReconnectInterval)
+		clientOptions.SetConnectRetryInterval(options.MaxReconnectInterval)
+	}
+	b.client = mqtt.NewClient(clientOptions)
+	return b, nil
+}
+
+// Start connects to the broker and starts publishing the outbound messages. It does not wait for the connection,
+// the bridge keeps trying to connect and reconnects when the connection is lost.
+func (b *Bridge) Start() {
+	b.client.Connect()
+	b.wg.Add(1)
+	go b.publish()
+}
+
+// connected subscribes the inbound rules, on every connect as a clean session forgets the subscriptions
+func (b *Bridge) connected(client mqtt.Client) {
+	b.setConnected(true, nil)
+	b.options.Logf("MQTT bridge connected to %s", b.options.Broker)
+	if len(b.options.Inbound) == 0 {
+		return
+	}
+	filters := make(map[string]byte, len(b.options.Inbound))
+	for _, rule := range b.options.Inbound {
+		if qos, ok := filters[rule.Filter]; !ok || rule.QoS > qos {
+			filters[rule.Filter] = rule.QoS
+		}
+	}
+	go func() {
+		token := client.SubscribeMultiple(filters, nil)
+		if token.WaitTimeout(b.options.PublishTimeout) && token.Error() != nil {
+			b.options.Logf("MQTT bridge failed to subscribe to %v: %v", filters, token.Error())
+		}
+	}()
+}
+
+func (b *Bridge) lost(_ mqtt.Client, err error) {
+	b.setConnected(false, err)
+	b.options.Logf("MQTT bridge lost the connection to %s, reconnecting: %v", b.options.Broker, err)
+}
+
+func (b *Bridge) setConnected(connected bool, err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.status.Connected = connected
+	b.status.Since = time.Now().UTC()
+	if err != nil {
+		b.status.LastError = err.Error()
+	}
+}
+
+func (b *Bridge) count(counter *uint64) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	*counter++
+}
+
+// receive republishes a message of the broker to the bus with the first inbound rule which matches its topic.
+// The message is acknowledged to the broker after it has been passed to the bus, or was rejected by it.
+func (b *Bridge) receive(_ mqtt.Client, message mqtt.Message) {
+	defer message.Ack()
+	b.count(&b.status.Inbound)
+	for _, rule := range b.options.Inbound {
+		busTopic, ok := rule.rewrite(message.Topic())
+		if !ok {
+			continue
+		}
+		if err := b.options.Publish(busTopic, string(message.Payload()), message.Retained()); err != nil {
+			b.count(&b.status.Failed)
+			b.options.Logf("MQTT bridge failed to publish %s as %s: %v", message.Topic(), busTopic, err)
+		}
+		return
+	}
+}
+
+// Forward queues the message of a bus topic for the broker, with the first outbound rule which matches the topic.
+// A nil *Bridge forwards nothing.
+func (b *Bridge) Forward(topicName string, payload string) {
+	if b == nil {
+		return
+	}
+	for _, rule := range b.options.Outbound {
+		mqttTopic, ok := rule.rewrite(topicName)
+		if !ok {
+			continue
+		}
+		select {
+		case b.queue <- outbound{topic: mqttTopic, payload: payload, rule: rule}:
+		default:
+			b.count(&b.status.Dropped)
+			b.options.Logf("MQTT bridge dropped a message of %s, the queue is full", topicName)
+		}
+		return
+	}
+}
+
+// publish sends the queued outbound messages to the broker until the bridge is closed. While reconnecting,
+// QoS 1 and 2 messages are stored by the client and sent after the reconnect, QoS 0 messages are lost.
+func (b *Bridge) publish() {
+	defer b.wg.Done()
+	for {
+		select {
+		case message := <-b.queue:
+			token := b.client.Publish(message.topic, message.rule.QoS, message.rule.Retain, message.payload)
+			if !token.WaitTimeout(b.options.PublishTimeout) {
+				// the client keeps QoS 1 and 2 messages and sends them once the connection is back
+				b.count(&b.status.Outbound)
+				continue
+			}
+			if err := token.Error(); err != nil {
+				b.count(&b.status.Failed)
+				b.options.Logf("MQTT bridge failed to publish %s: %v", message.topic, err)
+				continue
+			}
+			b.count(&b.status.Outbound)
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Status returns the state of the bridge
+func (b *Bridge) Status() Status {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.status
+}
+
+// Close stops publishing and disconnects from the broker. Queued outbound messages are not published.
+func (b *Bridge) Close() {
+	if b == nil {
+		return
+	}
+	close(b.done)
+	b.wg.Wait()
+	b.client.Disconnect(250)
+}
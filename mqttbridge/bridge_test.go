@@ -0,0 +1,188 @@
+package mqttbridge
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// busMessage is a message the bridge published to the bus or to the broker
+type busMessage struct {
+	topic    string
+	payload  string
+	retained bool
+	qos      byte
+}
+
+// startBroker runs an in-process broker on the address, with an inline client to publish and subscribe
+func startBroker(address string) *mqtt.Server {
+	broker := mqtt.New(&mqtt.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	Expect(broker.AddHook(new(auth.AllowHook), nil)).To(Succeed())
+	Expect(broker.AddListener(listeners.NewTCP(listeners.Config{Type: "tcp", ID: "tcp", Address: address}))).To(Succeed())
+	go func() {
+		_ = broker.Serve()
+	}()
+	return broker
+}
+
+func freeAddress() string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer l.Close()
+	return l.Addr().String()
+}
+
+var _ = Describe("Bridge", func() {
+	var address string
+	var broker *mqtt.Server
+	var bridge *Bridge
+	var bus chan busMessage
+	var publishErr error
+
+	start := func(options Options) {
+		options.Broker = "tcp://" + address
+		options.ClientID = "iac-signalr-test"
+		options.MaxReconnectInterval = 100 * time.Millisecond
+		out, failure := bus, publishErr
+		options.Publish = func(topic string, payload string, retained bool) error {
+			out <- busMessage{topic: topic, payload: payload, retained: retained}
+			return failure
+		}
+		var err error
+		bridge, err = New(options)
+		Expect(err).NotTo(HaveOccurred())
+		bridge.Start()
+		Eventually(func() bool { return bridge.Status().Connected }, time.Second).Should(BeTrue())
+	}
+
+	// subscribed waits until the broker has the subscriptions of the bridge
+	subscribed := func(filter string) {
+		Eventually(func() bool {
+			client, ok := broker.Clients.Get("iac-signalr-test")
+			if !ok {
+				return false
+			}
+			_, ok = client.State.Subscriptions.Get(filter)
+			return ok
+		}, time.Second).Should(BeTrue())
+	}
+
+	BeforeEach(func() {
+		address = freeAddress()
+		broker = startBroker(address)
+		bus = make(chan busMessage, 10)
+		publishErr = nil
+		bridge = nil
+	})
+
+	AfterEach(func() {
+		bridge.Close()
+		_ = broker.Close()
+	})
+
+	Context("inbound", func() {
+		It("should republish the messages of the filters to the rewritten bus topics", func() {
+			start(Options{Inbound: []Rule{
+				{Filter: "factory/+/temp", Topic: "plant1/{1}/temperature", QoS: 1},
+				{Filter: "factory/#"},
+			}})
+			subscribed("factory/+/temp")
+			Expect(broker.Publish("factory/line3/temp", []byte("21.5"), false, 1)).To(Succeed())
+			Eventually(bus).Should(Receive(Equal(busMessage{topic: "plant1/line3/temperature", payload: "21.5"})))
+			Expect(broker.Publish("factory/line3/state", []byte("running"), false, 0)).To(Succeed())
+			Eventually(bus).Should(Receive(Equal(busMessage{topic: "factory/line3/state", payload: "running"})))
+			Expect(broker.Publish("office/printer", []byte("jam"), false, 0)).To(Succeed())
+			Consistently(bus, 100*time.Millisecond).ShouldNot(Receive())
+			Expect(bridge.Status().Inbound).To(BeEquivalentTo(2))
+		})
+
+		It("should pass on the retained messages of the broker as retained", func() {
+			Expect(broker.Publish("factory/line3/state", []byte("running"), true, 0)).To(Succeed())
+			start(Options{Inbound: []Rule{{Filter: "factory/#", Topic: "plant1/{1}"}}})
+			Eventually(bus).Should(Receive(Equal(busMessage{topic: "plant1/line3/state", payload: "running", retained: true})))
+		})
+
+		It("should count the messages the bus rejects", func() {
+			publishErr = errors.New("invalid topic")
+			start(Options{Inbound: []Rule{{Filter: "factory/#", QoS: 1}}})
+			subscribed("factory/#")
+			Expect(broker.Publish("factory/line3/state", []byte("running"), false, 1)).To(Succeed())
+			Eventually(bus).Should(Receive())
+			Eventually(func() uint64 { return bridge.Status().Failed }).Should(BeEquivalentTo(1))
+		})
+	})
+
+	Context("outbound", func() {
+		var received chan busMessage
+
+		BeforeEach(func() {
+			received = make(chan busMessage, 10)
+			Expect(broker.Subscribe("devices/#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+				received <- busMessage{topic: pk.TopicName, payload: string(pk.Payload), retained: pk.FixedHeader.Retain, qos: pk.FixedHeader.Qos}
+			})).To(Succeed())
+		})
+
+		It("should forward the messages of the bus topics to the rewritten MQTT topics", func() {
+			start(Options{Outbound: []Rule{
+				{Filter: "plant1/+/setpoint", Topic: "devices/{1}/set", QoS: 1, Retain: true},
+				{Filter: "plant1/+/command", Topic: "devices/{1}/cmd"},
+			}})
+			bridge.Forward("plant1/line3/setpoint", "22")
+			Eventually(received).Should(Receive(Equal(busMessage{topic: "devices/line3/set", payload: "22", retained: true, qos: 1})))
+			bridge.Forward("plant1/line3/command", "stop")
+			Eventually(received).Should(Receive(Equal(busMessage{topic: "devices/line3/cmd", payload: "stop"})))
+			bridge.Forward("plant2/line3/command", "stop")
+			Consistently(received, 100*time.Millisecond).ShouldNot(Receive())
+			Eventually(func() uint64 { return bridge.Status().Outbound }).Should(BeEquivalentTo(2))
+		})
+
+		It("should do nothing without bridge", func() {
+			var none *Bridge
+			none.Forward("plant1/line3/command", "stop")
+			none.Close()
+		})
+	})
+
+	Context("reconnect", func() {
+		It("should reconnect and subscribe again after the broker restarted", func() {
+			start(Options{
+				Inbound:  []Rule{{Filter: "factory/#", Topic: "plant1/{1}", QoS: 1}},
+				Outbound: []Rule{{Filter: "plant1/+/command", Topic: "devices/{1}/cmd", QoS: 1}},
+			})
+			subscribed("factory/#")
+			Expect(broker.Close()).To(Succeed())
+			Eventually(func() bool { return bridge.Status().Connected }, time.Second).Should(BeFalse())
+			Expect(bridge.Status().LastError).NotTo(BeEmpty())
+
+			broker = startBroker(address)
+			received := make(chan busMessage, 10)
+			Expect(broker.Subscribe("devices/#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+				received <- busMessage{topic: pk.TopicName, payload: string(pk.Payload), qos: pk.FixedHeader.Qos}
+			})).To(Succeed())
+			Eventually(func() bool { return bridge.Status().Connected }, 5*time.Second).Should(BeTrue())
+			subscribed("factory/#")
+			Expect(broker.Publish("factory/line3/state", []byte("running"), false, 1)).To(Succeed())
+			Eventually(bus).Should(Receive(Equal(busMessage{topic: "plant1/line3/state", payload: "running"})))
+			bridge.Forward("plant1/line3/command", "stop")
+			Eventually(received).Should(Receive(Equal(busMessage{topic: "devices/line3/cmd", payload: "stop", qos: 1})))
+		})
+	})
+
+	It("should reject invalid rules", func() {
+		_, err := New(Options{Broker: "tcp://localhost:1883", Inbound: []Rule{{Filter: "factory/+", Topic: "plant1/{2}"}}})
+		Expect(err).To(HaveOccurred())
+		_, err = New(Options{Broker: "tcp://localhost:1883", Outbound: []Rule{{Filter: "plant1/#", QoS: 3}}})
+		Expect(err).To(MatchError("rule plant1/#: qos 3 is not 0, 1 or 2"))
+		_, err = New(Options{})
+		Expect(err).To(HaveOccurred())
+	})
+})
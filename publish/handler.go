@@ -0,0 +1,238 @@
+// Package publish provides an HTTP API for producers without a SignalR client, like batch jobs, gateways and
+// scripts, to publish messages to the clients of the message bus.
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The targets of a Message
+const (
+	TargetSubscribers = "subscribers" // the subscribers of the topic, like IACMessageBus.Send
+	TargetUI          = "ui"          // the UI clients, like IACMessageBus.SendToUI
+	TargetGroup       = "group"       // the connections in Message.Group
+	TargetUser        = "user"        // the connections of Message.User
+	TargetConnection  = "connection"  // the connection Message.ConnectionID
+)
+
+// SenderHeader names the producer, which is passed as sender like the connectionID argument of the hub methods
+const SenderHeader = "X-Sender"
+
+// DefaultSender is the sender of requests without SenderHeader
+const DefaultSender = "http"
+
+// DefaultMaxBodySize limits the request body, if no MaxBodySize is given
+const DefaultMaxBodySize = 1 << 20
+
+// DefaultMaxBatch limits the number of messages per request, if no MaxBatch is given
+const DefaultMaxBatch = 1000
+
+// Message is one message of a publish request. The body of a request is a Message or an array of them.
+type Message struct {
+	// Topic defaults to the topic in the path
+	Topic string `json:"topic,omitempty"`
+	// Message is sent as it is if it is a JSON string, other JSON values are sent as their JSON text
+	Message json.RawMessage `json:"message"`
+	// Target defaults to TargetSubscribers
+	Target       string `json:"target,omitempty"`
+	Group        string `json:"group,omitempty"`
+	User         string `json:"user,omitempty"`
+	ConnectionID string `json:"connectionId,omitempty"`
+	// Retain keeps the message as last value of the topic, like the retain header of IACMessageBus.Send
+	Retain bool `json:"retain,omitempty"`
+	// Payload is Message as it is sent to the clients
+	Payload string `json:"-"`
+}
+
+// Publisher sends the messages to the clients
+type Publisher interface {
+	// Publish sends the message to its target. An error rejects the message.
+	Publish(message Message, sender string) error
+}
+
+// Result is the status of one message of a request
+type Result struct {
+	Index    int    `json:"index"`
+	Topic    string `json:"topic"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Response is the body of the response to a request, with the results in the order of the messages
+type Response struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Results  []Result `json:"results"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Options configure the handler
+type Options struct {
+	MaxBodySize int64
+	MaxBatch    int
+}
+
+// NewHandler returns the handler of
+//
+//	POST {prefix}/{topic}    publish the messages of the body to the topic, unless they name their own topic
+//	POST {prefix}            publish the messages of the body, which name their topic
+//
+// The topic in the path may contain slashes. The response is 200 if all messages were accepted, 207 if some
+// and 422 if none, with a Response body. A body which is not a Message or an array of them is rejected with 400.
+func NewHandler(prefix string, publisher Publisher, options Options) http.Handler {
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultMaxBodySize
+	}
+	if options.MaxBatch <= 0 {
+		options.MaxBatch = DefaultMaxBatch
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		pathTopic, err := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(path, prefix), "/"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		messages, err := readMessages(http.MaxBytesReader(w, r.Body, options.MaxBodySize))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(messages) > options.MaxBatch {
+			writeError(w, http.StatusRequestEntityTooLarge,
+				fmt.Errorf("%d messages exceed the maximum of %d messages", len(messages), options.MaxBatch))
+			return
+		}
+		sender := r.Header.Get(SenderHeader)
+		if sender == "" {
+			sender = DefaultSender
+		}
+		response := Response{Results: make([]Result, 0, len(messages))}
+		for i, message := range messages {
+			if message.Topic == "" {
+				message.Topic = pathTopic
+			}
+			result := Result{Index: i, Topic: message.Topic}
+			err := prepare(&message)
+			if err == nil {
+				err = publisher.Publish(message, sender)
+			}
+			if err != nil {
+				result.Error = err.Error()
+				response.Rejected++
+			} else {
+				result.Accepted = true
+				response.Accepted++
+			}
+			response.Results = append(response.Results, result)
+		}
+		status := http.StatusOK
+		switch {
+		case response.Accepted == 0:
+			status = http.StatusUnprocessableEntity
+		case response.Rejected > 0:
+			status = http.StatusMultiStatus
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+// readMessages decodes a Message or an array of them
+func readMessages(body io.Reader) ([]Message, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("body is empty")
+	}
+	var messages []Message
+	if data[0] == '[' {
+		err = json.Unmarshal(data, &messages)
+	} else {
+		var message Message
+		err = json.Unmarshal(data, &message)
+		messages = []Message{message}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("no messages")
+	}
+	return messages, nil
+}
+
+// prepare checks the topic and the target of the message and sets its Payload
+func prepare(message *Message) error {
+	if message.Topic == "" {
+		return errors.New("topic is empty")
+	}
+	raw := bytes.TrimSpace(message.Message)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return errors.New("message is missing")
+	}
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &message.Payload); err != nil {
+			return err
+		}
+	} else {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return err
+		}
+		message.Payload = compact.String()
+	}
+	if message.Target == "" {
+		message.Target = TargetSubscribers
+	}
+	switch message.Target {
+	case TargetSubscribers, TargetUI:
+	case TargetGroup:
+		if message.Group == "" {
+			return errors.New("group is empty")
+		}
+	case TargetUser:
+		if message.User == "" {
+			return errors.New("user is empty")
+		}
+	case TargetConnection:
+		if message.ConnectionID == "" {
+			return errors.New("connectionId is empty")
+		}
+	default:
+		return fmt.Errorf("unknown target %q", message.Target)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
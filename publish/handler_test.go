@@ -0,0 +1,124 @@
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testPublisher records the published messages and rejects the topic "rejected"
+type testPublisher struct {
+	messages []Message
+	senders  []string
+}
+
+func (p *testPublisher) Publish(message Message, sender string) error {
+	if message.Topic == "rejected" {
+		return errors.New("rejected by publisher")
+	}
+	p.messages = append(p.messages, message)
+	p.senders = append(p.senders, sender)
+	return nil
+}
+
+var _ = Describe("Handler", func() {
+	var publisher *testPublisher
+	var handler http.Handler
+
+	BeforeEach(func() {
+		publisher = &testPublisher{}
+		handler = NewHandler("/api/publish/", publisher, Options{MaxBatch: 3})
+	})
+
+	post := func(path string, body string, response interface{}) int {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if response != nil {
+			Expect(json.Unmarshal(recorder.Body.Bytes(), response)).To(Succeed())
+		}
+		return recorder.Code
+	}
+
+	It("should publish a single message to the topic of the path", func() {
+		var response Response
+		Expect(post("/api/publish/plant1/line3/status", `{"message":"running"}`, &response)).To(Equal(http.StatusOK))
+		Expect(response).To(Equal(Response{Accepted: 1, Results: []Result{{Index: 0, Topic: "plant1/line3/status", Accepted: true}}}))
+		Expect(publisher.messages).To(HaveLen(1))
+		Expect(publisher.messages[0].Payload).To(Equal("running"))
+		Expect(publisher.messages[0].Target).To(Equal(TargetSubscribers))
+		Expect(publisher.senders).To(Equal([]string{DefaultSender}))
+	})
+
+	It("should pass JSON values other than strings as their JSON text", func() {
+		Expect(post("/api/publish/orders", `{"message": {"id": 42, "items": [1, 2]}}`, nil)).To(Equal(http.StatusOK))
+		Expect(publisher.messages[0].Payload).To(Equal(`{"id":42,"items":[1,2]}`))
+	})
+
+	It("should decode escaped slashes in the topic of the path", func() {
+		Expect(post("/api/publish/plant1%2Fline3", `{"message":"x"}`, nil)).To(Equal(http.StatusOK))
+		Expect(publisher.messages[0].Topic).To(Equal("plant1/line3"))
+	})
+
+	It("should publish batches with the status of every message", func() {
+		var response Response
+		body := `[
+			{"message": "a"},
+			{"topic": "other", "message": "b", "target": "group", "group": "operators"},
+			{"topic": "rejected", "message": "c"}
+		]`
+		Expect(post("/api/publish/plant1", body, &response)).To(Equal(http.StatusMultiStatus))
+		Expect(response.Accepted).To(Equal(2))
+		Expect(response.Rejected).To(Equal(1))
+		Expect(response.Results[1]).To(Equal(Result{Index: 1, Topic: "other", Accepted: true}))
+		Expect(response.Results[2]).To(Equal(Result{Index: 2, Topic: "rejected", Error: "rejected by publisher"}))
+		Expect(publisher.messages[1].Group).To(Equal("operators"))
+	})
+
+	It("should reject messages without topic, message or target", func() {
+		var response Response
+		body := `[
+			{"message": "a"},
+			{"topic": "t"},
+			{"topic": "t", "message": "b", "target": "user"},
+			{"topic": "t", "message": "b", "target": "everyone"}
+		]`
+		handler = NewHandler("/api/publish", publisher, Options{})
+		Expect(post("/api/publish", body, &response)).To(Equal(http.StatusUnprocessableEntity))
+		var errs []string
+		for _, result := range response.Results {
+			errs = append(errs, result.Error)
+		}
+		Expect(errs).To(Equal([]string{"topic is empty", "message is missing", "user is empty", `unknown target "everyone"`}))
+		Expect(publisher.messages).To(BeEmpty())
+	})
+
+	It("should pass the sender header", func() {
+		request := httptest.NewRequest(http.MethodPost, "/api/publish/t", strings.NewReader(`{"message":"x"}`))
+		request.Header.Set(SenderHeader, "plc-gateway-7")
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		Expect(publisher.senders).To(Equal([]string{"plc-gateway-7"}))
+	})
+
+	It("should reject malformed bodies and too large batches", func() {
+		Expect(post("/api/publish/t", `{"message":`, nil)).To(Equal(http.StatusBadRequest))
+		Expect(post("/api/publish/t", ``, nil)).To(Equal(http.StatusBadRequest))
+		Expect(post("/api/publish/t", `[]`, nil)).To(Equal(http.StatusBadRequest))
+		Expect(post("/api/publish/t", `[{"message":"1"},{"message":"2"},{"message":"3"},{"message":"4"}]`, nil)).
+			To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(publisher.messages).To(BeEmpty())
+	})
+
+	It("should only allow POST", func() {
+		request := httptest.NewRequest(http.MethodGet, "/api/publish/t", nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(recorder.Header().Get("Allow")).To(Equal(http.MethodPost))
+	})
+})
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-kit/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/mdaxf/iac-signalr/publish"
+	"github.com/mdaxf/iac-signalr/signalr"
+)
+
+// notifyReceiver receives the messages of the notify topic
+type notifyReceiver struct {
+	signalr.Receiver
+	messages chan string
+}
+
+func (r *notifyReceiver) Notify(message string) {
+	r.messages <- message
+}
+
+var _ = Describe("httpPublisher", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var server signalr.Server
+	var httpServer *httptest.Server
+	var publisher *httpPublisher
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		hub := newTestHub()
+		var err error
+		server, err = signalr.NewServer(ctx, signalr.HubFactory(hub.newInstance),
+			signalr.Logger(log.NewNopLogger(), false),
+			signalr.UserFromRequest(newUserFromRequest(UserConfig{Header: "X-IAC-User", TrustedProxy: true})))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(signalr.WithHTTPServeMux(router), IACMessageBusName)
+		httpServer = httptest.NewServer(router)
+		publisher = &httpPublisher{hub: hub, server: server}
+	})
+
+	AfterEach(func() {
+		cancel()
+		httpServer.Close()
+	})
+
+	// connect connects a client which sends the user in the header
+	connect := func(header http.Header) *notifyReceiver {
+		receiver := &notifyReceiver{messages: make(chan string, 10)}
+		client, err := signalr.NewClient(ctx,
+			signalr.WithConnector(func() (signalr.Connection, error) {
+				return signalr.NewHTTPConnection(ctx, httpServer.URL+IACMessageBusName,
+					signalr.WithHTTPHeaders(func() http.Header { return header }))
+			}),
+			signalr.WithReceiver(receiver),
+			signalr.Logger(log.NewNopLogger(), false))
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(ctx, signalr.ClientConnected)).To(Succeed())
+		return receiver
+	}
+
+	It("should send to the connections of a user", func() {
+		alice1 := connect(http.Header{"X-IAC-User": []string{"alice"}})
+		alice2 := connect(http.Header{"X-IAC-User": []string{"alice"}})
+		bob := connect(http.Header{"X-IAC-User": []string{"bob"}})
+		Eventually(func() int { return len(server.Connections()) }).Should(Equal(3))
+
+		Expect(publisher.Publish(publish.Message{Topic: "notify", Payload: "for alice",
+			Target: publish.TargetUser, User: "alice"}, "test")).To(Succeed())
+		Eventually(alice1.messages).Should(Receive(Equal("for alice")))
+		Eventually(alice2.messages).Should(Receive(Equal("for alice")))
+		Consistently(bob.messages, 100*time.Millisecond).ShouldNot(Receive())
+
+		Expect(publisher.Publish(publish.Message{Topic: "notify", Payload: "for carol",
+			Target: publish.TargetUser, User: "carol"}, "test")).To(MatchError("user carol has no connection"))
+	})
+
+	It("should reject wildcard topics only for the subscribers", func() {
+		connect(nil)
+		Eventually(func() int { return len(server.Connections()) }).Should(Equal(1))
+		Expect(publisher.Publish(publish.Message{Topic: "notify/#", Payload: "x",
+			Target: publish.TargetSubscribers}, "test")).To(HaveOccurred())
+		Expect(publisher.Publish(publish.Message{Topic: "notify/#", Payload: "x",
+			Target: publish.TargetConnection, ConnectionID: server.Connections()[0].ConnectionID}, "test")).To(Succeed())
+	})
+})
+
+var _ = Describe("newUserFromRequest", func() {
+	request := func(user string, commonName string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, IACMessageBusName+"?user=mallory", nil)
+		if user != "" {
+			r.Header.Set("X-IAC-User", user)
+		}
+		if commonName != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return r
+	}
+
+	It("should take the user from the client certificate before the header", func() {
+		userFromRequest := newUserFromRequest(UserConfig{Header: "X-IAC-User", TrustedProxy: true})
+		Expect(userFromRequest(request("mallory", "alice"))).To(Equal("alice"))
+		Expect(userFromRequest(request("bob", ""))).To(Equal("bob"))
+	})
+
+	It("should ignore the header and the query without a trusted proxy", func() {
+		userFromRequest := newUserFromRequest(UserConfig{Header: "X-IAC-User"})
+		Expect(userFromRequest(request("mallory", ""))).To(BeEmpty())
+		Expect(userFromRequest(request("mallory", "alice"))).To(Equal("alice"))
+	})
+})
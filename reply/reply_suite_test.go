@@ -0,0 +1,13 @@
+package reply
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestReply(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reply Suite")
+}
@@ -0,0 +1,182 @@
+// Package reply routes requests over the message bus to one of the responders of their topic
+// and returns the reply of that responder to the requester.
+package reply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+// DefaultTimeout is the time a request waits for its reply, if the requester gives none
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxTimeout limits the timeout a requester can give, if no MaxTimeout is given
+const DefaultMaxTimeout = 5 * time.Minute
+
+// ErrNoResponder is returned for requests to topics without responders
+var ErrNoResponder = errors.New("no responder for the topic of the request")
+
+// ErrResponderGone is returned for requests whose responder disconnected before it replied
+var ErrResponderGone = errors.New("responder disconnected before it replied")
+
+// ErrUnknownRequest is returned by Reply for requests which are not waiting for a reply of the responder
+var ErrUnknownRequest = errors.New("request is not waiting for a reply of this responder")
+
+// TimeoutError is returned for requests which were not replied within their timeout
+type TimeoutError struct {
+	Topic   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request to %s was not replied within %s", e.Topic, e.Timeout)
+}
+
+// Request is a request sent to a responder
+type Request struct {
+	CorrelationID string    `json:"correlationId"`
+	Topic         string    `json:"topic"`
+	Payload       string    `json:"payload"`
+	Sender        string    `json:"sender"`
+	Deadline      time.Time `json:"deadline"`
+}
+
+// Options configure a Router
+type Options struct {
+	// DefaultTimeout is used for requests without timeout
+	DefaultTimeout time.Duration
+	// MaxTimeout limits the timeout of requests
+	MaxTimeout time.Duration
+	// Send sends the request to the responder connection
+	Send func(connectionID string, request Request)
+}
+
+// call is a request waiting for its reply
+type call struct {
+	responder string
+	replies   chan result
+}
+
+type result struct {
+	payload string
+	err     error
+}
+
+// Router keeps the responders of topic filters and the requests waiting for a reply. It is safe for concurrent use.
+type Router struct {
+	mx         sync.Mutex
+	options    Options
+	responders *topic.Subscriptions
+	next       uint64 // round robin over the responders of a topic
+	calls      map[string]*call
+}
+
+// New creates a Router without responders
+func New(options Options) *Router {
+	if options.DefaultTimeout <= 0 {
+		options.DefaultTimeout = DefaultTimeout
+	}
+	if options.MaxTimeout <= 0 {
+		options.MaxTimeout = DefaultMaxTimeout
+	}
+	return &Router{options: options, responders: topic.NewSubscriptions(), calls: make(map[string]*call)}
+}
+
+// Serve makes the connection a responder for the requests to the topics matching the filter
+func (r *Router) Serve(filter string, connectionID string) error {
+	_, err := r.responders.Subscribe(filter, connectionID)
+	return err
+}
+
+// Unserve removes the connection as responder for the topic filter
+func (r *Router) Unserve(filter string, connectionID string) {
+	r.responders.Unsubscribe(filter, connectionID)
+}
+
+// RemoveConnection removes the connection as responder and fails the requests waiting for its reply
+func (r *Router) RemoveConnection(connectionID string) {
+	r.responders.RemoveConnection(connectionID)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for correlationID, c := range r.calls {
+		if c.responder == connectionID {
+			delete(r.calls, correlationID)
+			c.replies <- result{err: ErrResponderGone}
+		}
+	}
+}
+
+// Request sends the payload to one responder of the topic and waits for its reply, until the timeout has passed
+// or ctx is done. A timeout of zero or less uses Options.DefaultTimeout, longer ones are cut to Options.MaxTimeout.
+func (r *Router) Request(ctx context.Context, topicName string, payload string, sender string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = r.options.DefaultTimeout
+	}
+	if timeout > r.options.MaxTimeout {
+		timeout = r.options.MaxTimeout
+	}
+	responders := r.responders.Subscribers(topicName)
+	if len(responders) == 0 {
+		return "", ErrNoResponder
+	}
+	request := Request{
+		CorrelationID: uuid.NewString(),
+		Topic:         topicName,
+		Payload:       payload,
+		Sender:        sender,
+		Deadline:      time.Now().Add(timeout).UTC(),
+	}
+	r.mx.Lock()
+	c := &call{responder: responders[r.next%uint64(len(responders))], replies: make(chan result, 1)}
+	r.next++
+	r.calls[request.CorrelationID] = c
+	r.mx.Unlock()
+	if r.options.Send != nil {
+		r.options.Send(c.responder, request)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-c.replies:
+		return res.payload, res.err
+	case <-timer.C:
+		r.forget(request.CorrelationID)
+		return "", &TimeoutError{Topic: topicName, Timeout: timeout}
+	case <-ctx.Done():
+		r.forget(request.CorrelationID)
+		return "", ctx.Err()
+	}
+}
+
+// forget removes a request which does not wait for its reply anymore
+func (r *Router) forget(correlationID string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	delete(r.calls, correlationID)
+}
+
+// Reply completes the request with the payload. Only the responder the request was sent to can reply.
+func (r *Router) Reply(connectionID string, correlationID string, payload string) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	c, ok := r.calls[correlationID]
+	if !ok || c.responder != connectionID {
+		return ErrUnknownRequest
+	}
+	delete(r.calls, correlationID)
+	c.replies <- result{payload: payload}
+	return nil
+}
+
+// Waiting returns the number of requests waiting for a reply
+func (r *Router) Waiting() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.calls)
+}
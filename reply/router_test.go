@@ -0,0 +1,133 @@
+package reply
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// sent is a request with the responder it was sent to
+type sent struct {
+	responder string
+	request   Request
+}
+
+var _ = Describe("Router", func() {
+	var router *Router
+	var requests chan sent
+
+	BeforeEach(func() {
+		requests = make(chan sent, 10)
+		router = New(Options{
+			MaxTimeout: time.Second,
+			Send: func(connectionID string, request Request) {
+				requests <- sent{responder: connectionID, request: request}
+			},
+		})
+	})
+
+	type response struct {
+		payload string
+		err     error
+	}
+
+	request := func(ctx context.Context, topicName string, timeout time.Duration) <-chan response {
+		responses := make(chan response, 1)
+		go func() {
+			payload, err := router.Request(ctx, topicName, "question", "ui", timeout)
+			responses <- response{payload, err}
+		}()
+		return responses
+	}
+
+	It("should return the reply of the responder", func() {
+		Expect(router.Serve("orders/+", "backend")).To(Succeed())
+		responses := request(context.Background(), "orders/new", time.Second)
+		var s sent
+		Eventually(requests).Should(Receive(&s))
+		Expect(s.responder).To(Equal("backend"))
+		Expect(s.request.Topic).To(Equal("orders/new"))
+		Expect(s.request.Payload).To(Equal("question"))
+		Expect(s.request.Sender).To(Equal("ui"))
+		Expect(router.Reply("backend", s.request.CorrelationID, "answer")).To(Succeed())
+		Eventually(responses).Should(Receive(Equal(response{payload: "answer"})))
+		Expect(router.Waiting()).To(Equal(0))
+	})
+
+	It("should send each request to one responder, in turn", func() {
+		Expect(router.Serve("orders/#", "a")).To(Succeed())
+		Expect(router.Serve("orders/#", "b")).To(Succeed())
+		responders := map[string]int{}
+		for i := 0; i < 4; i++ {
+			request(context.Background(), "orders/new", time.Second)
+			var s sent
+			Eventually(requests).Should(Receive(&s))
+			responders[s.responder]++
+			Expect(router.Reply(s.responder, s.request.CorrelationID, "answer")).To(Succeed())
+		}
+		Expect(responders).To(Equal(map[string]int{"a": 2, "b": 2}))
+	})
+
+	It("should fail requests without responders", func() {
+		Expect(router.Serve("orders/#", "backend")).To(Succeed())
+		_, err := router.Request(context.Background(), "alarms/new", "question", "ui", time.Second)
+		Expect(err).To(Equal(ErrNoResponder))
+		router.Unserve("orders/#", "backend")
+		_, err = router.Request(context.Background(), "orders/new", "question", "ui", time.Second)
+		Expect(err).To(Equal(ErrNoResponder))
+	})
+
+	It("should time out and reject the late reply", func() {
+		Expect(router.Serve("orders/new", "backend")).To(Succeed())
+		responses := request(context.Background(), "orders/new", 20*time.Millisecond)
+		var s sent
+		Eventually(requests).Should(Receive(&s))
+		var r response
+		Eventually(responses).Should(Receive(&r))
+		var timeout *TimeoutError
+		Expect(errors.As(r.err, &timeout)).To(BeTrue())
+		Expect(timeout.Timeout).To(Equal(20 * time.Millisecond))
+		Expect(router.Reply("backend", s.request.CorrelationID, "late")).To(Equal(ErrUnknownRequest))
+	})
+
+	It("should limit the timeout", func() {
+		Expect(router.Serve("orders/new", "backend")).To(Succeed())
+		request(context.Background(), "orders/new", time.Hour)
+		var s sent
+		Eventually(requests).Should(Receive(&s))
+		Expect(s.request.Deadline).To(BeTemporally("~", time.Now().Add(time.Second), 500*time.Millisecond))
+	})
+
+	It("should only accept the reply of the responder the request was sent to", func() {
+		Expect(router.Serve("orders/new", "backend")).To(Succeed())
+		request(context.Background(), "orders/new", time.Second)
+		var s sent
+		Eventually(requests).Should(Receive(&s))
+		Expect(router.Reply("other", s.request.CorrelationID, "answer")).To(Equal(ErrUnknownRequest))
+		Expect(router.Reply("backend", "unknown", "answer")).To(Equal(ErrUnknownRequest))
+		Expect(router.Waiting()).To(Equal(1))
+	})
+
+	It("should fail the requests of a responder which disconnects", func() {
+		Expect(router.Serve("orders/new", "backend")).To(Succeed())
+		responses := request(context.Background(), "orders/new", time.Second)
+		Eventually(requests).Should(Receive())
+		router.RemoveConnection("backend")
+		Eventually(responses).Should(Receive(Equal(response{err: ErrResponderGone})))
+		_, err := router.Request(context.Background(), "orders/new", "question", "ui", time.Second)
+		Expect(err).To(Equal(ErrNoResponder))
+	})
+
+	It("should end the request when the requester is gone", func() {
+		Expect(router.Serve("orders/new", "backend")).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		responses := request(ctx, "orders/new", time.Second)
+		Eventually(requests).Should(Receive())
+		cancel()
+		Eventually(responses).Should(Receive(Equal(response{err: context.Canceled})))
+		Expect(router.Waiting()).To(Equal(0))
+	})
+})
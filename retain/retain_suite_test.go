@@ -0,0 +1,13 @@
+package retain
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRetain(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Retain Suite")
+}
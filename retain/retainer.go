@@ -0,0 +1,96 @@
+package retain
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+// Options configure a Retainer
+type Options struct {
+	// TTL is the time after which a retained message expires. Zero keeps messages until they are replaced or cleared.
+	TTL time.Duration
+	// Topics are topic filters whose messages are retained even if their publish is not flagged as retained
+	Topics []string
+}
+
+// Retainer keeps the last retained message of each topic in a Store
+type Retainer struct {
+	// mx keeps Matching from removing a message as expired which was replaced meanwhile
+	mx      sync.Mutex
+	store   Store
+	options Options
+	now     func() time.Time
+}
+
+// New creates a Retainer which keeps the messages in store
+func New(store Store, options Options) *Retainer {
+	return &Retainer{store: store, options: options, now: time.Now}
+}
+
+// Retains reports whether the messages of the topic are retained by configuration
+func (r *Retainer) Retains(topicName string) bool {
+	for _, filter := range r.options.Topics {
+		if topic.Match(filter, topicName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Retain stores the payload as last value of the topic. An empty payload clears the topic, like in MQTT.
+func (r *Retainer) Retain(topicName string, payload string) error {
+	if payload == "" {
+		return r.Clear(topicName)
+	}
+	now := r.now().UTC()
+	message := Message{Topic: topicName, Payload: payload, Time: now}
+	if r.options.TTL > 0 {
+		message.Expires = now.Add(r.options.TTL)
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.store.Put(message)
+}
+
+// Clear removes the retained message of the topic
+func (r *Retainer) Clear(topicName string) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.store.Delete(topicName)
+}
+
+// Matching returns the retained messages of the topics matching the topic filter, sorted by topic.
+// Expired messages are removed from the store.
+func (r *Retainer) Matching(filter string) ([]Message, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	now := r.now()
+	var messages []Message
+	var expired []string
+	err := r.store.Range(func(message Message) bool {
+		if message.expired(now) {
+			expired = append(expired, message.Topic)
+		} else if topic.Match(filter, message.Topic) {
+			messages = append(messages, message)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, topicName := range expired {
+		if err := r.store.Delete(topicName); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Topic < messages[j].Topic })
+	return messages, nil
+}
+
+// Close closes the store
+func (r *Retainer) Close() error {
+	return r.store.Close()
+}
@@ -0,0 +1,65 @@
+package retain
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retainer", func() {
+	var retainer *Retainer
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		retainer = New(NewMemoryStore(), Options{TTL: time.Minute, Topics: []string{"plant1/+/status"}})
+		retainer.now = func() time.Time { return now }
+	})
+
+	topics := func(messages []Message) []string {
+		var names []string
+		for _, message := range messages {
+			names = append(names, message.Topic)
+		}
+		return names
+	}
+
+	It("should tell the topics which are retained by configuration", func() {
+		Expect(retainer.Retains("plant1/line3/status")).To(BeTrue())
+		Expect(retainer.Retains("plant1/line3/alarm")).To(BeFalse())
+	})
+
+	It("should return the retained messages matching a filter", func() {
+		Expect(retainer.Retain("plant1/line3/status", "running")).To(Succeed())
+		Expect(retainer.Retain("plant1/line2/status", "stopped")).To(Succeed())
+		Expect(retainer.Retain("plant2/line1/status", "running")).To(Succeed())
+		messages, err := retainer.Matching("plant1/#")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(topics(messages)).To(Equal([]string{"plant1/line2/status", "plant1/line3/status"}))
+		Expect(messages[1].Payload).To(Equal("running"))
+		Expect(messages[1].Time).To(Equal(now))
+		Expect(messages[1].Expires).To(Equal(now.Add(time.Minute)))
+	})
+
+	It("should clear messages explicitly or by an empty payload", func() {
+		Expect(retainer.Retain("plant1/line3/status", "running")).To(Succeed())
+		Expect(retainer.Retain("plant1/line2/status", "stopped")).To(Succeed())
+		Expect(retainer.Clear("plant1/line3/status")).To(Succeed())
+		Expect(retainer.Retain("plant1/line2/status", "")).To(Succeed())
+		messages, err := retainer.Matching("#")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messages).To(BeEmpty())
+	})
+
+	It("should expire messages after the TTL", func() {
+		Expect(retainer.Retain("plant1/line3/status", "running")).To(Succeed())
+		now = now.Add(30 * time.Second)
+		Expect(retainer.Retain("plant1/line2/status", "stopped")).To(Succeed())
+		now = now.Add(30 * time.Second)
+		messages, err := retainer.Matching("#")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(topics(messages)).To(Equal([]string{"plant1/line2/status"}))
+		Expect(all(retainer.store)).To(Equal(map[string]string{"plant1/line2/status": "stopped"}))
+	})
+})
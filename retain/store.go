@@ -0,0 +1,268 @@
+// Package retain keeps the last value of message bus topics, so new subscribers receive the current state
+// of a topic right away instead of waiting for its next message.
+package retain
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Message is the retained value of a topic
+type Message struct {
+	Topic   string    `json:"topic"`
+	Payload string    `json:"payload"`
+	Time    time.Time `json:"time"`
+	Expires time.Time `json:"expires"` // zero if the message does not expire
+}
+
+// expired reports whether the message has expired at now
+func (m Message) expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !now.Before(m.Expires)
+}
+
+// Store keeps one Message per topic. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores the message, replacing the message of its topic
+	Put(message Message) error
+	// Delete removes the message of the topic
+	Delete(topic string) error
+	// Range calls f for every message until f returns false
+	Range(f func(message Message) bool) error
+	// Close releases the resources of the store
+	Close() error
+}
+
+// MemoryStore is a Store which keeps the messages in memory
+type MemoryStore struct {
+	mx       sync.RWMutex
+	messages map[string]Message
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[string]Message)}
+}
+
+// Put stores the message, replacing the message of its topic
+func (s *MemoryStore) Put(message Message) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.messages[message.Topic] = message
+	return nil
+}
+
+// Delete removes the message of the topic
+func (s *MemoryStore) Delete(topic string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.messages, topic)
+	return nil
+}
+
+// Range calls f for every message until f returns false.
+// f is called on a snapshot, so it may call the other methods of the store.
+func (s *MemoryStore) Range(f func(message Message) bool) error {
+	s.mx.RLock()
+	messages := make([]Message, 0, len(s.messages))
+	for _, message := range s.messages {
+		messages = append(messages, message)
+	}
+	s.mx.RUnlock()
+	for _, message := range messages {
+		if !f(message) {
+			break
+		}
+	}
+	return nil
+}
+
+// Close does nothing
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// minCompaction is the number of records in the file of a FileStore below which it is not compacted
+const minCompaction = 1000
+
+// record is one line of the file of a FileStore
+type record struct {
+	Delete  string   `json:"delete,omitempty"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// FileStore is a Store which keeps the messages in memory and appends every change as a JSON line to a file.
+// On open, the file is replayed and compacted to one line per message. An incomplete last line, as left by
+// a crash while writing, is dropped. The file is compacted again when it has more than twice as many lines
+// as messages. Lines are not synced to disk one by one, so a crash of the machine may lose the last changes.
+type FileStore struct {
+	memory  *MemoryStore
+	mx      sync.Mutex
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	records int
+}
+
+// NewFileStore opens or creates the file at path
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{memory: NewMemoryStore(), path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the file into memory
+func (s *FileStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// an incomplete last line has no newline
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		if r.Message != nil {
+			_ = s.memory.Put(*r.Message)
+		} else {
+			_ = s.memory.Delete(r.Delete)
+		}
+	}
+}
+
+// compact rewrites the file with the messages in memory and reopens it for appending.
+// The new file replaces the old one by rename, so a crash leaves either of them.
+func (s *FileStore) compact() error {
+	if s.file != nil {
+		_ = s.writer.Flush()
+		_ = s.file.Close()
+		s.file = nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	records := 0
+	_ = s.memory.Range(func(message Message) bool {
+		err = writeRecord(writer, record{Message: &message})
+		records++
+		return err == nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.records = records
+	return nil
+}
+
+func writeRecord(w io.Writer, r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// append writes the record to the file and compacts it when it has grown too much
+func (s *FileStore) append(r record) error {
+	if s.file == nil {
+		return fmt.Errorf("%s is closed", s.path)
+	}
+	if err := writeRecord(s.writer, r); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	s.records++
+	if s.records > minCompaction && s.records > 2*s.count() {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *FileStore) count() int {
+	s.memory.mx.RLock()
+	defer s.memory.mx.RUnlock()
+	return len(s.memory.messages)
+}
+
+// Put stores the message, replacing the message of its topic
+func (s *FileStore) Put(message Message) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_ = s.memory.Put(message)
+	return s.append(record{Message: &message})
+}
+
+// Delete removes the message of the topic
+func (s *FileStore) Delete(topic string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_ = s.memory.Delete(topic)
+	return s.append(record{Delete: topic})
+}
+
+// Range calls f for every message until f returns false
+func (s *FileStore) Range(f func(message Message) bool) error {
+	return s.memory.Range(f)
+}
+
+// Close flushes and closes the file
+func (s *FileStore) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.writer.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
@@ -0,0 +1,106 @@
+package retain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// all returns the messages of the store by topic
+func all(store Store) map[string]string {
+	payloads := make(map[string]string)
+	Expect(store.Range(func(message Message) bool {
+		payloads[message.Topic] = message.Payload
+		return true
+	})).To(Succeed())
+	return payloads
+}
+
+func lines(path string) int {
+	data, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	return strings.Count(string(data), "\n")
+}
+
+var _ = Describe("MemoryStore", func() {
+	It("should keep one message per topic", func() {
+		store := NewMemoryStore()
+		Expect(store.Put(Message{Topic: "a", Payload: "1"})).To(Succeed())
+		Expect(store.Put(Message{Topic: "a", Payload: "2"})).To(Succeed())
+		Expect(store.Put(Message{Topic: "b", Payload: "3"})).To(Succeed())
+		Expect(store.Delete("b")).To(Succeed())
+		Expect(all(store)).To(Equal(map[string]string{"a": "2"}))
+	})
+})
+
+var _ = Describe("FileStore", func() {
+	var dir string
+	var path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "signalr-retain")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "retained.jsonl")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("should restore the messages after reopening", func() {
+		store, err := NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(store.Put(Message{Topic: "a", Payload: "1"})).To(Succeed())
+		Expect(store.Put(Message{Topic: "a", Payload: "2", Expires: expires})).To(Succeed())
+		Expect(store.Put(Message{Topic: "b", Payload: "3"})).To(Succeed())
+		Expect(store.Delete("b")).To(Succeed())
+		Expect(store.Close()).To(Succeed())
+		Expect(lines(path)).To(Equal(4))
+
+		store, err = NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+		Expect(all(store)).To(Equal(map[string]string{"a": "2"}))
+		Expect(store.Range(func(message Message) bool {
+			Expect(message.Expires).To(Equal(expires))
+			return true
+		})).To(Succeed())
+		// compacted on open
+		Expect(lines(path)).To(Equal(1))
+	})
+
+	It("should drop an incomplete last line", func() {
+		Expect(os.WriteFile(path, []byte(`{"message":{"topic":"a","payload":"1"}}`+"\n"+`{"message":{"topic":"a","pay`), 0644)).To(Succeed())
+		store, err := NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+		Expect(all(store)).To(Equal(map[string]string{"a": "1"}))
+		Expect(store.Put(Message{Topic: "b", Payload: "2"})).To(Succeed())
+		Expect(lines(path)).To(Equal(2))
+	})
+
+	It("should reject a corrupt file", func() {
+		Expect(os.WriteFile(path, []byte("garbage\n"+`{"message":{"topic":"a","payload":"1"}}`+"\n"), 0644)).To(Succeed())
+		_, err := NewFileStore(path)
+		Expect(err).To(MatchError(ContainSubstring(path + ":1")))
+	})
+
+	It("should compact the file when it grows", func() {
+		store, err := NewFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+		for i := 0; i < 3*minCompaction; i++ {
+			Expect(store.Put(Message{Topic: fmt.Sprintf("t%d", i%10), Payload: fmt.Sprint(i)})).To(Succeed())
+		}
+		Expect(lines(path)).To(BeNumerically("<=", minCompaction+1))
+		Expect(all(store)).To(HaveLen(10))
+		Expect(all(store)).To(HaveKeyWithValue("t9", fmt.Sprint(3*minCompaction-1)))
+	})
+})
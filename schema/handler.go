@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Handler serves the registered schemas below prefix, e.g. "/schemas/".
+//
+//	GET {prefix}          lists the topics with their schema url and invalid message count
+//	GET {prefix}{topic}   returns the schema document of the topic
+func (r *Registry) Handler(prefix string) http.Handler {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		topic := strings.TrimPrefix(req.URL.Path, prefix)
+		if topic == "" || req.URL.Path+"/" == prefix {
+			r.serveIndex(w, prefix)
+			return
+		}
+		raw, ok := r.Schema(topic)
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(raw)
+	})
+}
+
+type topicInfo struct {
+	Topic   string `json:"topic"`
+	URL     string `json:"url"`
+	Invalid uint64 `json:"invalid"`
+}
+
+func (r *Registry) serveIndex(w http.ResponseWriter, prefix string) {
+	invalid := r.InvalidCounts()
+	topics := make([]topicInfo, 0)
+	for _, topic := range r.Topics() {
+		topics = append(topics, topicInfo{Topic: topic, URL: prefix + topic, Invalid: invalid[topic]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(topics)
+}
@@ -0,0 +1,175 @@
+// Package schema provides a registry of JSON Schemas for message bus topics.
+//
+// The registry is loaded from a directory of JSON Schema files. The topic of a schema is the path of the
+// file relative to the directory, with forward slashes and without the ".json" or ".schema.json" extension,
+// e.g. the file "plant1/line2/status.schema.json" holds the schema for the topic "plant1/line2/status".
+// Schemas may reference each other with relative $ref values.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ValidationError is returned by Registry.Validate when a message does not match the schema of its topic
+type ValidationError struct {
+	Topic string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("message for topic %s is invalid: %v", e.Topic, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Registry holds the compiled schemas of all registered topics and counts the invalid messages per topic.
+// A nil *Registry is valid and accepts all messages.
+type Registry struct {
+	schemas map[string]*topicSchema
+	mx      sync.Mutex
+	invalid map[string]uint64
+}
+
+type topicSchema struct {
+	file     string
+	raw      []byte
+	compiled *jsonschema.Schema
+}
+
+// Load reads and compiles all *.json files below dir
+func Load(dir string) (*Registry, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		schemas: make(map[string]*topicSchema),
+		invalid: make(map[string]uint64),
+	}
+	compiler := jsonschema.NewCompiler()
+	err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil {
+			return err
+		}
+		topic := topicOf(rel)
+		if existing, ok := r.schemas[topic]; ok {
+			return fmt.Errorf("topic %s has two schemas: %s and %s", topic, existing.file, path)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		compiled, err := compiler.Compile(path)
+		if err != nil {
+			return fmt.Errorf("compiling schema for topic %s: %w", topic, err)
+		}
+		r.schemas[topic] = &topicSchema{file: path, raw: raw, compiled: compiled}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func topicOf(relPath string) string {
+	topic := filepath.ToSlash(relPath)
+	for _, ext := range []string{".schema.json", ".json"} {
+		if strings.HasSuffix(topic, ext) {
+			return strings.TrimSuffix(topic, ext)
+		}
+	}
+	return topic
+}
+
+// Validate checks message against the schema of topic. Messages for topics without schema are always valid.
+// message has to be JSON text. Invalid messages are counted and reported as *ValidationError.
+func (r *Registry) Validate(topic string, message string) error {
+	if r == nil {
+		return nil
+	}
+	s, ok := r.schemas[topic]
+	if !ok {
+		return nil
+	}
+	var value interface{}
+	err := json.Unmarshal([]byte(message), &value)
+	if err == nil {
+		err = s.compiled.Validate(value)
+	} else {
+		err = fmt.Errorf("not a JSON document: %w", err)
+	}
+	if err != nil {
+		r.mx.Lock()
+		r.invalid[topic]++
+		r.mx.Unlock()
+		return &ValidationError{Topic: topic, Err: err}
+	}
+	return nil
+}
+
+// Has returns if a schema for topic is registered
+func (r *Registry) Has(topic string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.schemas[topic]
+	return ok
+}
+
+// Topics returns the sorted list of topics with schema
+func (r *Registry) Topics() []string {
+	if r == nil {
+		return nil
+	}
+	topics := make([]string, 0, len(r.schemas))
+	for topic := range r.schemas {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Schema returns the schema document of topic as it was loaded from the schema file
+func (r *Registry) Schema(topic string) ([]byte, bool) {
+	if r == nil {
+		return nil, false
+	}
+	s, ok := r.schemas[topic]
+	if !ok {
+		return nil, false
+	}
+	return s.raw, true
+}
+
+// InvalidCounts returns the number of rejected messages per topic
+func (r *Registry) InvalidCounts() map[string]uint64 {
+	counts := make(map[string]uint64)
+	if r == nil {
+		return counts
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for topic, count := range r.invalid {
+		counts[topic] = count
+	}
+	return counts
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const statusSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["machine", "state"],
+	"properties": {
+		"machine": {"type": "string"},
+		"state": {"$ref": "../common/state.json"}
+	}
+}`
+
+const stateSchema = `{"enum": ["running", "stopped", "error"]}`
+
+var _ = Describe("Registry", func() {
+	var dir string
+	var registry *Registry
+
+	writeSchema := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "signalr-schema")
+		Expect(err).NotTo(HaveOccurred())
+		writeSchema("plant1/status.schema.json", statusSchema)
+		writeSchema("common/state.json", stateSchema)
+		registry, err = Load(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("should derive the topics from the file paths", func() {
+		Expect(registry.Topics()).To(Equal([]string{"common/state", "plant1/status"}))
+		Expect(registry.Has("plant1/status")).To(BeTrue())
+	})
+
+	It("should accept valid messages and messages without schema", func() {
+		Expect(registry.Validate("plant1/status", `{"machine":"M1","state":"running"}`)).To(Succeed())
+		Expect(registry.Validate("unregistered", `not json at all`)).To(Succeed())
+		Expect(registry.InvalidCounts()).To(BeEmpty())
+	})
+
+	It("should reject and count invalid messages", func() {
+		err := registry.Validate("plant1/status", `{"machine":"M1","state":"exploded"}`)
+		var validationErr *ValidationError
+		Expect(errors.As(err, &validationErr)).To(BeTrue())
+		Expect(validationErr.Topic).To(Equal("plant1/status"))
+		Expect(registry.Validate("plant1/status", `{"machine":`)).NotTo(Succeed())
+		Expect(registry.InvalidCounts()).To(Equal(map[string]uint64{"plant1/status": 2}))
+	})
+
+	It("should fail to load broken schemas", func() {
+		writeSchema("broken.json", `{"type": 42}`)
+		_, err := Load(dir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should accept everything when no registry is configured", func() {
+		var none *Registry
+		Expect(none.Validate("plant1/status", `garbage`)).To(Succeed())
+		Expect(none.Topics()).To(BeEmpty())
+	})
+
+	Describe("Handler", func() {
+		var server *httptest.Server
+		BeforeEach(func() {
+			mux := http.NewServeMux()
+			mux.Handle("/schemas/", registry.Handler("/schemas/"))
+			server = httptest.NewServer(mux)
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should list the topics", func() {
+			Expect(registry.Validate("plant1/status", `{}`)).NotTo(Succeed())
+			resp, err := http.Get(server.URL + "/schemas/")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			var topics []topicInfo
+			Expect(json.NewDecoder(resp.Body).Decode(&topics)).To(Succeed())
+			Expect(topics).To(ContainElement(topicInfo{Topic: "plant1/status", URL: "/schemas/plant1/status", Invalid: 1}))
+		})
+
+		It("should serve the schema of a topic", func() {
+			resp, err := http.Get(server.URL + "/schemas/plant1/status")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/schema+json"))
+			body, _ := io.ReadAll(resp.Body)
+			Expect(string(body)).To(Equal(statusSchema))
+		})
+
+		It("should answer 404 for unknown topics", func() {
+			resp, err := http.Get(server.URL + "/schemas/nope")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+})
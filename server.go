@@ -1,28 +1,47 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"crypto/subtle"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/mdaxf/iac-signalr/admin"
+	"github.com/mdaxf/iac-signalr/audit"
+	"github.com/mdaxf/iac-signalr/capture"
+	"github.com/mdaxf/iac-signalr/dashboard"
+	"github.com/mdaxf/iac-signalr/delivery"
+	"github.com/mdaxf/iac-signalr/diagnostics"
+	"github.com/mdaxf/iac-signalr/healthcheck"
+	"github.com/mdaxf/iac-signalr/heartbeat"
+	"github.com/mdaxf/iac-signalr/history"
 	"github.com/mdaxf/iac-signalr/logger"
+	"github.com/mdaxf/iac-signalr/metrics"
 	"github.com/mdaxf/iac-signalr/middleware"
+	"github.com/mdaxf/iac-signalr/mqttbridge"
 	"github.com/mdaxf/iac-signalr/public"
+	"github.com/mdaxf/iac-signalr/publish"
+	"github.com/mdaxf/iac-signalr/reply"
+	"github.com/mdaxf/iac-signalr/retain"
+	"github.com/mdaxf/iac-signalr/schema"
 	"github.com/mdaxf/iac-signalr/signalr"
-	"github.com/mdaxf/iac/health"
+	"github.com/mdaxf/iac-signalr/stompbridge"
+	"github.com/mdaxf/iac-signalr/topic"
+	"github.com/mdaxf/iac-signalr/webhook"
 )
 
 type Config struct {
@@ -33,6 +52,334 @@ type Config struct {
 	InsecureSkipVerify bool                   `json:"insecureSkipVerify"`
 	KeepAliveInterval  int                    `json:"keepAliveInterval"` // in seconds, default 15
 	TimeoutInterval    int                    `json:"timeoutInterval"`   // in seconds, default 60
+	TLS                TLSConfig              `json:"tls"`
+	SchemaDir          string                 `json:"schemaDir"` // directory of per-topic JSON Schemas, optional
+	CORS               CORSConfig             `json:"cors"`
+	User               UserConfig             `json:"user"`
+	Audit              AuditConfig            `json:"audit"`
+	Metrics            MetricsConfig          `json:"metrics"`
+	Admin              AdminConfig            `json:"admin"`
+	Dashboard          DashboardConfig        `json:"dashboard"`
+	Health             HealthConfig           `json:"health"`
+	Heartbeat          HeartbeatConfig        `json:"heartbeat"`
+	Capture            CaptureConfig          `json:"capture"`
+	Diagnostics        DiagnosticsConfig      `json:"diagnostics"`
+	MessageBus         MessageBusConfig       `json:"messageBus"`
+	Retain             RetainConfig           `json:"retain"`
+	History            HistoryConfig          `json:"history"`
+	Delivery           DeliveryConfig         `json:"delivery"`
+	Requests           RequestsConfig         `json:"requests"`
+	Publish            PublishConfig          `json:"publish"`
+	Webhooks           WebhooksConfig         `json:"webhooks"`
+	MQTT               MQTTConfig             `json:"mqtt"`
+	STOMP              STOMPConfig            `json:"stomp"`
+}
+
+// CORSConfig complements the allowed origins in Config.Clients
+type CORSConfig struct {
+	AllowCredentials *bool    `json:"allowCredentials"` // default true
+	MaxAge           int      `json:"maxAge"`           // preflight cache duration in seconds
+	ExposedHeaders   []string `json:"exposedHeaders"`
+	AllowedHeaders   []string `json:"allowedHeaders"`
+}
+
+// UserConfig determines the user of a connection, shown in the audit log and the admin API and addressed by the
+// user target of the publish API. The user is the common name of the verified client certificate with mutual TLS.
+// Without one, the request header Header is used when TrustedProxy is set, because the server can't authenticate it.
+type UserConfig struct {
+	Header       string `json:"header"`       // request header with the user name, set by the app server or a proxy
+	TrustedProxy bool   `json:"trustedProxy"` // the connections come through a proxy which sets Header for every request
+}
+
+// AuditConfig enables the audit log of hub invocations, group changes, connects and disconnects
+type AuditConfig struct {
+	File       string `json:"file"`       // audit is enabled when set
+	MaxSize    int    `json:"maxSize"`    // in MB, default 10
+	MaxFiles   int    `json:"maxFiles"`   // rotated files which are kept, default 5
+	HashChain  bool   `json:"hashChain"`  // tamper-evident hash chained records
+	HashKey    string `json:"hashKey"`    // HMAC key of the hash chain, required with hashChain
+	HashKeyEnv string `json:"hashKeyEnv"` // environment variable with the HMAC key, instead of hashKey
+}
+
+// MetricsConfig enables the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Path          string `json:"path"`          // default /metrics
+	RequireAPIKey bool   `json:"requireApiKey"` // scrapes need the "apikey" Authorization like /health
+}
+
+// AdminConfig enables the admin API for connections and groups. It always requires the API key.
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"` // default /admin
+}
+
+// DashboardConfig enables the operations dashboard. Its admin hub requires the API key.
+type DashboardConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Path      string   `json:"path"`      // default /dashboard
+	MaxTopics int      `json:"maxTopics"` // topics counted separately, default 1000
+	TopicTTL  int      `json:"topicTTL"`  // seconds after its last message a topic is no longer counted, default 3600
+	Redact    []string `json:"redact"`    // fields redacted in the live tail, like capture.redact
+}
+
+// CaptureConfig enables the capture of hub messages for debugging. It always requires the API key.
+type CaptureConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Path        string   `json:"path"`        // default /capture
+	Size        int      `json:"size"`        // messages kept, default 10000
+	MaxDuration int      `json:"maxDuration"` // longest capture in seconds, default 600
+	Redact      []string `json:"redact"`      // field names or dotted paths whose values are replaced
+}
+
+// MessageBusConfig configures the delivery of the message bus topics
+type MessageBusConfig struct {
+	// Broadcast sends every topic to all connections as before topic subscriptions, for older clients
+	// which filter the topics themselves
+	Broadcast bool `json:"broadcast"`
+}
+
+// RetainConfig configures the retained last values of topics, which new subscribers receive on Subscribe
+type RetainConfig struct {
+	File   string   `json:"file"`   // keeps the retained messages across restarts, in memory if empty
+	TTL    int      `json:"ttl"`    // in seconds, retained messages do not expire if 0
+	Topics []string `json:"topics"` // topic filters whose messages are always retained
+}
+
+// HistoryConfig keeps the messages of topics for clients which reconnect with SubscribeFrom
+type HistoryConfig struct {
+	Topics      []string `json:"topics"`      // topic filters whose messages are kept, the history is disabled if empty
+	Dir         string   `json:"dir"`         // directory of the segment files, in memory if empty
+	MaxCount    int      `json:"maxCount"`    // messages kept per topic, default 1000
+	MaxAge      int      `json:"maxAge"`      // in seconds, 0 keeps messages regardless of their age
+	MaxBytes    int64    `json:"maxBytes"`    // payload bytes kept per topic, 0 does not limit the size
+	SegmentSize int64    `json:"segmentSize"` // in bytes, default 4 MiB
+}
+
+// DeliveryConfig enables the at-least-once delivery of SendToBackEnd to consumer groups which Ack the messages
+type DeliveryConfig struct {
+	AtLeastOnce       bool     `json:"atLeastOnce"`
+	VisibilityTimeout int      `json:"visibilityTimeout"` // in seconds until an unacknowledged message is sent again, default 30
+	MaxAttempts       int      `json:"maxAttempts"`       // deliveries before a message is dead-lettered, default 5
+	DeadLetterTopic   string   `json:"deadLetterTopic"`   // default IAC/deadletter
+	Groups            []string `json:"groups"`            // consumer groups which keep messages until their first consumer joins
+}
+
+// RequestsConfig limits the time a Request waits for the Reply of its responder
+type RequestsConfig struct {
+	DefaultTimeout int `json:"defaultTimeout"` // in milliseconds, for requests without timeout, default 30000
+	MaxTimeout     int `json:"maxTimeout"`     // in milliseconds, longer timeouts are cut to it, default 300000
+}
+
+// PublishConfig enables the HTTP publish API for producers without a SignalR client. It always requires the API key.
+type PublishConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Path        string `json:"path"`        // default /api/publish
+	MaxBatch    int    `json:"maxBatch"`    // messages per request, default 1000
+	MaxBodySize int64  `json:"maxBodySize"` // in bytes, default 1 MiB
+}
+
+// WebhooksConfig delivers the messages of topics to HTTP endpoints. Its status and delivery log require the API key.
+type WebhooksConfig struct {
+	Path      string          `json:"path"`    // status and delivery log, default /webhooks
+	LogSize   int             `json:"logSize"` // results kept in the delivery log, default 1000
+	Endpoints []WebhookConfig `json:"endpoints"`
+}
+
+// WebhookConfig is one webhook endpoint
+type WebhookConfig struct {
+	Name             string            `json:"name"`
+	URL              string            `json:"url"`
+	Topics           []string          `json:"topics"`    // topic filters whose messages are delivered
+	Secret           string            `json:"secret"`    // signs the requests with HMAC-SHA256
+	SecretEnv        string            `json:"secretEnv"` // environment variable with the secret, instead of secret
+	Headers          map[string]string `json:"headers"`
+	Timeout          int               `json:"timeout"`          // in milliseconds, default 10000
+	Concurrency      int               `json:"concurrency"`      // concurrent requests, default 4
+	QueueSize        int               `json:"queueSize"`        // messages waiting for delivery, default 1000
+	MaxAttempts      int               `json:"maxAttempts"`      // requests per message, default 5
+	Backoff          int               `json:"backoff"`          // in milliseconds before the first retry, default 1000
+	MaxBackoff       int               `json:"maxBackoff"`       // in milliseconds, default 60000
+	BreakerThreshold int               `json:"breakerThreshold"` // consecutive failures which open the breaker, default 5
+	BreakerCooldown  int               `json:"breakerCooldown"`  // in seconds, default 30
+}
+
+// MQTTConfig bridges the message bus to an MQTT broker. The bridge is enabled when Broker is set.
+type MQTTConfig struct {
+	Broker               string          `json:"broker"`   // like tcp://broker:1883 or ssl://broker:8883
+	ClientID             string          `json:"clientId"` // default iac-signalr-{hostname}
+	Username             string          `json:"username"`
+	Password             string          `json:"password"`
+	PasswordEnv          string          `json:"passwordEnv"` // environment variable with the password, instead of password
+	TLS                  ClientTLSConfig `json:"tls"`         // used for ssl://, tls:// and wss:// brokers
+	CleanSession         bool            `json:"cleanSession"`
+	KeepAlive            int             `json:"keepAlive"`            // in seconds, default 30
+	MaxReconnectInterval int             `json:"maxReconnectInterval"` // in seconds, default 60
+	QueueSize            int             `json:"queueSize"`            // outbound messages waiting for the broker, default 1000
+	Inbound              []MQTTRule      `json:"inbound"`              // MQTT topic filters republished to the bus
+	Outbound             []MQTTRule      `json:"outbound"`             // bus topic filters forwarded to MQTT
+}
+
+// MQTTRule maps the topics matching Filter to Topic, where {1}, {2}... are the levels matched by the wildcards of
+// Filter. The first matching rule of a message applies.
+type MQTTRule struct {
+	Filter string `json:"filter"`
+	Topic  string `json:"topic"` // default the topic of the message
+	QoS    byte   `json:"qos"`   // of the subscription or the published messages, 0, 1 or 2
+	Retain bool   `json:"retain"`
+}
+
+// STOMPConfig bridges the message bus to a STOMP broker like ActiveMQ. The bridge is enabled when Address is set.
+type STOMPConfig struct {
+	Address              string          `json:"address"` // host:port, like activemq:61613
+	Login                string          `json:"login"`
+	Passcode             string          `json:"passcode"`
+	PasscodeEnv          string          `json:"passcodeEnv"` // environment variable with the passcode, instead of passcode
+	Host                 string          `json:"host"`        // virtual host, default the host of address
+	ClientID             string          `json:"clientId"`    // needed for durable subscriptions
+	UseTLS               bool            `json:"useTLS"`
+	TLS                  ClientTLSConfig `json:"tls"`
+	HeartBeat            int             `json:"heartBeat"`            // in seconds, 0 disables the heart-beats
+	MaxReconnectInterval int             `json:"maxReconnectInterval"` // in seconds, default 60
+	QueueSize            int             `json:"queueSize"`            // outbound messages waiting for the broker, default 1000
+	SendTimeout          int             `json:"sendTimeout"`          // in milliseconds to wait for a receipt, default 10000
+	Inbound              []STOMPRule     `json:"inbound"`              // destinations republished to the bus
+	Outbound             []STOMPRule     `json:"outbound"`             // bus topic filters sent to destinations
+}
+
+// STOMPRule maps a destination of the STOMP broker to a bus topic
+type STOMPRule struct {
+	Destination string            `json:"destination"` // like /queue/iac.orders, with {1}, {2}... of filter for outbound rules
+	Topic       string            `json:"topic"`       // bus topic of inbound rules
+	Filter      string            `json:"filter"`      // bus topic filter of outbound rules
+	Durable     string            `json:"durable"`     // name of the durable subscription of an inbound rule
+	HeaderMap   map[string]string `json:"headerMap"`   // STOMP to bus header names inbound, bus to STOMP outbound
+	Headers     map[string]string `json:"headers"`     // added to outbound messages, like {"persistent": "true"}
+}
+
+// DiagnosticsConfig serves pprof and the goroutine report on a separate listener. It always requires the API key.
+type DiagnosticsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"` // default 127.0.0.1:6060
+}
+
+// HeartbeatConfig configures the registration with the app server at AppServer["url"]
+type HeartbeatConfig struct {
+	Disabled       bool   `json:"disabled"`
+	Interval       int    `json:"interval"`       // in seconds, default 300
+	Path           string `json:"path"`           // default /IACComponents/heartbeat
+	DeregisterPath string `json:"deregisterPath"` // receives DELETE on shutdown, default Path
+}
+
+// HealthConfig sets the thresholds of the readiness checks served on /ready and /health.
+// When ProbeAddress is set, /live and /ready are served on it over plain http, too, for probes which
+// can't use the TLS listener, like the docker health check with mutual TLS.
+type HealthConfig struct {
+	MaxGoroutines  int    `json:"maxGoroutines"`  // default 10000
+	MaxConnections int    `json:"maxConnections"` // default 5000
+	Timeout        int    `json:"timeout"`        // per check, in seconds, default 5
+	ProbeAddress   string `json:"probeAddress"`   // e.g. ":8223", default none
+}
+
+// newHealthChecker creates the liveness and readiness checks of the server.
+// The server is live while its lifetime manager responds. It is ready while it listens, its logger
+// can write and the goroutine and connection counts are below the thresholds.
+func newHealthChecker(config HealthConfig, server signalr.Server, listening *healthcheck.Flag) *healthcheck.Checker {
+	if config.MaxGoroutines <= 0 {
+		config.MaxGoroutines = 10000
+	}
+	if config.MaxConnections <= 0 {
+		config.MaxConnections = 5000
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5
+	}
+	checker := healthcheck.New(time.Duration(config.Timeout) * time.Second)
+	checker.AddLiveness("lifetimeManager", healthcheck.LifetimeManager(server))
+	checker.AddReadiness("listener", listening.Check(errors.New("listener not bound")))
+	checker.AddReadiness("logger", func(context.Context) error { return logger.Writable() })
+	checker.AddReadiness("goroutines", healthcheck.Goroutines(config.MaxGoroutines))
+	checker.AddReadiness("connections", healthcheck.Connections(server, config.MaxConnections))
+	return checker
+}
+
+// newMQTTOptions converts the MQTTConfig to the options of the bridge, without its Publish and Logf
+func newMQTTOptions(config MQTTConfig) (mqttbridge.Options, error) {
+	clientID := config.ClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = "iac-signalr-" + hostname
+	}
+	password := config.Password
+	if config.PasswordEnv != "" {
+		password = os.Getenv(config.PasswordEnv)
+	}
+	keepAlive := config.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = 30
+	}
+	maxReconnectInterval := config.MaxReconnectInterval
+	if maxReconnectInterval <= 0 {
+		maxReconnectInterval = 60
+	}
+	options := mqttbridge.Options{
+		Broker:               config.Broker,
+		ClientID:             clientID,
+		Username:             config.Username,
+		Password:             password,
+		CleanSession:         config.CleanSession,
+		KeepAlive:            time.Duration(keepAlive) * time.Second,
+		MaxReconnectInterval: time.Duration(maxReconnectInterval) * time.Second,
+		QueueSize:            config.QueueSize,
+	}
+	for _, rule := range config.Inbound {
+		options.Inbound = append(options.Inbound, mqttbridge.Rule(rule))
+	}
+	for _, rule := range config.Outbound {
+		options.Outbound = append(options.Outbound, mqttbridge.Rule(rule))
+	}
+	switch strings.SplitN(config.Broker, "://", 2)[0] {
+	case "ssl", "tls", "mqtts", "wss":
+		tlsConfig, err := newClientTLSConfig(config.TLS)
+		if err != nil {
+			return options, err
+		}
+		options.TLS = tlsConfig
+	}
+	return options, nil
+}
+
+// newSTOMPOptions converts the STOMPConfig to the options of the bridge, without its Publish and Logf
+func newSTOMPOptions(config STOMPConfig) (stompbridge.Options, error) {
+	passcode := config.Passcode
+	if config.PasscodeEnv != "" {
+		passcode = os.Getenv(config.PasscodeEnv)
+	}
+	options := stompbridge.Options{
+		Address:              config.Address,
+		Login:                config.Login,
+		Passcode:             passcode,
+		Host:                 config.Host,
+		ClientID:             config.ClientID,
+		HeartBeat:            time.Duration(config.HeartBeat) * time.Second,
+		MaxReconnectInterval: time.Duration(config.MaxReconnectInterval) * time.Second,
+		QueueSize:            config.QueueSize,
+		SendTimeout:          time.Duration(config.SendTimeout) * time.Millisecond,
+	}
+	for _, rule := range config.Inbound {
+		options.Inbound = append(options.Inbound, stompbridge.Rule(rule))
+	}
+	for _, rule := range config.Outbound {
+		options.Outbound = append(options.Outbound, stompbridge.Rule(rule))
+	}
+	if config.UseTLS {
+		tlsConfig, err := newClientTLSConfig(config.TLS)
+		if err != nil {
+			return options, err
+		}
+		options.TLS = tlsConfig
+	}
+	return options, nil
 }
 
 var ilog logger.Log
@@ -41,6 +388,15 @@ var nodedata map[string]interface{}
 var IACMessageBusName = "/iacmessagebus"
 var SignalRConfig Config
 
+// runningServer is the message bus server and its health checks, used by /health and the heartbeat
+type runningServer struct {
+	server  signalr.Server
+	checker *healthcheck.Checker
+}
+
+// running is nil until the server is created
+var running atomic.Pointer[runningServer]
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -69,9 +425,69 @@ func secureCompare(a, b string) bool {
 	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
 
-func runHTTPServer(address string, hub signalr.HubInterface, clients string, config Config) {
-	// Create SignalR logger adapter
-	logAdapter := logger.NewSignalRLogAdapter(ilog)
+// requireAPIKey rejects requests without the "apikey <key>" Authorization header
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !secureCompare("apikey "+getAPIKey(SignalRConfig), r.Header.Get("Authorization")) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizedAPIKey checks the "apikey <key>" or "Bearer <key>" Authorization header, or the access_token
+// query parameter, which the browser SignalR client uses for websockets as it can't set headers there.
+func authorizedAPIKey(r *http.Request) bool {
+	apiKey := getAPIKey(SignalRConfig)
+	if apiKey == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	return secureCompare("apikey "+apiKey, auth) ||
+		secureCompare("Bearer "+apiKey, auth) ||
+		secureCompare(apiKey, r.URL.Query().Get("access_token"))
+}
+
+// newUserFromRequest returns the function which determines the user of a connection from its request.
+// A verified client certificate takes precedence over the header, which clients could set to any user.
+func newUserFromRequest(config UserConfig) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			return r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+		if config.TrustedProxy && config.Header != "" {
+			return r.Header.Get(config.Header)
+		}
+		return ""
+	}
+}
+
+// newCORSPolicy builds the CORS policy from the comma separated origins in Config.Clients and Config.CORS
+func newCORSPolicy(config Config) signalr.CORSPolicy {
+	policy := signalr.CORSPolicy{
+		AllowCredentials: true,
+		MaxAge:           time.Duration(config.CORS.MaxAge) * time.Second,
+		ExposedHeaders:   config.CORS.ExposedHeaders,
+		AllowedHeaders:   config.CORS.AllowedHeaders,
+	}
+	if config.CORS.AllowCredentials != nil {
+		policy.AllowCredentials = *config.CORS.AllowCredentials
+	}
+	for _, origin := range strings.Split(config.Clients, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			policy.AllowedOrigins = append(policy.AllowedOrigins, origin)
+		}
+	}
+	return policy
+}
+
+// runHTTPServer serves the hub until ctx is done and shuts the http server down. It returns an error if the
+// server could not be started or stopped serving before ctx was done.
+func runHTTPServer(ctx context.Context, address string, hub *IACMessageBus, config Config) error {
+	// Structured SignalR logging. Debug logging is switched per connection or hub method by the admin API.
+	logAdapter := signalr.SlogLogger(logger.NewSlogHandler(ilog))
+	debugFilter := &signalr.DebugFilter{}
 
 	// Get timeout configuration with defaults
 	keepAlive := config.KeepAliveInterval
@@ -83,26 +499,255 @@ func runHTTPServer(address string, hub signalr.HubInterface, clients string, con
 		timeout = 60 // default 60 seconds
 	}
 
+	if config.SchemaDir != "" {
+		schemas, err := schema.Load(config.SchemaDir)
+		if err != nil {
+			return fmt.Errorf("failed to load message schemas from %s: %w", config.SchemaDir, err)
+		}
+		hub.schemas = schemas
+		ilog.Info(fmt.Sprintf("Loaded message schemas for topics %v", schemas.Topics()))
+	}
+
+	if config.Dashboard.Enabled {
+		hub.monitor = dashboard.NewMonitor(dashboard.MonitorOptions{
+			MaxTopics: config.Dashboard.MaxTopics,
+			TopicTTL:  time.Duration(config.Dashboard.TopicTTL) * time.Second,
+			Redact:    config.Dashboard.Redact,
+		})
+	}
+
+	hub.topics = topic.NewSubscriptions()
+	var retainStore retain.Store = retain.NewMemoryStore()
+	if config.Retain.File != "" {
+		fileStore, err := retain.NewFileStore(config.Retain.File)
+		if err != nil {
+			return fmt.Errorf("failed to open the retained messages %s: %w", config.Retain.File, err)
+		}
+		retainStore = fileStore
+		ilog.Info(fmt.Sprintf("Keeping retained messages in %s", config.Retain.File))
+	}
+	for _, filter := range config.Retain.Topics {
+		if err := topic.ValidateFilter(filter); err != nil {
+			return fmt.Errorf("invalid retained topic: %w", err)
+		}
+	}
+	hub.retained = retain.New(retainStore, retain.Options{
+		TTL:    time.Duration(config.Retain.TTL) * time.Second,
+		Topics: config.Retain.Topics,
+	})
+	defer hub.retained.Close()
+	if len(config.History.Topics) > 0 {
+		for _, filter := range config.History.Topics {
+			if err := topic.ValidateFilter(filter); err != nil {
+				return fmt.Errorf("invalid history topic: %w", err)
+			}
+		}
+		messageHistory, err := history.Open(history.Options{
+			Dir:         config.History.Dir,
+			Topics:      config.History.Topics,
+			MaxCount:    config.History.MaxCount,
+			MaxAge:      time.Duration(config.History.MaxAge) * time.Second,
+			MaxBytes:    config.History.MaxBytes,
+			SegmentSize: config.History.SegmentSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open the message history in %s: %w", config.History.Dir, err)
+		}
+		defer messageHistory.Close()
+		hub.history = messageHistory
+		ilog.Info(fmt.Sprintf("Keeping the message history of topics %v in %q", config.History.Topics, config.History.Dir))
+	}
+	hub.broadcast = config.MessageBus.Broadcast
+	if hub.broadcast {
+		ilog.Info("Message bus broadcasts all topics to all connections")
+	}
+
+	// the delivery queue and the request router send through the server, which is created below
+	var server signalr.Server
+	if config.Delivery.AtLeastOnce {
+		deadLetterTopic := config.Delivery.DeadLetterTopic
+		if deadLetterTopic == "" {
+			deadLetterTopic = "IAC/deadletter"
+		}
+		hub.delivery = delivery.New(delivery.Options{
+			VisibilityTimeout: time.Duration(config.Delivery.VisibilityTimeout) * time.Second,
+			MaxAttempts:       config.Delivery.MaxAttempts,
+			Groups:            config.Delivery.Groups,
+			Deliver: func(connectionID string, d delivery.Delivery) {
+				signalr.ClientsWithHeaders(server.HubClients(), d.Headers).Client(connectionID).Send("sendtobackend", d)
+			},
+			DeadLetter: func(d delivery.Delivery) {
+				ilog.Error(fmt.Sprintf("Message %s of topic %s was not acknowledged by consumer group %s after %d attempts, moved to %s",
+					d.ID, d.Topic, d.Group, d.Attempt, deadLetterTopic))
+				hub.publishTo(server.HubClients(), d.Headers, deadLetterTopic, d)
+			},
+		})
+		ilog.Info(fmt.Sprintf("SendToBackEnd delivers at least once to consumer groups, dead letters go to %s", deadLetterTopic))
+	}
+
+	if len(config.Webhooks.Endpoints) > 0 {
+		var endpoints []webhook.Endpoint
+		for _, e := range config.Webhooks.Endpoints {
+			secret := e.Secret
+			if e.SecretEnv != "" {
+				secret = os.Getenv(e.SecretEnv)
+			}
+			endpoints = append(endpoints, webhook.Endpoint{
+				Name:             e.Name,
+				URL:              e.URL,
+				Topics:           e.Topics,
+				Secret:           secret,
+				Headers:          e.Headers,
+				Timeout:          time.Duration(e.Timeout) * time.Millisecond,
+				Concurrency:      e.Concurrency,
+				QueueSize:        e.QueueSize,
+				MaxAttempts:      e.MaxAttempts,
+				Backoff:          time.Duration(e.Backoff) * time.Millisecond,
+				MaxBackoff:       time.Duration(e.MaxBackoff) * time.Millisecond,
+				BreakerThreshold: e.BreakerThreshold,
+				BreakerCooldown:  time.Duration(e.BreakerCooldown) * time.Second,
+			})
+		}
+		webhooks, err := webhook.New(endpoints, webhook.Options{
+			LogSize: config.Webhooks.LogSize,
+			OnResult: func(entry webhook.LogEntry) {
+				if entry.Status != webhook.StatusDelivered {
+					ilog.Error(fmt.Sprintf("Webhook %s: message %s of topic %s %s after %d attempts: %s",
+						entry.Endpoint, entry.ID, entry.Topic, entry.Status, entry.Attempts, entry.Error))
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("invalid webhooks: %w", err)
+		}
+		defer webhooks.Close()
+		hub.webhooks = webhooks
+		ilog.Info(fmt.Sprintf("Delivering messages to %d webhook endpoints", len(endpoints)))
+	}
+
+	if config.MQTT.Broker != "" {
+		mqttOptions, err := newMQTTOptions(config.MQTT)
+		if err != nil {
+			return fmt.Errorf("invalid MQTT bridge: %w", err)
+		}
+		// inbound messages are sent through the server, the bridge is started once it is created
+		mqttOptions.Publish = func(topic string, message string, retained bool) error {
+			return hub.bridgePublisher(mqttMethod, server)(topic, message, retained)
+		}
+		mqttOptions.Logf = func(format string, args ...interface{}) {
+			ilog.Info(fmt.Sprintf(format, args...))
+		}
+		hub.mqtt, err = mqttbridge.New(mqttOptions)
+		if err != nil {
+			return fmt.Errorf("invalid MQTT bridge: %w", err)
+		}
+	}
+
+	if config.STOMP.Address != "" {
+		stompOptions, err := newSTOMPOptions(config.STOMP)
+		if err != nil {
+			return fmt.Errorf("invalid STOMP bridge: %w", err)
+		}
+		stompOptions.Publish = func(topic string, message string) error {
+			return hub.bridgePublisher(stompMethod, server)(topic, message, false)
+		}
+		stompOptions.Logf = func(format string, args ...interface{}) {
+			ilog.Info(fmt.Sprintf(format, args...))
+		}
+		hub.stomp, err = stompbridge.New(stompOptions)
+		if err != nil {
+			return fmt.Errorf("invalid STOMP bridge: %w", err)
+		}
+	}
+
+	hub.requests = reply.New(reply.Options{
+		DefaultTimeout: time.Duration(config.Requests.DefaultTimeout) * time.Millisecond,
+		MaxTimeout:     time.Duration(config.Requests.MaxTimeout) * time.Millisecond,
+		Send: func(connectionID string, request reply.Request) {
+			server.HubClients().Client(connectionID).Send("request", request)
+		},
+	})
+
+	cors := newCORSPolicy(config)
 	// Configure server with proper timeout settings and WebSocket-only transport
 	// Force WebSocket transport to avoid SSE/long polling issues
 	// TimeoutInterval should be at least 2x KeepAliveInterval
-	server, err := signalr.NewServer(context.TODO(), signalr.SimpleHubFactory(hub),
-		signalr.Logger(logAdapter, false),
+	options := []func(signalr.Party) error{
+		signalr.HubFactory(hub.newInstance),
+		signalr.LoggerWithDebugFilter(logAdapter, debugFilter),
 		signalr.HTTPTransports(signalr.TransportWebSockets), // Force WebSocket only
-		signalr.KeepAliveInterval(time.Duration(keepAlive)*time.Second),
-		signalr.TimeoutInterval(time.Duration(timeout)*time.Second),
-		signalr.HandshakeTimeout(15*time.Second),
-		signalr.AllowOriginPatterns(strings.Split(clients, ",")),
-		signalr.InsecureSkipVerify(config.InsecureSkipVerify))
+		signalr.KeepAliveInterval(time.Duration(keepAlive) * time.Second),
+		signalr.TimeoutInterval(time.Duration(timeout) * time.Second),
+		signalr.HandshakeTimeout(15 * time.Second),
+		signalr.CORS(cors),
+		signalr.InsecureSkipVerify(config.InsecureSkipVerify),
+		signalr.UserFromRequest(newUserFromRequest(config.User)),
+	}
+
+	if config.Audit.File != "" {
+		hashKey := config.Audit.HashKey
+		if config.Audit.HashKeyEnv != "" {
+			hashKey = os.Getenv(config.Audit.HashKeyEnv)
+		}
+		auditSink, err := audit.NewFileSink(config.Audit.File, audit.Options{
+			MaxSize:   int64(config.Audit.MaxSize) * 1024 * 1024,
+			MaxFiles:  config.Audit.MaxFiles,
+			HashChain: config.Audit.HashChain,
+			Key:       []byte(hashKey),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open audit file %s: %w", config.Audit.File, err)
+		}
+		defer auditSink.Close()
+		options = append(options, signalr.WithAuditSink(auditSink))
+		ilog.Info(fmt.Sprintf("Writing audit events to %s, hash chain: %v", config.Audit.File, config.Audit.HashChain))
+	}
+
+	var prometheusMetrics *metrics.Prometheus
+	if config.Metrics.Enabled {
+		prometheusMetrics = metrics.NewPrometheus()
+		options = append(options, signalr.WithMetrics(prometheusMetrics))
+	}
 
+	if hub.monitor != nil {
+		options = append(options, signalr.WithMetrics(hub.monitor))
+	}
+
+	var recorder *capture.Recorder
+	if config.Capture.Enabled {
+		recorder = capture.New(capture.Options{
+			Size:        config.Capture.Size,
+			MaxDuration: time.Duration(config.Capture.MaxDuration) * time.Second,
+			Redact:      config.Capture.Redact,
+		})
+		options = append(options, signalr.WithTap(recorder))
+	}
+
+	server, err := signalr.NewServer(ctx, options...)
 	if err != nil {
-		ilog.Error(fmt.Sprintf("Failed to create SignalR server: %v", err))
-		return
+		return fmt.Errorf("failed to create SignalR server: %w", err)
 	}
 
-	ilog.Info(fmt.Sprintf("SignalR server configured - Transport: WebSocket-only, KeepAlive: %ds, Timeout: %ds, InsecureSkipVerify: %v", keepAlive, timeout, config.InsecureSkipVerify))
+	if hub.delivery != nil {
+		deliveryCtx, stopDelivery := context.WithCancel(ctx)
+		defer stopDelivery()
+		go hub.delivery.Run(deliveryCtx)
+	}
 
-	signalr.AllowedClients = clients
+	if hub.mqtt != nil {
+		hub.mqtt.Start()
+		defer hub.mqtt.Close()
+		ilog.Info(fmt.Sprintf("Bridging %d inbound and %d outbound MQTT rules with %s",
+			len(config.MQTT.Inbound), len(config.MQTT.Outbound), config.MQTT.Broker))
+	}
+	if hub.stomp != nil {
+		hub.stomp.Start()
+		defer hub.stomp.Close()
+		ilog.Info(fmt.Sprintf("Bridging %d inbound and %d outbound STOMP rules with %s",
+			len(config.STOMP.Inbound), len(config.STOMP.Outbound), config.STOMP.Address))
+	}
+
+	ilog.Info(fmt.Sprintf("SignalR server configured - Transport: WebSocket-only, KeepAlive: %ds, Timeout: %ds, InsecureSkipVerify: %v", keepAlive, timeout, config.InsecureSkipVerify))
 
 	router := http.NewServeMux()
 
@@ -110,8 +755,95 @@ func runHTTPServer(address string, hub signalr.HubInterface, clients string, con
 
 	ilog.Info(fmt.Sprintf("Serving public content from the embedded filesystem\n"))
 	router.Handle("/", http.FileServer(http.FS(public.FS)))
+	router.Handle("/schemas/", cors.Handler(hub.schemas.Handler("/schemas/")))
 
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	if prometheusMetrics != nil {
+		metricsPath := config.Metrics.Path
+		if metricsPath == "" {
+			metricsPath = "/metrics"
+		}
+		var metricsHandler http.Handler = prometheusMetrics.Handler()
+		if config.Metrics.RequireAPIKey {
+			metricsHandler = requireAPIKey(metricsHandler)
+		}
+		router.Handle(metricsPath, metricsHandler)
+		ilog.Info(fmt.Sprintf("Serving Prometheus metrics on %s", metricsPath))
+	}
+
+	if config.Admin.Enabled {
+		adminPath := strings.TrimSuffix(config.Admin.Path, "/")
+		if adminPath == "" {
+			adminPath = "/admin"
+		}
+		router.Handle(adminPath+"/", requireAPIKey(admin.NewHandler(server, adminPath)))
+		ilog.Info(fmt.Sprintf("Serving the admin API on %s/", adminPath))
+	}
+
+	if config.Publish.Enabled {
+		publishPath := strings.TrimSuffix(config.Publish.Path, "/")
+		if publishPath == "" {
+			publishPath = "/api/publish"
+		}
+		publishHandler := requireAPIKey(publish.NewHandler(publishPath, &httpPublisher{hub: hub, server: server},
+			publish.Options{MaxBatch: config.Publish.MaxBatch, MaxBodySize: config.Publish.MaxBodySize}))
+		router.Handle(publishPath, publishHandler)
+		router.Handle(publishPath+"/", publishHandler)
+		ilog.Info(fmt.Sprintf("Serving the publish API on %s/{topic}", publishPath))
+	}
+
+	if hub.webhooks != nil {
+		webhooksPath := strings.TrimSuffix(config.Webhooks.Path, "/")
+		if webhooksPath == "" {
+			webhooksPath = "/webhooks"
+		}
+		router.Handle(webhooksPath+"/", requireAPIKey(hub.webhooks.Handler(webhooksPath)))
+		ilog.Info(fmt.Sprintf("Serving the webhook status and delivery log on %s/", webhooksPath))
+	}
+
+	if recorder != nil {
+		recorder.Attach(server)
+		capturePath := strings.TrimSuffix(config.Capture.Path, "/")
+		if capturePath == "" {
+			capturePath = "/capture"
+		}
+		router.Handle(capturePath+"/", requireAPIKey(recorder.Handler(capturePath)))
+		ilog.Info(fmt.Sprintf("Serving the message capture on %s/, redacted fields: %v", capturePath, config.Capture.Redact))
+	}
+
+	if hub.monitor != nil {
+		dashboardPath := strings.TrimSuffix(config.Dashboard.Path, "/")
+		if dashboardPath == "" {
+			dashboardPath = "/dashboard"
+		}
+		board, err := dashboard.New(ctx, server, hub.monitor, dashboard.Options{Authorize: authorizedAPIKey},
+			signalr.Logger(logAdapter, false),
+			signalr.HTTPTransports(signalr.TransportWebSockets),
+			signalr.KeepAliveInterval(time.Duration(keepAlive)*time.Second),
+			signalr.TimeoutInterval(time.Duration(timeout)*time.Second))
+		if err != nil {
+			return fmt.Errorf("failed to create the dashboard: %w", err)
+		}
+		dashboardHandler := board.Handler(dashboardPath)
+		router.Handle(dashboardPath, dashboardHandler)
+		router.Handle(dashboardPath+"/", dashboardHandler)
+		ilog.Info(fmt.Sprintf("Serving the dashboard on %s/", dashboardPath))
+	}
+
+	if config.Diagnostics.Enabled {
+		go serveDiagnostics(ctx, config.Diagnostics, server)
+	}
+
+	listening := &healthcheck.Flag{}
+	healthChecker := newHealthChecker(config.Health, server, listening)
+	running.Store(&runningServer{server: server, checker: healthChecker})
+	// Probes of orchestrators and the docker health check can't send the API key
+	router.Handle("/live", healthChecker.LivenessHandler())
+	router.Handle("/ready", healthChecker.ReadinessHandler())
+	if config.Health.ProbeAddress != "" {
+		go serveProbes(ctx, config.Health.ProbeAddress, healthChecker)
+	}
+
+	router.Handle("/health", cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -123,25 +855,96 @@ func runHTTPServer(address string, hub signalr.HubInterface, clients string, con
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		result, err := CheckServiceStatus(ilog, SignalRConfig)
+		report, err := CheckServiceStatus(ilog, SignalRConfig)
+		w.Header().Set("Content-Type", "application/json")
 		if err != nil {
-			ilog.Error(fmt.Sprintf("HeartBeat error: %v", err))
+			w.WriteHeader(http.StatusServiceUnavailable)
 		}
+		json.NewEncoder(w).Encode(healthData(report))
+	})))
 
-		data := make(map[string]interface{})
-		data["Node"] = nodedata
-		data["Result"] = result
-		data["ServiceStatus"] = make(map[string]interface{})
-		data["timestamp"] = time.Now().UTC()
+	httpServer := &http.Server{
+		Addr:    address,
+		Handler: middleware.LogRequests(router),
+	}
+	if config.TLS.enabled() {
+		tlsConfig, err := newServerTLSConfig(config.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	listening.Set(true)
+	defer listening.Set(false)
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(data)
-	})
+	// Shutdown stops accepting connections and waits for the running requests, the websocket connections are
+	// closed by the server context
+	served := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			ilog.Info(fmt.Sprintf("Listening for secure websocket connections on %s %s, mutual TLS: %v", "Address:", address, config.TLS.ClientCAFile != ""))
+			// Certificates are served by tlsConfig.GetCertificate, so no files are passed here
+			served <- httpServer.ServeTLS(listener, "", "")
+			return
+		}
+		ilog.Info(fmt.Sprintf("Listening for websocket connections on %s %s", "Address:", address))
+		//	fmt.Printf("Listening for websocket connections on http://%s\n", address)
+		served <- httpServer.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+	listening.Set(false)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
 
-	ilog.Info(fmt.Sprintf("Listening for websocket connections on %s %s", "Address:", address))
-	//	fmt.Printf("Listening for websocket connections on http://%s\n", address)
-	if err := http.ListenAndServe(address, middleware.LogRequests(router)); err != nil {
-		ilog.Error(fmt.Sprintf("ListenAndServe: %s", err))
+// serveProbes serves /live and /ready over plain http until ctx is done
+func serveProbes(ctx context.Context, address string, checker *healthcheck.Checker) {
+	router := http.NewServeMux()
+	router.Handle("/live", checker.LivenessHandler())
+	router.Handle("/ready", checker.ReadinessHandler())
+	probeServer := &http.Server{
+		Addr:    address,
+		Handler: router,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = probeServer.Close()
+	}()
+	ilog.Info(fmt.Sprintf("Serving the health probes on %s", address))
+	if err := probeServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		ilog.Error(fmt.Sprintf("Health probes: %s", err))
+	}
+}
+
+// serveDiagnostics serves the pprof profiles and the goroutine report until ctx is done
+func serveDiagnostics(ctx context.Context, config DiagnosticsConfig, server signalr.Server) {
+	address := config.Address
+	if address == "" {
+		address = "127.0.0.1:6060"
+	}
+	diagnosticsServer := &http.Server{
+		Addr:    address,
+		Handler: requireAPIKey(diagnostics.NewHandler(server)),
+	}
+	go func() {
+		<-ctx.Done()
+		_ = diagnosticsServer.Close()
+	}()
+	ilog.Info(fmt.Sprintf("Serving pprof and the goroutine report on %s", address))
+	if err := diagnosticsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		ilog.Error(fmt.Sprintf("Diagnostics: %s", err))
 	}
 }
 
@@ -201,6 +1004,61 @@ func main() {
 	if envInsecure := os.Getenv("SIGNALR_INSECURE_SKIP_VERIFY"); envInsecure == "true" {
 		config.InsecureSkipVerify = true
 	}
+	if envCertFile := os.Getenv("SIGNALR_TLS_CERT_FILE"); envCertFile != "" {
+		config.TLS.CertFile = envCertFile
+	}
+	if envKeyFile := os.Getenv("SIGNALR_TLS_KEY_FILE"); envKeyFile != "" {
+		config.TLS.KeyFile = envKeyFile
+	}
+	if envClientCAFile := os.Getenv("SIGNALR_TLS_CLIENT_CA_FILE"); envClientCAFile != "" {
+		config.TLS.ClientCAFile = envClientCAFile
+	}
+	if envSchemaDir := os.Getenv("SIGNALR_SCHEMA_DIR"); envSchemaDir != "" {
+		config.SchemaDir = envSchemaDir
+	}
+	if envAuditFile := os.Getenv("SIGNALR_AUDIT_FILE"); envAuditFile != "" {
+		config.Audit.File = envAuditFile
+	}
+	if envMetrics := os.Getenv("SIGNALR_METRICS_ENABLED"); envMetrics == "true" {
+		config.Metrics.Enabled = true
+	}
+	if envAdmin := os.Getenv("SIGNALR_ADMIN_ENABLED"); envAdmin == "true" {
+		config.Admin.Enabled = true
+	}
+	if envDashboard := os.Getenv("SIGNALR_DASHBOARD_ENABLED"); envDashboard == "true" {
+		config.Dashboard.Enabled = true
+	}
+	if envCapture := os.Getenv("SIGNALR_CAPTURE_ENABLED"); envCapture == "true" {
+		config.Capture.Enabled = true
+	}
+	if envBroadcast := os.Getenv("SIGNALR_MESSAGEBUS_BROADCAST"); envBroadcast == "true" {
+		config.MessageBus.Broadcast = true
+	}
+	if envRetainFile := os.Getenv("SIGNALR_RETAIN_FILE"); envRetainFile != "" {
+		config.Retain.File = envRetainFile
+	}
+	if envHistoryDir := os.Getenv("SIGNALR_HISTORY_DIR"); envHistoryDir != "" {
+		config.History.Dir = envHistoryDir
+	}
+	if envPublish := os.Getenv("SIGNALR_PUBLISH_ENABLED"); envPublish == "true" {
+		config.Publish.Enabled = true
+	}
+	if envDelivery := os.Getenv("SIGNALR_DELIVERY_AT_LEAST_ONCE"); envDelivery == "true" {
+		config.Delivery.AtLeastOnce = true
+	}
+	if envMQTTBroker := os.Getenv("SIGNALR_MQTT_BROKER"); envMQTTBroker != "" {
+		config.MQTT.Broker = envMQTTBroker
+	}
+	if envSTOMPAddress := os.Getenv("SIGNALR_STOMP_ADDRESS"); envSTOMPAddress != "" {
+		config.STOMP.Address = envSTOMPAddress
+	}
+	if envProbeAddress := os.Getenv("SIGNALR_HEALTH_PROBE_ADDRESS"); envProbeAddress != "" {
+		config.Health.ProbeAddress = envProbeAddress
+	}
+	if envDiagnostics := os.Getenv("SIGNALR_DIAGNOSTICS_ADDRESS"); envDiagnostics != "" {
+		config.Diagnostics.Enabled = true
+		config.Diagnostics.Address = envDiagnostics
+	}
 
 	SignalRConfig = config
 	address := config.Address
@@ -215,158 +1073,142 @@ func main() {
 	nodedata["Status"] = "Running"
 	nodedata["StartTime"] = time.Now().UTC()
 
-	ilog := logger.Log{ModuleName: logger.SignalR, User: "System", ControllerName: "Signalr Server"}
+	ilog = logger.Log{ModuleName: logger.SignalR, User: "System", ControllerName: "Signalr Server"}
 	logger.Init(config.Log)
 
 	ilog.Info(fmt.Sprintf("Starting SignalR Server Address: %s, allow Clients: %s", address, clients))
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		//	url := "http://" + address + IACMessageBusName
-		hub := &IACMessageBus{
-			ilog: ilog,
+	hip, err := GetHostandIPAddress()
+	if err != nil {
+		ilog.Error(fmt.Sprintf("Failed to get host and ip address: %v", err))
+	}
+	for key, value := range hip {
+		nodedata[key] = value
+	}
+	if _, port, err := net.SplitHostPort(address); err == nil && hip["Host"] != nil {
+		scheme := "http"
+		if config.TLS.enabled() {
+			scheme = "https"
 		}
+		nodedata["healthapi"] = fmt.Sprintf("%s://%s:%s/health", scheme, hip["Host"], port)
+	}
 
-		go runHTTPServer(address, hub, clients, config)
-		<-time.After(time.Millisecond * 2)
-		/*	go func() {
-			fmt.Println(runHTTPClient(url, &receiver{}))
-		}() */
-	}()
-	/*
-		hip, err := GetHostandIPAddress()
-
-		if err != nil {
-			ilog.Error(fmt.Sprintf("Failed to get host and ip address: %v", err))
-		}
-		for key, value := range hip {
-			nodedata[key] = value
-		}
-		if hip["Host"] != nil {
-			port := 0
-			if strings.Contains(address, ":") {
-				urls := strings.Split(address, ":")
-				if len(urls) == 2 {
-					p, err := strconv.Atoi(urls[1])
-					if err != nil {
-						ilog.Error(fmt.Sprintf("Failed to get port number: %v", err))
-					} else {
-						port = p
-					}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-				}
-			} else {
-				p, err := strconv.Atoi(address)
-				if err != nil {
-					ilog.Error(fmt.Sprintf("Failed to get port number: %v", err))
-				} else {
-					port = p
-				}
-
-			}
+	hub := &IACMessageBus{
+		ilog: ilog,
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- runHTTPServer(ctx, address, hub, config)
+	}()
 
-			if port > 0 {
-				nodedata["healthapi"] = fmt.Sprintf("http://%s:%d/health", hip["Host"], port)
-			}
-		}
-		// Start the heartbeat
+	var wg sync.WaitGroup
+	if service := newHeartbeat(config); service != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for {
-				HeartBeat(ilog, config)
-				time.Sleep(5 * time.Minute)
-			}
+			service.Run(ctx)
 		}()
-	*/
-	wg.Wait()
-
-	ch := make(chan struct{})
-	<-ch
-}
-
-func HeartBeat(ilog logger.Log, gconfig Config) {
-	ilog.Debug("Start HeartBeat for iac-activemq application with appid: " + nodedata["AppID"].(string))
-	appHeartBeatUrl := gconfig.AppServer["url"].(string) + "/IACComponents/heartbeat"
-	//ilog.Debug("HeartBeat URL: " + appHeartBeatUrl)
-
-	result, err := CheckServiceStatus(ilog, gconfig)
-	if err != nil {
-		ilog.Error(fmt.Sprintf("HeartBeat error: %v", err))
 	}
 
-	data := make(map[string]interface{})
-	data["Node"] = nodedata
-	data["Result"] = result
-	data["ServiceStatus"] = make(map[string]interface{})
-	data["timestamp"] = time.Now().UTC()
-	// send the heartbeat to the server
-	headers := make(map[string]string)
-	headers["Content-Type"] = "application/json"
-	headers["Authorization"] = "apikey " + getAPIKey(gconfig)
-
-	_, err = CallWebService(appHeartBeatUrl, "POST", data, headers)
-
-	if err != nil {
-		ilog.Error(fmt.Sprintf("HeartBeat error: %v", err))
-		return
+	select {
+	case err := <-served:
+		// the server failed to start or stopped serving, deregister from the app server and exit
+		ilog.Error(fmt.Sprintf("SignalR Server stopped: %v", err))
+		stop()
+		wg.Wait()
+		os.Exit(1)
+	case <-ctx.Done():
 	}
-
-	//	ilog.Debug(fmt.Sprintf("HeartBeat post response: %v", response))
+	ilog.Info("Shutting down SignalR Server")
+	if err := <-served; err != nil {
+		ilog.Error(fmt.Sprintf("Failed to shut down the SignalR Server: %v", err))
+	}
+	// Wait for the deregistration from the app server
+	wg.Wait()
 }
 
-func CheckServiceStatus(iLog logger.Log, config Config) (map[string]interface{}, error) {
-	iLog.Debug("Check SignalR Server Status")
-
-	result, err := health.CheckSignalRServerHealth(nodedata, "http://"+config.Address, "ws:"+config.Address)
+// newHeartbeat creates the registration with the app server, or returns nil if there is no app server or it is disabled
+func newHeartbeat(config Config) *heartbeat.Service {
+	appServerURL, _ := config.AppServer["url"].(string)
+	if appServerURL == "" || config.Heartbeat.Disabled {
+		return nil
+	}
+	path := config.Heartbeat.Path
+	if path == "" {
+		path = "/IACComponents/heartbeat"
+	}
+	deregisterPath := config.Heartbeat.DeregisterPath
+	if deregisterPath == "" {
+		deregisterPath = path
+	}
+	appServerURL = strings.TrimSuffix(appServerURL, "/")
+	service, err := heartbeat.New(heartbeat.Options{
+		URL:           appServerURL + path,
+		DeregisterURL: appServerURL + deregisterPath,
+		APIKey:        getAPIKey(config),
+		Interval:      time.Duration(config.Heartbeat.Interval) * time.Second,
+		OnError: func(err error) {
+			ilog.Error(fmt.Sprintf("HeartBeat error: %v", err))
+		},
+	}, heartbeatPayload)
 	if err != nil {
-		iLog.Error(fmt.Sprintf("Check SignalR Server Status error: %v", err))
-		return nil, err
+		ilog.Error(fmt.Sprintf("Failed to create the heartbeat: %v", err))
+		return nil
 	}
-
-	return result, nil
+	ilog.Info(fmt.Sprintf("Registering with the app server at %s", appServerURL+path))
+	return service
 }
 
-func CallWebService(url string, method string, data map[string]interface{}, headers map[string]string) (map[string]interface{}, error) {
-	var result map[string]interface{}
-	// Create a new HTTP client
-	client := &http.Client{}
-
-	bytesdata, err := json.Marshal(data)
-	if err != nil {
-		//	fmt.Error(fmt.Sprintf("Error:", err))
-		return nil, err
+// heartbeatPayload is the /health data with the connection and group statistics of the server
+func heartbeatPayload() map[string]interface{} {
+	report, _ := CheckServiceStatus(ilog, SignalRConfig)
+	data := healthData(report)
+	if r := running.Load(); r != nil {
+		data["Statistics"] = heartbeat.ServerStats(r.server)
 	}
+	return data
+}
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(bytesdata))
+// CheckServiceStatus runs the in-process readiness checks. It returns an error if one of them failed.
+func CheckServiceStatus(iLog logger.Log, config Config) (healthcheck.Report, error) {
+	iLog.Debug("Check SignalR Server Status")
 
-	if err != nil {
-		//	fmt.Error("Error in WebServiceCallFunc.Execute: %s", err)
-		return nil, err
+	r := running.Load()
+	if r == nil {
+		return healthcheck.Report{Status: healthcheck.StatusDown, Time: time.Now().UTC()}, errors.New("SignalR server not started")
 	}
-	if headers != nil {
-		for key, value := range headers {
-			req.Header.Set(key, value)
+	report := r.checker.Readiness(context.Background())
+	if !report.Up() {
+		var failed []string
+		for _, check := range report.Checks {
+			if check.Status != healthcheck.StatusUp {
+				failed = append(failed, check.Name+": "+check.Error)
+			}
 		}
+		err := fmt.Errorf("SignalR server not ready: %s", strings.Join(failed, ", "))
+		iLog.Error(fmt.Sprintf("Check SignalR Server Status error: %v", err))
+		return report, err
 	}
+	return report, nil
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	err = json.Unmarshal(respBody, &result)
-	if err != nil {
-		//	fmt.Error(fmt.Sprintf("Error:", err))
-		return nil, err
+// healthData is the body of /health and the heartbeat, with the status of each check in ServiceStatus
+func healthData(report healthcheck.Report) map[string]interface{} {
+	serviceStatus := make(map[string]interface{})
+	for _, check := range report.Checks {
+		serviceStatus[check.Name] = check
 	}
-	//	fmt.printf("Response data: %v", result)
-	return result, nil
+	data := make(map[string]interface{})
+	data["Node"] = nodedata
+	data["Result"] = map[string]interface{}{"status": report.Status, "time": report.Time}
+	data["ServiceStatus"] = serviceStatus
+	data["timestamp"] = time.Now().UTC()
+	return data
 }
+
 func GetHostandIPAddress() (map[string]interface{}, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -17,19 +17,56 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/mdaxf/iac-signalr/dashboard"
+	"github.com/mdaxf/iac-signalr/delivery"
+	"github.com/mdaxf/iac-signalr/history"
 	"github.com/mdaxf/iac-signalr/logger"
+	"github.com/mdaxf/iac-signalr/mqttbridge"
+	"github.com/mdaxf/iac-signalr/publish"
+	"github.com/mdaxf/iac-signalr/reply"
+	"github.com/mdaxf/iac-signalr/retain"
+	"github.com/mdaxf/iac-signalr/schema"
 	"github.com/mdaxf/iac-signalr/signalr"
+	"github.com/mdaxf/iac-signalr/stompbridge"
+	"github.com/mdaxf/iac-signalr/topic"
+	"github.com/mdaxf/iac-signalr/webhook"
 )
 
 type IACMessageBus struct {
 	signalr.Hub
-	ilog logger.Log
+	ilog    logger.Log
+	schemas *schema.Registry
+	monitor *dashboard.Monitor // counts the messages per topic for the dashboard, may be nil
+	topics  *topic.Subscriptions
+	// broadcast sends the messages of Send and AddMessage to all connections instead of the subscribers
+	// of the topic, for older clients which do not subscribe and filter the topics themselves.
+	broadcast bool
+	retained  *retain.Retainer
+	history   *history.History // keeps the messages of the configured topics for SubscribeFrom, may be nil
+	// delivery keeps the messages of SendToBackEnd until a consumer acknowledges them, nil without at-least-once delivery
+	delivery *delivery.Queue
+	requests *reply.Router       // routes Request to the connections which serve its topic
+	webhooks *webhook.Dispatcher // delivers the messages of the configured topics to HTTP endpoints, may be nil
+	mqtt     *mqttbridge.Bridge  // forwards the messages of the configured topics to the MQTT broker, may be nil
+	stomp    *stompbridge.Bridge // forwards the messages of the configured topics to the STOMP broker, may be nil
 }
 
+// newInstance creates the hub instance of an invocation. Hub instances share the logger, schemas, monitor,
+// subscriptions, retained messages, history, delivery queue, request router, webhooks and bridges of the prototype c.
+func (c *IACMessageBus) newInstance() signalr.HubInterface {
+	return &IACMessageBus{ilog: c.ilog, schemas: c.schemas, monitor: c.monitor, topics: c.topics,
+		broadcast: c.broadcast, retained: c.retained, history: c.history, delivery: c.delivery,
+		requests: c.requests, webhooks: c.webhooks, mqtt: c.mqtt, stomp: c.stomp}
+}
+
+// retainHeader flags a Send or AddMessage as retained when its value is "true"
+const retainHeader = "retain"
+
 var groupname = "IAC_Internal_MessageBus"
 
 // uiGroupname is the group that only frontend (UI) clients join.
@@ -38,8 +75,88 @@ var groupname = "IAC_Internal_MessageBus"
 // the "Unknown method" completion that previously caused disconnections.
 var uiGroupname = "IAC_UI_MessageBus"
 
-func (c *IACMessageBus) Subscribe(topic string, connectionID string) {
-	c.ilog.Debug(fmt.Sprintf("Subscribe: topic: %s, sender: %s\n", topic, connectionID))
+// Subscribe subscribes the calling connection to the topic filter, so it receives the messages of the matching
+// topics. The filter may contain the MQTT wildcards "+" for one level and "#" for any levels, like "plant1/+/machine7/#".
+// The connectionID of the sender is only logged, it is kept for the clients which pass it.
+// The retained messages of the matching topics are sent to the caller right away.
+func (c *IACMessageBus) Subscribe(topic string, connectionID string) error {
+	c.ilog.Debug(fmt.Sprintf("Subscribe: topic: %s, sender: %s, connection: %s\n", topic, connectionID, c.ConnectionID()))
+	if _, err := c.topics.Subscribe(topic, c.ConnectionID()); err != nil {
+		return err
+	}
+	messages, err := c.retained.Matching(topic)
+	if err != nil {
+		c.ilog.Error(fmt.Sprintf("Subscribe: retained messages of %s: %v", topic, err))
+		return nil
+	}
+	for _, message := range messages {
+		c.Clients().Caller().Send(message.Topic, message.Payload)
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscription of the calling connection to the topic filter
+func (c *IACMessageBus) Unsubscribe(topic string, connectionID string) {
+	c.ilog.Debug(fmt.Sprintf("Unsubscribe: topic: %s, sender: %s, connection: %s\n", topic, connectionID, c.ConnectionID()))
+	c.topics.Unsubscribe(topic, c.ConnectionID())
+}
+
+// publish sends the message to the subscribers of the topic, or to all connections in broadcast mode.
+// Subscribers with several matching filters receive the message once. The headers of the invocation are sent along.
+func (c *IACMessageBus) publish(topic string, message string) {
+	c.publishTo(c.Clients(), c.Headers(), topic, message)
+}
+
+// publishTo is publish for callers outside of hub invocations, which pass the HubClients of the server
+// and the headers to send, if any
+func (c *IACMessageBus) publishTo(clients signalr.HubClients, headers map[string]string, topic string, message interface{}) {
+	clients = signalr.ClientsWithHeaders(clients, headers)
+	if c.broadcast {
+		clients.Group(groupname).Send(topic, message)
+		return
+	}
+	for _, connectionID := range c.topics.Subscribers(topic) {
+		clients.Client(connectionID).Send(topic, message)
+	}
+}
+
+// SubscribeFrom streams the messages of the topic with a sequence number after lastSeq, followed by the live
+// messages of the topic, each with its sequence number. A client which reconnects passes the sequence number
+// of the last message it received, so it gets the messages it missed before the new ones. The stream ends when
+// the client falls too far behind or the topic has no history; the client then calls SubscribeFrom again. When the
+// client cancels the stream or disconnects, the server stops following the topic.
+func (c *IACMessageBus) SubscribeFrom(topic string, lastSeq uint64) <-chan history.Entry {
+	c.ilog.Debug(fmt.Sprintf("SubscribeFrom: topic: %s, lastSeq: %d, connection: %s\n", topic, lastSeq, c.ConnectionID()))
+	if !c.history.Enabled(topic) {
+		c.ilog.Error(fmt.Sprintf("SubscribeFrom: topic %s has no history", topic))
+		entries := make(chan history.Entry)
+		close(entries)
+		return entries
+	}
+	return c.history.Follow(c.Context(), topic, lastSeq)
+}
+
+// published passes a message sent to a topic to the history and the outbound integrations.
+// Messages which came from a bridge are not forwarded back to it.
+func (c *IACMessageBus) published(method string, topic string, message string) {
+	c.record(method, topic, message)
+	c.webhooks.Dispatch(topic, message)
+	if method != mqttMethod {
+		c.mqtt.Forward(topic, message)
+	}
+	if method != stompMethod {
+		c.stomp.Forward(topic, message)
+	}
+}
+
+// record adds the message to the history of the topic, if its history is kept
+func (c *IACMessageBus) record(method string, topic string, message string) {
+	if !c.history.Enabled(topic) {
+		return
+	}
+	if _, err := c.history.Append(topic, message); err != nil {
+		c.ilog.Error(fmt.Sprintf("%s: failed to add the message of %s to the history: %v", method, topic, err))
+	}
 }
 
 // SubscribeUI adds the calling connection to the UI-only broadcast group.
@@ -50,21 +167,117 @@ func (c *IACMessageBus) SubscribeUI(connectionID string) {
 	c.Groups().AddToGroup(uiGroupname, connectionID)
 }
 
-func (c *IACMessageBus) Send(topic string, message string, connectionID string) {
+// validate checks the message against the schema of the topic, if there is one.
+// Invalid messages are not sent and the error is returned to the caller as error completion.
+func (c *IACMessageBus) validate(method string, topicName string, message string, connectionID string) error {
+	return c.reject(method, connectionID, c.schemas.Validate(topicName, message))
+}
+
+// validateForSubscribers is validate for messages to the subscribers of the topic. Without broadcast, the topic
+// must not contain wildcards, which are reserved for subscriptions.
+func (c *IACMessageBus) validateForSubscribers(method string, topicName string, message string, connectionID string) error {
+	if !c.broadcast {
+		if err := c.reject(method, connectionID, topic.ValidateTopic(topicName)); err != nil {
+			return err
+		}
+	}
+	return c.validate(method, topicName, message, connectionID)
+}
+
+// reject logs and counts err of a rejected message and returns it
+func (c *IACMessageBus) reject(method string, connectionID string, err error) error {
+	if err != nil {
+		c.ilog.Error(fmt.Sprintf("%s: rejected message from %s: %v", method, connectionID, err))
+		c.monitor.Error(method, err)
+	}
+	return err
+}
+
+func (c *IACMessageBus) Send(topic string, message string, connectionID string) error {
 	c.ilog.Info(fmt.Sprintf("Send: topic: %s, sender: %s\n", topic, connectionID))
-	c.Clients().Group(groupname).Send(topic, message)
+	if err := c.validateForSubscribers("Send", topic, message, connectionID); err != nil {
+		return err
+	}
+	c.publish(topic, message)
+	c.monitor.Message("Send", topic, message, connectionID)
+	c.retainIfFlagged("Send", topic, message)
+	c.published("Send", topic, message)
+	return nil
+}
+
+// SendRetained sends the message like Send and keeps it as last value of the topic for new subscribers.
+// An empty message clears the retained value.
+func (c *IACMessageBus) SendRetained(topic string, message string, connectionID string) error {
+	if message == "" {
+		return c.ClearRetained(topic, connectionID)
+	}
+	c.ilog.Info(fmt.Sprintf("SendRetained: topic: %s, sender: %s\n", topic, connectionID))
+	if err := c.validateForSubscribers("SendRetained", topic, message, connectionID); err != nil {
+		return err
+	}
+	c.publish(topic, message)
+	c.monitor.Message("SendRetained", topic, message, connectionID)
+	c.published("SendRetained", topic, message)
+	return c.retained.Retain(topic, message)
+}
+
+// ClearRetained removes the retained value of the topic
+func (c *IACMessageBus) ClearRetained(topic string, connectionID string) error {
+	c.ilog.Info(fmt.Sprintf("ClearRetained: topic: %s, sender: %s\n", topic, connectionID))
+	return c.retained.Clear(topic)
+}
+
+// retainIfFlagged keeps the message as last value of the topic if the invocation has the retain header
+// or the topic is retained by configuration
+func (c *IACMessageBus) retainIfFlagged(method string, topic string, message string) {
+	c.retainMessage(method, topic, message, c.Headers()[retainHeader] == "true")
+}
+
+// retainMessage keeps the message as last value of the topic if it is flagged or the topic is retained by configuration
+func (c *IACMessageBus) retainMessage(method string, topic string, message string, flagged bool) {
+	if !flagged && !c.retained.Retains(topic) {
+		return
+	}
+	if err := c.retained.Retain(topic, message); err != nil {
+		c.ilog.Error(fmt.Sprintf("%s: failed to retain the message of %s: %v", method, topic, err))
+	}
+}
+
+// headerClients returns the Clients of the hub, which send the headers of the current invocation along,
+// so correlation or tenant ids of the sender reach the receivers of its messages
+func (c *IACMessageBus) headerClients() signalr.HubClients {
+	return signalr.ClientsWithHeaders(c.Clients(), c.Headers())
 }
 
 // SendToUI broadcasts topic+message to the IAC_UI_MessageBus group only.
 // Called by iac-main backend to push agent progress/chat events to frontend clients.
 // Backend Go clients do not join this group, so they never see these messages.
-func (c *IACMessageBus) SendToUI(topic string, message string, connectionID string) {
+func (c *IACMessageBus) SendToUI(topic string, message string, connectionID string) error {
 	c.ilog.Info(fmt.Sprintf("SendToUI: topic: %s, sender: %s\n", topic, connectionID))
-	c.Clients().Group(uiGroupname).Send(topic, message)
+	if err := c.validate("SendToUI", topic, message, connectionID); err != nil {
+		return err
+	}
+	c.headerClients().Group(uiGroupname).Send(topic, message)
+	c.monitor.Message("SendToUI", topic, message, connectionID)
+	c.published("SendToUI", topic, message)
+	return nil
 }
 
-func (c *IACMessageBus) SendToBackEnd(topic string, message string, connectionID string) {
+// SendToBackEnd sends the message to the backend clients as "sendtobackend". With at-least-once delivery, the
+// message gets a messageId and goes to one consumer of every consumer group, which has to Ack it. The headers of the
+// invocation are sent along in both cases. The messages are for the backend clients only, so unlike Send they are
+// not kept in the history nor passed to the webhooks and bridges.
+func (c *IACMessageBus) SendToBackEnd(topic string, message string, connectionID string) error {
 	c.ilog.Debug(fmt.Sprintf("SendToBackEnd: topic: %s, message: %s, sender: %s\n", topic, message, connectionID))
+	if err := c.validate("SendToBackEnd", topic, message, connectionID); err != nil {
+		return err
+	}
+	if c.delivery != nil {
+		queued := c.delivery.Publish(topic, message, connectionID, c.Headers())
+		c.ilog.Debug(fmt.Sprintf("SendToBackEnd: queued message %s for the consumer groups\n", queued.ID))
+		c.monitor.Message("SendToBackEnd", topic, message, connectionID)
+		return nil
+	}
 	JsonMsg := make(map[string]interface{}) //"{\"topic\":\"" + topic + "\",\"message\":\"" + message + "\",\"sender\":\"" + connectionID + "\"}"
 	JsonMsg["topic"] = topic
 	JsonMsg["message"] = message
@@ -72,13 +285,82 @@ func (c *IACMessageBus) SendToBackEnd(topic string, message string, connectionID
 	//	fmt.Printf("SendToBackEnd: JsonMsg: %s\n", JsonMsg)
 
 	c.ilog.Debug(fmt.Sprintf("SendToBackEnd: JsonMsg: %s\n", JsonMsg))
-	c.Clients().Group(groupname).Send("sendtobackend", JsonMsg)
+	c.headerClients().Group(groupname).Send("sendtobackend", JsonMsg)
+	c.monitor.Message("SendToBackEnd", topic, message, connectionID)
 	//	c.Clients().Caller().Send("receive", message)
+	return nil
 }
 
-func (c *IACMessageBus) AddMessage(message string, topic string, sender string) {
+func (c *IACMessageBus) AddMessage(message string, topic string, sender string) error {
 	ilog.Debug(fmt.Sprintf("AddMessage: topic: %s, message: %s, sender: %s\n", topic, message, sender))
-	c.Clients().Group(groupname).Send(topic, message)
+	if err := c.validateForSubscribers("AddMessage", topic, message, sender); err != nil {
+		return err
+	}
+	c.publish(topic, message)
+	c.monitor.Message("AddMessage", topic, message, sender)
+	c.retainIfFlagged("AddMessage", topic, message)
+	c.published("AddMessage", topic, message)
+	return nil
+}
+
+// JoinConsumerGroup makes the calling connection a consumer of the group for the at-least-once delivery of
+// SendToBackEnd. Every group receives every message, and within a group each message goes to one consumer.
+func (c *IACMessageBus) JoinConsumerGroup(group string) error {
+	c.ilog.Info(fmt.Sprintf("JoinConsumerGroup: connection %s joining consumer group %s", c.ConnectionID(), group))
+	if c.delivery == nil {
+		return errors.New("at-least-once delivery is not enabled")
+	}
+	if group == "" {
+		return errors.New("consumer group must not be empty")
+	}
+	c.delivery.Join(group, c.ConnectionID())
+	return nil
+}
+
+// Ack acknowledges a message received by "sendtobackend" with at-least-once delivery, so it is not delivered again.
+// A connection which consumes in several groups acknowledges each delivery of the message it received.
+func (c *IACMessageBus) Ack(messageID string) error {
+	c.ilog.Debug(fmt.Sprintf("Ack: message %s, connection: %s\n", messageID, c.ConnectionID()))
+	if c.delivery == nil {
+		return errors.New("at-least-once delivery is not enabled")
+	}
+	return c.delivery.Ack(c.ConnectionID(), messageID)
+}
+
+// ServeRequests makes the calling connection a responder for the requests to the topics matching the filter.
+// It receives them as "request" with the correlationId it passes to Reply. The requests of a topic with several
+// responders are sent to one of them in turn.
+func (c *IACMessageBus) ServeRequests(topic string) error {
+	c.ilog.Info(fmt.Sprintf("ServeRequests: connection %s serving requests to %s", c.ConnectionID(), topic))
+	return c.requests.Serve(topic, c.ConnectionID())
+}
+
+// StopServingRequests removes the calling connection as responder for the topic filter
+func (c *IACMessageBus) StopServingRequests(topic string) {
+	c.ilog.Info(fmt.Sprintf("StopServingRequests: connection %s stops serving requests to %s", c.ConnectionID(), topic))
+	c.requests.Unserve(topic, c.ConnectionID())
+}
+
+// Request sends the payload to one responder of the topic and returns its reply. It fails if the topic has no
+// responder, or the reply does not come within timeoutMs milliseconds, or the default timeout if it is 0.
+func (c *IACMessageBus) Request(topic string, payload string, timeoutMs int) (string, error) {
+	c.ilog.Debug(fmt.Sprintf("Request: topic: %s, payload: %s, timeout: %dms, sender: %s\n", topic, payload, timeoutMs, c.ConnectionID()))
+	if err := c.validate("Request", topic, payload, c.ConnectionID()); err != nil {
+		return "", err
+	}
+	c.monitor.Message("Request", topic, payload, c.ConnectionID())
+	result, err := c.requests.Request(c.Context(), topic, payload, c.ConnectionID(), time.Duration(timeoutMs)*time.Millisecond)
+	if err != nil {
+		c.ilog.Error(fmt.Sprintf("Request: request of %s to %s failed: %v", c.ConnectionID(), topic, err))
+		c.monitor.Error("Request", err)
+	}
+	return result, err
+}
+
+// Reply completes the request with the correlationID, which the calling connection received as "request"
+func (c *IACMessageBus) Reply(correlationID string, payload string) error {
+	c.ilog.Debug(fmt.Sprintf("Reply: correlationId: %s, payload: %s, sender: %s\n", correlationID, payload, c.ConnectionID()))
+	return c.requests.Reply(c.ConnectionID(), correlationID, payload)
 }
 
 // add the client to the connection
@@ -91,13 +373,20 @@ func (c *IACMessageBus) OnDisconnected(connectionID string) {
 	c.ilog.Info(fmt.Sprintf("Client %s disconnected from groups %s and %s", connectionID, groupname, uiGroupname))
 	c.Groups().RemoveFromGroup(groupname, connectionID)
 	c.Groups().RemoveFromGroup(uiGroupname, connectionID)
+	c.topics.RemoveConnection(connectionID)
+	if c.delivery != nil {
+		c.delivery.Leave(connectionID)
+	}
+	if c.requests != nil {
+		c.requests.RemoveConnection(connectionID)
+	}
 }
 
 func (c *IACMessageBus) Broadcast(message string) {
 	// Broadcast to all clients
 	c.ilog.Debug(fmt.Sprintf("broadcast message: %s\n", message))
-	c.Clients().Group(groupname).Send("broadcast", message)
-	c.Clients().Group(groupname).Send("receive", message)
+	c.headerClients().Group(groupname).Send("broadcast", message)
+	c.headerClients().Group(groupname).Send("receive", message)
 }
 
 func (c *IACMessageBus) Echo(message string) {
@@ -169,3 +458,81 @@ func (c *IACMessageBus) Abort() {
 	fmt.Println("Abort")
 	c.Hub.Abort()
 }
+
+// httpPublisher publishes the messages of the HTTP publish API through the server, like the hub methods do
+type httpPublisher struct {
+	hub    *IACMessageBus // the prototype hub, which shares its state with the hub instances
+	server signalr.Server
+}
+
+// Publish sends the message like Send to the subscribers of the topic, like SendToUI to the UI clients,
+// or to a group, the connections of a user or one connection
+func (p *httpPublisher) Publish(message publish.Message, sender string) error {
+	c := p.hub
+	c.ilog.Info(fmt.Sprintf("Publish: topic: %s, target: %s, sender: %s\n", message.Topic, message.Target, sender))
+	validate := c.validate
+	if message.Target == publish.TargetSubscribers {
+		validate = c.validateForSubscribers
+	}
+	if err := validate("Publish", message.Topic, message.Payload, sender); err != nil {
+		return err
+	}
+	clients := p.server.HubClients()
+	switch message.Target {
+	case publish.TargetSubscribers:
+		c.publishTo(clients, nil, message.Topic, message.Payload)
+		c.retainMessage("Publish", message.Topic, message.Payload, message.Retain)
+		c.published("Publish", message.Topic, message.Payload)
+	case publish.TargetUI:
+		clients.Group(uiGroupname).Send(message.Topic, message.Payload)
+		c.published("Publish", message.Topic, message.Payload)
+	case publish.TargetGroup:
+		clients.Group(message.Group).Send(message.Topic, message.Payload)
+	case publish.TargetUser:
+		var connections []string
+		for _, status := range p.server.Connections() {
+			if status.User == message.User {
+				connections = append(connections, status.ConnectionID)
+			}
+		}
+		if len(connections) == 0 {
+			return fmt.Errorf("user %s has no connection", message.User)
+		}
+		for _, connectionID := range connections {
+			clients.Client(connectionID).Send(message.Topic, message.Payload)
+		}
+	case publish.TargetConnection:
+		found := false
+		for _, status := range p.server.Connections() {
+			found = found || status.ConnectionID == message.ConnectionID
+		}
+		if !found {
+			return fmt.Errorf("connection %s not found", message.ConnectionID)
+		}
+		clients.Client(message.ConnectionID).Send(message.Topic, message.Payload)
+	}
+	c.monitor.Message("Publish", message.Topic, message.Payload, sender)
+	return nil
+}
+
+// mqttMethod and stompMethod name the messages of the bridges in the logs, the monitor and the history
+const (
+	mqttMethod  = "MQTT"
+	stompMethod = "STOMP"
+)
+
+// bridgePublisher returns the function a bridge passes its inbound messages to. They are sent like Send
+// to the subscribers of the topic, and retained if the broker sent them as retained messages.
+func (c *IACMessageBus) bridgePublisher(method string, server signalr.Server) func(topic string, message string, retained bool) error {
+	return func(topic string, message string, retained bool) error {
+		c.ilog.Debug(fmt.Sprintf("%s: topic: %s, retained: %v\n", method, topic, retained))
+		if err := c.validateForSubscribers(method, topic, message, method); err != nil {
+			return err
+		}
+		c.publishTo(server.HubClients(), nil, topic, message)
+		c.retainMessage(method, topic, message, retained)
+		c.published(method, topic, message)
+		c.monitor.Message(method, topic, message, method)
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package signalr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// AuditKind is the kind of action recorded by an AuditEvent
+type AuditKind string
+
+const (
+	AuditConnect    AuditKind = "connect"
+	AuditDisconnect AuditKind = "disconnect"
+	AuditInvocation AuditKind = "invocation"
+	AuditGroupJoin  AuditKind = "groupJoin"
+	AuditGroupLeave AuditKind = "groupLeave"
+)
+
+// AuditOutcome values
+const (
+	AuditOK    = "ok"
+	AuditError = "error"
+)
+
+// AuditEvent describes one action on the server which has to be audited.
+// ArgumentDigest is the hex encoded SHA-256 of the arguments of an invocation as they were received,
+// so the payload can be proven without storing it.
+type AuditEvent struct {
+	Time           time.Time `json:"time"`
+	Kind           AuditKind `json:"kind"`
+	ConnectionID   string    `json:"connectionId"`
+	User           string    `json:"user,omitempty"`
+	RemoteAddress  string    `json:"remoteAddress,omitempty"`
+	Method         string    `json:"method,omitempty"`
+	InvocationID   string    `json:"invocationId,omitempty"`
+	Group          string    `json:"group,omitempty"`
+	ArgumentDigest string    `json:"argumentDigest,omitempty"`
+	Outcome        string    `json:"outcome"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// AuditSink receives the AuditEvents of a server. Audit is called synchronously,
+// in the order the events happen on one connection. Errors are logged by the server.
+type AuditSink interface {
+	Audit(event AuditEvent) error
+}
+
+// WithAuditSink sets the AuditSink which receives an AuditEvent for every hub invocation,
+// group join and leave, connect and disconnect.
+func WithAuditSink(sink AuditSink) func(Party) error {
+	return func(p Party) error {
+		if _, ok := p.(*server); ok {
+			p.setAuditSink(sink)
+			return nil
+		}
+		return errors.New("option WithAuditSink is server only")
+	}
+}
+
+// UserFromRequest sets the function which determines the user of a http connection for the AuditEvents
+// and the ConnectionInfo. By default, the common name of a verified TLS client certificate is used.
+func UserFromRequest(userFunc func(r *http.Request) string) func(Party) error {
+	return func(p Party) error {
+		if s, ok := p.(*server); ok {
+			s.userFromRequest = userFunc
+			return nil
+		}
+		return errors.New("option UserFromRequest is server only")
+	}
+}
+
+// ConnectionInfo describes the origin of a connection
+type ConnectionInfo struct {
+	RemoteAddress string
+	User          string
+}
+
+type connectionInfoKey struct{}
+
+// ConnectionInfoFromContext returns the ConnectionInfo stored in the context of a http connection,
+// e.g. HubContext.Context()
+func ConnectionInfoFromContext(ctx context.Context) (ConnectionInfo, bool) {
+	info, ok := ctx.Value(connectionInfoKey{}).(ConnectionInfo)
+	return info, ok
+}
+
+func withConnectionInfo(ctx context.Context, request *http.Request, userFunc func(r *http.Request) string) context.Context {
+	info := ConnectionInfo{RemoteAddress: request.RemoteAddr}
+	if userFunc != nil {
+		info.User = userFunc(request)
+	} else if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 {
+		info.User = request.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	return context.WithValue(ctx, connectionInfoKey{}, info)
+}
+
+func newAuditEvent(kind AuditKind, conn hubConnection) AuditEvent {
+	event := AuditEvent{
+		Time:         time.Now().UTC(),
+		Kind:         kind,
+		ConnectionID: conn.ConnectionID(),
+		Outcome:      AuditOK,
+	}
+	if info, ok := ConnectionInfoFromContext(conn.Context()); ok {
+		event.User = info.User
+		event.RemoteAddress = info.RemoteAddress
+	}
+	return event
+}
+
+// audit sends the event to the sink of the party, if there is one
+func audit(p Party, event AuditEvent, err error) {
+	sink := p.auditSink()
+	if sink == nil {
+		return
+	}
+	if err != nil {
+		event.Outcome = AuditError
+		event.Error = err.Error()
+	}
+	if sinkErr := sink.Audit(event); sinkErr != nil {
+		info, _ := p.loggers()
+		_ = info.Log(evt, "audit", "error", sinkErr, "kind", event.Kind, "connection", event.ConnectionID)
+	}
+}
+
+// argumentDigest hashes the raw arguments of an invocation
+func argumentDigest(arguments []interface{}) string {
+	h := sha256.New()
+	for _, arg := range arguments {
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			_, _ = h.Write(v.Bytes())
+		} else {
+			_, _ = fmt.Fprint(h, arg)
+		}
+		_, _ = h.Write([]byte{0x1e})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,154 @@
+package signalr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type auditHub struct {
+	Hub
+}
+
+func (a *auditHub) Join(group string) {
+	a.Groups().AddToGroup(group, a.ConnectionID())
+}
+
+func (a *auditHub) Leave(group string) {
+	a.Groups().RemoveFromGroup(group, a.ConnectionID())
+}
+
+func (a *auditHub) Reject(message string) error {
+	return errors.New("rejected " + message)
+}
+
+func (a *auditHub) Add2(i int) int {
+	return i + 2
+}
+
+type chanAuditSink chan AuditEvent
+
+func (c chanAuditSink) Audit(event AuditEvent) error {
+	c <- event
+	return nil
+}
+
+var _ = Describe("Audit", func() {
+	var server Server
+	var conn *testingConnection
+	var sink chanAuditSink
+
+	BeforeEach(func(done Done) {
+		sink = make(chanAuditSink, 20)
+		var err error
+		server, err = NewServer(context.TODO(), SimpleHubFactory(&auditHub{}), WithAuditSink(sink), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		conn = newTestingConnectionForServer()
+		go func() { _ = server.Serve(conn) }()
+		event := <-sink
+		Expect(event.Kind).To(Equal(AuditConnect))
+		Expect(event.ConnectionID).To(Equal(conn.ConnectionID()))
+		close(done)
+	}, 2.0)
+
+	AfterEach(func(done Done) {
+		server.cancel()
+		close(done)
+	})
+
+	It("should audit invocations with argument digest", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"a1","target":"add2","arguments":[40]}`)
+		event := <-sink
+		Expect(event.Kind).To(Equal(AuditInvocation))
+		Expect(event.Method).To(Equal("add2"))
+		Expect(event.InvocationID).To(Equal("a1"))
+		Expect(event.Outcome).To(Equal(AuditOK))
+		Expect(event.ArgumentDigest).To(HaveLen(64))
+		conn.ClientSend(`{"type":1,"invocationId":"a2","target":"add2","arguments":[40]}`)
+		Expect((<-sink).ArgumentDigest).To(Equal(event.ArgumentDigest))
+		conn.ClientSend(`{"type":1,"invocationId":"a3","target":"add2","arguments":[41]}`)
+		Expect((<-sink).ArgumentDigest).NotTo(Equal(event.ArgumentDigest))
+		close(done)
+	}, 2.0)
+
+	It("should audit failed invocations", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"r1","target":"reject","arguments":["it"]}`)
+		event := <-sink
+		Expect(event.Outcome).To(Equal(AuditError))
+		Expect(event.Error).To(Equal("rejected it"))
+		conn.ClientSend(`{"type":1,"invocationId":"m1","target":"missing"}`)
+		event = <-sink
+		Expect(event.Method).To(Equal("missing"))
+		Expect(event.Outcome).To(Equal(AuditError))
+		close(done)
+	}, 2.0)
+
+	It("should audit group join and leave", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"j1","target":"join","arguments":["line1"]}`)
+		event := <-sink
+		Expect(event.Kind).To(Equal(AuditGroupJoin))
+		Expect(event.Group).To(Equal("line1"))
+		Expect(event.ConnectionID).To(Equal(conn.ConnectionID()))
+		Expect((<-sink).Kind).To(Equal(AuditInvocation))
+		conn.ClientSend(`{"type":1,"invocationId":"l1","target":"leave","arguments":["line1"]}`)
+		event = <-sink
+		Expect(event.Kind).To(Equal(AuditGroupLeave))
+		Expect(event.Group).To(Equal("line1"))
+		close(done)
+	}, 2.0)
+
+	It("should audit only the group changes", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"l0","target":"leave","arguments":["line2"]}`)
+		Expect((<-sink).Kind).To(Equal(AuditInvocation))
+		conn.ClientSend(`{"type":1,"invocationId":"j1","target":"join","arguments":["line2"]}`)
+		Expect((<-sink).Kind).To(Equal(AuditGroupJoin))
+		Expect((<-sink).Kind).To(Equal(AuditInvocation))
+		conn.ClientSend(`{"type":1,"invocationId":"j2","target":"join","arguments":["line2"]}`)
+		Expect((<-sink).Kind).To(Equal(AuditInvocation))
+		conn.ClientSend(`{"type":1,"invocationId":"l1","target":"leave","arguments":["line2"]}`)
+		Expect((<-sink).Kind).To(Equal(AuditGroupLeave))
+		Expect((<-sink).Kind).To(Equal(AuditInvocation))
+		conn.ClientSend(`{"type":1,"invocationId":"l2","target":"leave","arguments":["line2"]}`)
+		Expect((<-sink).Kind).To(Equal(AuditInvocation))
+		close(done)
+	}, 2.0)
+
+	It("should audit disconnects", func(done Done) {
+		conn.ClientSend(`{"type":7}`)
+		Eventually(sink).Should(Receive(WithTransform(func(e AuditEvent) AuditKind { return e.Kind }, Equal(AuditDisconnect))))
+		close(done)
+	}, 2.0)
+})
+
+var _ = Describe("Audit of http connections", func() {
+	It("should record the remote address and user of the connection", func(done Done) {
+		sink := make(chanAuditSink, 20)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		server, err := NewServer(ctx, SimpleHubFactory(&auditHub{}), WithAuditSink(sink), testLoggerOption(),
+			UserFromRequest(func(r *http.Request) string { return r.Header.Get("X-User") }))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(WithHTTPServeMux(router), "/hub")
+		testServer := httptest.NewServer(router)
+		defer testServer.Close()
+		conn, err := NewHTTPConnection(ctx, testServer.URL+"/hub", WithHTTPHeaders(func() http.Header {
+			return http.Header{"X-User": []string{"operator1"}}
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := NewClient(ctx, WithConnection(conn), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		var event AuditEvent
+		Eventually(sink, time.Second).Should(Receive(&event))
+		Expect(event.Kind).To(Equal(AuditConnect))
+		Expect(event.User).To(Equal("operator1"))
+		Expect(event.RemoteAddress).To(HavePrefix("127.0.0.1:"))
+		close(done)
+	}, 3.0)
+})
@@ -15,6 +15,7 @@ import (
 	"github.com/cenkalti/backoff/v4"
 
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ClientState is the state of the client.
@@ -84,11 +85,23 @@ const (
 // Invoke invokes a method on the server and returns a channel wich will return the InvokeResult.
 // When failing, InvokeResult.Error contains the client side error.
 //
+//	InvokeContext(ctx context.Context, method string, arguments ...interface{}) <-chan InvokeResult
+//
+// InvokeContext is Invoke with the trace context of ctx propagated to the server in the invocation headers.
+// Headers added to ctx by ContextWithHeaders are sent, too.
+// ctx is only used as parent of the invocation span, canceling it does not cancel the invocation.
+//
 //	Send(method string, arguments ...interface{}) <-chan error
 //
 // Send invokes a method on the server but does not return a result from the server but only a channel,
 // which might contain a client side error occurred while sending.
 //
+//	SendContext(ctx context.Context, method string, arguments ...interface{}) <-chan error
+//
+// SendContext is Send with the trace context of ctx propagated to the server in the invocation headers.
+// Headers added to ctx by ContextWithHeaders are sent, too.
+// ctx is only used as parent of the invocation span, canceling it does not cancel the invocation.
+//
 //	PullStream(method string, arguments ...interface{}) <-chan InvokeResult
 //
 // PullStream invokes a streaming method on the server and returns a channel which delivers the stream items.
@@ -108,7 +121,9 @@ type Client interface {
 	Err() error
 	WaitForState(ctx context.Context, waitFor ClientState) <-chan error
 	Invoke(method string, arguments ...interface{}) <-chan InvokeResult
+	InvokeContext(ctx context.Context, method string, arguments ...interface{}) <-chan InvokeResult
 	Send(method string, arguments ...interface{}) <-chan error
+	SendContext(ctx context.Context, method string, arguments ...interface{}) <-chan error
 	PullStream(method string, arguments ...interface{}) <-chan InvokeResult
 	PushStreams(method string, arguments ...interface{}) <-chan InvokeResult
 }
@@ -242,7 +257,6 @@ func (c *client) run() error {
 	c.mx.Lock()
 	c.loop = loop
 	c.mx.Unlock()
-	fmt.Println("run", c.State(), c.loop)
 	// Broadcast when loop is connected
 	isLoopConnected := make(chan struct{}, 1)
 	go func() {
@@ -253,7 +267,7 @@ func (c *client) run() error {
 	err = loop.Run(isLoopConnected)
 
 	if err == nil {
-		fmt.Println("run loop error:", err)
+		_ = loop.dbg.Log(evt, "message loop ended", react, "close connection")
 		err = loop.hubConn.Close("", false) // allowReconnect value is ignored as servers never initiate a connection
 	}
 
@@ -300,11 +314,12 @@ func (c *client) setupConnectionAndProtocol() (hubProtocol, error) {
 				return nil, err
 			}
 		}
-		// Pass maximum receive message size to a potential websocket connection
-		if wsConn, ok := c.conn.(*webSocketConnection); ok {
-			wsConn.conn.SetReadLimit(int64(c.maximumReceiveMessageSize()))
-		}
+		_, span := c.tracer().Start(c.context(), "signalr.handshake", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrRPCSystem.String("signalr"),
+				attrConnectionID.String(c.conn.ConnectionID()),
+				attrTransport.String(transportName(c.conn))))
 		protocol, err := c.processHandshake()
+		endSpan(span, err)
 		if err != nil {
 			return nil, err
 		}
@@ -425,35 +440,42 @@ func (c *client) waitingIsOver(waitFor ClientState, ch chan<- error) bool {
 }
 
 func (c *client) Invoke(method string, arguments ...interface{}) <-chan InvokeResult {
+	return c.InvokeContext(c.context(), method, arguments...)
+}
+
+func (c *client) InvokeContext(ctx context.Context, method string, arguments ...interface{}) <-chan InvokeResult {
 	ch := make(chan InvokeResult, 1)
-	fmt.Println("Invoke", method, arguments)
 	go func() {
-		fmt.Println(c.State())
 		if err := <-c.waitForConnected(); err != nil {
-			fmt.Println("Invoke", method, arguments, err)
+			_ = c.dbg.Log(evt, "invoke", logMethod, method, "error", err, react, "not connected")
 			ch <- InvokeResult{Error: err}
 			close(ch)
 			return
 		}
+		span, headers := c.startInvocationSpan(ctx, method)
 		id := c.loop.GetNewID()
-		fmt.Println("Invoke get new ID: ", method, arguments, id)
+		info, dbg := withLogContext(c.loop.info, c.loop.dbg, logMethod, method, logInvocation, id)
 		resultCh, errCh := c.loop.invokeClient.newInvocation(id)
-		fmt.Println("Invoke newInvocation: ", method, arguments, id, resultCh, errCh)
 		irCh := newInvokeResultChan(c.context(), resultCh, errCh)
-		fmt.Println("Invoke newInvokeResultChan: ", method, arguments, id, irCh)
 
-		if err := c.loop.hubConn.SendInvocation(id, method, arguments); err != nil {
-			fmt.Println("Invoke SendInvocation error: ", method, arguments, id, err)
+		if err := c.loop.hubConn.SendInvocation(id, method, arguments, headers); err != nil {
+			_ = info.Log(evt, msgSend, "error", err, react, "invocation failed")
 			c.loop.invokeClient.deleteInvocation(id)
+			endSpan(span, err)
 			ch <- InvokeResult{Error: err}
 			close(ch)
 			return
 		}
-		fmt.Println("Invoke SendInvocation: ", method, arguments, id)
+		_ = dbg.Log(evt, msgSend, "arguments", arguments)
 		go func() {
+			var err error
 			for ir := range irCh {
+				if ir.Error != nil {
+					err = ir.Error
+				}
 				ch <- ir
 			}
+			endSpan(span, err)
 			close(ch)
 		}()
 	}()
@@ -461,6 +483,10 @@ func (c *client) Invoke(method string, arguments ...interface{}) <-chan InvokeRe
 }
 
 func (c *client) Send(method string, arguments ...interface{}) <-chan error {
+	return c.SendContext(c.context(), method, arguments...)
+}
+
+func (c *client) SendContext(ctx context.Context, method string, arguments ...interface{}) <-chan error {
 	errCh := make(chan error, 1)
 	go func() {
 		if err := <-c.waitForConnected(); err != nil {
@@ -468,10 +494,14 @@ func (c *client) Send(method string, arguments ...interface{}) <-chan error {
 			close(errCh)
 			return
 		}
+		span, headers := c.startInvocationSpan(ctx, method)
 		id := c.loop.GetNewID()
-		fmt.Println("Send get new ID: ", method, arguments, id)
+		_ = c.loop.dbg.Log(evt, msgSend, logMethod, method, logInvocation, id, "arguments", arguments)
 		_, sendErrCh := c.loop.invokeClient.newInvocation(id)
-		if err := c.loop.hubConn.SendInvocation(id, method, arguments); err != nil {
+		err := c.loop.hubConn.SendInvocation(id, method, arguments, headers)
+		// The server sends no completion, so the span ends when the invocation has been written
+		endSpan(span, err)
+		if err != nil {
 			c.loop.invokeClient.deleteInvocation(id)
 			errCh <- err
 			close(errCh)
@@ -487,6 +517,16 @@ func (c *client) Send(method string, arguments ...interface{}) <-chan error {
 	return errCh
 }
 
+// startInvocationSpan starts the span of an invocation and returns it with the headers which propagate it to the server
+func (c *client) startInvocationSpan(ctx context.Context, method string) (trace.Span, map[string]string) {
+	ctx, span := c.tracer().Start(ctx, "invoke "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrRPCSystem.String("signalr"),
+			attrRPCMethod.String(method),
+			attrConnectionID.String(c.loop.hubConn.ConnectionID())))
+	return span, injectHeaders(ctx, contextHeaders(ctx))
+}
+
 func (c *client) PullStream(method string, arguments ...interface{}) <-chan InvokeResult {
 	irCh := make(chan InvokeResult, 1)
 	go func() {
@@ -561,8 +601,8 @@ func (c *client) allowReconnect() bool {
 
 func (c *client) prefixLoggers(connectionID string) (info StructuredLogger, dbg StructuredLogger) {
 	if c.receiver == nil {
-		return log.WithPrefix(c.info, "ts", log.DefaultTimestampUTC, "class", "Client", "connection", connectionID),
-			log.WithPrefix(c.dbg, "ts", log.DefaultTimestampUTC, "class", "Client", "connection", connectionID)
+		return log.WithPrefix(c.info, "ts", log.DefaultTimestampUTC, "class", "Client", logConnection, connectionID),
+			log.WithPrefix(c.dbg, "ts", log.DefaultTimestampUTC, "class", "Client", logConnection, connectionID)
 	}
 	var t reflect.Type = nil
 	switch reflect.ValueOf(c.receiver).Kind() {
@@ -573,11 +613,11 @@ func (c *client) prefixLoggers(connectionID string) (info StructuredLogger, dbg
 	}
 	return log.WithPrefix(c.info, "ts", log.DefaultTimestampUTC,
 			"class", "Client",
-			"connection", connectionID,
+			logConnection, connectionID,
 			"hub", t),
 		log.WithPrefix(c.dbg, "ts", log.DefaultTimestampUTC,
 			"class", "Client",
-			"connection", connectionID,
+			logConnection, connectionID,
 			"hub", t)
 }
 
@@ -612,7 +652,7 @@ func (c *client) receiveHandshakeResponse() (hubProtocol, error) {
 	readJSONFramesChan := make(chan []interface{}, 1)
 	go func() {
 		var remainBuf bytes.Buffer
-		rawHandshake, err := readJSONFrames(c.conn, &remainBuf)
+		rawHandshake, err := readJSONFrames(c.conn, &remainBuf, int(c.maximumReceiveMessageSize()))
 		readJSONFramesChan <- []interface{}{rawHandshake, err}
 	}()
 	select {
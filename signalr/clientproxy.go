@@ -1,32 +1,40 @@
 package signalr
 
+import "context"
+
 //ClientProxy allows the hub to send messages to one or more of its clients
 type ClientProxy interface {
 	Send(target string, args ...interface{})
 }
 
+// The ctx of the proxies is the context of the hub invocation which sends, or context.Background()
+// when sending from outside a hub. It carries the trace context propagated to the clients.
+
 type allClientProxy struct {
+	ctx             context.Context
 	lifetimeManager HubLifetimeManager
 }
 
 func (a *allClientProxy) Send(target string, args ...interface{}) {
-	a.lifetimeManager.InvokeAll(target, args)
+	a.lifetimeManager.InvokeAll(a.ctx, target, args)
 }
 
 type singleClientProxy struct {
+	ctx             context.Context
 	connectionID    string
 	lifetimeManager HubLifetimeManager
 }
 
 func (a *singleClientProxy) Send(target string, args ...interface{}) {
-	a.lifetimeManager.InvokeClient(a.connectionID, target, args)
+	a.lifetimeManager.InvokeClient(a.ctx, a.connectionID, target, args)
 }
 
 type groupClientProxy struct {
+	ctx             context.Context
 	groupName       string
 	lifetimeManager HubLifetimeManager
 }
 
 func (g *groupClientProxy) Send(target string, args ...interface{}) {
-	g.lifetimeManager.InvokeGroup(g.groupName, target, args)
+	g.lifetimeManager.InvokeGroup(g.ctx, g.groupName, target, args)
 }
@@ -13,11 +13,12 @@ import (
 type clientSSEConnection struct {
 	ConnectionBase
 	reqURL    string
+	client    Doer
 	sseReader io.Reader
 	sseWriter io.Writer
 }
 
-func newClientSSEConnection(address string, connectionID string, body io.ReadCloser) (*clientSSEConnection, error) {
+func newClientSSEConnection(address string, connectionID string, body io.ReadCloser, client Doer) (*clientSSEConnection, error) {
 	// Setup request
 	reqURL, err := url.Parse(address)
 	if err != nil {
@@ -32,6 +33,7 @@ func newClientSSEConnection(address string, connectionID string, body io.ReadClo
 			connectionID: connectionID,
 		},
 		reqURL: reqURL.String(),
+		client: client,
 	}
 	c.sseReader, c.sseWriter = io.Pipe()
 	go func() {
@@ -74,8 +76,7 @@ func (c *clientSSEConnection) Write(p []byte) (n int, err error) {
 	if err != nil {
 		return 0, err
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,107 @@
+package signalr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ConnectionStatus describes a connection of a Server.
+// LastActivity is the time the last data was received from the client, or ConnectedAt if none has been received.
+type ConnectionStatus struct {
+	ConnectionID  string    `json:"connectionId"`
+	Transport     string    `json:"transport"`
+	Protocol      string    `json:"protocol"`
+	RemoteAddress string    `json:"remoteAddress,omitempty"`
+	User          string    `json:"user,omitempty"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	LastActivity  time.Time `json:"lastActivity"`
+	Groups        []string  `json:"groups"`
+}
+
+// connectionLister is implemented by lifetime managers which can list their connections and groups
+type connectionLister interface {
+	connectionStatus() []ConnectionStatus
+	groupMembers() map[string][]string
+}
+
+func (d *defaultHubLifetimeManager) connectionStatus() []ConnectionStatus {
+	groups := make(map[string][]string)
+	for group, members := range d.groupMembers() {
+		for _, connectionID := range members {
+			groups[connectionID] = append(groups[connectionID], group)
+		}
+	}
+	status := make([]ConnectionStatus, 0)
+	d.clients.Range(func(key, value interface{}) bool {
+		s := value.(hubConnection).Status()
+		s.Groups = groups[s.ConnectionID]
+		if s.Groups == nil {
+			s.Groups = []string{}
+		}
+		sort.Strings(s.Groups)
+		status = append(status, s)
+		return true
+	})
+	sort.Slice(status, func(i, j int) bool {
+		if status[i].ConnectedAt.Equal(status[j].ConnectedAt) {
+			return status[i].ConnectionID < status[j].ConnectionID
+		}
+		return status[i].ConnectedAt.Before(status[j].ConnectedAt)
+	})
+	return status
+}
+
+func (d *defaultHubLifetimeManager) groupMembers() map[string][]string {
+	d.groupsMx.RLock()
+	defer d.groupsMx.RUnlock()
+	members := make(map[string][]string)
+	d.groups.Range(func(key, value interface{}) bool {
+		conns := value.(map[string]hubConnection)
+		if len(conns) == 0 {
+			return true
+		}
+		ids := make([]string, 0, len(conns))
+		for connectionID := range conns {
+			ids = append(ids, connectionID)
+		}
+		sort.Strings(ids)
+		members[key.(string)] = ids
+		return true
+	})
+	return members
+}
+
+func (s *server) Connections() []ConnectionStatus {
+	if lister, ok := s.lifetimeManager.(connectionLister); ok {
+		return lister.connectionStatus()
+	}
+	return nil
+}
+
+func (s *server) GroupMembers() map[string][]string {
+	if lister, ok := s.lifetimeManager.(connectionLister); ok {
+		return lister.groupMembers()
+	}
+	return nil
+}
+
+func (s *server) Groups() GroupManager {
+	return s.groupManager
+}
+
+func (s *server) Disconnect(connectionID string, reason string, allowReconnect bool) error {
+	lookup, ok := s.lifetimeManager.(connectionLookup)
+	if !ok {
+		return fmt.Errorf("connection %s not found", connectionID)
+	}
+	conn, ok := lookup.connection(connectionID)
+	if !ok {
+		return fmt.Errorf("connection %s not found", connectionID)
+	}
+	// The close message tells the client why it is disconnected. The loop of the connection
+	// ends when the connection is aborted, whether or not the close message could be sent.
+	err := conn.Close(reason, allowReconnect)
+	conn.Abort()
+	return err
+}
@@ -0,0 +1,60 @@
+package signalr
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server connection status", func() {
+	var server Server
+	var conn *testingConnection
+
+	BeforeEach(func(done Done) {
+		var err error
+		server, err = NewServer(context.TODO(), SimpleHubFactory(&metricsHub{}), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		conn = newTestingConnectionForServer()
+		go func() { _ = server.Serve(conn) }()
+		Eventually(server.Connections).Should(HaveLen(1))
+		close(done)
+	}, 2.0)
+
+	AfterEach(func(done Done) {
+		server.cancel()
+		close(done)
+	}, 2.0)
+
+	It("should list the connections with their groups", func(done Done) {
+		before := time.Now().UTC()
+		conn.ClientSend(`{"type":1,"invocationId":"1","target":"join","arguments":["g"]}`)
+		Eventually(server.GroupMembers).Should(Equal(map[string][]string{"g": {conn.ConnectionID()}}))
+		status := server.Connections()[0]
+		Expect(status.ConnectionID).To(Equal(conn.ConnectionID()))
+		Expect(status.Transport).To(Equal("*signalr.testingConnection"))
+		Expect(status.Protocol).To(Equal("json"))
+		Expect(status.Groups).To(Equal([]string{"g"}))
+		Expect(status.LastActivity).To(BeTemporally(">=", before))
+		Expect(status.LastActivity).To(BeTemporally(">=", status.ConnectedAt))
+		close(done)
+	}, 2.0)
+
+	It("should change groups from server-side code", func(done Done) {
+		server.Groups().AddToGroup("a", conn.ConnectionID())
+		server.Groups().AddToGroup("b", conn.ConnectionID())
+		Expect(server.Connections()[0].Groups).To(Equal([]string{"a", "b"}))
+		server.Groups().RemoveFromGroup("a", conn.ConnectionID())
+		Expect(server.GroupMembers()).To(Equal(map[string][]string{"b": {conn.ConnectionID()}}))
+		close(done)
+	}, 2.0)
+
+	It("should disconnect a connection with a close message", func(done Done) {
+		Expect(server.Disconnect(conn.ConnectionID(), "maintenance", false)).NotTo(HaveOccurred())
+		Eventually(conn.ReceiveChan()).Should(Receive(Equal(closeMessage{Type: 7, Error: "maintenance"})))
+		Eventually(server.Connections).Should(BeEmpty())
+		Expect(server.Disconnect(conn.ConnectionID(), "again", false)).To(HaveOccurred())
+		close(done)
+	}, 2.0)
+})
@@ -0,0 +1,222 @@
+package signalr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which browser origins may call the server cross-origin.
+// The same policy is used for the http endpoints and for the origin check of websocket connections.
+//
+// AllowedOrigins entries are
+//
+//	"https://ui.plant1.example.com:8080"  exact origin, scheme, host and port have to match
+//	"https://*.plant1.example.com"        any subdomain of plant1.example.com over https
+//	"*.plant1.example.com"                any subdomain with any scheme
+//	"*"                                   any origin, not allowed together with AllowCredentials
+//
+// An origin without port only matches origins with the default port of their scheme.
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string // default GET, POST
+	AllowedHeaders   []string // default Content-Type, Authorization, X-Requested-With, X-SignalR-User-Agent
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache preflight results, 0 means not set
+}
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodPost}
+var defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-Requested-With", "X-SignalR-User-Agent"}
+
+// CORS sets the CORS policy of the server. Without a policy, only same-origin browser requests are allowed.
+func CORS(policy CORSPolicy) func(Party) error {
+	return func(p Party) error {
+		if s, ok := p.(*server); ok {
+			if err := policy.validate(); err != nil {
+				return err
+			}
+			s.cors = &policy
+			return nil
+		}
+		return errors.New("option CORS is server only")
+	}
+}
+
+func (p *CORSPolicy) validate() error {
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" && p.AllowCredentials {
+			return errors.New("CORS origin * can not be combined with AllowCredentials")
+		}
+		if origin == "" {
+			return errors.New("empty CORS origin")
+		}
+	}
+	return nil
+}
+
+// AllowsOrigin reports if the value of an Origin header is allowed by the policy
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, allowed := range p.AllowedOrigins {
+		if originMatches(strings.ToLower(allowed), u.Scheme, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func originMatches(pattern string, scheme string, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if pattern[:i] != scheme {
+			return false
+		}
+		pattern = pattern[i+3:]
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return pattern == host
+}
+
+// sameOrigin reports if the Origin header of the request points to the host the request was sent to
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Handler wraps next with the policy. Preflight requests are answered without calling next.
+// Cross-origin requests from origins which are not allowed are rejected with 403 Forbidden.
+func (p *CORSPolicy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.AllowsOrigin(origin) {
+			if !preflight && sameOrigin(r, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Origin %s is not allowed", origin), http.StatusForbidden)
+			return
+		}
+		if p.AllowCredentials || !p.allowsAnyOrigin() {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		if p.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			p.preflight(w, r)
+			return
+		}
+		if len(p.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *CORSPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	methods := p.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := p.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	if !containsFold(methods, r.Header.Get("Access-Control-Request-Method")) {
+		http.Error(w, "Method not allowed", http.StatusForbidden)
+		return
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" && !containsFold(headers, header) {
+			http.Error(w, fmt.Sprintf("Header %s is not allowed", header), http.StatusForbidden)
+			return
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *CORSPolicy) allowsAnyOrigin() bool {
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowOriginPatterns adds the origins to the CORS policy of the server, see CORSPolicy for the patterns.
+//
+// Deprecated: Use the CORS option, which also sets methods, headers and credentials.
+func AllowOriginPatterns(origins []string) func(Party) error {
+	return func(p Party) error {
+		if s, ok := p.(*server); ok {
+			if s.cors == nil {
+				s.cors = &CORSPolicy{}
+			}
+			s.cors.AllowedOrigins = append(s.cors.AllowedOrigins, origins...)
+		}
+		return nil
+	}
+}
+
+// AllowedClients is the comma separated list of origins EnableCors allows.
+//
+// Deprecated: Use the CORS option or CORSPolicy.Handler.
+var AllowedClients string
+
+// EnableCors sets the CORS response headers for the origins in AllowedClients with credentials.
+// Unlike CORSPolicy.Handler, it neither answers preflight requests nor rejects other origins.
+//
+// Deprecated: Use the CORS option or CORSPolicy.Handler.
+func EnableCors(w *http.ResponseWriter, r *http.Request) {
+	policy := CORSPolicy{AllowCredentials: true}
+	for _, origin := range strings.Split(AllowedClients, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			policy.AllowedOrigins = append(policy.AllowedOrigins, origin)
+		}
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && policy.AllowsOrigin(origin) {
+		(*w).Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	(*w).Header().Set("Access-Control-Allow-Headers", strings.Join(defaultCORSHeaders, ", "))
+	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
+}
@@ -0,0 +1,186 @@
+package signalr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"nhooyr.io/websocket"
+)
+
+var _ = Describe("CORS policy", func() {
+
+	Context("origin matching", func() {
+		policy := &CORSPolicy{AllowedOrigins: []string{
+			"http://127.0.0.1:8080",
+			"https://*.plant1.example.com",
+			"*.plant2.example.com:8443",
+		}}
+		It("should match exact origins", func() {
+			Expect(policy.AllowsOrigin("http://127.0.0.1:8080")).To(BeTrue())
+			Expect(policy.AllowsOrigin("HTTP://127.0.0.1:8080")).To(BeTrue())
+			Expect(policy.AllowsOrigin("https://127.0.0.1:8080")).To(BeFalse())
+			Expect(policy.AllowsOrigin("http://127.0.0.1:8081")).To(BeFalse())
+		})
+		It("should match wildcard subdomains", func() {
+			Expect(policy.AllowsOrigin("https://hmi.plant1.example.com")).To(BeTrue())
+			Expect(policy.AllowsOrigin("https://a.b.plant1.example.com")).To(BeTrue())
+			Expect(policy.AllowsOrigin("https://plant1.example.com")).To(BeFalse())
+			Expect(policy.AllowsOrigin("https://evilplant1.example.com")).To(BeFalse())
+			Expect(policy.AllowsOrigin("http://hmi.plant1.example.com")).To(BeFalse())
+			Expect(policy.AllowsOrigin("https://hmi.plant1.example.com:8443")).To(BeFalse())
+			Expect(policy.AllowsOrigin("http://hmi.plant2.example.com:8443")).To(BeTrue())
+			Expect(policy.AllowsOrigin("https://hmi.plant2.example.com:8443")).To(BeTrue())
+		})
+		It("should not match invalid origins", func() {
+			Expect(policy.AllowsOrigin("null")).To(BeFalse())
+			Expect(policy.AllowsOrigin("")).To(BeFalse())
+		})
+	})
+
+	It("should reject * together with credentials", func() {
+		_, err := NewServer(context.TODO(), SimpleHubFactory(&addHub{}),
+			CORS(CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}), testLoggerOption())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should add the origins of the deprecated AllowOriginPatterns to the policy", func() {
+		s, err := NewServer(context.TODO(), SimpleHubFactory(&addHub{}), testLoggerOption(),
+			CORS(CORSPolicy{AllowedOrigins: []string{"https://hmi.example.com"}, AllowCredentials: true}),
+			AllowOriginPatterns([]string{"*.plant1.example.com"}))
+		Expect(err).NotTo(HaveOccurred())
+		defer s.cancel()
+		policy := s.(*server).corsPolicy()
+		Expect(policy.AllowCredentials).To(BeTrue())
+		Expect(policy.AllowsOrigin("https://hmi.example.com")).To(BeTrue())
+		Expect(policy.AllowsOrigin("https://hmi.plant1.example.com")).To(BeTrue())
+		Expect(policy.AllowsOrigin("https://hmi.plant2.example.com")).To(BeFalse())
+	})
+
+	It("should set the origin header of the deprecated EnableCors only for AllowedClients", func() {
+		AllowedClients = "http://127.0.0.1:8080, https://hmi.example.com"
+		defer func() { AllowedClients = "" }()
+		for origin, allowed := range map[string]string{
+			"https://hmi.example.com":  "https://hmi.example.com",
+			"https://evil.example.com": "",
+		} {
+			w := http.ResponseWriter(httptest.NewRecorder())
+			r := httptest.NewRequest(http.MethodGet, "/hub/negotiate", nil)
+			r.Header.Set("Origin", origin)
+			EnableCors(&w, r)
+			Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal(allowed))
+			Expect(w.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		}
+	})
+
+	Context("on the hub endpoints", func() {
+		var testServer *httptest.Server
+		var cancel context.CancelFunc
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			server, err := NewServer(ctx, SimpleHubFactory(&addHub{}), testLoggerOption(),
+				CORS(CORSPolicy{
+					AllowedOrigins:   []string{"https://*.plant1.example.com"},
+					ExposedHeaders:   []string{"X-Request-Id"},
+					AllowCredentials: true,
+					MaxAge:           10 * time.Minute,
+				}))
+			Expect(err).NotTo(HaveOccurred())
+			router := http.NewServeMux()
+			server.MapHTTP(WithHTTPServeMux(router), "/hub")
+			testServer = httptest.NewServer(router)
+		})
+		AfterEach(func() {
+			cancel()
+			testServer.Close()
+		})
+
+		preflight := func(origin string, method string, headers string) *http.Response {
+			req, _ := http.NewRequest(http.MethodOptions, testServer.URL+"/hub/negotiate", nil)
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", method)
+			if headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", headers)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			return resp
+		}
+
+		It("should answer the preflight of /negotiate for an allowed origin", func() {
+			resp := preflight("https://hmi.plant1.example.com", "POST", "x-signalr-user-agent, content-type")
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://hmi.plant1.example.com"))
+			Expect(resp.Header.Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+			Expect(resp.Header.Get("Access-Control-Allow-Methods")).To(ContainSubstring("POST"))
+			Expect(resp.Header.Get("Access-Control-Allow-Headers")).To(ContainSubstring("X-SignalR-User-Agent"))
+			Expect(resp.Header.Get("Access-Control-Max-Age")).To(Equal("600"))
+			Expect(resp.Header.Values("Vary")).To(ContainElement("Origin"))
+		})
+
+		It("should reject the preflight of /negotiate for other origins", func() {
+			resp := preflight("https://evil.example.com", "POST", "")
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		})
+
+		It("should reject the preflight of /negotiate for methods and headers not allowed", func() {
+			Expect(preflight("https://hmi.plant1.example.com", "DELETE", "").StatusCode).To(Equal(http.StatusForbidden))
+			Expect(preflight("https://hmi.plant1.example.com", "POST", "X-Custom").StatusCode).To(Equal(http.StatusForbidden))
+		})
+
+		It("should negotiate with an allowed origin and expose headers", func() {
+			req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/hub/negotiate", nil)
+			req.Header.Set("Origin", "https://hmi.plant1.example.com")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://hmi.plant1.example.com"))
+			Expect(resp.Header.Get("Access-Control-Expose-Headers")).To(Equal("X-Request-Id"))
+		})
+
+		It("should not negotiate with other origins", func() {
+			req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/hub/negotiate", nil)
+			req.Header.Set("Origin", "https://evil.example.com")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		})
+
+		It("should negotiate with same-origin requests and requests without origin", func() {
+			for _, origin := range []string{"", testServer.URL} {
+				req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/hub/negotiate", nil)
+				if origin != "" {
+					req.Header.Set("Origin", origin)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			}
+		})
+
+		It("should accept websockets only from allowed origins", func(done Done) {
+			wsURL := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/hub"
+			conn, _, err := websocket.Dial(context.Background(), wsURL, &websocket.DialOptions{
+				HTTPHeader: http.Header{"Origin": []string{"https://hmi.plant1.example.com"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_ = conn.Close(websocket.StatusNormalClosure, "")
+			_, resp, err := websocket.Dial(context.Background(), wsURL, &websocket.DialOptions{
+				HTTPHeader: http.Header{"Origin": []string{"https://evil.example.com"}},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			close(done)
+		}, 2.0)
+	})
+})
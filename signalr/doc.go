@@ -98,6 +98,9 @@ The server then automatically negotiates which kind of connection (Websockets, S
 The SignalR protocol constrains the signature of hub or receiver methods that can be used over SignalR.
 All methods with serializable types as parameters and return types are supported.
 Methods with multiple return values are not generally supported, but returning one or no value and an optional error is supported.
+A trailing error return value is never sent as part of the result: if it is nil, the invocation completes with the other
+return values, otherwise it completes with the message of the error and without result. Earlier versions sent the
+error as a further result value, and the invocation completed without error.
 
 	// Simple signatures for hub/receiver methods
 	func (mh *MathHub) Divide(a, b float64) (float64, error) // error on division by zero
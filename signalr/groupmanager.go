@@ -1,5 +1,10 @@
 package signalr
 
+import (
+	"fmt"
+	"time"
+)
+
 // GroupManager manages the client groups of the hub
 type GroupManager interface {
 	AddToGroup(groupName string, connectionID string)
@@ -8,12 +13,88 @@ type GroupManager interface {
 
 type defaultGroupManager struct {
 	lifetimeManager HubLifetimeManager
+	party           Party
 }
 
 func (d *defaultGroupManager) AddToGroup(groupName string, connectionID string) {
-	d.lifetimeManager.AddToGroup(groupName, connectionID)
+	changed := true
+	if membership, ok := d.lifetimeManager.(groupMembership); ok {
+		changed = membership.addToGroup(groupName, connectionID)
+	} else {
+		d.lifetimeManager.AddToGroup(groupName, connectionID)
+	}
+	// A failed join is audited with its error, joining a group again is not audited
+	if changed || !d.connected(connectionID) {
+		d.audit(AuditGroupJoin, groupName, connectionID)
+	}
+	d.measure()
 }
 
 func (d *defaultGroupManager) RemoveFromGroup(groupName string, connectionID string) {
-	d.lifetimeManager.RemoveFromGroup(groupName, connectionID)
+	changed := true
+	if membership, ok := d.lifetimeManager.(groupMembership); ok {
+		changed = membership.removeFromGroup(groupName, connectionID)
+	} else {
+		d.lifetimeManager.RemoveFromGroup(groupName, connectionID)
+	}
+	// Leaving a group the connection is not a member of is not audited
+	if changed {
+		d.audit(AuditGroupLeave, groupName, connectionID)
+	}
+	d.measure()
+}
+
+// groupMembership is implemented by lifetime managers which report if AddToGroup and RemoveFromGroup changed the group
+type groupMembership interface {
+	addToGroup(groupName string, connectionID string) bool
+	removeFromGroup(groupName string, connectionID string) bool
+}
+
+// groupCounter is implemented by lifetime managers which can count their groups
+type groupCounter interface {
+	groupCounts() (groups int, members int)
+}
+
+func (d *defaultGroupManager) measure() {
+	if d.party == nil {
+		return
+	}
+	if _, ok := d.party.metrics().(noMetrics); ok {
+		return
+	}
+	if counter, ok := d.lifetimeManager.(groupCounter); ok {
+		d.party.metrics().GroupsChanged(counter.groupCounts())
+	}
+}
+
+// connectionLookup is implemented by lifetime managers which can return the hubConnection for a connectionID
+type connectionLookup interface {
+	connection(connectionID string) (hubConnection, bool)
+}
+
+// connected returns false if the lifetime manager knows that the connection is not connected
+func (d *defaultGroupManager) connected(connectionID string) bool {
+	if lookup, ok := d.lifetimeManager.(connectionLookup); ok {
+		_, ok = lookup.connection(connectionID)
+		return ok
+	}
+	return true
+}
+
+func (d *defaultGroupManager) audit(kind AuditKind, groupName string, connectionID string) {
+	if d.party == nil || d.party.auditSink() == nil {
+		return
+	}
+	event := AuditEvent{Time: time.Now().UTC(), Kind: kind, ConnectionID: connectionID, Outcome: AuditOK}
+	var err error
+	if lookup, ok := d.lifetimeManager.(connectionLookup); ok {
+		if conn, ok := lookup.connection(connectionID); ok {
+			event = newAuditEvent(kind, conn)
+		} else if kind == AuditGroupJoin {
+			// Leaving is possible after disconnect, but only connected connections can join
+			err = fmt.Errorf("connection %s not found", connectionID)
+		}
+	}
+	event.Group = groupName
+	audit(d.party, event, err)
 }
@@ -0,0 +1,56 @@
+package signalr
+
+import "context"
+
+type headersKey struct{}
+
+// ContextWithHeaders returns a copy of ctx which carries headers. Client.InvokeContext and Client.SendContext
+// send them with the invocation, where the hub method can read them with Hub.Headers.
+// Headers already in ctx are kept unless they have the same key.
+func ContextWithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	merged := contextHeaders(ctx)
+	if merged == nil {
+		merged = make(map[string]string, len(headers))
+	}
+	for key, value := range headers {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// contextHeaders returns a copy of the headers in ctx, or nil if there are none
+func contextHeaders(ctx context.Context) map[string]string {
+	headers, ok := ctx.Value(headersKey{}).(map[string]string)
+	if !ok {
+		return nil
+	}
+	cp := make(map[string]string, len(headers))
+	for key, value := range headers {
+		cp[key] = value
+	}
+	return cp
+}
+
+// HeadersFromContext returns the headers in ctx. Hub and receiver methods with a context.Context as first
+// parameter get a context with the headers of the invocation.
+func HeadersFromContext(ctx context.Context) map[string]string {
+	return contextHeaders(ctx)
+}
+
+// ClientsWithHeaders returns HubClients which send headers with their invocations, in addition to the trace context.
+// Hubs forward the headers of an invocation to other clients with ClientsWithHeaders(h.Clients(), h.Headers()).
+// HubClients which are not of the Hub or the Server are returned unchanged.
+func ClientsWithHeaders(clients HubClients, headers map[string]string) HubClients {
+	switch c := clients.(type) {
+	case *callerHubClients:
+		return &callerHubClients{
+			defaultHubClients: c.defaultHubClients,
+			connectionID:      c.connectionID,
+			ctx:               ContextWithHeaders(c.ctx, headers),
+		}
+	case *defaultHubClients:
+		return &headersHubClients{defaultHubClients: c, ctx: ContextWithHeaders(context.Background(), headers)}
+	default:
+		return clients
+	}
+}
@@ -0,0 +1,111 @@
+package signalr
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type headersHub struct {
+	Hub
+}
+
+func (h *headersHub) Tenant() string {
+	return h.Headers()["tenant"]
+}
+
+func (h *headersHub) Count() int {
+	return len(h.Headers())
+}
+
+func (h *headersHub) ContextTenant(ctx context.Context, prefix string) string {
+	return prefix + HeadersFromContext(ctx)["tenant"]
+}
+
+func (h *headersHub) Forward(message string) {
+	ClientsWithHeaders(h.Clients(), h.Headers()).Caller().Send("receive", message)
+}
+
+type headersReceiver struct {
+	Receiver
+	headers chan map[string]string
+}
+
+func (r *headersReceiver) Receive(ctx context.Context, message string) {
+	r.headers <- HeadersFromContext(ctx)
+}
+
+var _ = Describe("Headers", func() {
+	for _, f := range []TransferFormatType{"Text", "Binary"} {
+		format := f
+		Context(fmt.Sprintf("with transfer format %v", format), func() {
+			var server Server
+			var client Client
+			var cancelClient context.CancelFunc
+			var receiver *headersReceiver
+
+			BeforeEach(func(done Done) {
+				var err error
+				server, err = NewServer(context.TODO(), SimpleHubFactory(&headersHub{}), testLoggerOption())
+				Expect(err).NotTo(HaveOccurred())
+				cliConn, srvConn := newClientServerConnections()
+				go func() { _ = server.Serve(srvConn) }()
+				var ctx context.Context
+				ctx, cancelClient = context.WithCancel(context.Background())
+				receiver = &headersReceiver{headers: make(chan map[string]string, 1)}
+				client, err = NewClient(ctx, WithConnection(cliConn), WithReceiver(receiver), TransferFormat(format), testLoggerOption())
+				Expect(err).NotTo(HaveOccurred())
+				client.Start()
+				Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+				close(done)
+			}, 2.0)
+
+			AfterEach(func(done Done) {
+				cancelClient()
+				server.cancel()
+				close(done)
+			}, 2.0)
+
+			It("should pass the headers of the invocation to the hub method", func(done Done) {
+				ctx := ContextWithHeaders(context.Background(), map[string]string{"tenant": "A", "correlation": "1"})
+				r := <-client.InvokeContext(ctx, "Tenant")
+				Expect(r.Error).NotTo(HaveOccurred())
+				Expect(r.Value).To(Equal("A"))
+				close(done)
+			}, 2.0)
+
+			It("should merge headers added to the context", func(done Done) {
+				ctx := ContextWithHeaders(context.Background(), map[string]string{"tenant": "A"})
+				ctx = ContextWithHeaders(ctx, map[string]string{"tenant": "B", "correlation": "1"})
+				r := <-client.InvokeContext(ctx, "Tenant")
+				Expect(r.Error).NotTo(HaveOccurred())
+				Expect(r.Value).To(Equal("B"))
+				close(done)
+			}, 2.0)
+
+			It("should pass the headers of the invocation in the context of the hub method", func(done Done) {
+				ctx := ContextWithHeaders(context.Background(), map[string]string{"tenant": "A"})
+				r := <-client.InvokeContext(ctx, "ContextTenant", "tenant ")
+				Expect(r.Error).NotTo(HaveOccurred())
+				Expect(r.Value).To(Equal("tenant A"))
+				close(done)
+			}, 2.0)
+
+			It("should forward the headers to the receiver of the client", func(done Done) {
+				ctx := ContextWithHeaders(context.Background(), map[string]string{"tenant": "A"})
+				Expect(<-client.SendContext(ctx, "Forward", "hello")).NotTo(HaveOccurred())
+				Expect(<-receiver.headers).To(HaveKeyWithValue("tenant", "A"))
+				close(done)
+			}, 2.0)
+
+			It("should invoke without headers", func(done Done) {
+				r := <-client.Invoke("Count")
+				Expect(r.Error).NotTo(HaveOccurred())
+				Expect(fmt.Sprint(r.Value)).To(Equal("0"))
+				close(done)
+			}, 2.0)
+		})
+	}
+})
@@ -2,6 +2,7 @@ package signalr
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,8 @@ import (
 	"net/url"
 	"path"
 
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"nhooyr.io/websocket"
 )
 
@@ -18,9 +21,11 @@ type Doer interface {
 }
 
 type httpConnection struct {
-	client     Doer
-	headers    func() http.Header
-	transports []TransportType
+	client         Doer
+	headers        func() http.Header
+	transports     []TransportType
+	tlsConfig      *tls.Config
+	tracerProvider trace.TracerProvider
 }
 
 // WithHTTPClient sets the http client used to connect to the signalR server.
@@ -36,8 +41,46 @@ func WithHTTPClient(client Doer) func(*httpConnection) error {
 func WithHTTPHeaders(headers func() http.Header) func(*httpConnection) error {
 	return func(c *httpConnection) error {
 		c.headers = headers
-		c.headers().Set("Access-Control-Allow-Origin", "http://127.0.0.1:8080")
-		c.headers().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-requested-with")
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https and wss connections to the signalR server,
+// e.g. to trust a private CA or to present a client certificate to a server which requires mutual TLS.
+// If no client is set by WithHTTPClient, a http.Client using the TLS configuration is created.
+// A client set by WithHTTPClient has to be configured with the TLS configuration by the caller.
+func WithTLSConfig(config *tls.Config) func(*httpConnection) error {
+	return func(c *httpConnection) error {
+		c.tlsConfig = config
+		return nil
+	}
+}
+
+// WithClientCertificate loads a client certificate and its key from PEM encoded files and presents it
+// to servers which require mutual TLS. The files are read each time a connection is created, so a
+// client using WithConnector picks up renewed certificates when it reconnects.
+// WithClientCertificate can be combined with WithTLSConfig, but must be passed after it.
+func WithClientCertificate(certFile, keyFile string) func(*httpConnection) error {
+	return func(c *httpConnection) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		if c.tlsConfig == nil {
+			c.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		} else {
+			c.tlsConfig = c.tlsConfig.Clone()
+		}
+		c.tlsConfig.Certificates = append(c.tlsConfig.Certificates, cert)
+		return nil
+	}
+}
+
+// WithHTTPTracerProvider sets the OpenTelemetry TracerProvider for the span of the negotiate request.
+// Default is the global TracerProvider.
+func WithHTTPTracerProvider(provider trace.TracerProvider) func(*httpConnection) error {
+	return func(c *httpConnection) error {
+		c.tracerProvider = provider
 		return nil
 	}
 }
@@ -71,7 +114,13 @@ func NewHTTPConnection(ctx context.Context, address string, options ...func(*htt
 	}
 
 	if httpConn.client == nil {
-		httpConn.client = http.DefaultClient
+		if httpConn.tlsConfig != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = httpConn.tlsConfig
+			httpConn.client = &http.Client{Transport: transport}
+		} else {
+			httpConn.client = http.DefaultClient
+		}
 	}
 	if len(httpConn.transports) == 0 {
 		httpConn.transports = []TransportType{TransportWebSockets, TransportServerSentEvents}
@@ -82,36 +131,11 @@ func NewHTTPConnection(ctx context.Context, address string, options ...func(*htt
 		return nil, err
 	}
 
-	negotiateURL := *reqURL
-	negotiateURL.Path = path.Join(negotiateURL.Path, "negotiate")
-	req, err := http.NewRequestWithContext(ctx, "POST", negotiateURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	if httpConn.headers != nil {
-		req.Header = httpConn.headers()
-	}
-	resp, err := httpConn.client.Do(req)
-
-	if err != nil {
-		return nil, err
-	}
-	defer func() { closeResponseBody(resp.Body) }()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("%v %v -> %v", req.Method, req.URL.String(), resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
+	negotiateResponse, cookies, err := httpConn.negotiate(ctx, reqURL)
 	if err != nil {
 		return nil, err
 	}
 
-	negotiateResponse := negotiateResponse{}
-	if err := json.Unmarshal(body, &negotiateResponse); err != nil {
-		return nil, err
-	}
-
 	q := reqURL.Query()
 	q.Set("id", negotiateResponse.ConnectionID)
 	reqURL.RawQuery = q.Encode()
@@ -132,6 +156,10 @@ func NewHTTPConnection(ctx context.Context, address string, options ...func(*htt
 		}
 
 		opts := &websocket.DialOptions{}
+		// Use the same client for the websocket handshake, so TLS settings apply to wss, too
+		if client, ok := httpConn.client.(*http.Client); ok {
+			opts.HTTPClient = client
+		}
 
 		if httpConn.headers != nil {
 			opts.HTTPHeader = httpConn.headers()
@@ -139,7 +167,7 @@ func NewHTTPConnection(ctx context.Context, address string, options ...func(*htt
 			opts.HTTPHeader = http.Header{}
 		}
 
-		for _, cookie := range resp.Cookies() {
+		for _, cookie := range cookies {
 			opts.HTTPHeader.Add("Cookie", cookie.String())
 		}
 
@@ -167,7 +195,7 @@ func NewHTTPConnection(ctx context.Context, address string, options ...func(*htt
 			return nil, err
 		}
 
-		conn, err = newClientSSEConnection(address, negotiateResponse.ConnectionID, resp.Body)
+		conn, err = newClientSSEConnection(address, negotiateResponse.ConnectionID, resp.Body, httpConn.client)
 		if err != nil {
 			return nil, err
 		}
@@ -176,6 +204,50 @@ func NewHTTPConnection(ctx context.Context, address string, options ...func(*htt
 	return conn, nil
 }
 
+// negotiate sends the negotiate request and returns the response and the cookies set by the server.
+// The trace context of the request span is sent to the server.
+func (h *httpConnection) negotiate(ctx context.Context, reqURL *url.URL) (response negotiateResponse, cookies []*http.Cookie, err error) {
+	tracer := defaultTracer()
+	if h.tracerProvider != nil {
+		tracer = h.tracerProvider.Tracer(tracerName)
+	}
+	ctx, span := tracer.Start(ctx, "signalr.negotiate", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrRPCSystem.String("signalr")))
+	defer func() { endSpan(span, err) }()
+
+	negotiateURL := *reqURL
+	negotiateURL.Path = path.Join(negotiateURL.Path, "negotiate")
+	req, err := http.NewRequestWithContext(ctx, "POST", negotiateURL.String(), nil)
+	if err != nil {
+		return response, nil, err
+	}
+	if h.headers != nil {
+		req.Header = h.headers()
+	}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return response, nil, err
+	}
+	defer func() { closeResponseBody(resp.Body) }()
+
+	if resp.StatusCode != 200 {
+		return response, nil, fmt.Errorf("%v %v -> %v", req.Method, req.URL.String(), resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, nil, err
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, nil, err
+	}
+	return response, resp.Cookies(), nil
+}
+
 // closeResponseBody reads a http response body to the end and closes it
 // See https://blog.cubieserver.de/2022/http-connection-reuse-in-go-clients/
 // The body needs to be fully read and closed, otherwise the connection will not be reused
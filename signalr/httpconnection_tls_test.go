@@ -0,0 +1,146 @@
+package signalr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA() *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue creates a certificate signed by the CA and returns it PEM encoded
+func (ca *testCA) issue(commonName string, usage x509.ExtKeyUsage) (certPEM []byte, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+var _ = Describe("HTTP connection with mutual TLS", func() {
+	var ca *testCA
+	var testServer *httptest.Server
+	var dir, certFile, keyFile string
+	var cancel context.CancelFunc
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ca = newTestCA()
+		ctx, cancel = context.WithCancel(context.Background())
+		server, err := NewServer(ctx, SimpleHubFactory(&addHub{}), HTTPTransports(TransportWebSockets, TransportServerSentEvents), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		server.MapHTTP(WithHTTPServeMux(router), "/hub")
+		serverCertPEM, serverKeyPEM := ca.issue("127.0.0.1", x509.ExtKeyUsageServerAuth)
+		serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+		Expect(err).NotTo(HaveOccurred())
+		testServer = httptest.NewUnstartedServer(router)
+		testServer.TLS = &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.pool,
+			MinVersion:   tls.VersionTLS12,
+		}
+		testServer.StartTLS()
+		clientCertPEM, clientKeyPEM := ca.issue("backend", x509.ExtKeyUsageClientAuth)
+		dir, err = os.MkdirTemp("", "signalr-tls")
+		Expect(err).NotTo(HaveOccurred())
+		certFile = filepath.Join(dir, "client.crt")
+		keyFile = filepath.Join(dir, "client.key")
+		Expect(os.WriteFile(certFile, clientCertPEM, 0600)).To(Succeed())
+		Expect(os.WriteFile(keyFile, clientKeyPEM, 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+		testServer.Close()
+		_ = os.RemoveAll(dir)
+	})
+
+	for _, transport := range []TransportType{TransportWebSockets, TransportServerSentEvents} {
+		transport := transport
+		Context(string(transport), func() {
+			It("should connect when a client certificate is presented", func(done Done) {
+				conn, err := NewHTTPConnection(ctx, testServer.URL+"/hub",
+					WithTransports(transport),
+					WithTLSConfig(&tls.Config{RootCAs: ca.pool, MinVersion: tls.VersionTLS12}),
+					WithClientCertificate(certFile, keyFile))
+				Expect(err).NotTo(HaveOccurred())
+				client, err := NewClient(ctx, WithConnection(conn), testLoggerOption())
+				Expect(err).NotTo(HaveOccurred())
+				client.Start()
+				Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+				result := <-client.Invoke("Add2", 1)
+				Expect(result.Error).NotTo(HaveOccurred())
+				Expect(result.Value).To(BeEquivalentTo(3))
+				close(done)
+			}, 5.0)
+
+			It("should fail to negotiate without a client certificate", func() {
+				_, err := NewHTTPConnection(ctx, testServer.URL+"/hub",
+					WithTransports(transport),
+					WithTLSConfig(&tls.Config{RootCAs: ca.pool, MinVersion: tls.VersionTLS12}))
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	}
+
+	It("should report missing client certificate files", func() {
+		_, err := NewHTTPConnection(ctx, testServer.URL+"/hub",
+			WithClientCertificate(filepath.Join(os.TempDir(), "missing.crt"), keyFile))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,6 +1,7 @@
 package signalr
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/teivah/onecontext"
+	"go.opentelemetry.io/otel/trace"
 	"nhooyr.io/websocket"
 )
 
@@ -103,7 +105,7 @@ func (h *httpMux) handleServerSentEvent(writer http.ResponseWriter, request *htt
 	h.mx.RUnlock()
 	if ok {
 		if _, ok := c.(*negotiateConnection); ok {
-			ctx, _ := onecontext.Merge(h.server.context(), request.Context())
+			ctx, _ := onecontext.Merge(h.server.context(), h.connectionContext(request))
 			sseConn, jobChan, jobResultChan, err := newServerSSEConnection(ctx, c.ConnectionID())
 			if err != nil {
 				writer.WriteHeader(http.StatusInternalServerError)
@@ -138,27 +140,33 @@ func (h *httpMux) handleServerSentEvent(writer http.ResponseWriter, request *htt
 			close(jobResultChan)
 		} else {
 			// connectionID in use
+			h.server.metrics().HandshakeFailed(string(TransportServerSentEvents), HandshakeFailureConnection)
 			writer.WriteHeader(http.StatusConflict)
 		}
 	} else {
+		h.server.metrics().HandshakeFailed(string(TransportServerSentEvents), HandshakeFailureConnection)
 		writer.WriteHeader(http.StatusNotFound)
 	}
 }
 
 func (h *httpMux) handleWebsocket(writer http.ResponseWriter, request *http.Request) {
+	// websocket.Accept only allows same-origin requests, origins allowed by the CORS policy are checked here
+	insecureSkipVerify := h.server.insecureSkipVerify()
+	if cors := h.server.corsPolicy(); cors != nil && request.Header.Get("Origin") != "" {
+		insecureSkipVerify = insecureSkipVerify || cors.AllowsOrigin(request.Header.Get("Origin"))
+	}
 	accOptions := &websocket.AcceptOptions{
 		CompressionMode:    websocket.CompressionContextTakeover,
-		InsecureSkipVerify: h.server.insecureSkipVerify(),
-		OriginPatterns:     h.server.originPatterns(),
+		InsecureSkipVerify: insecureSkipVerify,
 	}
 	websocketConn, err := websocket.Accept(writer, request, accOptions)
 	if err != nil {
 		_, debug := h.server.loggers()
 		_ = debug.Log(evt, "handleWebsocket", msg, "error accepting websockets", "error", err)
+		h.server.metrics().HandshakeFailed(string(TransportWebSockets), HandshakeFailureUpgrade)
 		// don't need to write an error header here as websocket.Accept has already used http.Error
 		return
 	}
-	websocketConn.SetReadLimit(int64(h.server.maximumReceiveMessageSize()))
 	connectionMapKey := request.URL.Query().Get("id")
 	if connectionMapKey == "" {
 		// Support websocket connection without negotiate
@@ -175,25 +183,31 @@ func (h *httpMux) handleWebsocket(writer http.ResponseWriter, request *http.Requ
 	if ok {
 		if _, ok := c.(*negotiateConnection); ok {
 			// Connection is negotiated but not initiated
-			ctx, _ := onecontext.Merge(h.server.context(), request.Context())
+			ctx, _ := onecontext.Merge(h.server.context(), h.connectionContext(request))
 			err = h.serveConnection(newWebSocketConnection(ctx, c.ConnectionID(), websocketConn))
 			if err != nil {
 				_ = websocketConn.Close(1005, err.Error())
 			}
 		} else {
 			// Already initiated
+			h.server.metrics().HandshakeFailed(string(TransportWebSockets), HandshakeFailureConnection)
 			_ = websocketConn.Close(1002, "Bad request")
 		}
 	} else {
 		// Not negotiated
+		h.server.metrics().HandshakeFailed(string(TransportWebSockets), HandshakeFailureConnection)
 		_ = websocketConn.Close(1002, "Not found")
 	}
 }
 
 func (h *httpMux) negotiate(w http.ResponseWriter, req *http.Request) {
-	if req.Method == "OPTIONS" {
+	switch req.Method {
+	case http.MethodOptions:
 		w.WriteHeader(http.StatusOK)
-	} else {
+	case http.MethodPost:
+		_, span := h.server.tracer().Start(extractRequest(req), "signalr.negotiate", trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrRPCSystem.String("signalr")))
+		defer span.End()
 		connectionID := newConnectionID()
 		connectionMapKey := connectionID
 		negotiateVersion, err := strconv.Atoi(req.Header.Get("negotiateVersion"))
@@ -227,6 +241,7 @@ func (h *httpMux) negotiate(w http.ResponseWriter, req *http.Request) {
 					})
 			}
 		}
+		span.SetAttributes(attrConnectionID.String(connectionID))
 		response := negotiateResponse{
 			ConnectionToken:     connectionToken,
 			ConnectionID:        connectionID,
@@ -235,10 +250,17 @@ func (h *httpMux) negotiate(w http.ResponseWriter, req *http.Request) {
 		}
 		w.WriteHeader(http.StatusOK)
 		_ = json.NewEncoder(w).Encode(response) // Can't imagine an error when encoding
-
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+// connectionContext adds the ConnectionInfo of the request to the request context
+func (h *httpMux) connectionContext(request *http.Request) context.Context {
+	return withConnectionInfo(request.Context(), request, h.server.requestUser())
+}
+
 func (h *httpMux) serveConnection(c Connection) error {
 	h.mx.Lock()
 	h.connectionMap[c.ConnectionID()] = c
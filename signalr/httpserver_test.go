@@ -251,7 +251,7 @@ func handShakeAndCallWebSocketTestServer(port int, connectionID string) {
 		_ = ws.Close(websocket.StatusNormalClosure, "")
 	}()
 	wsConn := newWebSocketConnection(context.TODO(), connectionID, ws)
-	cliConn := newHubConnection(wsConn, &protocol, 1<<15, testLogger())
+	cliConn := newHubConnection(wsConn, &protocol, 1<<15, noMetrics{}, nil, testLogger())
 	_, _ = wsConn.Write(append([]byte(`{"protocol": "json","version": 1}`), 30))
 	_, _ = wsConn.Write(append([]byte(`{"type":1,"invocationId":"666","target":"add2","arguments":[1]}`), 30))
 	result := make(chan interface{})
@@ -53,7 +53,16 @@ func (h *Hub) ConnectionID() string {
 	return h.context.ConnectionID()
 }
 
-// Context is the context.Context of the current connection
+// Headers returns the headers the client sent with the current invocation, e.g. correlation or tenant ids.
+// In OnConnected and OnDisconnected, there are none.
+func (h *Hub) Headers() map[string]string {
+	h.cm.RLock()
+	defer h.cm.RUnlock()
+	return h.context.Headers()
+}
+
+// Context is the context.Context of the current connection.
+// In a stream invocation, it is also done when the client cancels the stream or the stream ends
 func (h *Hub) Context() context.Context {
 	h.cm.RLock()
 	defer h.cm.RUnlock()
@@ -1,5 +1,7 @@
 package signalr
 
+import "context"
+
 // HubClients gives the hub access to various client groups
 // All() gets a ClientProxy that can be used to invoke methods on all clients connected to the hub
 // Caller() gets a ClientProxy that can be used to invoke methods of the current calling client
@@ -22,11 +24,23 @@ func (c *defaultHubClients) All() ClientProxy {
 }
 
 func (c *defaultHubClients) Client(connectionID string) ClientProxy {
-	return &singleClientProxy{connectionID: connectionID, lifetimeManager: c.lifetimeManager}
+	return c.client(context.Background(), connectionID)
 }
 
 func (c *defaultHubClients) Group(groupName string) ClientProxy {
-	return &groupClientProxy{groupName: groupName, lifetimeManager: c.lifetimeManager}
+	return c.group(context.Background(), groupName)
+}
+
+func (c *defaultHubClients) all(ctx context.Context) ClientProxy {
+	return &allClientProxy{ctx: ctx, lifetimeManager: c.lifetimeManager}
+}
+
+func (c *defaultHubClients) client(ctx context.Context, connectionID string) ClientProxy {
+	return &singleClientProxy{ctx: ctx, connectionID: connectionID, lifetimeManager: c.lifetimeManager}
+}
+
+func (c *defaultHubClients) group(ctx context.Context, groupName string) ClientProxy {
+	return &groupClientProxy{ctx: ctx, groupName: groupName, lifetimeManager: c.lifetimeManager}
 }
 
 // Caller is only implemented to fulfill the HubClients interface, so the servers defaultHubClients interface can be
@@ -35,23 +49,47 @@ func (c *defaultHubClients) Caller() ClientProxy {
 	return nil
 }
 
+// callerHubClients are the HubClients of a hub invocation. ctx is the context of the invocation.
 type callerHubClients struct {
 	defaultHubClients *defaultHubClients
 	connectionID      string
+	ctx               context.Context
 }
 
 func (c *callerHubClients) All() ClientProxy {
-	return c.defaultHubClients.All()
+	return c.defaultHubClients.all(c.ctx)
 }
 
 func (c *callerHubClients) Caller() ClientProxy {
-	return c.defaultHubClients.Client(c.connectionID)
+	return c.defaultHubClients.client(c.ctx, c.connectionID)
 }
 
 func (c *callerHubClients) Client(connectionID string) ClientProxy {
-	return c.defaultHubClients.Client(connectionID)
+	return c.defaultHubClients.client(c.ctx, connectionID)
 }
 
 func (c *callerHubClients) Group(groupName string) ClientProxy {
-	return c.defaultHubClients.Group(groupName)
+	return c.defaultHubClients.group(c.ctx, groupName)
+}
+
+// headersHubClients are the HubClients of the server with a context, which carries the headers to send.
+type headersHubClients struct {
+	defaultHubClients *defaultHubClients
+	ctx               context.Context
+}
+
+func (c *headersHubClients) All() ClientProxy {
+	return c.defaultHubClients.all(c.ctx)
+}
+
+func (c *headersHubClients) Caller() ClientProxy {
+	return nil
+}
+
+func (c *headersHubClients) Client(connectionID string) ClientProxy {
+	return c.defaultHubClients.client(c.ctx, connectionID)
+}
+
+func (c *headersHubClients) Group(groupName string) ClientProxy {
+	return c.defaultHubClients.group(c.ctx, groupName)
 }
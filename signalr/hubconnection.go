@@ -14,7 +14,7 @@ import (
 type hubConnection interface {
 	ConnectionID() string
 	Receive() <-chan receiveResult
-	SendInvocation(id string, target string, args []interface{}) error
+	SendInvocation(id string, target string, args []interface{}, headers map[string]string) error
 	SendStreamInvocation(id string, target string, args []interface{}) error
 	SendInvocationWithStreamIds(id string, target string, args []interface{}, streamIds []string) error
 	StreamItem(id string, item interface{}) error
@@ -22,6 +22,7 @@ type hubConnection interface {
 	Close(error string, allowReconnect bool) error
 	Ping() error
 	LastWriteStamp() time.Time
+	Status() ConnectionStatus
 	Items() *sync.Map
 	Context() context.Context
 	Abort()
@@ -32,7 +33,7 @@ type receiveResult struct {
 	err     error
 }
 
-func newHubConnection(connection Connection, protocol hubProtocol, maximumReceiveMessageSize uint, info StructuredLogger) hubConnection {
+func newHubConnection(connection Connection, protocol hubProtocol, maximumReceiveMessageSize uint, metrics Metrics, tap Tap, info StructuredLogger) hubConnection {
 	ctx, cancelFunc := context.WithCancel(connection.Context())
 	c := &defaultHubConnection{
 		ctx:                       ctx,
@@ -42,6 +43,10 @@ func newHubConnection(connection Connection, protocol hubProtocol, maximumReceiv
 		connection:                connection,
 		maximumReceiveMessageSize: maximumReceiveMessageSize,
 		items:                     &sync.Map{},
+		metrics:                   metrics,
+		tap:                       tap,
+		transport:                 transportName(connection),
+		connectedAt:               time.Now().UTC(),
 		info:                      info,
 	}
 	if connectionWithTransferMode, ok := connection.(ConnectionWithTransferMode); ok {
@@ -59,6 +64,11 @@ type defaultHubConnection struct {
 	maximumReceiveMessageSize uint
 	items                     *sync.Map
 	lastWriteStamp            time.Time
+	lastReadStamp             time.Time
+	connectedAt               time.Time
+	metrics                   Metrics
+	tap                       Tap
+	transport                 string
 	info                      StructuredLogger
 }
 
@@ -72,7 +82,7 @@ func (c *defaultHubConnection) Close(errorText string, allowReconnect bool) erro
 		Error:          errorText,
 		AllowReconnect: allowReconnect,
 	}
-	return c.protocol.WriteMessage(closeMessage, c.connection)
+	return c.protocol.WriteMessage(closeMessage, meteredWriter{c})
 }
 
 func (c *defaultHubConnection) ConnectionID() string {
@@ -110,6 +120,10 @@ func (c *defaultHubConnection) Receive() <-chan receiveResult {
 					}
 				}
 				if n > 0 {
+					c.metrics.BytesReceived(c.transport, n)
+					c.mx.Lock()
+					c.lastReadStamp = time.Now()
+					c.mx.Unlock()
 					_, err = writer.Write(p[:n])
 					if err != nil {
 						select {
@@ -146,6 +160,7 @@ func (c *defaultHubConnection) Receive() <-chan receiveResult {
 					}
 				} else {
 					for _, message := range messages {
+						c.tapMessage(TapInbound, message)
 						select {
 						case recvChan <- receiveResult{message: message}:
 						case <-ctx.Done():
@@ -161,12 +176,13 @@ func (c *defaultHubConnection) Receive() <-chan receiveResult {
 	return recvChan
 }
 
-func (c *defaultHubConnection) SendInvocation(id string, target string, args []interface{}) error {
+func (c *defaultHubConnection) SendInvocation(id string, target string, args []interface{}, headers map[string]string) error {
 	if args == nil {
 		args = make([]interface{}, 0)
 	}
 	var invocationMessage = invocationMessage{
 		Type:         1,
+		Headers:      headers,
 		InvocationID: id,
 		Target:       target,
 		Arguments:    args,
@@ -224,6 +240,27 @@ func (c *defaultHubConnection) Ping() error {
 	return c.writeMessage(pingMessage)
 }
 
+// Status returns the ConnectionStatus without the groups, which are only known to the HubLifetimeManager
+func (c *defaultHubConnection) Status() ConnectionStatus {
+	status := ConnectionStatus{
+		ConnectionID: c.ConnectionID(),
+		Transport:    c.transport,
+		Protocol:     protocolName(c.protocol),
+		ConnectedAt:  c.connectedAt,
+		LastActivity: c.connectedAt,
+	}
+	c.mx.Lock()
+	if !c.lastReadStamp.IsZero() {
+		status.LastActivity = c.lastReadStamp.UTC()
+	}
+	c.mx.Unlock()
+	if info, ok := ConnectionInfoFromContext(c.ctx); ok {
+		status.RemoteAddress = info.RemoteAddress
+		status.User = info.User
+	}
+	return status
+}
+
 func (c *defaultHubConnection) LastWriteStamp() time.Time {
 	defer c.mx.Unlock()
 	c.mx.Lock()
@@ -231,6 +268,7 @@ func (c *defaultHubConnection) LastWriteStamp() time.Time {
 }
 
 func (c *defaultHubConnection) writeMessage(message interface{}) error {
+	c.tapMessage(TapOutbound, message)
 	c.mx.Lock()
 	c.lastWriteStamp = time.Now()
 	c.mx.Unlock()
@@ -239,7 +277,7 @@ func (c *defaultHubConnection) writeMessage(message interface{}) error {
 			return fmt.Errorf("hubConnection canceled: %w", c.ctx.Err())
 		}
 		e := make(chan error, 1)
-		go func() { e <- c.protocol.WriteMessage(message, c.connection) }()
+		go func() { e <- c.protocol.WriteMessage(message, meteredWriter{c}) }()
 		select {
 		case <-c.ctx.Done():
 			return fmt.Errorf("hubConnection canceled: %w", c.ctx.Err())
@@ -255,3 +293,14 @@ func (c *defaultHubConnection) writeMessage(message interface{}) error {
 	}
 	return err
 }
+
+// meteredWriter writes to the connection and counts the bytes sent
+type meteredWriter struct {
+	c *defaultHubConnection
+}
+
+func (m meteredWriter) Write(p []byte) (int, error) {
+	n, err := m.c.connection.Write(p)
+	m.c.metrics.BytesSent(m.c.transport, n)
+	return n, err
+}
@@ -10,6 +10,7 @@ import (
 // Groups gets a GroupManager that can be used to add and remove connections to named groups
 // Items holds key/value pairs scoped to the hubs connection
 // ConnectionID gets the ID of the current connection
+// Headers gets the headers of the current invocation. They are nil outside an invocation and should not be modified
 // Abort aborts the current connection
 // Logger returns the logger used in this server
 type HubContext interface {
@@ -17,6 +18,7 @@ type HubContext interface {
 	Groups() GroupManager
 	Items() *sync.Map
 	ConnectionID() string
+	Headers() map[string]string
 	Context() context.Context
 	Abort()
 	Logger() (info StructuredLogger, dbg StructuredLogger)
@@ -27,6 +29,7 @@ type connectionHubContext struct {
 	connection hubConnection
 	clients    HubClients
 	groups     GroupManager
+	headers    map[string]string
 	info       StructuredLogger
 	dbg        StructuredLogger
 }
@@ -47,6 +50,10 @@ func (c *connectionHubContext) ConnectionID() string {
 	return c.connection.ConnectionID()
 }
 
+func (c *connectionHubContext) Headers() map[string]string {
+	return c.headers
+}
+
 func (c *connectionHubContext) Context() context.Context {
 	return c.connection.Context()
 }
@@ -1,9 +1,11 @@
 package signalr
 
 import (
+	"context"
 	"sync"
 
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HubLifetimeManager is a lifetime manager abstraction for hub instances
@@ -12,14 +14,15 @@ import (
 // InvokeAll() sends an invocation message to all hub connections
 // InvokeClient() sends an invocation message to a specified hub connection
 // InvokeGroup() sends an invocation message to a specified group of hub connections
+// The trace context of ctx and the headers added to it by ContextWithHeaders are sent in the headers of the invocation messages.
 // AddToGroup() adds a connection to the specified group
 // RemoveFromGroup() removes a connection from the specified group
 type HubLifetimeManager interface {
 	OnConnected(conn hubConnection)
 	OnDisconnected(conn hubConnection)
-	InvokeAll(target string, args []interface{})
-	InvokeClient(connectionID string, target string, args []interface{})
-	InvokeGroup(groupName string, target string, args []interface{})
+	InvokeAll(ctx context.Context, target string, args []interface{})
+	InvokeClient(ctx context.Context, connectionID string, target string, args []interface{})
+	InvokeGroup(ctx context.Context, groupName string, target string, args []interface{})
 	AddToGroup(groupName, connectionID string)
 	RemoveFromGroup(groupName, connectionID string)
 }
@@ -32,9 +35,14 @@ func newLifeTimeManager(info StructuredLogger) defaultHubLifetimeManager {
 }
 
 type defaultHubLifetimeManager struct {
-	clients sync.Map
-	groups  sync.Map
-	info    StructuredLogger
+	clients  sync.Map
+	groups   sync.Map
+	groupsMx sync.RWMutex // guards the connection maps in groups and the counts
+	// number of non-empty groups and of their members, kept up to date by AddToGroup and RemoveFromGroup
+	groupCount  int
+	memberCount int
+	info        StructuredLogger
+	party       Party
 }
 
 func (d *defaultHubLifetimeManager) OnConnected(conn hubConnection) {
@@ -45,43 +53,131 @@ func (d *defaultHubLifetimeManager) OnDisconnected(conn hubConnection) {
 	d.clients.Delete(conn.ConnectionID())
 }
 
-func (d *defaultHubLifetimeManager) InvokeAll(target string, args []interface{}) {
+func (d *defaultHubLifetimeManager) connection(connectionID string) (hubConnection, bool) {
+	if client, ok := d.clients.Load(connectionID); ok {
+		return client.(hubConnection), true
+	}
+	return nil, false
+}
+
+func (d *defaultHubLifetimeManager) InvokeAll(ctx context.Context, target string, args []interface{}) {
+	span, headers := d.startSend(ctx, "all", target)
+	recipients := 0
 	d.clients.Range(func(key, value interface{}) bool {
-		go func() {
-			_ = value.(hubConnection).SendInvocation("", target, args)
-		}()
+		recipients++
+		conn := value.(hubConnection)
+		go withLabels(sendLabels(conn), func() {
+			_ = conn.SendInvocation("", target, args, headers)
+		})
 		return true
 	})
+	d.broadcast(span, "all", recipients)
 }
 
-func (d *defaultHubLifetimeManager) InvokeClient(connectionID string, target string, args []interface{}) {
+func (d *defaultHubLifetimeManager) InvokeClient(ctx context.Context, connectionID string, target string, args []interface{}) {
+	span, headers := d.startSend(ctx, "client", target)
 	if client, ok := d.clients.Load(connectionID); ok {
-		go func() {
-			_ = client.(hubConnection).SendInvocation("", target, args)
-		}()
+		conn := client.(hubConnection)
+		go withLabels(sendLabels(conn), func() {
+			_ = conn.SendInvocation("", target, args, headers)
+		})
+		d.broadcast(span, "client", 1)
+	} else {
+		d.broadcast(span, "client", 0)
 	}
 }
 
-func (d *defaultHubLifetimeManager) InvokeGroup(groupName string, target string, args []interface{}) {
+func (d *defaultHubLifetimeManager) InvokeGroup(ctx context.Context, groupName string, target string, args []interface{}) {
+	span, headers := d.startSend(ctx, "group", target)
+	recipients := 0
+	d.groupsMx.RLock()
+	defer d.groupsMx.RUnlock()
 	if groups, ok := d.groups.Load(groupName); ok {
 		for _, v := range groups.(map[string]hubConnection) {
 			conn := v
-			go func() {
-				_ = conn.SendInvocation("", target, args)
-			}()
+			recipients++
+			go withLabels(sendLabels(conn), func() {
+				_ = conn.SendInvocation("", target, args, headers)
+			})
 		}
 	}
+	d.broadcast(span, "group", recipients)
 }
 
 func (d *defaultHubLifetimeManager) AddToGroup(groupName string, connectionID string) {
-	if client, ok := d.clients.Load(connectionID); ok {
-		groups, _ := d.groups.LoadOrStore(groupName, make(map[string]hubConnection))
-		groups.(map[string]hubConnection)[connectionID] = client.(hubConnection)
+	d.addToGroup(groupName, connectionID)
+}
+
+// addToGroup adds the connection to the group and returns false if it is not connected or already a member
+func (d *defaultHubLifetimeManager) addToGroup(groupName string, connectionID string) bool {
+	client, ok := d.clients.Load(connectionID)
+	if !ok {
+		return false
 	}
+	d.groupsMx.Lock()
+	defer d.groupsMx.Unlock()
+	groups, _ := d.groups.LoadOrStore(groupName, make(map[string]hubConnection))
+	members := groups.(map[string]hubConnection)
+	_, member := members[connectionID]
+	if !member {
+		if len(members) == 0 {
+			d.groupCount++
+		}
+		d.memberCount++
+	}
+	members[connectionID] = client.(hubConnection)
+	return !member
 }
 
 func (d *defaultHubLifetimeManager) RemoveFromGroup(groupName string, connectionID string) {
+	d.removeFromGroup(groupName, connectionID)
+}
+
+// removeFromGroup removes the connection from the group and returns false if it was not a member
+func (d *defaultHubLifetimeManager) removeFromGroup(groupName string, connectionID string) bool {
+	d.groupsMx.Lock()
+	defer d.groupsMx.Unlock()
 	if groups, ok := d.groups.Load(groupName); ok {
-		delete(groups.(map[string]hubConnection), connectionID)
+		members := groups.(map[string]hubConnection)
+		if _, ok := members[connectionID]; ok {
+			delete(members, connectionID)
+			d.memberCount--
+			if len(members) == 0 {
+				d.groupCount--
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// groupCounts returns the number of non-empty groups and the number of their members
+func (d *defaultHubLifetimeManager) groupCounts() (groups int, members int) {
+	d.groupsMx.RLock()
+	defer d.groupsMx.RUnlock()
+	return d.groupCount, d.memberCount
+}
+
+// startSend starts the span of a send and returns it with the headers which propagate it and the headers of ctx
+// to the clients.
+// The span ends when the messages are handed over to the connections, not when they are written.
+func (d *defaultHubLifetimeManager) startSend(ctx context.Context, kind string, target string) (trace.Span, map[string]string) {
+	tracer := defaultTracer()
+	if d.party != nil {
+		tracer = d.party.tracer()
+	}
+	ctx, span := tracer.Start(ctx, "send "+target,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrRPCSystem.String("signalr"),
+			attrSendKind.String(kind),
+			attrSendTarget.String(target)))
+	return span, injectHeaders(ctx, contextHeaders(ctx))
+}
+
+func (d *defaultHubLifetimeManager) broadcast(span trace.Span, kind string, recipients int) {
+	span.SetAttributes(attrRecipients.Int(recipients))
+	span.End()
+	if d.party != nil {
+		d.party.metrics().Broadcast(kind, recipients)
 	}
 }
@@ -10,11 +10,13 @@ import (
 // If buf does not contain the whole message, it returns a nil message and complete false
 // WriteMessage writes a message to the specified writer
 // UnmarshalArgument() unmarshals a raw message depending of the specified value type into a destination value
+// setLimits() sets the limits for received messages. ParseMessages returns a *MessageLimitError if one is exceeded
 type hubProtocol interface {
 	ParseMessages(reader io.Reader, remainBuf *bytes.Buffer) ([]interface{}, error)
 	WriteMessage(message interface{}, writer io.Writer) error
 	UnmarshalArgument(src interface{}, dst interface{}) error
 	setDebugLogger(dbg StructuredLogger)
+	setLimits(limits messageLimits)
 	transferMode() TransferMode
 }
 
@@ -25,26 +27,29 @@ type hubMessage struct {
 
 // easyjson:json
 type invocationMessage struct {
-	Type         int           `json:"type"`
-	Target       string        `json:"target"`
-	InvocationID string        `json:"invocationId,omitempty"`
-	Arguments    []interface{} `json:"arguments"`
-	StreamIds    []string      `json:"streamIds,omitempty"`
+	Type         int               `json:"type"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Target       string            `json:"target"`
+	InvocationID string            `json:"invocationId,omitempty"`
+	Arguments    []interface{}     `json:"arguments"`
+	StreamIds    []string          `json:"streamIds,omitempty"`
 }
 
 //easyjson:json
 type completionMessage struct {
-	Type         int         `json:"type"`
-	InvocationID string      `json:"invocationId"`
-	Result       interface{} `json:"result,omitempty"`
-	Error        string      `json:"error,omitempty"`
+	Type         int               `json:"type"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	InvocationID string            `json:"invocationId"`
+	Result       interface{}       `json:"result,omitempty"`
+	Error        string            `json:"error,omitempty"`
 }
 
 //easyjson:json
 type streamItemMessage struct {
-	Type         int         `json:"type"`
-	InvocationID string      `json:"invocationId"`
-	Item         interface{} `json:"item"`
+	Type         int               `json:"type"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	InvocationID string            `json:"invocationId"`
+	Item         interface{}       `json:"item"`
 }
 
 //easyjson:json
@@ -0,0 +1,87 @@
+package signalr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+var errEndOfFuzzInput = errors.New("end of fuzz input")
+
+// fuzzReader returns the fuzz input and then an error, because readJSONFrames waits for more data on io.EOF
+type fuzzReader struct {
+	data []byte
+}
+
+func (f *fuzzReader) Read(p []byte) (int, error) {
+	if len(f.data) == 0 {
+		return 0, errEndOfFuzzInput
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func fuzzSeeds(f *testing.F, protocol hubProtocol) {
+	for _, message := range []interface{}{
+		invocationMessage{Type: 1, Target: "add2", InvocationID: "1", Arguments: []interface{}{1, "2", []int{3}}},
+		invocationMessage{Type: 4, Target: "stream", InvocationID: "2", Arguments: []interface{}{map[string]int{"a": 1}}, StreamIds: []string{"1"}},
+		streamItemMessage{Type: 2, InvocationID: "1", Item: []interface{}{[]interface{}{1}}},
+		completionMessage{Type: 3, InvocationID: "1", Result: 1},
+		completionMessage{Type: 3, InvocationID: "1", Error: "failed"},
+		cancelInvocationMessage{Type: 5, InvocationID: "1"},
+		hubMessage{Type: 6},
+		closeMessage{Type: 7, Error: "closed", AllowReconnect: true},
+	} {
+		buf := bytes.Buffer{}
+		if err := protocol.WriteMessage(message, &buf); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+}
+
+func fuzzParseMessages(t *testing.T, protocol hubProtocol, data []byte) {
+	remainBuf := bytes.Buffer{}
+	reader := &fuzzReader{data: data}
+	// Both protocols read from the reader on every call, so the loop ends with errEndOfFuzzInput at the latest
+	for {
+		messages, err := protocol.ParseMessages(reader, &remainBuf)
+		if err != nil {
+			return
+		}
+		for _, message := range messages {
+			switch message.(type) {
+			case invocationMessage, streamItemMessage, completionMessage, cancelInvocationMessage, closeMessage, hubMessage:
+			default:
+				t.Fatalf("unexpected message %#v", message)
+			}
+		}
+	}
+}
+
+func FuzzJSONParseMessages(f *testing.F) {
+	protocol := &jsonHubProtocol{}
+	protocol.setDebugLogger(log.NewNopLogger())
+	protocol.setLimits(messageLimits{maxFrameSize: 1 << 15, maxArguments: 64, maxNestingDepth: 32})
+	fuzzSeeds(f, protocol)
+	f.Add([]byte("{\"type\":1,\"arguments\":[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[1]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]}\x1e"))
+	f.Add([]byte("{\"type\":\x1e\x1e{}\x1e"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzParseMessages(t, protocol, data)
+	})
+}
+
+func FuzzMessagePackParseMessages(f *testing.F) {
+	protocol := &messagePackHubProtocol{}
+	protocol.setDebugLogger(log.NewNopLogger())
+	protocol.setLimits(messageLimits{maxFrameSize: 1 << 15, maxArguments: 64, maxNestingDepth: 32})
+	fuzzSeeds(f, protocol)
+	f.Add([]byte{0x80, 0x80, 0x80, 0x80, 0x04})
+	f.Add([]byte{0x06, 0x95, 0x01, 0x80, 0xc0, 0xa1, 0x61, 0xdd})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzParseMessages(t, protocol, data)
+	})
+}
@@ -40,6 +40,7 @@ var _ = Describe("Protocol", func() {
 					arguments := a
 					want := invocationMessage{
 						Type:         1,
+						Headers:      map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
 						Target:       "A",
 						InvocationID: "B",
 						Arguments:    arguments,
@@ -55,6 +56,7 @@ var _ = Describe("Protocol", func() {
 						Expect(len(got)).To(Equal(1))
 						Expect(got[0]).To(BeAssignableToTypeOf(invocationMessage{}))
 						gotMsg := got[0].(invocationMessage)
+						Expect(gotMsg.Headers).To(Equal(want.Headers))
 						Expect(gotMsg.Target).To(Equal(want.Target))
 						Expect(gotMsg.InvocationID).To(Equal(want.InvocationID))
 						Expect(gotMsg.StreamIds).To(Equal(want.StreamIds))
@@ -80,6 +82,7 @@ var _ = Describe("Protocol", func() {
 					{Type: 2, InvocationID: "6", Item: []int{1, 2, 3}},
 					{Type: 2, InvocationID: "7", Item: map[string]int{"1": 4, "2": 5, "3": 6}},
 					{Type: 2, InvocationID: "9"},
+					{Type: 2, Headers: map[string]string{"correlation": "10"}, InvocationID: "10", Item: 10},
 				} {
 					want := w
 					It(fmt.Sprintf("should be equal after roundtrip of %#v", want), func(done Done) {
@@ -92,6 +95,7 @@ var _ = Describe("Protocol", func() {
 						Expect(got[0]).To(BeAssignableToTypeOf(streamItemMessage{}))
 						gotMsg := got[0].(streamItemMessage)
 						Expect(gotMsg.InvocationID).To(Equal(want.InvocationID))
+						Expect(gotMsg.Headers).To(Equal(want.Headers))
 						if want.Item == nil {
 							var v interface{}
 							Expect(protocol.UnmarshalArgument(gotMsg.Item, &v)).NotTo(HaveOccurred())
@@ -119,6 +123,7 @@ var _ = Describe("Protocol", func() {
 					{Type: 3, InvocationID: "7", Result: map[string]int{"1": 4, "2": 5, "3": 6}},
 					{Type: 3, InvocationID: "8"},
 					{Type: 3, InvocationID: "9", Error: "Failed"},
+					{Type: 3, Headers: map[string]string{"correlation": "10"}, InvocationID: "10", Result: 10},
 				} {
 					want := w
 					It(fmt.Sprintf("should be equal after roundtrip of %#v", want), func(done Done) {
@@ -131,6 +136,7 @@ var _ = Describe("Protocol", func() {
 						Expect(got[0]).To(BeAssignableToTypeOf(completionMessage{}))
 						gotMsg := got[0].(completionMessage)
 						Expect(gotMsg.InvocationID).To(Equal(want.InvocationID))
+						Expect(gotMsg.Headers).To(Equal(want.Headers))
 						if want.Result == nil {
 							// Important: In contrast to StreamItemMessage a nil Result is not transmitted
 							// So if a stream ends with a nil item,
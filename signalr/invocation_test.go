@@ -1,6 +1,7 @@
 package signalr
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -51,6 +52,43 @@ func (i *invocationHub) AsyncClosedChan() chan bool {
 	return r
 }
 
+func (i *invocationHub) Validate(value int) (int, error) {
+	invocationQueue <- fmt.Sprintf("Validate(%v)", value)
+	if value < 0 {
+		return 0, errors.New("value must not be negative")
+	}
+	return value, nil
+}
+
+func (i *invocationHub) Check(value int) error {
+	invocationQueue <- fmt.Sprintf("Check(%v)", value)
+	if value < 0 {
+		return errors.New("value must not be negative")
+	}
+	return nil
+}
+
+func (i *invocationHub) Divide(a, b int) (int, int, error) {
+	invocationQueue <- fmt.Sprintf("Divide(%v, %v)", a, b)
+	if b == 0 {
+		return 0, 0, errors.New("division by zero")
+	}
+	return a / b, a % b, nil
+}
+
+func (i *invocationHub) Count(n int) (<-chan int, error) {
+	invocationQueue <- fmt.Sprintf("Count(%v)", n)
+	if n < 0 {
+		return nil, errors.New("count must not be negative")
+	}
+	ch := make(chan int, n)
+	for j := 0; j < n; j++ {
+		ch <- j
+	}
+	close(ch)
+	return ch, nil
+}
+
 func (i *invocationHub) Panic() {
 	invocationQueue <- "Panic()"
 	panic("Don't panic!")
@@ -333,6 +371,115 @@ var _ = Describe("Invocation", func() {
 		})
 	})
 
+	Describe("Invocation of func with error result", func() {
+		var server Server
+		var conn *testingConnection
+		BeforeEach(func(done Done) {
+			server, conn = connect(&invocationHub{})
+			close(done)
+		})
+		AfterEach(func(done Done) {
+			server.cancel()
+			close(done)
+		})
+		Context("When the func returns a nil error", func() {
+			It("should return the result without the error", func(done Done) {
+				conn.ClientSend(`{"type":1,"invocationId": "v1","target":"validate","arguments":[7]}`)
+				Expect(<-invocationQueue).To(Equal("Validate(7)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("v1"))
+				Expect(recv.Result).To(Equal(float64(7)))
+				Expect(recv.Error).To(Equal(""))
+				close(done)
+			}, 2.0)
+		})
+		Context("When the func returns an error", func() {
+			It("should return a completion with the error but no result", func(done Done) {
+				conn.ClientSend(`{"type":1,"invocationId": "v2","target":"validate","arguments":[-1]}`)
+				Expect(<-invocationQueue).To(Equal("Validate(-1)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("v2"))
+				Expect(recv.Result).To(BeNil())
+				Expect(recv.Error).To(Equal("value must not be negative"))
+				close(done)
+			}, 2.0)
+		})
+		Context("When a func with only an error result returns nil", func() {
+			It("should return a completion without result", func(done Done) {
+				conn.ClientSend(`{"type":1,"invocationId": "c1","target":"check","arguments":[1]}`)
+				Expect(<-invocationQueue).To(Equal("Check(1)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("c1"))
+				Expect(recv.Result).To(BeNil())
+				Expect(recv.Error).To(Equal(""))
+				close(done)
+			}, 2.0)
+		})
+		Context("When a func with only an error result returns an error", func() {
+			It("should return a completion with the error", func(done Done) {
+				conn.ClientSend(`{"type":1,"invocationId": "c2","target":"check","arguments":[-1]}`)
+				Expect(<-invocationQueue).To(Equal("Check(-1)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("c2"))
+				Expect(recv.Result).To(BeNil())
+				Expect(recv.Error).To(Equal("value must not be negative"))
+				close(done)
+			}, 2.0)
+		})
+		Context("When a func with two results and an error returns a nil error", func() {
+			It("should return both results without the error", func(done Done) {
+				conn.ClientSend(`{"type":1,"invocationId": "d1","target":"divide","arguments":[7, 2]}`)
+				Expect(<-invocationQueue).To(Equal("Divide(7, 2)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("d1"))
+				Expect(recv.Result).To(Equal([]interface{}{float64(3), float64(1)}))
+				Expect(recv.Error).To(Equal(""))
+				close(done)
+			}, 2.0)
+		})
+		Context("When a func with two results and an error returns an error", func() {
+			It("should return a completion with the error but no results", func(done Done) {
+				conn.ClientSend(`{"type":1,"invocationId": "d2","target":"divide","arguments":[7, 0]}`)
+				Expect(<-invocationQueue).To(Equal("Divide(7, 0)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("d2"))
+				Expect(recv.Result).To(BeNil())
+				Expect(recv.Error).To(Equal("division by zero"))
+				close(done)
+			}, 2.0)
+		})
+		Context("When a streaming func with an error result returns a nil error", func() {
+			It("should stream the items of the chan", func(done Done) {
+				conn.ClientSend(`{"type":4,"invocationId": "s1","target":"count","arguments":[2]}`)
+				Expect(<-invocationQueue).To(Equal("Count(2)"))
+				var items []string
+				for {
+					switch recv := (<-conn.received).(type) {
+					case streamItemMessage:
+						items = append(items, fmt.Sprint(recv.Item))
+						continue
+					case completionMessage:
+						Expect(recv.InvocationID).To(Equal("s1"))
+						Expect(recv.Error).To(Equal(""))
+					}
+					break
+				}
+				Expect(items).To(Equal([]string{"0", "1"}))
+				close(done)
+			}, 2.0)
+		})
+		Context("When a streaming func with an error result returns an error", func() {
+			It("should return a completion with the error", func(done Done) {
+				conn.ClientSend(`{"type":4,"invocationId": "s2","target":"count","arguments":[-1]}`)
+				Expect(<-invocationQueue).To(Equal("Count(-1)"))
+				recv := (<-conn.received).(completionMessage)
+				Expect(recv.InvocationID).To(Equal("s2"))
+				Expect(recv.Error).To(Equal("count must not be negative"))
+				close(done)
+			}, 2.0)
+		})
+	})
+
 	Describe("Panic in invoked func", func() {
 		var server Server
 		var conn *testingConnection
@@ -13,13 +13,15 @@ import (
 
 // jsonHubProtocol is the JSON based SignalR protocol
 type jsonHubProtocol struct {
-	dbg log.Logger
+	dbg    log.Logger
+	limits messageLimits
 }
 
 // Protocol specific messages for correct unmarshaling of arguments or results.
 // jsonInvocationMessage is only used in ParseMessages, not in WriteMessage
 type jsonInvocationMessage struct {
 	Type         int               `json:"type"`
+	Headers      map[string]string `json:"headers,omitempty"`
 	Target       string            `json:"target"`
 	InvocationID string            `json:"invocationId"`
 	Arguments    []json.RawMessage `json:"arguments"`
@@ -27,16 +29,18 @@ type jsonInvocationMessage struct {
 }
 
 type jsonStreamItemMessage struct {
-	Type         int             `json:"type"`
-	InvocationID string          `json:"invocationId"`
-	Item         json.RawMessage `json:"item"`
+	Type         int               `json:"type"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	InvocationID string            `json:"invocationId"`
+	Item         json.RawMessage   `json:"item"`
 }
 
 type jsonCompletionMessage struct {
-	Type         int             `json:"type"`
-	InvocationID string          `json:"invocationId"`
-	Result       json.RawMessage `json:"result,omitempty"`
-	Error        string          `json:"error,omitempty"`
+	Type         int               `json:"type"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	InvocationID string            `json:"invocationId"`
+	Result       json.RawMessage   `json:"result,omitempty"`
+	Error        string            `json:"error,omitempty"`
 }
 
 type jsonError struct {
@@ -65,13 +69,16 @@ func (j *jsonHubProtocol) UnmarshalArgument(src interface{}, dst interface{}) er
 
 // ParseMessages reads all messages from the reader and puts the remaining bytes into remainBuf
 func (j *jsonHubProtocol) ParseMessages(reader io.Reader, remainBuf *bytes.Buffer) (messages []interface{}, err error) {
-	frames, err := readJSONFrames(reader, remainBuf)
+	frames, err := readJSONFrames(reader, remainBuf, j.limits.maxFrameSize)
 	if err != nil {
 		return nil, err
 	}
 	message := hubMessage{}
 	messages = make([]interface{}, 0)
 	for _, frame := range frames {
+		if err = j.limits.checkJSONDepth(frame); err != nil {
+			return nil, err
+		}
 		err = json.Unmarshal(frame, &message)
 		_ = j.dbg.Log(evt, "read", msg, string(frame))
 		if err != nil {
@@ -96,6 +103,8 @@ func (j *jsonHubProtocol) parseMessage(messageType int, text []byte) (message in
 		jsonInvocation := jsonInvocationMessage{}
 		if err = json.Unmarshal(text, &jsonInvocation); err != nil {
 			err = &jsonError{string(text), err}
+		} else if err = j.limits.checkArguments(len(jsonInvocation.Arguments) + len(jsonInvocation.StreamIds)); err != nil {
+			return nil, err
 		}
 		arguments := make([]interface{}, len(jsonInvocation.Arguments))
 		for i, a := range jsonInvocation.Arguments {
@@ -103,6 +112,7 @@ func (j *jsonHubProtocol) parseMessage(messageType int, text []byte) (message in
 		}
 		return invocationMessage{
 			Type:         jsonInvocation.Type,
+			Headers:      jsonInvocation.Headers,
 			Target:       jsonInvocation.Target,
 			InvocationID: jsonInvocation.InvocationID,
 			Arguments:    arguments,
@@ -115,6 +125,7 @@ func (j *jsonHubProtocol) parseMessage(messageType int, text []byte) (message in
 		}
 		return streamItemMessage{
 			Type:         jsonStreamItem.Type,
+			Headers:      jsonStreamItem.Headers,
 			InvocationID: jsonStreamItem.InvocationID,
 			Item:         jsonStreamItem.Item,
 		}, err
@@ -125,6 +136,7 @@ func (j *jsonHubProtocol) parseMessage(messageType int, text []byte) (message in
 		}
 		completion := completionMessage{
 			Type:         jsonCompletion.Type,
+			Headers:      jsonCompletion.Headers,
 			InvocationID: jsonCompletion.InvocationID,
 			Error:        jsonCompletion.Error,
 		}
@@ -152,8 +164,10 @@ func (j *jsonHubProtocol) parseMessage(messageType int, text []byte) (message in
 	}
 }
 
-// readJSONFrames reads all complete frames (delimited by 0x1e) from the reader and puts the remaining bytes into remainBuf
-func readJSONFrames(reader io.Reader, remainBuf *bytes.Buffer) ([][]byte, error) {
+// readJSONFrames reads all complete frames (delimited by 0x1e) from the reader and puts the remaining bytes into remainBuf.
+// If maxFrameSize is not 0, frames, complete or not, which are larger than maxFrameSize are rejected.
+func readJSONFrames(reader io.Reader, remainBuf *bytes.Buffer, maxFrameSize int) ([][]byte, error) {
+	limits := messageLimits{maxFrameSize: maxFrameSize}
 	p := make([]byte, 1<<15)
 	buf := &bytes.Buffer{}
 	_, _ = buf.ReadFrom(remainBuf)
@@ -170,6 +184,15 @@ func readJSONFrames(reader io.Reader, remainBuf *bytes.Buffer) ([][]byte, error)
 			if err != nil {
 				return nil, err
 			}
+			for _, frame := range frames {
+				if err = limits.checkFrameSize(len(frame)); err != nil {
+					return nil, err
+				}
+			}
+			// Don't buffer an incomplete frame which is already too large
+			if err = limits.checkFrameSize(buf.Len()); err != nil {
+				return nil, err
+			}
 			if len(frames) > 0 {
 				_, _ = remainBuf.ReadFrom(buf)
 				return frames, nil
@@ -217,6 +240,10 @@ func (j *jsonHubProtocol) transferMode() TransferMode {
 	return TextTransferMode
 }
 
+func (j *jsonHubProtocol) setLimits(limits messageLimits) {
+	j.limits = limits
+}
+
 func (j *jsonHubProtocol) setDebugLogger(dbg StructuredLogger) {
 	j.dbg = log.WithPrefix(dbg, "ts", log.DefaultTimestampUTC, "protocol", "JSON")
 }
@@ -0,0 +1,39 @@
+package signalr
+
+import (
+	"context"
+	"runtime/pprof"
+	"strings"
+)
+
+// pprof labels set on the goroutines of a connection and its hub invocations.
+// Goroutines started by a labeled goroutine inherit its labels, so goroutine, CPU and heap profiles
+// can be attributed to connections and hub methods.
+const (
+	LabelConnection = "signalr.connection"
+	LabelTransport  = "signalr.transport"
+	LabelMethod     = "signalr.method"
+	LabelInvocation = "signalr.invocation"
+)
+
+// connectionLabels returns the pprof labels of the goroutines serving the connection of the loop
+func (l *loop) connectionLabels() pprof.LabelSet {
+	return pprof.Labels(LabelConnection, l.hubConn.ConnectionID(), LabelTransport, l.transport)
+}
+
+// invocationLabels returns the pprof labels of the goroutine running a hub method
+func (l *loop) invocationLabels(invocation invocationMessage) pprof.LabelSet {
+	return pprof.Labels(LabelConnection, l.hubConn.ConnectionID(), LabelTransport, l.transport,
+		LabelMethod, strings.ToLower(invocation.Target), LabelInvocation, invocation.InvocationID)
+}
+
+// sendLabels returns the pprof labels of the goroutine sending to a connection. The sends are started by the
+// goroutine of the sender, so they are labeled with the recipient instead of inheriting the labels of the sender.
+func sendLabels(conn hubConnection) pprof.LabelSet {
+	return pprof.Labels(LabelConnection, conn.ConnectionID())
+}
+
+// withLabels runs f with the labels set on the current goroutine and restores the previous labels afterwards
+func withLabels(labels pprof.LabelSet, f func()) {
+	pprof.Do(context.Background(), labels, func(context.Context) { f() })
+}
@@ -0,0 +1,96 @@
+package signalr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var blockingHubRelease = make(chan struct{})
+
+type blockingHub struct {
+	Hub
+}
+
+func (b *blockingHub) Block() {
+	<-blockingHubRelease
+}
+
+// blockingSendConnection is a hubConnection whose sends block until release is closed
+type blockingSendConnection struct {
+	hubConnection
+	id      string
+	release chan struct{}
+}
+
+func (b *blockingSendConnection) ConnectionID() string {
+	return b.id
+}
+
+func (b *blockingSendConnection) SendInvocation(string, string, []interface{}, map[string]string) error {
+	<-b.release
+	return nil
+}
+
+// goroutineProfile returns the goroutine profile in the text format, which includes the labels
+func goroutineProfile() string {
+	var buf bytes.Buffer
+	Expect(pprof.Lookup("goroutine").WriteTo(&buf, 1)).To(Succeed())
+	return buf.String()
+}
+
+var _ = Describe("pprof labels", func() {
+	It("should label the goroutines of connections and hub invocations", func(done Done) {
+		server, err := NewServer(context.TODO(), SimpleHubFactory(&blockingHub{}), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		cliConn, srvConn := newClientServerConnections()
+		go func() { _ = server.Serve(srvConn) }()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client, err := NewClient(ctx, WithConnection(cliConn), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+		connection := fmt.Sprintf("%q:%q", LabelConnection, srvConn.ConnectionID())
+		Eventually(goroutineProfile).Should(ContainSubstring(connection))
+		result := client.Invoke("Block")
+		Eventually(goroutineProfile).Should(And(
+			ContainSubstring(fmt.Sprintf("%q:%q", LabelMethod, "block")),
+			ContainSubstring(fmt.Sprintf("%q:%q", LabelInvocation, "1"))))
+		blockingHubRelease <- struct{}{}
+		Expect((<-result).Error).NotTo(HaveOccurred())
+		server.cancel()
+		close(done)
+	}, 5.0)
+
+	It("should label the goroutines sending to a group with the recipient", func(done Done) {
+		manager := newLifeTimeManager(testLogger())
+		recipient := &blockingSendConnection{id: "recipient-connection", release: make(chan struct{})}
+		defer close(recipient.release)
+		manager.OnConnected(recipient)
+		manager.AddToGroup("g", recipient.ConnectionID())
+		withLabels(pprof.Labels(LabelConnection, "sender-connection", LabelMethod, "send"), func() {
+			manager.InvokeGroup(context.Background(), "g", "receive", nil)
+		})
+		profile := func() []string {
+			// the blocked send is the goroutine stack which contains SendInvocation of the test connection
+			var sends []string
+			for _, stack := range strings.Split(goroutineProfile(), "\n\n") {
+				if strings.Contains(stack, "blockingSendConnection).SendInvocation") {
+					sends = append(sends, stack)
+				}
+			}
+			return sends
+		}
+		Eventually(profile).Should(ConsistOf(And(
+			ContainSubstring(fmt.Sprintf("%q:%q", LabelConnection, "recipient-connection")),
+			Not(ContainSubstring("sender-connection")),
+			Not(ContainSubstring(LabelMethod)))))
+		close(done)
+	}, 5.0)
+})
@@ -0,0 +1,221 @@
+package signalr
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// messageLimits are the limits a hubProtocol enforces on received messages. Zero values mean unlimited.
+type messageLimits struct {
+	maxFrameSize    int // size of one encoded message
+	maxArguments    int // arguments plus stream ids of an invocation
+	maxNestingDepth int // nesting of arrays and objects, the message itself counts as one level
+}
+
+func partyMessageLimits(p Party) messageLimits {
+	return messageLimits{
+		maxFrameSize:    int(p.maximumReceiveMessageSize()),
+		maxArguments:    int(p.maximumArguments()),
+		maxNestingDepth: int(p.maximumNestingDepth()),
+	}
+}
+
+// MessageLimitError is returned when a received message exceeds one of the limits set by
+// MaximumReceiveMessageSize, MaximumArguments or MaximumNestingDepth.
+// The connection is closed with the error text as close message.
+type MessageLimitError struct {
+	Limit string
+	Value int
+	Max   int
+}
+
+func (e *MessageLimitError) Error() string {
+	switch e.Limit {
+	case "size":
+		return fmt.Sprintf("message of %d bytes exceeds the maximum message size of %d bytes", e.Value, e.Max)
+	case "arguments":
+		return fmt.Sprintf("invocation with %d arguments exceeds the maximum of %d arguments", e.Value, e.Max)
+	default:
+		return fmt.Sprintf("message nested %d levels deep exceeds the maximum nesting depth of %d", e.Value, e.Max)
+	}
+}
+
+func (l messageLimits) checkFrameSize(size int) error {
+	if l.maxFrameSize > 0 && size > l.maxFrameSize {
+		return &MessageLimitError{Limit: "size", Value: size, Max: l.maxFrameSize}
+	}
+	return nil
+}
+
+func (l messageLimits) checkArguments(count int) error {
+	if l.maxArguments > 0 && count > l.maxArguments {
+		return &MessageLimitError{Limit: "arguments", Value: count, Max: l.maxArguments}
+	}
+	return nil
+}
+
+// checkJSONDepth scans a JSON frame for its nesting depth without decoding it
+func (l messageLimits) checkJSONDepth(frame []byte) error {
+	if l.maxNestingDepth <= 0 {
+		return nil
+	}
+	depth := 0
+	inString := false
+	escaped := false
+	for _, b := range frame {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch b {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '[' || b == '{':
+			depth++
+			if depth > l.maxNestingDepth {
+				return &MessageLimitError{Limit: "depth", Value: depth, Max: l.maxNestingDepth}
+			}
+		case b == ']' || b == '}':
+			depth--
+		}
+	}
+	return nil
+}
+
+// checkMessagePackDepth walks the structure of a messagepack frame for its nesting depth without decoding it.
+// Arrays and maps claiming more items than the frame can hold are rejected, as decoding them would allocate
+// for the claimed size. Other malformed frames are not reported here, they fail when they are decoded.
+func (l messageLimits) checkMessagePackDepth(frame []byte) error {
+	if l.maxNestingDepth <= 0 {
+		return nil
+	}
+	// remaining holds the number of items left on each level, the outermost level holds the message itself
+	remaining := []uint64{1}
+	pos := 0
+	for len(remaining) > 0 {
+		if remaining[len(remaining)-1] == 0 {
+			remaining = remaining[:len(remaining)-1]
+			continue
+		}
+		remaining[len(remaining)-1]--
+		size, items, ok := messagePackItem(frame[pos:])
+		if !ok || size > len(frame)-pos {
+			return nil
+		}
+		pos += size
+		if items >= 0 {
+			// Each item takes at least one byte
+			if uint64(items) > uint64(len(frame)-pos) {
+				return fmt.Errorf("messagepack container with %d items exceeds the frame of %d bytes", items, len(frame))
+			}
+			if len(remaining) > l.maxNestingDepth {
+				return &MessageLimitError{Limit: "depth", Value: len(remaining), Max: l.maxNestingDepth}
+			}
+			remaining = append(remaining, uint64(items))
+		}
+	}
+	return nil
+}
+
+// messagePackItem returns the size of the header (for arrays and maps) or of the whole value (for all others)
+// at the start of b and the number of items contained in an array or map, or -1 for all other values.
+func messagePackItem(b []byte) (size int, items int64, ok bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	// length returns the big endian number of n bytes after the type byte
+	length := func(n int) (uint64, bool) {
+		if len(b) < 1+n {
+			return 0, false
+		}
+		switch n {
+		case 1:
+			return uint64(b[1]), true
+		case 2:
+			return uint64(binary.BigEndian.Uint16(b[1:])), true
+		default:
+			return uint64(binary.BigEndian.Uint32(b[1:])), true
+		}
+	}
+	// value returns the size of a value with an n byte length field, extra bytes after it and the data
+	value := func(n int, extra int) (int, int64, bool) {
+		l, ok := length(n)
+		if !ok || l > uint64(len(b)) {
+			return 0, 0, false
+		}
+		return 1 + n + extra + int(l), -1, true
+	}
+	// container returns the header size of an array or map with an n byte length field
+	container := func(n int, perItem uint64) (int, int64, bool) {
+		l, ok := length(n)
+		return 1 + n, int64(l * perItem), ok
+	}
+	t := b[0]
+	switch {
+	case t <= 0x7f || t >= 0xe0 || t == 0xc0 || t == 0xc2 || t == 0xc3:
+		return 1, -1, true
+	case t <= 0x8f:
+		return 1, int64(t&0x0f) * 2, true
+	case t <= 0x9f:
+		return 1, int64(t & 0x0f), true
+	case t <= 0xbf:
+		return 1 + int(t&0x1f), -1, true
+	}
+	switch t {
+	case 0xc4:
+		return value(1, 0)
+	case 0xc5:
+		return value(2, 0)
+	case 0xc6:
+		return value(4, 0)
+	case 0xc7:
+		return value(1, 1)
+	case 0xc8:
+		return value(2, 1)
+	case 0xc9:
+		return value(4, 1)
+	case 0xca:
+		return 5, -1, true
+	case 0xcb:
+		return 9, -1, true
+	case 0xcc, 0xd0:
+		return 2, -1, true
+	case 0xcd, 0xd1:
+		return 3, -1, true
+	case 0xce, 0xd2:
+		return 5, -1, true
+	case 0xcf, 0xd3:
+		return 9, -1, true
+	case 0xd4:
+		return 3, -1, true
+	case 0xd5:
+		return 4, -1, true
+	case 0xd6:
+		return 6, -1, true
+	case 0xd7:
+		return 10, -1, true
+	case 0xd8:
+		return 18, -1, true
+	case 0xd9:
+		return value(1, 0)
+	case 0xda:
+		return value(2, 0)
+	case 0xdb:
+		return value(4, 0)
+	case 0xdc:
+		return container(2, 1)
+	case 0xdd:
+		return container(4, 1)
+	case 0xde:
+		return container(2, 2)
+	case 0xdf:
+		return container(4, 2)
+	}
+	// 0xc1 is never used
+	return 0, 0, false
+}
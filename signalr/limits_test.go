@@ -0,0 +1,169 @@
+package signalr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func nestedArgument(depth int) []interface{} {
+	var arg interface{} = "leaf [{"
+	for i := 0; i < depth; i++ {
+		arg = []interface{}{arg}
+	}
+	return []interface{}{arg}
+}
+
+var _ = Describe("Message limits", func() {
+	limits := messageLimits{maxFrameSize: 200, maxArguments: 3, maxNestingDepth: 5}
+
+	for _, p := range []hubProtocol{
+		&jsonHubProtocol{},
+		&messagePackHubProtocol{},
+	} {
+		protocol := p
+		protocol.setDebugLogger(testLogger())
+		protocol.setLimits(limits)
+
+		parse := func(message interface{}) error {
+			buf := bytes.Buffer{}
+			Expect(protocol.WriteMessage(message, &buf)).To(Succeed())
+			_, err := protocol.ParseMessages(&buf, &bytes.Buffer{})
+			return err
+		}
+		limitError := func(limit string) OmegaMatcher {
+			return WithTransform(func(err error) string {
+				if limitErr, ok := err.(*MessageLimitError); ok {
+					return limitErr.Limit
+				}
+				return fmt.Sprintf("%v", err)
+			}, Equal(limit))
+		}
+
+		Describe(fmt.Sprintf("%T", protocol), func() {
+			It("should accept messages within the limits", func() {
+				Expect(parse(invocationMessage{Type: 1, Target: "t", Arguments: append(nestedArgument(2), 1), StreamIds: []string{"1"}})).To(Succeed())
+			})
+			It("should reject messages larger than the maximum size", func() {
+				Expect(parse(invocationMessage{Type: 1, Target: "t", Arguments: []interface{}{strings.Repeat("x", 300)}})).To(limitError("size"))
+			})
+			It("should reject invocations with too many arguments", func() {
+				Expect(parse(invocationMessage{Type: 1, Target: "t", Arguments: []interface{}{1, 2, 3, 4}})).To(limitError("arguments"))
+				Expect(parse(invocationMessage{Type: 1, Target: "t", Arguments: []interface{}{1, 2}, StreamIds: []string{"1", "2"}})).To(limitError("arguments"))
+			})
+			It("should reject messages nested too deep", func() {
+				Expect(parse(invocationMessage{Type: 1, Target: "t", Arguments: nestedArgument(4)})).To(limitError("depth"))
+				Expect(parse(streamItemMessage{Type: 2, InvocationID: "1", Item: nestedArgument(4)})).To(limitError("depth"))
+			})
+		})
+	}
+
+	It("should reject incomplete JSON frames larger than the maximum size before they are complete", func() {
+		protocol := &jsonHubProtocol{}
+		protocol.setDebugLogger(testLogger())
+		protocol.setLimits(limits)
+		_, err := protocol.ParseMessages(strings.NewReader(`{"type":1,"target":"`+strings.Repeat("x", 300)), &bytes.Buffer{})
+		Expect(err).To(BeAssignableToTypeOf(&MessageLimitError{}))
+	})
+
+	It("should reject messagepack frames larger than the maximum size before they are read", func() {
+		protocol := &messagePackHubProtocol{}
+		protocol.setDebugLogger(testLogger())
+		protocol.setLimits(limits)
+		// Frame length 1GB, without the frame
+		_, err := protocol.ParseMessages(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x04}), &bytes.Buffer{})
+		Expect(err).To(BeAssignableToTypeOf(&MessageLimitError{}))
+	})
+
+	It("should reject messagepack maps and arrays claiming more items than the frame holds", func() {
+		protocol := &messagePackHubProtocol{}
+		protocol.setDebugLogger(testLogger())
+		protocol.setLimits(limits)
+		// Invocation with a header map of 0xffffffff entries
+		frame := []byte{0x95, 0x01, 0xdf, 0xff, 0xff, 0xff, 0xff, 0xa1, 0x61}
+		_, err := protocol.ParseMessages(bytes.NewReader(append([]byte{byte(len(frame))}, frame...)), &bytes.Buffer{})
+		Expect(err).To(MatchError(ContainSubstring("exceeds the frame")))
+	})
+
+	Context("on the server", func() {
+		var server Server
+		var conn *testingConnection
+
+		BeforeEach(func(done Done) {
+			var err error
+			server, err = NewServer(context.TODO(), SimpleHubFactory(&addHub{}), testLoggerOption(),
+				MaximumReceiveMessageSize(1000), MaximumArguments(2), MaximumNestingDepth(4))
+			Expect(err).NotTo(HaveOccurred())
+			conn = newTestingConnectionForServer()
+			go func() { _ = server.Serve(conn) }()
+			close(done)
+		})
+		AfterEach(func() {
+			server.cancel()
+		})
+
+		expectClose := func(text string) {
+			for {
+				if message, ok := (<-conn.received).(closeMessage); ok {
+					Expect(message.Error).To(ContainSubstring(text))
+					return
+				}
+			}
+		}
+
+		It("should close the connection when a message is too large", func(done Done) {
+			conn.ClientSend(fmt.Sprintf(`{"type":1,"invocationId":"1","target":"add2","arguments":["%s"]}`, strings.Repeat("x", 1000)))
+			expectClose("exceeds the maximum message size of 1000 bytes")
+			close(done)
+		}, 2.0)
+
+		It("should close the connection when an invocation has too many arguments", func(done Done) {
+			conn.ClientSend(`{"type":1,"invocationId":"1","target":"add2","arguments":[1,2,3]}`)
+			expectClose("invocation with 3 arguments exceeds the maximum of 2 arguments")
+			close(done)
+		}, 2.0)
+
+		It("should close the connection when a message is nested too deep", func(done Done) {
+			conn.ClientSend(`{"type":1,"invocationId":"1","target":"add2","arguments":[[[["1"]]]]}`)
+			expectClose("exceeds the maximum nesting depth of 4")
+			close(done)
+		}, 2.0)
+
+		It("should ignore brackets in strings", func(done Done) {
+			conn.ClientSend(`{"type":1,"invocationId":"1","target":"add2","arguments":["[[[[\"[{"]}`)
+			Expect((<-conn.received).(completionMessage).Error).NotTo(ContainSubstring("nesting"))
+			close(done)
+		}, 2.0)
+	})
+
+	for _, t := range []TransportType{TransportWebSockets, TransportServerSentEvents} {
+		transport := t
+		It(fmt.Sprintf("should close %v connections with a close message", transport), func(done Done) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			server, err := NewServer(ctx, SimpleHubFactory(&addHub{}), testLoggerOption(),
+				HTTPTransports(transport), MaximumReceiveMessageSize(1000))
+			Expect(err).NotTo(HaveOccurred())
+			router := http.NewServeMux()
+			server.MapHTTP(WithHTTPServeMux(router), "/hub")
+			testServer := httptest.NewServer(router)
+			defer testServer.Close()
+			conn, err := NewHTTPConnection(ctx, testServer.URL+"/hub")
+			Expect(err).NotTo(HaveOccurred())
+			client, err := NewClient(ctx, WithConnection(conn), testLoggerOption())
+			Expect(err).NotTo(HaveOccurred())
+			client.Start()
+			Expect(<-client.WaitForState(ctx, ClientConnected)).To(Succeed())
+			client.Send("Echo", strings.Repeat("x", 2000))
+			<-client.WaitForState(ctx, ClientClosed)
+			Expect(client.Err()).To(MatchError(ContainSubstring("exceeds the maximum message size of 1000 bytes")))
+			close(done)
+		}, 5.0)
+	}
+})
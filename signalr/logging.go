@@ -0,0 +1,218 @@
+package signalr
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Keys of the context of connection and invocation log events
+const (
+	logConnection = "connection"
+	logTransport  = "transport"
+	logMethod     = "method"
+	logInvocation = "invocation"
+)
+
+// withLogContext adds keyVals to the context of both loggers
+func withLogContext(info StructuredLogger, dbg StructuredLogger, keyVals ...interface{}) (StructuredLogger, StructuredLogger) {
+	return log.With(info, keyVals...), log.With(dbg, keyVals...)
+}
+
+// SlogLogger adapts a slog.Handler to a StructuredLogger, e.g. for the Logger option.
+// The level of the event becomes the slog level, its "event" the message and "ts" the time of the record.
+// All other key/values become attributes in their original order.
+func SlogLogger(handler slog.Handler) StructuredLogger {
+	return &slogLogger{handler: handler}
+}
+
+type slogLogger struct {
+	handler slog.Handler
+}
+
+func (s *slogLogger) Log(keyVals ...interface{}) error {
+	lvl := slog.LevelInfo
+	message := ""
+	ts := time.Now()
+	attrs := make([]slog.Attr, 0, len(keyVals)/2)
+	for i := 0; i < len(keyVals); i += 2 {
+		key := fmt.Sprint(keyVals[i])
+		var value interface{} = log.ErrMissingValue
+		if i+1 < len(keyVals) {
+			value = keyVals[i+1]
+		}
+		switch key {
+		case "level":
+			lvl = slogLevel(value)
+			continue
+		case "ts":
+			if t, ok := value.(time.Time); ok {
+				ts = t
+				continue
+			}
+		case evt:
+			if message == "" {
+				message = fmt.Sprint(value)
+				continue
+			}
+		}
+		attrs = append(attrs, slogAttr(key, value))
+	}
+	ctx := context.Background()
+	if !s.handler.Enabled(ctx, lvl) {
+		return nil
+	}
+	record := slog.NewRecord(ts, lvl, message, 0)
+	record.AddAttrs(attrs...)
+	return s.handler.Handle(ctx, record)
+}
+
+func slogLevel(value interface{}) slog.Level {
+	switch fmt.Sprint(value) {
+	case level.DebugValue().String():
+		return slog.LevelDebug
+	case level.WarnValue().String():
+		return slog.LevelWarn
+	case level.ErrorValue().String():
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func slogAttr(key string, value interface{}) slog.Attr {
+	switch v := value.(type) {
+	case error:
+		return slog.String(key, v.Error())
+	case fmt.Stringer:
+		return slog.String(key, v.String())
+	default:
+		return slog.Any(key, v)
+	}
+}
+
+// LoggerWithDebugFilter sets the logger used by the Party. Info events are always logged,
+// debug events only for the connections and hub methods which are enabled in filter.
+// The filter can be changed while the Party is running, e.g. by the admin API of a server.
+func LoggerWithDebugFilter(logger StructuredLogger, filter *DebugFilter) func(Party) error {
+	return func(p Party) error {
+		if filter == nil {
+			return fmt.Errorf("option LoggerWithDebugFilter: filter is nil")
+		}
+		info, _ := buildInfoDebugLogger(logger, false)
+		_, dbg := buildInfoDebugLogger(&filteredLogger{logger: logger, filter: filter}, true)
+		p.setLoggers(info, dbg)
+		if s, ok := p.(*server); ok {
+			s.debugFilter = filter
+		}
+		return nil
+	}
+}
+
+// filteredLogger passes the events which are enabled in its DebugFilter by their connection and method
+type filteredLogger struct {
+	logger StructuredLogger
+	filter *DebugFilter
+}
+
+func (f *filteredLogger) Log(keyVals ...interface{}) error {
+	var connectionID, method string
+	for i := 0; i+1 < len(keyVals); i += 2 {
+		switch keyVals[i] {
+		case logConnection:
+			connectionID = fmt.Sprint(keyVals[i+1])
+		case logMethod:
+			method = fmt.Sprint(keyVals[i+1])
+		}
+	}
+	if !f.filter.Enabled(connectionID, method) {
+		return nil
+	}
+	return f.logger.Log(keyVals...)
+}
+
+// DebugStatus tells for which connections and hub methods debug logging is enabled
+type DebugStatus struct {
+	All         bool     `json:"all"`
+	Connections []string `json:"connections"`
+	Methods     []string `json:"methods"`
+}
+
+// DebugFilter enables debug logging at runtime, for all events, single connections or single hub methods.
+// Hub method names are case-insensitive. The zero value has debug logging disabled.
+type DebugFilter struct {
+	mx          sync.RWMutex
+	all         bool
+	connections map[string]struct{}
+	methods     map[string]struct{}
+}
+
+// SetAll enables or disables debug logging for all events
+func (f *DebugFilter) SetAll(enabled bool) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.all = enabled
+}
+
+// SetConnection enables or disables debug logging for the connection
+func (f *DebugFilter) SetConnection(connectionID string, enabled bool) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.connections = setMember(f.connections, connectionID, enabled)
+}
+
+// SetMethod enables or disables debug logging for the invocations of the hub method
+func (f *DebugFilter) SetMethod(method string, enabled bool) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.methods = setMember(f.methods, strings.ToLower(method), enabled)
+}
+
+// Enabled tells if debug events of the connection and method are logged. Both may be empty.
+func (f *DebugFilter) Enabled(connectionID string, method string) bool {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	if f.all {
+		return true
+	}
+	if _, ok := f.connections[connectionID]; ok && connectionID != "" {
+		return true
+	}
+	_, ok := f.methods[strings.ToLower(method)]
+	return ok && method != ""
+}
+
+// Status returns the connections and methods with debug logging, sorted
+func (f *DebugFilter) Status() DebugStatus {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return DebugStatus{All: f.all, Connections: sortedMembers(f.connections), Methods: sortedMembers(f.methods)}
+}
+
+func setMember(set map[string]struct{}, member string, enabled bool) map[string]struct{} {
+	if enabled {
+		if set == nil {
+			set = make(map[string]struct{})
+		}
+		set[member] = struct{}{}
+	} else {
+		delete(set, member)
+	}
+	return set
+}
+
+func sortedMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
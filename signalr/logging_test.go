@@ -0,0 +1,158 @@
+package signalr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordHandler is a slog.Handler which keeps the records and their attributes
+type recordHandler struct {
+	mx      sync.Mutex
+	records []recordedLog
+}
+
+type recordedLog struct {
+	level   slog.Level
+	message string
+	attrs   map[string]string
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler           { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	entry := recordedLog{level: r.Level, message: r.Message, attrs: make(map[string]string)}
+	r.Attrs(func(a slog.Attr) bool {
+		entry.attrs[a.Key] = a.Value.String()
+		return true
+	})
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.records = append(h.records, entry)
+	return nil
+}
+
+// find returns the first record with the message and level, or nil
+func (h *recordHandler) find(message string, lvl slog.Level) *recordedLog {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	for i := range h.records {
+		if h.records[i].message == message && h.records[i].level == lvl {
+			return &h.records[i]
+		}
+	}
+	return nil
+}
+
+type loggingHub struct {
+	Hub
+}
+
+func (l *loggingHub) Work() {
+	info, dbg := l.Logger()
+	_ = info.Log(evt, "working")
+	_ = dbg.Log(evt, "working in detail")
+}
+
+var _ = Describe("SlogLogger", func() {
+	It("should map level, event and time to the record and keep the other key/values as attributes", func() {
+		handler := &recordHandler{}
+		ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(SlogLogger(handler).Log("ts", ts, "level", level.WarnValue(), evt, "something", "error", errors.New("broken"), "n", 3)).To(Succeed())
+		Expect(handler.records).To(HaveLen(1))
+		Expect(handler.records[0].level).To(Equal(slog.LevelWarn))
+		Expect(handler.records[0].message).To(Equal("something"))
+		Expect(handler.records[0].attrs).To(Equal(map[string]string{"error": "broken", "n": "3"}))
+	})
+})
+
+var _ = Describe("DebugFilter", func() {
+	It("should enable connections and case-insensitive methods", func() {
+		filter := &DebugFilter{}
+		Expect(filter.Enabled("c1", "Work")).To(BeFalse())
+		filter.SetConnection("c1", true)
+		filter.SetMethod("Work", true)
+		Expect(filter.Enabled("c1", "")).To(BeTrue())
+		Expect(filter.Enabled("c2", "work")).To(BeTrue())
+		Expect(filter.Enabled("c2", "other")).To(BeFalse())
+		Expect(filter.Status()).To(Equal(DebugStatus{Connections: []string{"c1"}, Methods: []string{"work"}}))
+		filter.SetConnection("c1", false)
+		filter.SetAll(true)
+		Expect(filter.Enabled("c2", "other")).To(BeTrue())
+		Expect(filter.Status()).To(Equal(DebugStatus{All: true, Connections: []string{}, Methods: []string{"work"}}))
+	})
+})
+
+var _ = Describe("Logging context", func() {
+	var handler *recordHandler
+	var filter *DebugFilter
+	var server Server
+	var client Client
+	var cancelClient context.CancelFunc
+
+	BeforeEach(func(done Done) {
+		handler = &recordHandler{}
+		filter = &DebugFilter{}
+		var err error
+		server, err = NewServer(context.TODO(), SimpleHubFactory(&loggingHub{}), LoggerWithDebugFilter(SlogLogger(handler), filter))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.DebugFilter()).To(BeIdenticalTo(filter))
+		cliConn, srvConn := newClientServerConnections()
+		go func() { _ = server.Serve(srvConn) }()
+		var ctx context.Context
+		ctx, cancelClient = context.WithCancel(context.Background())
+		client, err = NewClient(ctx, WithConnection(cliConn), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+		close(done)
+	}, 2.0)
+
+	AfterEach(func(done Done) {
+		cancelClient()
+		server.cancel()
+		close(done)
+	}, 2.0)
+
+	It("should add connection, transport, method and invocation to the events of the hub", func(done Done) {
+		Expect((<-client.Invoke("Work")).Error).NotTo(HaveOccurred())
+		record := handler.find("working", slog.LevelInfo)
+		Expect(record).NotTo(BeNil())
+		Expect(record.attrs).To(HaveKey(logConnection))
+		Expect(record.attrs[logConnection]).NotTo(BeEmpty())
+		Expect(record.attrs).To(HaveKey(logTransport))
+		Expect(record.attrs).To(HaveKeyWithValue(logMethod, "Work"))
+		Expect(record.attrs).To(HaveKeyWithValue(logInvocation, "1"))
+		Expect(handler.find("working in detail", slog.LevelDebug)).To(BeNil())
+		close(done)
+	}, 2.0)
+
+	It("should log debug events of enabled methods", func(done Done) {
+		filter.SetMethod("work", true)
+		Expect((<-client.Invoke("Work")).Error).NotTo(HaveOccurred())
+		record := handler.find("working in detail", slog.LevelDebug)
+		Expect(record).NotTo(BeNil())
+		Expect(record.attrs).To(HaveKeyWithValue(logMethod, "Work"))
+		close(done)
+	}, 2.0)
+
+	It("should log debug events of enabled connections", func(done Done) {
+		connections := server.Connections()
+		Expect(connections).To(HaveLen(1))
+		filter.SetConnection(connections[0].ConnectionID, true)
+		Expect((<-client.Invoke("Work")).Error).NotTo(HaveOccurred())
+		Expect(handler.find("working in detail", slog.LevelDebug)).NotTo(BeNil())
+		record := handler.find(msgRecv, slog.LevelDebug)
+		Expect(record).NotTo(BeNil())
+		Expect(record.attrs).To(HaveKeyWithValue(logConnection, connections[0].ConnectionID))
+		close(done)
+	}, 2.0)
+})
@@ -1,6 +1,7 @@
 package signalr
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"strings"
 	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type loop struct {
@@ -22,14 +25,21 @@ type loop struct {
 	streamer     *streamer
 	streamClient *streamClient
 	closeMessage *closeMessage
+	metrics      Metrics
+	transport    string
 }
 
 func newLoop(p Party, conn Connection, protocol hubProtocol) *loop {
 	protocol = reflect.New(reflect.ValueOf(protocol).Elem().Type()).Interface().(hubProtocol)
-	_, dbg := p.loggers()
-	protocol.setDebugLogger(dbg)
 	pInfo, pDbg := p.prefixLoggers(conn.ConnectionID())
-	hubConn := newHubConnection(conn, protocol, p.maximumReceiveMessageSize(), pInfo)
+	pInfo, pDbg = withLogContext(pInfo, pDbg, logTransport, transportName(conn))
+	protocol.setDebugLogger(pDbg)
+	protocol.setLimits(partyMessageLimits(p))
+	var tap Tap
+	if s, ok := p.(*server); ok {
+		tap = s.tap
+	}
+	hubConn := newHubConnection(conn, protocol, p.maximumReceiveMessageSize(), p.metrics(), tap, pInfo)
 	return &loop{
 		party:        p,
 		protocol:     protocol,
@@ -39,13 +49,25 @@ func newLoop(p Party, conn Connection, protocol hubProtocol) *loop {
 		streamClient: newStreamClient(protocol, p.chanReceiveTimeout(), p.streamBufferCapacity()),
 		info:         pInfo,
 		dbg:          pDbg,
+		metrics:      p.metrics(),
+		transport:    transportName(conn),
 	}
 }
 
 // Run runs the loop. After the startup sequence is done, this is signaled over the started channel.
 // Callers should pass a channel with buffer size 1 to allow the loop to run without waiting for the caller.
+// The goroutines of the loop carry the pprof labels of the connection.
 func (l *loop) Run(connected chan struct{}) (err error) {
+	withLabels(l.connectionLabels(), func() { err = l.run(connected) })
+	return err
+}
+
+func (l *loop) run(connected chan struct{}) (err error) {
 	l.party.onConnected(l.hubConn)
+	l.metrics.ConnectionOpened(l.transport, protocolName(l.protocol))
+	// reason is the Disconnect reason reported to the Metrics
+	reason := DisconnectError
+	pingFailed := false
 	connected <- struct{}{}
 	close(connected)
 	// Process messages
@@ -92,6 +114,7 @@ msgLoop:
 					case closeMessage:
 						_ = l.dbg.Log(evt, msgRecv, msg, fmtMsg(message))
 						l.closeMessage = &message
+						reason = DisconnectClosed
 						if message.Error != "" {
 							err = errors.New(message.Error)
 						}
@@ -100,24 +123,36 @@ msgLoop:
 						err = l.handleOtherMessage(message)
 						// No default case necessary, because the protocol would return either a hubMessage or an error
 					}
+					if err != nil && l.closeMessage == nil {
+						reason = DisconnectProtocol
+					}
 				} else {
 					_ = l.info.Log(evt, msgRecv, "error", err, msg, fmtMsg(evt.message), react, "close connection")
+					if isProtocolError(err) {
+						reason = DisconnectProtocol
+					}
 				}
 				break pingLoop
 			case <-time.After(l.party.keepAliveInterval()):
 				// Send ping only when there was no write in the keepAliveInterval before
 				if time.Since(l.hubConn.LastWriteStamp()) > l.party.keepAliveInterval() {
-					_ = l.hubConn.Ping()
+					// A failed ping aborts the hubConnection
+					pingFailed = l.hubConn.Ping() != nil
 				}
 				// Don't break the pingLoop when keepAlive is over, it exists for this case
 			case <-timeoutTicker.C:
 				err = fmt.Errorf("timeout interval elapsed (%v)", l.party.timeout())
+				reason = DisconnectTimeout
 				break pingLoop
 			case <-l.hubConn.Context().Done():
 				err = fmt.Errorf("breaking loop. hubConnection canceled: %w", l.hubConn.Context().Err())
+				if pingFailed {
+					reason = DisconnectPing
+				}
 				break pingLoop
 			case <-l.party.context().Done():
 				err = fmt.Errorf("breaking loop. Party canceled: %w", l.party.context().Err())
+				reason = DisconnectServer
 				break pingLoop
 			}
 		}
@@ -126,7 +161,9 @@ msgLoop:
 		}
 	}
 	l.party.onDisconnected(l.hubConn)
-	if err != nil {
+	l.metrics.ConnectionClosed(l.transport, protocolName(l.protocol), reason)
+	// The other party which sent a close message does not read anymore, so only close if it didn't
+	if err != nil && l.closeMessage == nil {
 		_ = l.hubConn.Close(fmt.Sprintf("%v", err), l.party.allowReconnect())
 	}
 	_ = l.dbg.Log(evt, "message loop ended")
@@ -182,51 +219,131 @@ func (l *loop) GetNewID() string {
 	return fmt.Sprint(atomic.LoadUint64(&l.lastID))
 }
 
+// invocationLoggers returns the loggers of the loop with the method and id of the invocation
+func (l *loop) invocationLoggers(invocation invocationMessage) (info StructuredLogger, dbg StructuredLogger) {
+	return withLogContext(l.info, l.dbg, logMethod, invocation.Target, logInvocation, invocation.InvocationID)
+}
+
 func (l *loop) handleInvocationMessage(invocation invocationMessage) {
-	_ = l.dbg.Log(evt, msgRecv, msg, fmtMsg(invocation))
+	info, dbg := l.invocationLoggers(invocation)
+	_ = dbg.Log(evt, msgRecv, msg, fmtMsg(invocation))
 
 	if invocation.InvocationID == "" {
 		// No invocation id, no invocation
 		id := l.GetNewID()
-		fmt.Println("Message get new ID: ", id)
+		_ = dbg.Log(evt, "new invocation for message without invocation id", "id", id)
 		_, _ = l.invokeClient.newInvocation(id)
 	}
 
+	// The hub gets the context of the invocation span, so its sends to clients continue the trace
+	ctx, span := l.party.tracer().Start(extractHeaders(l.hubConn.Context(), invocation.Headers), "invoke "+invocation.Target,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrRPCSystem.String("signalr"),
+			attrRPCMethod.String(invocation.Target),
+			attrInvocationID.String(invocation.InvocationID),
+			attrConnectionID.String(l.hubConn.ConnectionID())))
 	// Transient hub, dispatch invocation here
-	if method, ok := getMethod(l.party.invocationTarget(l.hubConn), invocation.Target); !ok {
+	target := &invocationHubConnection{
+		hubConnection: l.hubConn,
+		ctx:           ctx,
+		headers:       invocation.Headers,
+		method:        invocation.Target,
+		invocationID:  invocation.InvocationID,
+	}
+	method, ok := getMethod(l.party.invocationTarget(target), invocation.Target)
+	if !ok {
 		// Unable to find the method.
 		// For fire-and-forget invocations (InvocationID == ""), do NOT send a completion error back.
 		// The server has no matching InvocationID and would close the connection on an unexpected completion.
-		_ = l.info.Log(evt, "getMethod", "error", "missing method", "name", invocation.Target, react, "ignored (fire-and-forget)")
+		_ = info.Log(evt, "getMethod", "error", "missing method", "name", invocation.Target, react, "ignored (fire-and-forget)")
 		if invocation.InvocationID != "" {
 			_ = l.hubConn.Completion(invocation.InvocationID, nil, fmt.Sprintf("Unknown method %s", invocation.Target))
 		}
-	} else if in, err := buildMethodArguments(method, invocation, l.streamClient, l.protocol); err != nil {
+		l.invocationDone(invocation, false, time.Time{}, span, fmt.Errorf("unknown method %s", invocation.Target))
+		return
+	}
+	// Stream invocation is only allowed when the method has only one return value, besides an optional error
+	// We allow no channel return values, because a client can receive as stream with only one item
+	if invocation.Type == 4 && resultCount(method.Type()) != 1 {
+		err := fmt.Errorf("Stream invocation of method %s which has not return value kind channel", invocation.Target)
+		_ = l.hubConn.Completion(invocation.InvocationID, nil, err.Error())
+		l.invocationDone(invocation, true, time.Time{}, span, err)
+		return
+	}
+	if invocation.Type == 4 {
+		// The hub stops producing stream items when this context is done
+		target.ctx = l.streamer.invocationContext(ctx, invocation.InvocationID)
+	}
+	in, err := buildMethodArguments(ContextWithHeaders(target.ctx, invocation.Headers), method, invocation, l.streamClient, l.protocol)
+	if err != nil {
 		// argument build failed
-		_ = l.info.Log(evt, "buildMethodArguments", "error", err, "name", invocation.Target, react, "send completion with error")
+		_ = info.Log(evt, "buildMethodArguments", "error", err, "name", invocation.Target, react, "send completion with error")
 		_ = l.hubConn.Completion(invocation.InvocationID, nil, err.Error())
-	} else {
-		// Stream invocation is only allowed when the method has only one return value
-		// We allow no channel return values, because a client can receive as stream with only one item
-		if invocation.Type == 4 && method.Type().NumOut() != 1 {
-			_ = l.hubConn.Completion(invocation.InvocationID, nil,
-				fmt.Sprintf("Stream invocation of method %s which has not return value kind channel", invocation.Target))
-		} else {
-			// hub method might take a long time
-			go func() {
-				result := func() []reflect.Value {
-					defer l.recoverInvocationPanic(invocation)
-					return method.Call(in)
-				}()
-				l.returnInvocationResult(invocation, result)
-			}()
+		l.invocationDone(invocation, true, time.Time{}, span, err)
+		l.streamer.end(invocation.InvocationID)
+		return
+	}
+	// hub method might take a long time
+	go withLabels(l.invocationLabels(invocation), func() {
+		returned := false
+		start := time.Now()
+		result := func() []reflect.Value {
+			defer l.recoverInvocationPanic(invocation, start, span)
+			result := method.Call(in)
+			returned = true
+			return result
+		}()
+		// If the method panicked, recoverInvocationPanic has already reported the invocation as done
+		if returned {
+			_, err := splitErrorResult(result)
+			l.invocationDone(invocation, true, start, span, err)
 		}
+		l.returnInvocationResult(invocation, result)
+	})
+}
+
+// invocationDone reports the outcome of an invocation to the audit sink and the metrics and ends its span.
+// found is false if the hub has no method for the invocation, start is zero if the method has not been called.
+func (l *loop) invocationDone(invocation invocationMessage, found bool, start time.Time, span trace.Span, err error) {
+	l.auditInvocation(invocation, err)
+	method := ""
+	if found {
+		method = strings.ToLower(invocation.Target)
+	}
+	var duration time.Duration
+	if !start.IsZero() {
+		duration = time.Since(start)
+	}
+	l.metrics.InvocationDone(method, duration, err)
+	endSpan(span, err)
+}
+
+// auditInvocation sends the AuditEvent for an invocation received from the other party
+func (l *loop) auditInvocation(invocation invocationMessage, err error) {
+	if l.party.auditSink() == nil {
+		return
 	}
+	event := newAuditEvent(AuditInvocation, l.hubConn)
+	event.Method = invocation.Target
+	event.InvocationID = invocation.InvocationID
+	event.ArgumentDigest = argumentDigest(invocation.Arguments)
+	audit(l.party, event, err)
 }
 
 func (l *loop) returnInvocationResult(invocation invocationMessage, result []reflect.Value) {
+	// The context of a stream invocation ends with its stream, or here if the method returned no channel
+	if invocation.Type == 4 && !(len(result) > 0 && result[0].Kind() == reflect.Chan) {
+		defer l.streamer.end(invocation.InvocationID)
+	}
 	// No invocation id, no completion
 	if invocation.InvocationID != "" {
+		// A non nil error as last return value is sent as completion with error, a nil error is not part of the result
+		result, err := splitErrorResult(result)
+		if err != nil {
+			_ = l.hubConn.Completion(invocation.InvocationID, nil, err.Error())
+			l.streamer.end(invocation.InvocationID)
+			return
+		}
 		// if the hub method returns a chan, it should be considered asynchronous or source for a stream
 		if len(result) == 1 && result[0].Kind() == reflect.Chan {
 			switch invocation.Type {
@@ -278,7 +395,6 @@ func (l *loop) handleCompletionMessage(message completionMessage) error {
 	_ = l.dbg.Log(evt, msgRecv, msg, fmtMsg(message))
 	var err error
 	if l.streamClient.handlesInvocationID(message.InvocationID) {
-		message.InvocationID = message.InvocationID
 		err = l.streamClient.receiveCompletionItem(message, l.invokeClient)
 	} else if l.invokeClient.handlesInvocationID(message.InvocationID) {
 		err = l.invokeClient.receiveCompletionItem(message)
@@ -317,6 +433,31 @@ func (l *loop) sendResult(invocation invocationMessage, connFunc connFunc, resul
 	}
 }
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// resultCount is the number of return values of a hub method without a trailing error
+func resultCount(methodType reflect.Type) int {
+	n := methodType.NumOut()
+	if n > 0 && methodType.Out(n-1) == errorType {
+		n--
+	}
+	return n
+}
+
+// splitErrorResult removes a trailing error return value from the result of a hub method
+func splitErrorResult(result []reflect.Value) ([]reflect.Value, error) {
+	if len(result) == 0 || result[len(result)-1].Type() != errorType {
+		return result, nil
+	}
+	last := result[len(result)-1]
+	if !last.IsNil() {
+		return nil, last.Interface().(error)
+	}
+	return result[:len(result)-1], nil
+}
+
 type connFunc func(sl *loop, invocation invocationMessage, value interface{})
 
 func completion(sl *loop, invocation invocationMessage, value interface{}) {
@@ -328,11 +469,13 @@ func streamItem(sl *loop, invocation invocationMessage, value interface{}) {
 	_ = sl.hubConn.StreamItem(invocation.InvocationID, value)
 }
 
-func (l *loop) recoverInvocationPanic(invocation invocationMessage) {
+func (l *loop) recoverInvocationPanic(invocation invocationMessage, start time.Time, span trace.Span) {
 	if err := recover(); err != nil {
-		_ = l.info.Log(evt, "panic in target method", "error", err, "name", invocation.Target, react, "send completion with error")
+		info, dbg := l.invocationLoggers(invocation)
+		_ = info.Log(evt, "panic in target method", "error", err, "name", invocation.Target, react, "send completion with error")
+		l.invocationDone(invocation, true, start, span, fmt.Errorf("panic: %v", err))
 		stack := string(debug.Stack())
-		_ = l.dbg.Log(evt, "panic in target method", "error", err, "name", invocation.Target, react, "send completion with error", "stack", stack)
+		_ = dbg.Log(evt, "panic in target method", "error", err, "name", invocation.Target, react, "send completion with error", "stack", stack)
 		if invocation.InvocationID != "" {
 			if !l.party.enableDetailedErrors() {
 				stack = ""
@@ -342,14 +485,21 @@ func (l *loop) recoverInvocationPanic(invocation invocationMessage) {
 	}
 }
 
-func buildMethodArguments(method reflect.Value, invocation invocationMessage,
+// buildMethodArguments builds the arguments of the method from the invocation. A context.Context as first
+// parameter of the method gets ctx, which carries the headers of the invocation.
+func buildMethodArguments(ctx context.Context, method reflect.Value, invocation invocationMessage,
 	streamClient *streamClient, protocol hubProtocol) (arguments []reflect.Value, err error) {
-	if len(invocation.StreamIds)+len(invocation.Arguments) != method.Type().NumIn() {
+	arguments = make([]reflect.Value, method.Type().NumIn())
+	ctxCount := 0
+	if len(arguments) > 0 && method.Type().In(0) == contextType {
+		arguments[0] = reflect.ValueOf(ctx)
+		ctxCount = 1
+	}
+	if len(invocation.StreamIds)+len(invocation.Arguments) != method.Type().NumIn()-ctxCount {
 		return nil, fmt.Errorf("parameter mismatch calling method %v", invocation.Target)
 	}
-	arguments = make([]reflect.Value, method.Type().NumIn())
 	chanCount := 0
-	for i := 0; i < method.Type().NumIn(); i++ {
+	for i := ctxCount; i < method.Type().NumIn(); i++ {
 		t := method.Type().In(i)
 		// Is it a channel for client streaming?
 		if arg, clientStreaming, err := streamClient.buildChannelArgument(invocation, t, chanCount); err != nil {
@@ -362,7 +512,7 @@ func buildMethodArguments(method reflect.Value, invocation invocationMessage,
 		} else {
 			// it is not, so do the normal thing
 			arg := reflect.New(t)
-			if err := protocol.UnmarshalArgument(invocation.Arguments[i-chanCount], arg.Interface()); err != nil {
+			if err := protocol.UnmarshalArgument(invocation.Arguments[i-ctxCount-chanCount], arg.Interface()); err != nil {
 				return arguments, err
 			}
 			arguments[i] = arg.Elem()
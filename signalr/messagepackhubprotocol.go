@@ -6,13 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 
 	"github.com/go-kit/log"
 	"github.com/vmihailenco/msgpack/v5"
 )
 
 type messagePackHubProtocol struct {
-	dbg log.Logger
+	dbg    log.Logger
+	limits messageLimits
 }
 
 func (m *messagePackHubProtocol) ParseMessages(reader io.Reader, remainBuf *bytes.Buffer) ([]interface{}, error) {
@@ -22,6 +24,9 @@ func (m *messagePackHubProtocol) ParseMessages(reader io.Reader, remainBuf *byte
 	}
 	messages := make([]interface{}, 0)
 	for _, frame := range frames {
+		if err = m.limits.checkMessagePackDepth(frame); err != nil {
+			return nil, err
+		}
 		message, err := m.parseMessage(bytes.NewBuffer(frame))
 		if err != nil {
 			return nil, err
@@ -56,6 +61,10 @@ func (m *messagePackHubProtocol) readFrames(reader io.Reader, remainBuf *bytes.B
 		if lenLen < 0 {
 			return nil, fmt.Errorf("messagepack frame length to large")
 		}
+		// Check before the frame buffer is allocated
+		if err = m.limits.checkFrameSize(int(min(frameLen, math.MaxInt32))); err != nil {
+			return nil, err
+		}
 		// Still wondering why this happens, but it happens!
 		if frameLen == 0 {
 			// Store the overread bytes for the next iteration
@@ -109,10 +118,11 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 	if err != nil {
 		return nil, err
 	}
-	// Ignore Header for all messages, except ping message that has no header
+	// All messages, except ping message, have headers
 	// see message spec at https://github.com/dotnet/aspnetcore/blob/main/src/SignalR/docs/specs/HubProtocol.md#message-headers
+	var headers map[string]string
 	if msgType != 6 {
-		_, err = decoder.DecodeMap()
+		headers, err = decodeHeaders(decoder)
 		if err != nil {
 			return nil, err
 		}
@@ -128,6 +138,7 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 		}
 		invocationMessage := invocationMessage{
 			Type:         msgType,
+			Headers:      headers,
 			InvocationID: invocationID,
 		}
 		invocationMessage.Target, err = decoder.DecodeString()
@@ -138,6 +149,9 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 		if err != nil {
 			return nil, err
 		}
+		if err = m.limits.checkArguments(argLen); err != nil {
+			return nil, err
+		}
 		for i := 0; i < argLen; i++ {
 			argument, err := decoder.DecodeRaw()
 			if err != nil {
@@ -151,6 +165,9 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 			if err != nil {
 				return nil, err
 			}
+			if err = m.limits.checkArguments(argLen + streamIDLen); err != nil {
+				return nil, err
+			}
 			for i := 0; i < streamIDLen; i++ {
 				streamID, err := decoder.DecodeString()
 				if err != nil {
@@ -164,7 +181,7 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 		if msgLen != 4 {
 			return nil, fmt.Errorf("invalid streamItemMessage length %v", msgLen)
 		}
-		streamItemMessage := streamItemMessage{Type: 2}
+		streamItemMessage := streamItemMessage{Type: 2, Headers: headers}
 		streamItemMessage.InvocationID, err = decoder.DecodeString()
 		if err != nil {
 			return nil, err
@@ -178,7 +195,7 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 		if msgLen < 4 {
 			return nil, fmt.Errorf("invalid completionMessage length %v", msgLen)
 		}
-		completionMessage := completionMessage{Type: 3}
+		completionMessage := completionMessage{Type: 3, Headers: headers}
 		completionMessage.InvocationID, err = decoder.DecodeString()
 		if err != nil {
 			return nil, err
@@ -241,7 +258,8 @@ func (m *messagePackHubProtocol) parseMessage(buf *bytes.Buffer) (interface{}, e
 		}
 		return closeMessage, nil
 	}
-	return msg, nil
+	// Unknown message type, like the JSON protocol. The loop decides what to do with it
+	return hubMessage{Type: msgType}, nil
 }
 
 func (m *messagePackHubProtocol) decodeInvocationID(decoder *msgpack.Decoder) (string, error) {
@@ -269,7 +287,7 @@ func (m *messagePackHubProtocol) WriteMessage(message interface{}, writer io.Wri
 	encoder.SetCustomStructTag("json")
 	switch msg := message.(type) {
 	case invocationMessage:
-		if err := encodeMsgHeader(encoder, 6, msg.Type); err != nil {
+		if err := encodeMsgHeader(encoder, 6, msg.Type, msg.Headers); err != nil {
 			return err
 		}
 		if msg.InvocationID == "" {
@@ -301,7 +319,7 @@ func (m *messagePackHubProtocol) WriteMessage(message interface{}, writer io.Wri
 			}
 		}
 	case streamItemMessage:
-		if err := encodeMsgHeader(encoder, 4, msg.Type); err != nil {
+		if err := encodeMsgHeader(encoder, 4, msg.Type, msg.Headers); err != nil {
 			return err
 		}
 		if err := encoder.EncodeString(msg.InvocationID); err != nil {
@@ -315,7 +333,7 @@ func (m *messagePackHubProtocol) WriteMessage(message interface{}, writer io.Wri
 		if msg.Result != nil || msg.Error != "" {
 			msgLen = 5
 		}
-		if err := encodeMsgHeader(encoder, msgLen, msg.Type); err != nil {
+		if err := encodeMsgHeader(encoder, msgLen, msg.Type, msg.Headers); err != nil {
 			return err
 		}
 		if err := encoder.EncodeString(msg.InvocationID); err != nil {
@@ -341,7 +359,7 @@ func (m *messagePackHubProtocol) WriteMessage(message interface{}, writer io.Wri
 			}
 		}
 	case cancelInvocationMessage:
-		if err := encodeMsgHeader(encoder, 3, msg.Type); err != nil {
+		if err := encodeMsgHeader(encoder, 3, msg.Type, nil); err != nil {
 			return err
 		}
 		if err := encoder.EncodeString(msg.InvocationID); err != nil {
@@ -355,7 +373,7 @@ func (m *messagePackHubProtocol) WriteMessage(message interface{}, writer io.Wri
 			return err
 		}
 	case closeMessage:
-		if err := encodeMsgHeader(encoder, 3, msg.Type); err != nil {
+		if err := encodeMsgHeader(encoder, 3, msg.Type, nil); err != nil {
 			return err
 		}
 		if err := encoder.EncodeString(msg.Error); err != nil {
@@ -378,24 +396,59 @@ func (m *messagePackHubProtocol) WriteMessage(message interface{}, writer io.Wri
 	return err
 }
 
-func encodeMsgHeader(e *msgpack.Encoder, msgLen int, msgType int) (err error) {
+func encodeMsgHeader(e *msgpack.Encoder, msgLen int, msgType int, headers map[string]string) (err error) {
 	if err = e.EncodeArrayLen(msgLen); err != nil {
 		return err
 	}
 	if err = e.EncodeInt(int64(msgType)); err != nil {
 		return err
 	}
-	headers := make(map[string]interface{})
-	if err = e.EncodeMap(headers); err != nil {
+	if err = e.EncodeMapLen(len(headers)); err != nil {
 		return err
 	}
+	for key, value := range headers {
+		if err = e.EncodeString(key); err != nil {
+			return err
+		}
+		if err = e.EncodeString(value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// decodeHeaders decodes the headers map. Keys and values must be strings
+func decodeHeaders(decoder *msgpack.Decoder) (map[string]string, error) {
+	headerLen, err := decoder.DecodeMapLen()
+	if err != nil {
+		return nil, err
+	}
+	if headerLen <= 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, headerLen)
+	for i := 0; i < headerLen; i++ {
+		key, err := decoder.DecodeString()
+		if err != nil {
+			return nil, fmt.Errorf("invalid header key: %w", err)
+		}
+		value, err := decoder.DecodeString()
+		if err != nil {
+			return nil, fmt.Errorf("invalid header value: %w", err)
+		}
+		headers[key] = value
+	}
+	return headers, nil
+}
+
 func (m *messagePackHubProtocol) transferMode() TransferMode {
 	return BinaryTransferMode
 }
 
+func (m *messagePackHubProtocol) setLimits(limits messageLimits) {
+	m.limits = limits
+}
+
 func (m *messagePackHubProtocol) setDebugLogger(dbg StructuredLogger) {
 	m.dbg = log.WithPrefix(dbg, "ts", log.DefaultTimestampUTC, "protocol", "MSGP")
 }
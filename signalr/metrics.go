@@ -0,0 +1,184 @@
+package signalr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Metrics receives the measurements of the hub and transport activity of a server.
+// The methods are called synchronously from the goroutines serving the connections,
+// so implementations must be safe for concurrent use and should not block.
+//
+// transport is one of the TransportType values or "net" for connections not served over http,
+// protocol is "json" or "messagepack".
+type Metrics interface {
+	ConnectionOpened(transport string, protocol string)
+	// ConnectionClosed reason is one of the Disconnect constants
+	ConnectionClosed(transport string, protocol string, reason string)
+	// HandshakeFailed reason is one of the HandshakeFailure constants
+	HandshakeFailed(transport string, reason string)
+	// InvocationDone is called when a hub method invoked by a client has returned.
+	// method is the lower case name of the hub method or empty if the hub has no such method.
+	InvocationDone(method string, duration time.Duration, err error)
+	BytesReceived(transport string, n int)
+	BytesSent(transport string, n int)
+	// Broadcast is called when the hub sends to more than the caller. kind is "all", "group" or "client"
+	Broadcast(kind string, recipients int)
+	// GroupsChanged is called after a group join or leave with the number of non-empty groups and their members
+	GroupsChanged(groups int, members int)
+}
+
+// Reasons for Metrics.ConnectionClosed
+const (
+	DisconnectClosed   = "closed"   // the client sent a close message
+	DisconnectTimeout  = "timeout"  // nothing received in the TimeoutInterval
+	DisconnectPing     = "ping"     // the keep alive ping could not be sent
+	DisconnectServer   = "server"   // the server has been canceled
+	DisconnectProtocol = "protocol" // the client sent an invalid or too large message
+	DisconnectError    = "error"    // the connection failed
+)
+
+// Reasons for Metrics.HandshakeFailed
+const (
+	HandshakeFailureTimeout    = "timeout"    // no handshake request in the HandshakeTimeout
+	HandshakeFailureProtocol   = "protocol"   // the requested protocol is not supported
+	HandshakeFailureLimit      = "limit"      // the handshake request is too large
+	HandshakeFailureUpgrade    = "upgrade"    // the websocket upgrade failed
+	HandshakeFailureConnection = "connection" // the connection id is unknown or already in use
+	HandshakeFailureError      = "error"      // the handshake request is malformed or the connection failed
+)
+
+// WithMetrics sets the Metrics which receive the measurements of the servers' connections, invocations and broadcasts.
+// If the option is given more than once, all Metrics receive the measurements.
+func WithMetrics(metrics Metrics) func(Party) error {
+	return func(p Party) error {
+		if metrics == nil {
+			return errors.New("option WithMetrics needs Metrics")
+		}
+		if _, ok := p.(*server); ok {
+			switch current := p.metrics().(type) {
+			case noMetrics:
+				p.setMetrics(metrics)
+			case multiMetrics:
+				p.setMetrics(append(current, metrics))
+			default:
+				p.setMetrics(multiMetrics{current, metrics})
+			}
+			return nil
+		}
+		return errors.New("option WithMetrics is server only")
+	}
+}
+
+// multiMetrics passes the measurements to all its Metrics
+type multiMetrics []Metrics
+
+func (m multiMetrics) ConnectionOpened(transport string, protocol string) {
+	for _, metrics := range m {
+		metrics.ConnectionOpened(transport, protocol)
+	}
+}
+
+func (m multiMetrics) ConnectionClosed(transport string, protocol string, reason string) {
+	for _, metrics := range m {
+		metrics.ConnectionClosed(transport, protocol, reason)
+	}
+}
+
+func (m multiMetrics) HandshakeFailed(transport string, reason string) {
+	for _, metrics := range m {
+		metrics.HandshakeFailed(transport, reason)
+	}
+}
+
+func (m multiMetrics) InvocationDone(method string, duration time.Duration, err error) {
+	for _, metrics := range m {
+		metrics.InvocationDone(method, duration, err)
+	}
+}
+
+func (m multiMetrics) BytesReceived(transport string, n int) {
+	for _, metrics := range m {
+		metrics.BytesReceived(transport, n)
+	}
+}
+
+func (m multiMetrics) BytesSent(transport string, n int) {
+	for _, metrics := range m {
+		metrics.BytesSent(transport, n)
+	}
+}
+
+func (m multiMetrics) Broadcast(kind string, recipients int) {
+	for _, metrics := range m {
+		metrics.Broadcast(kind, recipients)
+	}
+}
+
+func (m multiMetrics) GroupsChanged(groups int, members int) {
+	for _, metrics := range m {
+		metrics.GroupsChanged(groups, members)
+	}
+}
+
+// noMetrics is used when no Metrics are set
+type noMetrics struct{}
+
+func (noMetrics) ConnectionOpened(string, string)             {}
+func (noMetrics) ConnectionClosed(string, string, string)     {}
+func (noMetrics) HandshakeFailed(string, string)              {}
+func (noMetrics) InvocationDone(string, time.Duration, error) {}
+func (noMetrics) BytesReceived(string, int)                   {}
+func (noMetrics) BytesSent(string, int)                       {}
+func (noMetrics) Broadcast(string, int)                       {}
+func (noMetrics) GroupsChanged(int, int)                      {}
+
+// transportName returns the transport label of a connection
+func transportName(conn Connection) string {
+	switch conn.(type) {
+	case *webSocketConnection:
+		return string(TransportWebSockets)
+	case *serverSSEConnection, *clientSSEConnection:
+		return string(TransportServerSentEvents)
+	case *netConnection:
+		return "net"
+	default:
+		return fmt.Sprintf("%T", conn)
+	}
+}
+
+// protocolName returns the name of the protocol, as requested in the handshake
+func protocolName(protocol hubProtocol) string {
+	for name, p := range protocolMap {
+		if reflect.TypeOf(p) == reflect.TypeOf(protocol) {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", protocol)
+}
+
+// handshakeFailure maps an error of processHandshake to one of the Handshake reasons
+func handshakeFailure(err error) string {
+	var limitErr *MessageLimitError
+	var protocolErr *unsupportedProtocolError
+	switch {
+	case errors.As(err, &limitErr):
+		return HandshakeFailureLimit
+	case errors.As(err, &protocolErr):
+		return HandshakeFailureProtocol
+	case errors.Is(err, context.DeadlineExceeded):
+		return HandshakeFailureTimeout
+	default:
+		return HandshakeFailureError
+	}
+}
+
+// isProtocolError reports if a receive error is caused by the message, not by the connection
+func isProtocolError(err error) bool {
+	var limitErr *MessageLimitError
+	var jsonErr *jsonError
+	return errors.As(err, &limitErr) || errors.As(err, &jsonErr)
+}
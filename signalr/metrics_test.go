@@ -0,0 +1,176 @@
+package signalr
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// chanMetrics sends all measurements except the byte counts as text to the channel
+type chanMetrics struct {
+	events   chan string
+	received int64
+	sent     int64
+}
+
+func (c *chanMetrics) ConnectionOpened(transport string, protocol string) {
+	c.events <- fmt.Sprintf("opened %s %s", transport, protocol)
+}
+
+func (c *chanMetrics) ConnectionClosed(transport string, protocol string, reason string) {
+	c.events <- fmt.Sprintf("closed %s %s %s", transport, protocol, reason)
+}
+
+func (c *chanMetrics) HandshakeFailed(transport string, reason string) {
+	c.events <- fmt.Sprintf("handshake %s %s", transport, reason)
+}
+
+func (c *chanMetrics) InvocationDone(method string, _ time.Duration, err error) {
+	c.events <- fmt.Sprintf("invocation %s %v", method, err != nil)
+}
+
+func (c *chanMetrics) BytesReceived(_ string, n int) {
+	atomic.AddInt64(&c.received, int64(n))
+}
+
+func (c *chanMetrics) BytesSent(_ string, n int) {
+	atomic.AddInt64(&c.sent, int64(n))
+}
+
+func (c *chanMetrics) Broadcast(kind string, recipients int) {
+	c.events <- fmt.Sprintf("broadcast %s %d", kind, recipients)
+}
+
+func (c *chanMetrics) GroupsChanged(groups int, members int) {
+	c.events <- fmt.Sprintf("groups %d %d", groups, members)
+}
+
+type metricsHub struct {
+	Hub
+}
+
+func (m *metricsHub) Join(group string) {
+	m.Groups().AddToGroup(group, m.ConnectionID())
+}
+
+func (m *metricsHub) Leave(group string) {
+	m.Groups().RemoveFromGroup(group, m.ConnectionID())
+}
+
+func (m *metricsHub) SendGroup(group string) {
+	m.Clients().Group(group).Send("receive", group)
+}
+
+func (m *metricsHub) Add2(i int) int {
+	return i + 2
+}
+
+var _ = Describe("Metrics", func() {
+	var server Server
+	var conn *testingConnection
+	var metrics *chanMetrics
+	const transport = "*signalr.testingConnection"
+
+	BeforeEach(func(done Done) {
+		metrics = &chanMetrics{events: make(chan string, 20)}
+		var err error
+		server, err = NewServer(context.TODO(), SimpleHubFactory(&metricsHub{}), WithMetrics(metrics),
+			TimeoutInterval(500*time.Millisecond), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		conn = newTestingConnectionForServer()
+		go func() { _ = server.Serve(conn) }()
+		Expect(<-metrics.events).To(Equal("opened " + transport + " json"))
+		close(done)
+	}, 2.0)
+
+	AfterEach(func(done Done) {
+		server.cancel()
+		close(done)
+	})
+
+	It("should measure invocations and bytes", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"1","target":"Add2","arguments":[1]}`)
+		Expect(<-metrics.events).To(Equal("invocation add2 false"))
+		conn.ClientSend(`{"type":1,"invocationId":"2","target":"add2","arguments":["x"]}`)
+		Expect(<-metrics.events).To(Equal("invocation add2 true"))
+		conn.ClientSend(`{"type":1,"invocationId":"3","target":"unknown","arguments":[]}`)
+		Expect(<-metrics.events).To(Equal("invocation  true"))
+		Eventually(func() int64 { return atomic.LoadInt64(&metrics.received) }).Should(BeNumerically(">", 100))
+		Eventually(func() int64 { return atomic.LoadInt64(&metrics.sent) }).Should(BeNumerically(">", 10))
+		close(done)
+	}, 2.0)
+
+	It("should measure groups and broadcasts", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"1","target":"join","arguments":["g"]}`)
+		Expect(<-metrics.events).To(Equal("groups 1 1"))
+		Expect(<-metrics.events).To(Equal("invocation join false"))
+		conn.ClientSend(`{"type":1,"invocationId":"2","target":"sendgroup","arguments":["g"]}`)
+		Expect(<-metrics.events).To(Equal("broadcast group 1"))
+		conn.ClientSend(`{"type":1,"invocationId":"3","target":"sendgroup","arguments":["other"]}`)
+		Eventually(metrics.events).Should(Receive(Equal("broadcast group 0")))
+		conn.ClientSend(`{"type":1,"invocationId":"4","target":"join","arguments":["g"]}`)
+		Eventually(metrics.events).Should(Receive(Equal("groups 1 1")))
+		conn.ClientSend(`{"type":1,"invocationId":"5","target":"join","arguments":["h"]}`)
+		Eventually(metrics.events).Should(Receive(Equal("groups 2 2")))
+		conn.ClientSend(`{"type":1,"invocationId":"6","target":"leave","arguments":["g"]}`)
+		Eventually(metrics.events).Should(Receive(Equal("groups 1 1")))
+		conn.ClientSend(`{"type":1,"invocationId":"7","target":"leave","arguments":["g"]}`)
+		Eventually(metrics.events).Should(Receive(Equal("groups 1 1")))
+		close(done)
+	}, 2.0)
+
+	It("should report the disconnect reason", func(done Done) {
+		conn.ClientSend(`{"type":7}`)
+		Expect(<-metrics.events).To(Equal("closed " + transport + " json closed"))
+		close(done)
+	}, 2.0)
+
+	It("should report timeouts", func(done Done) {
+		Expect(<-metrics.events).To(Equal("closed " + transport + " json timeout"))
+		close(done)
+	}, 2.0)
+
+	It("should report invalid messages", func(done Done) {
+		conn.ClientSend(`{"type":1,"invocationId":"1","target":"add2","arguments":[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[1]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]}`)
+		Expect(<-metrics.events).To(Equal("closed " + transport + " json protocol"))
+		close(done)
+	}, 2.0)
+})
+
+var _ = Describe("Metrics on handshake", func() {
+	It("should report unsupported protocols", func(done Done) {
+		metrics := &chanMetrics{events: make(chan string, 20)}
+		server, err := NewServer(context.TODO(), SimpleHubFactory(&metricsHub{}), WithMetrics(metrics), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		defer server.cancel()
+		conn := newTestingConnection()
+		conn.ClientSend(`{"protocol":"xml","version":1}`)
+		go func() { _ = server.Serve(conn) }()
+		Expect(<-metrics.events).To(Equal("handshake *signalr.testingConnection protocol"))
+		close(done)
+	}, 2.0)
+
+	It("should pass the measurements to all Metrics", func(done Done) {
+		first := &chanMetrics{events: make(chan string, 20)}
+		second := &chanMetrics{events: make(chan string, 20)}
+		server, err := NewServer(context.TODO(), SimpleHubFactory(&metricsHub{}),
+			WithMetrics(first), WithMetrics(second), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		defer server.cancel()
+		conn := newTestingConnection()
+		conn.ClientSend(`{"protocol":"xml","version":1}`)
+		go func() { _ = server.Serve(conn) }()
+		Expect(<-first.events).To(Equal("handshake *signalr.testingConnection protocol"))
+		Expect(<-second.events).To(Equal("handshake *signalr.testingConnection protocol"))
+		close(done)
+	}, 2.0)
+
+	It("should only be allowed on servers", func() {
+		_, err := NewClient(context.TODO(), WithConnection(newTestingConnection()), WithMetrics(&chanMetrics{}))
+		Expect(err).To(HaveOccurred())
+	})
+})
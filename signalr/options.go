@@ -58,6 +58,7 @@ func StreamBufferCapacity(capacity uint) func(Party) error {
 }
 
 // MaximumReceiveMessageSize is the maximum size in bytes of a single incoming hub message.
+// It is enforced by both hub protocols on all transports. A larger message closes the connection.
 // Default is 32768 bytes (32KB)
 func MaximumReceiveMessageSize(sizeInBytes uint) func(Party) error {
 	return func(p Party) error {
@@ -69,6 +70,33 @@ func MaximumReceiveMessageSize(sizeInBytes uint) func(Party) error {
 	}
 }
 
+// MaximumArguments is the maximum number of arguments, including streams, of a single incoming invocation.
+// An invocation with more arguments closes the connection.
+// Default is 64.
+func MaximumArguments(count uint) func(Party) error {
+	return func(p Party) error {
+		if count == 0 {
+			return errors.New("unsupported MaximumArguments 0")
+		}
+		p.setMaximumArguments(count)
+		return nil
+	}
+}
+
+// MaximumNestingDepth is the maximum nesting depth of arrays, objects and maps in a single incoming hub message.
+// The message itself and its arguments array count as the first two levels.
+// A deeper nested message closes the connection.
+// Default is 32.
+func MaximumNestingDepth(depth uint) func(Party) error {
+	return func(p Party) error {
+		if depth < 2 {
+			return errors.New("unsupported MaximumNestingDepth, must be at least 2")
+		}
+		p.setMaximumNestingDepth(depth)
+		return nil
+	}
+}
+
 // ChanReceiveTimeout is the timeout for processing stream items from the client, after StreamBufferCapacity was reached
 // If the hub method is not able to process a stream item during the timeout duration,
 // the server will send a completion with error.
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Party is the common base of Server and Client. The Party methods are only used internally,
@@ -29,8 +30,14 @@ type Party interface {
 	insecureSkipVerify() bool
 	setInsecureSkipVerify(skip bool)
 
-	originPatterns()   [] string
-	setOriginPatterns(orgs []string)
+	auditSink() AuditSink
+	setAuditSink(sink AuditSink)
+
+	metrics() Metrics
+	setMetrics(metrics Metrics)
+
+	tracer() trace.Tracer
+	setTracer(tracer trace.Tracer)
 
 	chanReceiveTimeout() time.Duration
 	setChanReceiveTimeout(interval time.Duration)
@@ -50,6 +57,12 @@ type Party interface {
 
 	maximumReceiveMessageSize() uint
 	setMaximumReceiveMessageSize(size uint)
+
+	maximumArguments() uint
+	setMaximumArguments(count uint)
+
+	maximumNestingDepth() uint
+	setMaximumNestingDepth(depth uint)
 }
 
 func newPartyBase(parentContext context.Context, info log.Logger, dbg log.Logger) partyBase {
@@ -63,9 +76,11 @@ func newPartyBase(parentContext context.Context, info log.Logger, dbg log.Logger
 		_chanReceiveTimeout:        time.Second * 5,
 		_streamBufferCapacity:      10,
 		_maximumReceiveMessageSize: 1 << 15, // 32KB
+		_maximumArguments:          64,
+		_maximumNestingDepth:       32,
+		_metrics:                   noMetrics{},
 		_enableDetailedErrors:      false,
 		_insecureSkipVerify:        false,
-		_originPatterns:            nil,
 		info:                       info,
 		dbg:                        dbg,
 	}
@@ -80,9 +95,13 @@ type partyBase struct {
 	_chanReceiveTimeout        time.Duration
 	_streamBufferCapacity      uint
 	_maximumReceiveMessageSize uint
+	_maximumArguments          uint
+	_maximumNestingDepth       uint
 	_enableDetailedErrors      bool
 	_insecureSkipVerify		   bool
-	_originPatterns             []string
+	_auditSink                 AuditSink
+	_metrics                   Metrics
+	_tracer                    trace.Tracer
 	info                       StructuredLogger
 	dbg                        StructuredLogger
 }
@@ -126,11 +145,31 @@ func (p *partyBase) setInsecureSkipVerify(skip bool) {
 	p._insecureSkipVerify = skip
 }
 
-func (p *partyBase) originPatterns() []string {
-	return  p._originPatterns
+func (p *partyBase) auditSink() AuditSink {
+	return p._auditSink
+}
+
+func (p *partyBase) setAuditSink(sink AuditSink) {
+	p._auditSink = sink
+}
+
+func (p *partyBase) metrics() Metrics {
+	return p._metrics
+}
+
+func (p *partyBase) setMetrics(metrics Metrics) {
+	p._metrics = metrics
+}
+
+func (p *partyBase) tracer() trace.Tracer {
+	if p._tracer == nil {
+		return defaultTracer()
+	}
+	return p._tracer
 }
-func (p *partyBase) setOriginPatterns(origins  []string) {
-	p._originPatterns = origins
+
+func (p *partyBase) setTracer(tracer trace.Tracer) {
+	p._tracer = tracer
 }
 
 func (p *partyBase) chanReceiveTimeout() time.Duration {
@@ -157,6 +196,22 @@ func (p *partyBase) setMaximumReceiveMessageSize(size uint) {
 	p._maximumReceiveMessageSize = size
 }
 
+func (p *partyBase) maximumArguments() uint {
+	return p._maximumArguments
+}
+
+func (p *partyBase) setMaximumArguments(count uint) {
+	p._maximumArguments = count
+}
+
+func (p *partyBase) maximumNestingDepth() uint {
+	return p._maximumNestingDepth
+}
+
+func (p *partyBase) setMaximumNestingDepth(depth uint) {
+	p._maximumNestingDepth = depth
+}
+
 func (p *partyBase) enableDetailedErrors() bool {
 	return p._enableDetailedErrors
 }
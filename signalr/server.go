@@ -10,9 +10,9 @@ import (
 	"os"
 	"reflect"
 	"runtime/debug"
-	"strings"
 
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Server is a SignalR server for one type of hub.
@@ -30,12 +30,39 @@ import (
 // HubClients()
 // allows to call all HubClients of the server from server-side, non-hub code.
 // Note that HubClients.Caller() returns nil, because there is no real caller which can be reached over a HubConnection.
+//
+//	Groups() GroupManager
+//
+// allows to add and remove connections to groups from server-side, non-hub code.
+//
+//	Connections() []ConnectionStatus
+//
+// returns the status of all connections, ordered by the time they connected.
+//
+//	GroupMembers() map[string][]string
+//
+// returns the connection ids of the members of all non-empty groups.
+//
+//	Disconnect(connectionID string, reason string, allowReconnect bool) error
+//
+// sends a close message with reason to the connection and closes it.
+//
+//	DebugFilter() *DebugFilter
+//
+// returns the filter set by LoggerWithDebugFilter, or nil.
 type Server interface {
 	Party
 	MapHTTP(routerFactory func() MappableRouter, path string)
 	Serve(conn Connection) error
 	HubClients() HubClients
+	Groups() GroupManager
+	Connections() []ConnectionStatus
+	GroupMembers() map[string][]string
+	Disconnect(connectionID string, reason string, allowReconnect bool) error
+	DebugFilter() *DebugFilter
 	availableTransports() []TransportType
+	corsPolicy() *CORSPolicy
+	requestUser() func(r *http.Request) string
 }
 
 type server struct {
@@ -46,10 +73,12 @@ type server struct {
 	groupManager      GroupManager
 	reconnectAllowed  bool
 	transports        []TransportType
+	cors              *CORSPolicy
+	userFromRequest   func(r *http.Request) string
+	debugFilter       *DebugFilter
+	tap               Tap
 }
 
-var AllowedClients string
-
 // NewServer creates a new server for one type of hub. The hub type is set by one of the
 // options UseHub, HubFactory or SimpleHubFactory
 func NewServer(ctx context.Context, options ...func(Party) error) (Server, error) {
@@ -59,14 +88,16 @@ func NewServer(ctx context.Context, options ...func(Party) error) (Server, error
 		lifetimeManager: &lifetimeManager,
 		defaultHubClients: &defaultHubClients{
 			lifetimeManager: &lifetimeManager,
-			allCache:        allClientProxy{lifetimeManager: &lifetimeManager},
-		},
-		groupManager: &defaultGroupManager{
-			lifetimeManager: &lifetimeManager,
+			allCache:        allClientProxy{ctx: context.Background(), lifetimeManager: &lifetimeManager},
 		},
 		partyBase:        newPartyBase(ctx, info, dbg),
 		reconnectAllowed: true,
 	}
+	lifetimeManager.party = server
+	server.groupManager = &defaultGroupManager{
+		lifetimeManager: &lifetimeManager,
+		party:           server,
+	}
 	for _, option := range options {
 		if option != nil {
 			if err := option(server); err != nil {
@@ -105,65 +136,35 @@ func WithHTTPServeMux(serveMux *http.ServeMux) func() MappableRouter {
 func (s *server) MapHTTP(routerFactory func() MappableRouter, path string) {
 	httpMux := newHTTPMux(s)
 	router := routerFactory()
-	/*	router.HandleFunc(fmt.Sprintf("%s/negotiate", path), httpMux.negotiate)
-		router.Handle(path, httpMux)
-	*/
-
-	negotiateHandler := corsMiddleware(http.HandlerFunc(httpMux.negotiate))
+	var negotiateHandler, otherRouteHandler http.Handler = http.HandlerFunc(httpMux.negotiate), httpMux
+	if s.cors != nil {
+		negotiateHandler = s.cors.Handler(negotiateHandler)
+		otherRouteHandler = s.cors.Handler(otherRouteHandler)
+	}
 	router.Handle(fmt.Sprintf("%s/negotiate", path), negotiateHandler)
-	//router.HandleFunc(fmt.Sprintf("%s/negotiate", path), httpMux.negotiate)
-	//	fmt.Println("MapHTTP", fmt.Sprintf("%s/negotiate", path), httpMux.negotiate)
-
-	otherRouteHandler := corsMiddleware(httpMux)
-
 	router.Handle(path, otherRouteHandler)
-
-	// Note: Removed invalid "*" pattern - it's not valid for Go's http.ServeMux (Go 1.22+)
-	// The path handler above already handles the hub path
-	// router.Handle("*", otherRouteHandler) // Invalid pattern, causes panic
-}
-func EnableCors(w *http.ResponseWriter, r *http.Request) {
-	allowedOrigins := strings.Split(AllowedClients, ",")
-
-	origin := r.Header.Get("Origin")
-	for _, allowedOrigin := range allowedOrigins {
-		if origin == allowedOrigin {
-			(*w).Header().Set("Access-Control-Allow-Origin", origin)
-			break
-		}
-	}
-	//	(*w).Header().Set("Access-Control-Allow-Origin", AllowedClients)
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-requested-with, x-signalr-user-agent")
-	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		// Set CORS headers to allow requests from any origin
-		EnableCors(&w, r)
-		//	fmt.Println("corsMiddleware", w.Header(), r.Method, r.Host, r.URL, r.Body, w.Header().Get("Origin"))
-		//	fmt.Println("request:", r.Header.Get("origin"), r.Method, r.Host, r.URL, r.Body, r.Header)
-		//	fmt.Println("next ServeHTTP:", next)
-
-		// Call the next handler in the chain
-		next.ServeHTTP(w, r)
-	})
 }
 
 // Serve serves the hub of the server on one connection.
 // The same server might serve different connections in parallel. Serve does not return until the connection is closed
 // or the servers' context is canceled.
 func (s *server) Serve(conn Connection) error {
-
+	_, span := s.tracer().Start(conn.Context(), "signalr.handshake", trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrRPCSystem.String("signalr"),
+			attrConnectionID.String(conn.ConnectionID()),
+			attrTransport.String(transportName(conn))))
 	protocol, err := s.processHandshake(conn)
 	//	fmt.Print("protocol", protocol, err)
 	if err != nil {
 		info, _ := s.prefixLoggers("")
 		_ = info.Log(evt, "processHandshake", "connectionId", conn.ConnectionID(), "error", err, react, "do not connect")
+		s.metrics().HandshakeFailed(transportName(conn), handshakeFailure(err))
+		span.SetAttributes(attrHandshakeFail.String(handshakeFailure(err)))
+		endSpan(span, err)
 		return err
 	}
+	span.SetAttributes(attrProtocol.String(protocolName(protocol)))
+	endSpan(span, nil)
 
 	return newLoop(s, conn, protocol).Run(make(chan struct{}, 1))
 }
@@ -176,8 +177,17 @@ func (s *server) availableTransports() []TransportType {
 	return s.transports
 }
 
+func (s *server) corsPolicy() *CORSPolicy {
+	return s.cors
+}
+
+func (s *server) requestUser() func(r *http.Request) string {
+	return s.userFromRequest
+}
+
 func (s *server) onConnected(hc hubConnection) {
 	s.lifetimeManager.OnConnected(hc)
+	audit(s, newAuditEvent(AuditConnect, hc), nil)
 	go func() {
 		defer s.recoverHubLifeCyclePanic()
 		s.invocationTarget(hc).(HubInterface).OnConnected(hc.ConnectionID())
@@ -190,6 +200,7 @@ func (s *server) onDisconnected(hc hubConnection) {
 		s.invocationTarget(hc).(HubInterface).OnDisconnected(hc.ConnectionID())
 	}()
 	s.lifetimeManager.OnDisconnected(hc)
+	audit(s, newAuditEvent(AuditDisconnect, hc), nil)
 
 }
 
@@ -216,36 +227,67 @@ func (s *server) recoverHubLifeCyclePanic() {
 func (s *server) prefixLoggers(connectionID string) (info StructuredLogger, dbg StructuredLogger) {
 	return log.WithPrefix(s.info, "ts", log.DefaultTimestampUTC,
 			"class", "Server",
-			"connection", connectionID,
+			logConnection, connectionID,
 			"hub", reflect.ValueOf(s.newHub()).Elem().Type()),
 		log.WithPrefix(s.dbg, "ts", log.DefaultTimestampUTC,
 			"class", "Server",
-			"connection", connectionID,
+			logConnection, connectionID,
 			"hub", reflect.ValueOf(s.newHub()).Elem().Type())
 }
 
+func (s *server) DebugFilter() *DebugFilter {
+	return s.debugFilter
+}
+
 func (s *server) newConnectionHubContext(hubConn hubConnection) HubContext {
+	var headers map[string]string
+	info, dbg := s.prefixLoggers(hubConn.ConnectionID())
+	info, dbg = withLogContext(info, dbg, logTransport, hubConn.Status().Transport)
+	if invocationConn, ok := hubConn.(*invocationHubConnection); ok {
+		headers = invocationConn.headers
+		info, dbg = withLogContext(info, dbg, logMethod, invocationConn.method, logInvocation, invocationConn.invocationID)
+	}
 	return &connectionHubContext{
 		abort: hubConn.Abort,
 		clients: &callerHubClients{
 			defaultHubClients: s.defaultHubClients,
 			connectionID:      hubConn.ConnectionID(),
+			ctx:               hubConn.Context(),
 		},
 		groups:     s.groupManager,
+		headers:    headers,
 		connection: hubConn,
-		info:       s.info,
-		dbg:        s.dbg,
+		info:       info,
+		dbg:        dbg,
 	}
 }
 
 func (s *server) processHandshake(conn Connection) (hubProtocol, error) {
 	if request, err := s.receiveHandshakeRequest(conn); err != nil {
+		var limitErr *MessageLimitError
+		if errors.As(err, &limitErr) {
+			// Tell the client why it is not connected
+			s.sendHandshakeError(conn, err)
+		}
 		return nil, err
 	} else {
 		return s.sendHandshakeResponse(conn, request)
 	}
 }
 
+func (s *server) sendHandshakeError(conn Connection, err error) {
+	_, dbg := s.prefixLoggers(conn.ConnectionID())
+	ctx, cancelWrite := context.WithTimeout(s.context(), s.HandshakeTimeout())
+	defer cancelWrite()
+	response, _ := json.Marshal(handshakeResponse{Error: err.Error()})
+	if _, respErr := ReadWriteWithContext(ctx,
+		func() (int, error) {
+			return conn.Write(append(response, 0x1e))
+		}, func() {}); respErr != nil {
+		_ = dbg.Log(evt, "handshake sent", "error", respErr)
+	}
+}
+
 func (s *server) receiveHandshakeRequest(conn Connection) (handshakeRequest, error) {
 	_, dbg := s.prefixLoggers(conn.ConnectionID())
 	ctx, cancelRead := context.WithTimeout(s.context(), s.HandshakeTimeout())
@@ -253,7 +295,7 @@ func (s *server) receiveHandshakeRequest(conn Connection) (handshakeRequest, err
 	readJSONFramesChan := make(chan []interface{}, 1)
 	go func() {
 		var remainBuf bytes.Buffer
-		rawHandshake, err := readJSONFrames(conn, &remainBuf)
+		rawHandshake, err := readJSONFrames(conn, &remainBuf, int(s.maximumReceiveMessageSize()))
 		readJSONFramesChan <- []interface{}{rawHandshake, err}
 	}()
 	request := handshakeRequest{}
@@ -287,7 +329,7 @@ func (s *server) sendHandshakeResponse(conn Connection, request handshakeRequest
 			_ = dbg.Log(evt, "handshake sent", "msg", handshakeResponse)
 		}
 	} else {
-		err = fmt.Errorf("protocol %v not supported", request.Protocol)
+		err = &unsupportedProtocolError{protocol: request.Protocol}
 		_ = info.Log(evt, "protocol requested", "error", err)
 		if _, respErr := ReadWriteWithContext(ctx,
 			func() (int, error) {
@@ -322,6 +364,14 @@ func (s *server) prefixLogger() (info log.Logger, debug log.Logger) {
 }
 */
 
+type unsupportedProtocolError struct {
+	protocol string
+}
+
+func (u *unsupportedProtocolError) Error() string {
+	return fmt.Sprintf("protocol %v not supported", u.protocol)
+}
+
 var protocolMap = map[string]hubProtocol{
 	"json":        &jsonHubProtocol{},
 	"messagepack": &messagePackHubProtocol{},
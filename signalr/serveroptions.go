@@ -67,12 +67,3 @@ func InsecureSkipVerify(skip bool) func(Party) error {
 		return nil
 	}
 }
-
-// AllowOriginPatterns lists the host patterns for authorized origins which is used for avoid same origin strategy.
-// See https://pkg.go.dev/nhooyr.io/websocket#AcceptOptions
-func AllowOriginPatterns(origins []string) func(Party) error {
-	return func(p Party) error {
-		p.setOriginPatterns(origins)
-		return nil
-	}
-}
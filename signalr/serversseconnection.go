@@ -14,8 +14,8 @@ type serverSSEConnection struct {
 	ConnectionBase
 	mx            sync.Mutex
 	postWriting   bool
-	postWriter    io.Writer
-	postReader    io.Reader
+	postWriter    *io.PipeWriter
+	postReader    *io.PipeReader
 	jobChan       chan []byte
 	jobResultChan chan RWJobResult
 }
@@ -32,6 +32,8 @@ func newServerSSEConnection(ctx context.Context, connectionID string) (*serverSS
 		s.mx.Lock()
 		close(s.jobChan)
 		s.mx.Unlock()
+		// Unblock a consumeRequest which has been left by the reader
+		_ = s.postWriter.CloseWithError(s.Context().Err())
 	}()
 	return &s, s.jobChan, s.jobResultChan, nil
 }
@@ -49,16 +51,17 @@ func (s *serverSSEConnection) consumeRequest(request *http.Request) int {
 	s.mx.Unlock()
 	defer func() {
 		_ = request.Body.Close()
+		s.mx.Lock()
+		s.postWriting = false
+		s.mx.Unlock()
 	}()
-	body, err := io.ReadAll(request.Body)
-	if err != nil {
+	// The body is streamed to the reader, the size of a single hub message is limited by the hubProtocol
+	if _, err := io.Copy(s.postWriter, request.Body); err != nil {
+		if s.Context().Err() != nil {
+			return http.StatusGone // 410
+		}
 		return http.StatusBadRequest // 400
-	} else if _, err := s.postWriter.Write(body); err != nil {
-		return http.StatusInternalServerError // 500
 	}
-	s.mx.Lock()
-	s.postWriting = false
-	s.mx.Unlock()
 	<-time.After(50 * time.Millisecond)
 	return http.StatusOK // 200
 }
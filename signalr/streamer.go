@@ -1,23 +1,41 @@
 package signalr
 
 import (
+	"context"
 	"reflect"
 	"sync"
 )
 
 type streamer struct {
-	cancels sync.Map
-	conn    hubConnection
+	cancels  sync.Map // the ids of the stream invocations canceled by the client
+	contexts sync.Map // the context.CancelFunc of the running stream invocations by invocation id
+	conn     hubConnection
+}
+
+// invocationContext returns the context of a stream invocation, which is canceled when the client cancels the
+// stream or the stream ends, so the hub method can stop producing items.
+func (s *streamer) invocationContext(ctx context.Context, invocationID string) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	s.contexts.Store(invocationID, cancel)
+	return ctx
+}
+
+// end cancels the context of the stream invocation
+func (s *streamer) end(invocationID string) {
+	if cancel, ok := s.contexts.LoadAndDelete(invocationID); ok {
+		cancel.(context.CancelFunc)()
+	}
 }
 
 func (s *streamer) Start(invocationID string, reflectedChannel reflect.Value) {
 	go func() {
+		defer s.cancels.Delete(invocationID)
+		defer s.end(invocationID)
 	loop:
 		for {
 			// Waits for channel, so might hang
 			if chanResult, ok := reflectedChannel.Recv(); ok {
 				if _, ok := s.cancels.Load(invocationID); ok {
-					s.cancels.Delete(invocationID)
 					_ = s.conn.Completion(invocationID, nil, "")
 					break loop
 				}
@@ -35,6 +53,9 @@ func (s *streamer) Start(invocationID string, reflectedChannel reflect.Value) {
 	}()
 }
 
+// Stop cancels the stream invocation. The context of the invocation is canceled, and the stream ends with the
+// next item or when the hub method closes the channel.
 func (s *streamer) Stop(invocationID string) {
 	s.cancels.Store(invocationID, struct{}{})
+	s.end(invocationID)
 }
@@ -1,6 +1,7 @@
 package signalr
 
 import (
+	"context"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -37,6 +38,23 @@ func (s *streamHub) EndlessStream() <-chan int {
 	return r
 }
 
+func (s *streamHub) ContextStream(ctx context.Context) <-chan int {
+	r := make(chan int)
+	go func() {
+		defer close(r)
+		for i := 1; ; i++ {
+			select {
+			case r <- i:
+			case <-ctx.Done():
+				streamInvocationQueue <- "ContextStream() done"
+				return
+			}
+		}
+	}()
+	streamInvocationQueue <- "ContextStream()"
+	return r
+}
+
 func (s *streamHub) SliceStream() <-chan []int {
 	r := make(chan []int)
 	go func() {
@@ -173,6 +191,30 @@ var _ = Describe("StreamInvocation", func() {
 		})
 	})
 
+	Describe("Stop stream invocation with context", func() {
+		var server Server
+		var conn *testingConnection
+		BeforeEach(func(done Done) {
+			server, conn = connect(&streamHub{})
+			close(done)
+		})
+		AfterEach(func(done Done) {
+			server.cancel()
+			close(done)
+		})
+		Context("When invoked by the client and stopped", func() {
+			It("should cancel the context of the invocation", func(done Done) {
+				conn.ClientSend(`{"type":4,"invocationId": "ctx","target":"contextstream"}`)
+				Expect(<-streamInvocationQueue).To(Equal("ContextStream()"))
+				recv := (<-conn.received).(streamItemMessage)
+				Expect(recv.InvocationID).To(Equal("ctx"))
+				conn.ClientSend(`{"type":5,"invocationId": "ctx"}`)
+				Eventually(streamInvocationQueue).Should(Receive(Equal("ContextStream() done")))
+				close(done)
+			})
+		})
+	})
+
 	Describe("Invalid CancelInvocation", func() {
 		var server Server
 		var conn *testingConnection
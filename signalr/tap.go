@@ -0,0 +1,114 @@
+package signalr
+
+import (
+	"errors"
+	"time"
+)
+
+// TapMessage directions
+const (
+	TapInbound  = "in"
+	TapOutbound = "out"
+)
+
+// TapMessage is a decoded hub message sent or received by a connection of the server.
+// Arguments, Item and Result of inbound messages are decoded to generic values.
+type TapMessage struct {
+	Time         time.Time         `json:"time"`
+	Direction    string            `json:"direction"`
+	ConnectionID string            `json:"connectionId"`
+	Type         string            `json:"type"`
+	Target       string            `json:"target,omitempty"`
+	InvocationID string            `json:"invocationId,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Arguments    []interface{}     `json:"arguments,omitempty"`
+	Item         interface{}       `json:"item,omitempty"`
+	Result       interface{}       `json:"result,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Tap captures the hub messages of the server, e.g. to debug what was sent on a topic.
+// Enabled is called for every message except pings and has to be fast. target is the method of invocations,
+// and empty for other messages. Only if Enabled returns true, the message is decoded and passed to Message.
+// Both are called synchronously from the connection.
+type Tap interface {
+	Enabled(connectionID string, target string) bool
+	Message(message TapMessage)
+}
+
+// WithTap sets the Tap which receives the inbound and outbound hub messages of all connections
+func WithTap(tap Tap) func(Party) error {
+	return func(p Party) error {
+		if tap == nil {
+			return errors.New("option WithTap needs a Tap")
+		}
+		if s, ok := p.(*server); ok {
+			s.tap = tap
+			return nil
+		}
+		return errors.New("option WithTap is server only")
+	}
+}
+
+// tapMessage passes the message to the tap of the connection if it is enabled for it
+func (c *defaultHubConnection) tapMessage(direction string, message interface{}) {
+	if c.tap == nil {
+		return
+	}
+	var m TapMessage
+	switch message := message.(type) {
+	case invocationMessage:
+		m = TapMessage{Type: "invocation", Target: message.Target, InvocationID: message.InvocationID, Headers: message.Headers}
+		if message.Type == 4 {
+			m.Type = "streamInvocation"
+		}
+		if !c.tap.Enabled(c.ConnectionID(), message.Target) {
+			return
+		}
+		m.Arguments = make([]interface{}, len(message.Arguments))
+		for i, argument := range message.Arguments {
+			m.Arguments[i] = c.tapValue(direction, argument)
+		}
+	case completionMessage:
+		if !c.tap.Enabled(c.ConnectionID(), "") {
+			return
+		}
+		m = TapMessage{Type: "completion", InvocationID: message.InvocationID, Headers: message.Headers,
+			Result: c.tapValue(direction, message.Result), Error: message.Error}
+	case streamItemMessage:
+		if !c.tap.Enabled(c.ConnectionID(), "") {
+			return
+		}
+		m = TapMessage{Type: "streamItem", InvocationID: message.InvocationID, Headers: message.Headers,
+			Item: c.tapValue(direction, message.Item)}
+	case cancelInvocationMessage:
+		if !c.tap.Enabled(c.ConnectionID(), "") {
+			return
+		}
+		m = TapMessage{Type: "cancelInvocation", InvocationID: message.InvocationID}
+	case closeMessage:
+		if !c.tap.Enabled(c.ConnectionID(), "") {
+			return
+		}
+		m = TapMessage{Type: "close", Error: message.Error}
+	default:
+		// Pings
+		return
+	}
+	m.Time = time.Now().UTC()
+	m.Direction = direction
+	m.ConnectionID = c.ConnectionID()
+	c.tap.Message(m)
+}
+
+// tapValue decodes the raw values of inbound messages. Outbound values are the values passed by the sender.
+func (c *defaultHubConnection) tapValue(direction string, value interface{}) interface{} {
+	if direction == TapOutbound || value == nil {
+		return value
+	}
+	var decoded interface{}
+	if err := c.protocol.UnmarshalArgument(value, &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
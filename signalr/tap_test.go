@@ -0,0 +1,101 @@
+package signalr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingTap records the messages of the connections with the method, or of all connections if method is empty
+type recordingTap struct {
+	mx       sync.Mutex
+	method   string
+	messages []TapMessage
+}
+
+func (r *recordingTap) Enabled(_ string, target string) bool {
+	return r.method == "" || strings.EqualFold(r.method, target)
+}
+
+func (r *recordingTap) Message(message TapMessage) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.messages = append(r.messages, message)
+}
+
+func (r *recordingTap) recorded() []TapMessage {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append([]TapMessage{}, r.messages...)
+}
+
+var _ = Describe("Tap", func() {
+	It("should not be set on a client", func() {
+		_, err := NewClient(context.TODO(), WithConnection(newTestingConnection()), WithTap(&recordingTap{}))
+		Expect(err).To(HaveOccurred())
+	})
+
+	for _, f := range []TransferFormatType{"Text", "Binary"} {
+		format := f
+		Context(fmt.Sprintf("with transfer format %v", format), func() {
+			It("should capture decoded inbound and outbound messages", func(done Done) {
+				tap := &recordingTap{}
+				server, err := NewServer(context.TODO(), SimpleHubFactory(&simpleHub{}), WithTap(tap), testLoggerOption())
+				Expect(err).NotTo(HaveOccurred())
+				defer server.cancel()
+				cliConn, srvConn := newClientServerConnections()
+				go func() { _ = server.Serve(srvConn) }()
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				client, err := NewClient(ctx, WithConnection(cliConn), TransferFormat(format), testLoggerOption())
+				Expect(err).NotTo(HaveOccurred())
+				client.Start()
+				Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+				r := <-client.Invoke("InvokeMe", "A", 1)
+				Expect(r.Error).NotTo(HaveOccurred())
+				Eventually(func() int { return len(tap.recorded()) }).Should(Equal(2))
+				messages := tap.recorded()
+				Expect(messages[0].Direction).To(Equal(TapInbound))
+				Expect(messages[0].Type).To(Equal("invocation"))
+				Expect(messages[0].Target).To(Equal("InvokeMe"))
+				Expect(messages[0].Arguments).To(HaveLen(2))
+				Expect(messages[0].Arguments[0]).To(Equal("A"))
+				Expect(messages[0].Arguments[1]).To(BeNumerically("==", 1))
+				Expect(messages[1].Direction).To(Equal(TapOutbound))
+				Expect(messages[1].Type).To(Equal("completion"))
+				Expect(messages[1].InvocationID).To(Equal(messages[0].InvocationID))
+				Expect(messages[1].Result).To(Equal("A1"))
+				Expect(messages[1].ConnectionID).To(Equal(messages[0].ConnectionID))
+				close(done)
+			}, 2.0)
+		})
+	}
+
+	It("should only capture messages for which the tap is enabled", func(done Done) {
+		tap := &recordingTap{method: "OnCallback"}
+		server, err := NewServer(context.TODO(), SimpleHubFactory(&simpleHub{}), WithTap(tap), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		defer server.cancel()
+		cliConn, srvConn := newClientServerConnections()
+		go func() { _ = server.Serve(srvConn) }()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		receiver := &simpleReceiver{ch: make(chan string, 1)}
+		client, err := NewClient(ctx, WithConnection(cliConn), WithReceiver(receiver), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+		Expect((<-client.Invoke("Callback", "low")).Error).NotTo(HaveOccurred())
+		Expect(<-receiver.ch).To(Equal("LOW"))
+		Eventually(func() int { return len(tap.recorded()) }).Should(Equal(1))
+		message := tap.recorded()[0]
+		Expect(message.Direction).To(Equal(TapOutbound))
+		Expect(message.Target).To(Equal("OnCallback"))
+		Expect(message.Arguments).To(Equal([]interface{}{"LOW"}))
+		close(done)
+	}, 2.0)
+})
@@ -0,0 +1,103 @@
+package signalr
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans
+const tracerName = "github.com/mdaxf/iac-signalr/signalr"
+
+// tracePropagator propagates the trace context in invocation headers and negotiate requests
+// with the W3C traceparent and tracestate headers
+var tracePropagator = propagation.TraceContext{}
+
+// Span attributes
+const (
+	attrRPCSystem     = attribute.Key("rpc.system")
+	attrRPCMethod     = attribute.Key("rpc.method")
+	attrConnectionID  = attribute.Key("signalr.connection_id")
+	attrInvocationID  = attribute.Key("signalr.invocation_id")
+	attrProtocol      = attribute.Key("signalr.protocol")
+	attrTransport     = attribute.Key("signalr.transport")
+	attrSendKind      = attribute.Key("signalr.send.kind")
+	attrSendTarget    = attribute.Key("signalr.send.target")
+	attrRecipients    = attribute.Key("signalr.send.recipients")
+	attrHandshakeFail = attribute.Key("signalr.handshake.failure")
+)
+
+// WithTracerProvider sets the OpenTelemetry TracerProvider for the spans of the handshake, the hub invocations
+// and the sends to clients. Default is the global TracerProvider.
+// The trace context is propagated in the headers of the invocation messages.
+func WithTracerProvider(provider trace.TracerProvider) func(Party) error {
+	return func(p Party) error {
+		p.setTracer(provider.Tracer(tracerName))
+		return nil
+	}
+}
+
+// defaultTracer returns the tracer of the global TracerProvider. As the global TracerProvider may
+// be set after the Party has been created, it is not stored.
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// injectHeaders adds the trace context of ctx to headers. It returns headers or a new map if headers is nil
+// and there is a trace context.
+func injectHeaders(ctx context.Context, headers map[string]string) map[string]string {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return headers
+	}
+	if headers == nil {
+		headers = make(map[string]string, len(carrier))
+	}
+	for key, value := range carrier {
+		headers[key] = value
+	}
+	return headers
+}
+
+// extractHeaders returns ctx with the remote trace context from headers
+func extractHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return tracePropagator.Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// extractRequest returns the request context with the remote trace context from the request headers
+func extractRequest(request *http.Request) context.Context {
+	return tracePropagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+}
+
+// endSpan records err on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// invocationHubConnection is the hubConnection passed to the hub for one invocation.
+// Its context carries the span of the invocation, headers are the headers of the invocation message.
+// method and invocationID are added to the log events of the hub.
+type invocationHubConnection struct {
+	hubConnection
+	ctx          context.Context
+	headers      map[string]string
+	method       string
+	invocationID string
+}
+
+func (i *invocationHubConnection) Context() context.Context {
+	return i.ctx
+}
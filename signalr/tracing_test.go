@@ -0,0 +1,106 @@
+package signalr
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// findSpan returns the first span with the name and kind, or nil
+func findSpan(spans tracetest.SpanStubs, name string, kind trace.SpanKind) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name && spans[i].SpanKind == kind {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+var _ = Describe("Tracing", func() {
+	var exporter *tracetest.InMemoryExporter
+	var server Server
+	var client Client
+	var cancelClient context.CancelFunc
+	var receiver *simpleReceiver
+
+	BeforeEach(func(done Done) {
+		exporter = tracetest.NewInMemoryExporter()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		var err error
+		server, err = NewServer(context.TODO(), SimpleHubFactory(&simpleHub{}), WithTracerProvider(provider), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		cliConn, srvConn := newClientServerConnections()
+		go func() { _ = server.Serve(srvConn) }()
+		var ctx context.Context
+		ctx, cancelClient = context.WithCancel(context.Background())
+		receiver = &simpleReceiver{ch: make(chan string, 1)}
+		client, err = NewClient(ctx, WithConnection(cliConn), WithReceiver(receiver), WithTracerProvider(provider), testLoggerOption())
+		Expect(err).NotTo(HaveOccurred())
+		client.Start()
+		Expect(<-client.WaitForState(context.Background(), ClientConnected)).NotTo(HaveOccurred())
+		close(done)
+	}, 2.0)
+
+	AfterEach(func(done Done) {
+		cancelClient()
+		server.cancel()
+		close(done)
+	}, 2.0)
+
+	It("should trace the handshake", func() {
+		Eventually(func() *tracetest.SpanStub {
+			return findSpan(exporter.GetSpans(), "signalr.handshake", trace.SpanKindServer)
+		}).ShouldNot(BeNil())
+		Eventually(func() *tracetest.SpanStub {
+			return findSpan(exporter.GetSpans(), "signalr.handshake", trace.SpanKindClient)
+		}).ShouldNot(BeNil())
+	})
+
+	It("should propagate the trace from the client invocation over the hub method to the send", func(done Done) {
+		ctx, parent := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "test")
+		r := <-client.InvokeContext(ctx, "Callback", "low")
+		Expect(r.Error).NotTo(HaveOccurred())
+		Expect(<-receiver.ch).To(Equal("LOW"))
+		parent.End()
+		var spans tracetest.SpanStubs
+		Eventually(func() *tracetest.SpanStub {
+			spans = exporter.GetSpans()
+			return findSpan(spans, "invoke OnCallback", trace.SpanKindServer)
+		}).ShouldNot(BeNil())
+		Eventually(func() *tracetest.SpanStub {
+			spans = exporter.GetSpans()
+			return findSpan(spans, "invoke Callback", trace.SpanKindClient)
+		}).ShouldNot(BeNil())
+		invoke := findSpan(spans, "invoke Callback", trace.SpanKindClient)
+		method := findSpan(spans, "invoke Callback", trace.SpanKindServer)
+		send := findSpan(spans, "send OnCallback", trace.SpanKindProducer)
+		callback := findSpan(spans, "invoke OnCallback", trace.SpanKindServer)
+		Expect(method).NotTo(BeNil())
+		Expect(send).NotTo(BeNil())
+		traceID := parent.SpanContext().TraceID()
+		for _, span := range []*tracetest.SpanStub{invoke, method, send, callback} {
+			Expect(span.SpanContext.TraceID()).To(Equal(traceID))
+		}
+		Expect(invoke.Parent.SpanID()).To(Equal(parent.SpanContext().SpanID()))
+		Expect(method.Parent.SpanID()).To(Equal(invoke.SpanContext.SpanID()))
+		Expect(method.Parent.IsRemote()).To(BeTrue())
+		Expect(send.Parent.SpanID()).To(Equal(method.SpanContext.SpanID()))
+		Expect(callback.Parent.SpanID()).To(Equal(send.SpanContext.SpanID()))
+		close(done)
+	}, 2.0)
+
+	It("should record hub method errors", func(done Done) {
+		r := <-client.Invoke("InvokeMe", "A", "B")
+		Expect(r.Error).To(HaveOccurred())
+		Eventually(func() *tracetest.SpanStub {
+			return findSpan(exporter.GetSpans(), "invoke InvokeMe", trace.SpanKindServer)
+		}).ShouldNot(BeNil())
+		method := findSpan(exporter.GetSpans(), "invoke InvokeMe", trace.SpanKindServer)
+		Expect(method.Events).NotTo(BeEmpty())
+		close(done)
+	}, 2.0)
+})
@@ -1,9 +1,10 @@
 package signalr
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
 	"nhooyr.io/websocket"
 )
@@ -11,10 +12,13 @@ import (
 type webSocketConnection struct {
 	ConnectionBase
 	conn         *websocket.Conn
+	reader       io.Reader // of the websocket message currently read
 	transferMode TransferMode
 }
 
 func newWebSocketConnection(ctx context.Context, connectionID string, conn *websocket.Conn) *webSocketConnection {
+	// Messages are streamed, so the hubProtocol limits the size of a single hub message, not the websocket
+	conn.SetReadLimit(-1)
 	w := &webSocketConnection{
 		conn:           conn,
 		ConnectionBase: *NewConnectionBase(ctx, connectionID),
@@ -46,11 +50,20 @@ func (w *webSocketConnection) Write(p []byte) (n int, err error) {
 func (w *webSocketConnection) Read(p []byte) (n int, err error) {
 	n, err = ReadWriteWithContext(w.Context(),
 		func() (int, error) {
-			_, data, err := w.conn.Read(w.Context())
-			if err != nil {
-				return 0, err
+			if w.reader == nil {
+				_, reader, err := w.conn.Reader(w.Context())
+				if err != nil {
+					return 0, err
+				}
+				w.reader = reader
+			}
+			n, err := w.reader.Read(p)
+			if errors.Is(err, io.EOF) {
+				// Websocket message complete, continue with the next one
+				w.reader = nil
+				err = nil
 			}
-			return bytes.NewReader(data).Read(p)
+			return n, err
 		},
 		func() {})
 	if err != nil {
@@ -0,0 +1,439 @@
+// Package stompbridge connects the message bus to a STOMP broker like ActiveMQ. Inbound rules subscribe to queues
+// or topics of the broker and republish their messages to bus topics, outbound rules send the messages of bus topics
+// to destinations of the broker. Inbound messages are acknowledged only after they were passed to the bus.
+package stompbridge
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-stomp/stomp/v3"
+	"github.com/go-stomp/stomp/v3/frame"
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+// DefaultQueueSize is the number of outbound messages waiting to be sent, if no QueueSize is given
+const DefaultQueueSize = 1000
+
+// DefaultSendTimeout is the time to wait for the receipt of an outbound message, if no SendTimeout is given
+const DefaultSendTimeout = 10 * time.Second
+
+// DefaultMaxReconnectInterval is the longest wait between reconnect attempts, if no MaxReconnectInterval is given
+const DefaultMaxReconnectInterval = time.Minute
+
+// sendAttempts is the number of connections an outbound message is tried on before it is dropped,
+// so a message the broker rejects does not block the ones after it
+const sendAttempts = 3
+
+// subscriptionNameHeader names a durable subscription, with the client-id of the connection.
+// ActiveMQ and ActiveMQ Artemis both accept it.
+const subscriptionNameHeader = "activemq.subscriptionName"
+
+// Rule maps a destination of the broker to a bus topic
+type Rule struct {
+	// Destination is the queue or topic of the broker, like /queue/iac.orders or /topic/iac.events.
+	// For outbound rules it is a template with {1}, {2}... for the levels matched by the wildcards of Filter.
+	Destination string
+	// Topic is the bus topic of the messages of inbound rules
+	Topic string
+	// Filter is the bus topic filter of outbound rules
+	Filter string
+	// Durable names the durable subscription of an inbound rule. The broker keeps the messages of the topic
+	// for it while the bridge is disconnected. It needs Options.ClientID.
+	Durable string
+	// HeaderMap maps the names of headers between the broker and the bus, from STOMP to bus names for inbound
+	// rules and from bus to STOMP names for outbound rules. With a HeaderMap, bus messages are an Envelope.
+	HeaderMap map[string]string
+	// Headers are added to the messages of outbound rules, like persistent:true
+	Headers map[string]string
+}
+
+// Envelope is the bus message of rules with a HeaderMap, which carries the mapped headers with the body
+type Envelope struct {
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// Options configure a Bridge
+type Options struct {
+	// Address is the host:port of the broker
+	Address string
+	// TLS connects with TLS if it is not nil
+	TLS      *tls.Config
+	Login    string
+	Passcode string
+	// Host is the virtual host, default the host of Address
+	Host string
+	// ClientID identifies the connection for durable subscriptions
+	ClientID string
+	// HeartBeat is the interval of the heart-beats in both directions, zero disables them
+	HeartBeat time.Duration
+	// MaxReconnectInterval is the longest wait between reconnect attempts
+	MaxReconnectInterval time.Duration
+	Inbound              []Rule
+	Outbound             []Rule
+	// QueueSize is the number of outbound messages waiting to be sent, further messages are dropped
+	QueueSize int
+	// SendTimeout is the time to wait for the receipt of an outbound message
+	SendTimeout time.Duration
+	// Publish sends an inbound message to the bus. The message is acknowledged to the broker if it returns nil,
+	// and negatively acknowledged otherwise, so the broker can redeliver it or move it to its dead letter queue.
+	Publish func(topic string, message string) error
+	// Logf logs connection changes and failed messages
+	Logf func(format string, args ...interface{})
+}
+
+// Bridge is the connection to the broker. It reconnects when the connection fails. It is safe for concurrent use.
+type Bridge struct {
+	options Options
+	queue   chan outbound
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mx      sync.Mutex
+	status  Status
+	// pending is the outbound message which was not sent on the last connection, only used by run
+	pending  *outbound
+	attempts int
+}
+
+// outbound is a message waiting to be sent to the broker
+type outbound struct {
+	destination string
+	message     string
+	rule        Rule
+}
+
+// Status is the state of the bridge
+type Status struct {
+	Broker    string    `json:"broker"`
+	Connected bool      `json:"connected"`
+	Since     time.Time `json:"since"` // of the last connect or disconnect
+	LastError string    `json:"lastError,omitempty"`
+	Inbound   uint64    `json:"inbound"`  // messages passed to the bus and acknowledged
+	Outbound  uint64    `json:"outbound"` // messages sent to the broker
+	Dropped   uint64    `json:"dropped"`  // outbound messages dropped because the queue was full or the broker rejected them
+	Failed    uint64    `json:"failed"`   // inbound messages the bus rejected, which were negatively acknowledged
+}
+
+// New checks the rules and creates the Bridge. It does not connect before Start.
+func New(options Options) (*Bridge, error) {
+	if options.Address == "" {
+		return nil, errors.New("stomp bridge has no address")
+	}
+	for _, rule := range options.Inbound {
+		if rule.Destination == "" || rule.Topic == "" {
+			return nil, fmt.Errorf("inbound rule %s: destination and topic are required", rule.Destination)
+		}
+		if err := topic.ValidateTopic(rule.Topic); err != nil {
+			return nil, err
+		}
+		if rule.Durable != "" && options.ClientID == "" {
+			return nil, fmt.Errorf("inbound rule %s: durable subscription %s needs a client id", rule.Destination, rule.Durable)
+		}
+	}
+	for _, rule := range options.Outbound {
+		if rule.Destination == "" {
+			return nil, fmt.Errorf("outbound rule %s: destination is required", rule.Filter)
+		}
+		if err := topic.ValidateRewrite(rule.Filter, rule.Destination); err != nil {
+			return nil, err
+		}
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.SendTimeout <= 0 {
+		options.SendTimeout = DefaultSendTimeout
+	}
+	if options.MaxReconnectInterval <= 0 {
+		options.MaxReconnectInterval = DefaultMaxReconnectInterval
+	}
+	if options.Logf == nil {
+		options.Logf = func(string, ...interface{}) {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bridge{
+		options: options,
+		queue:   make(chan outbound, options.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		status:  Status{Broker: options.Address},
+	}, nil
+}
+
+// Start connects to the broker in the background. It keeps trying to connect and reconnects when the connection
+// fails, then subscribes the inbound rules again.
+func (b *Bridge) Start() {
+	b.wg.Add(1)
+	go b.run()
+}
+
+// run keeps a connection to the broker until the bridge is closed
+func (b *Bridge) run() {
+	defer b.wg.Done()
+	retry := backoff.NewExponentialBackOff()
+	retry.InitialInterval = time.Second
+	if retry.InitialInterval > b.options.MaxReconnectInterval {
+		retry.InitialInterval = b.options.MaxReconnectInterval
+	}
+	retry.MaxInterval = b.options.MaxReconnectInterval
+	retry.MaxElapsedTime = 0
+	retry.Reset()
+	for {
+		connected, err := b.session()
+		if b.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			retry.Reset()
+			b.options.Logf("STOMP bridge lost the connection to %s, reconnecting: %v", b.options.Address, err)
+		} else {
+			b.options.Logf("STOMP bridge failed to connect to %s: %v", b.options.Address, err)
+		}
+		b.setConnected(false, err)
+		select {
+		case <-time.After(retry.NextBackOff()):
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// session connects, subscribes the inbound rules and sends the outbound messages until the connection fails
+// or the bridge is closed. connected reports whether the connection was made.
+func (b *Bridge) session() (connected bool, err error) {
+	conn, err := b.connect()
+	if err != nil {
+		return false, err
+	}
+	b.setConnected(true, nil)
+	b.options.Logf("STOMP bridge connected to %s", b.options.Address)
+	failed := make(chan error, len(b.options.Inbound))
+	var readers sync.WaitGroup
+	for _, rule := range b.options.Inbound {
+		var options []func(*frame.Frame) error
+		if rule.Durable != "" {
+			options = append(options, stomp.SubscribeOpt.Header(subscriptionNameHeader, rule.Durable))
+		}
+		var subscription *stomp.Subscription
+		subscription, err = conn.Subscribe(rule.Destination, stomp.AckClientIndividual, options...)
+		if err != nil {
+			err = fmt.Errorf("subscribe to %s: %w", rule.Destination, err)
+			break
+		}
+		readers.Add(1)
+		go b.receive(subscription, rule, failed, &readers)
+	}
+	if err == nil {
+		err = b.send(conn, failed)
+	}
+	if b.ctx.Err() != nil {
+		_ = conn.Disconnect()
+	} else {
+		_ = conn.MustDisconnect()
+	}
+	readers.Wait()
+	return true, err
+}
+
+func (b *Bridge) connect() (*stomp.Conn, error) {
+	dialer := &net.Dialer{Timeout: b.options.SendTimeout}
+	var netConn net.Conn
+	var err error
+	if b.options.TLS != nil {
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: b.options.TLS}).DialContext(b.ctx, "tcp", b.options.Address)
+	} else {
+		netConn, err = dialer.DialContext(b.ctx, "tcp", b.options.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	host := b.options.Host
+	if host == "" {
+		host, _, _ = net.SplitHostPort(b.options.Address)
+	}
+	options := []func(*stomp.Conn) error{
+		stomp.ConnOpt.Host(host),
+		stomp.ConnOpt.HeartBeat(b.options.HeartBeat, b.options.HeartBeat),
+		stomp.ConnOpt.RcvReceiptTimeout(b.options.SendTimeout),
+		stomp.ConnOpt.DisconnectReceiptTimeout(b.options.SendTimeout),
+	}
+	if b.options.Login != "" {
+		options = append(options, stomp.ConnOpt.Login(b.options.Login, b.options.Passcode))
+	}
+	if b.options.ClientID != "" {
+		options = append(options, stomp.ConnOpt.Header("client-id", b.options.ClientID))
+	}
+	conn, err := stomp.Connect(netConn, options...)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// receive passes the messages of the subscription to the bus, one after the other, and acknowledges each once
+// it was passed on. It reports a failure of the connection to failed.
+func (b *Bridge) receive(subscription *stomp.Subscription, rule Rule, failed chan<- error, readers *sync.WaitGroup) {
+	defer readers.Done()
+	for message := range subscription.C {
+		if message.Err != nil {
+			failed <- message.Err
+			return
+		}
+		err := b.options.Publish(rule.Topic, rule.inbound(message))
+		if err != nil {
+			b.count(&b.status.Failed)
+			b.options.Logf("STOMP bridge failed to publish a message of %s to %s: %v", rule.Destination, rule.Topic, err)
+			err = message.Conn.Nack(message)
+		} else {
+			b.count(&b.status.Inbound)
+			err = message.Conn.Ack(message)
+		}
+		if err != nil {
+			failed <- err
+			return
+		}
+	}
+}
+
+// inbound returns the bus message of a message of the broker, an Envelope if the rule maps headers
+func (r Rule) inbound(message *stomp.Message) string {
+	if len(r.HeaderMap) == 0 {
+		return string(message.Body)
+	}
+	envelope := Envelope{Headers: make(map[string]string), Body: string(message.Body)}
+	for stompName, busName := range r.HeaderMap {
+		if value, ok := message.Header.Contains(stompName); ok {
+			envelope.Headers[busName] = value
+		}
+	}
+	data, _ := json.Marshal(envelope)
+	return string(data)
+}
+
+// send sends the queued outbound messages with a receipt, until the connection fails or the bridge is closed.
+// A message which was not sent is kept for the next connection.
+func (b *Bridge) send(conn *stomp.Conn, failed <-chan error) error {
+	for {
+		if b.pending != nil {
+			b.attempts++
+			contentType, body, options := b.pending.frame()
+			if err := conn.Send(b.pending.destination, contentType, body, options...); err != nil {
+				if b.attempts >= sendAttempts {
+					b.count(&b.status.Dropped)
+					b.options.Logf("STOMP bridge dropped a message to %s after %d attempts: %v", b.pending.destination, b.attempts, err)
+					b.pending = nil
+				}
+				return err
+			}
+			b.count(&b.status.Outbound)
+			b.pending = nil
+		}
+		select {
+		case message := <-b.queue:
+			b.pending = &message
+			b.attempts = 0
+		case err := <-failed:
+			return err
+		case <-b.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// frame returns the content type, body and headers of the SEND frame. With a HeaderMap, a message which is
+// an Envelope is unpacked and its mapped headers are sent; other messages are sent as they are.
+func (m *outbound) frame() (string, []byte, []func(*frame.Frame) error) {
+	body := m.message
+	headers := make(map[string]string, len(m.rule.Headers))
+	for name, value := range m.rule.Headers {
+		headers[name] = value
+	}
+	var envelope Envelope
+	if len(m.rule.HeaderMap) > 0 && json.Unmarshal([]byte(m.message), &envelope) == nil && envelope.Headers != nil {
+		body = envelope.Body
+		for busName, stompName := range m.rule.HeaderMap {
+			if value, ok := envelope.Headers[busName]; ok {
+				headers[stompName] = value
+			}
+		}
+	}
+	contentType := headers[frame.ContentType]
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	delete(headers, frame.ContentType)
+	options := []func(*frame.Frame) error{stomp.SendOpt.Receipt}
+	for name, value := range headers {
+		options = append(options, stomp.SendOpt.Header(name, value))
+	}
+	return contentType, []byte(body), options
+}
+
+// Forward queues the message of a bus topic for the broker, with the first outbound rule which matches the topic.
+// A nil *Bridge forwards nothing.
+func (b *Bridge) Forward(topicName string, message string) {
+	if b == nil {
+		return
+	}
+	for _, rule := range b.options.Outbound {
+		destination, ok := topic.Rewrite(rule.Filter, rule.Destination, topicName)
+		if !ok {
+			continue
+		}
+		// Rewrite trims the separators around the result, destinations like /queue/... keep their leading one
+		if strings.HasPrefix(rule.Destination, "/") && !strings.HasPrefix(destination, "/") {
+			destination = "/" + destination
+		}
+		select {
+		case b.queue <- outbound{destination: destination, message: message, rule: rule}:
+		default:
+			b.count(&b.status.Dropped)
+			b.options.Logf("STOMP bridge dropped a message of %s, the queue is full", topicName)
+		}
+		return
+	}
+}
+
+func (b *Bridge) setConnected(connected bool, err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.status.Connected = connected
+	b.status.Since = time.Now().UTC()
+	if err != nil {
+		b.status.LastError = err.Error()
+	}
+}
+
+func (b *Bridge) count(counter *uint64) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	*counter++
+}
+
+// Status returns the state of the bridge
+func (b *Bridge) Status() Status {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.status
+}
+
+// Close disconnects from the broker. Queued outbound messages are not sent, unacknowledged inbound messages
+// are redelivered by the broker.
+func (b *Bridge) Close() {
+	if b == nil {
+		return
+	}
+	b.cancel()
+	b.wg.Wait()
+}
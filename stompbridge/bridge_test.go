@@ -0,0 +1,185 @@
+package stompbridge
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-stomp/stomp/v3/frame"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// busMessage is a message the bridge published to the bus
+type busMessage struct {
+	topic   string
+	message string
+}
+
+var _ = Describe("Bridge", func() {
+	var broker *standIn
+	var bridge *Bridge
+	var bus chan busMessage
+	var publish func(topic string, message string) error
+
+	start := func(options Options) {
+		options.Address = broker.address()
+		options.MaxReconnectInterval = 50 * time.Millisecond
+		options.SendTimeout = time.Second
+		out, pass := bus, publish
+		options.Publish = func(topic string, message string) error {
+			out <- busMessage{topic: topic, message: message}
+			return pass(topic, message)
+		}
+		var err error
+		bridge, err = New(options)
+		Expect(err).NotTo(HaveOccurred())
+		bridge.Start()
+		Eventually(func() bool { return bridge.Status().Connected }).Should(BeTrue())
+	}
+
+	BeforeEach(func() {
+		broker = newStandIn()
+		bus = make(chan busMessage, 10)
+		publish = func(string, string) error { return nil }
+		bridge = nil
+	})
+
+	AfterEach(func() {
+		bridge.Close()
+		broker.close()
+	})
+
+	Context("inbound", func() {
+		It("should acknowledge a message only after it was published to the bus", func() {
+			release := make(chan struct{})
+			publish = func(string, string) error {
+				<-release
+				return nil
+			}
+			start(Options{Inbound: []Rule{{Destination: "/queue/iac.orders", Topic: "plant1/orders"}}})
+			Eventually(broker.subscribes).Should(Receive(WithTransform(func(f *frame.Frame) string {
+				return f.Header.Get(frame.Ack)
+			}, Equal("client-individual"))))
+			id := broker.deliver("/queue/iac.orders", "order 1")
+			Eventually(bus).Should(Receive(Equal(busMessage{topic: "plant1/orders", message: "order 1"})))
+			Consistently(broker.acks, 100*time.Millisecond).ShouldNot(Receive())
+			close(release)
+			var ack *frame.Frame
+			Eventually(broker.acks).Should(Receive(&ack))
+			Expect(ack.Command).To(Equal(frame.ACK))
+			Expect(ack.Header.Get(frame.Id)).To(Equal(id))
+			Expect(bridge.Status().Inbound).To(BeEquivalentTo(1))
+		})
+
+		It("should negatively acknowledge the messages the bus rejects", func() {
+			publish = func(string, string) error { return errors.New("invalid message") }
+			start(Options{Inbound: []Rule{{Destination: "/queue/iac.orders", Topic: "plant1/orders"}}})
+			Eventually(broker.subscribes).Should(Receive())
+			id := broker.deliver("/queue/iac.orders", "order 1")
+			var nack *frame.Frame
+			Eventually(broker.acks).Should(Receive(&nack))
+			Expect(nack.Command).To(Equal(frame.NACK))
+			Expect(nack.Header.Get(frame.Id)).To(Equal(id))
+			Expect(bridge.Status().Failed).To(BeEquivalentTo(1))
+		})
+
+		It("should map the headers into an envelope", func() {
+			start(Options{Inbound: []Rule{{Destination: "/queue/iac.orders", Topic: "plant1/orders",
+				HeaderMap: map[string]string{"correlation-id": "correlationId", "JMSType": "type", "missing": "missing"}}}})
+			Eventually(broker.subscribes).Should(Receive())
+			broker.deliver("/queue/iac.orders", "order 1", "correlation-id", "c1", "JMSType", "order", "priority", "4")
+			var message busMessage
+			Eventually(bus).Should(Receive(&message))
+			Expect(message.message).To(MatchJSON(`{"headers":{"correlationId":"c1","type":"order"},"body":"order 1"}`))
+		})
+
+		It("should keep a durable subscription across reconnects", func() {
+			start(Options{ClientID: "iac-signalr-test", Inbound: []Rule{{Destination: "/topic/iac.events", Topic: "plant1/events", Durable: "signalr-events"}}})
+			var connect, subscribe *frame.Frame
+			Eventually(broker.connects).Should(Receive(&connect))
+			Expect(connect.Header.Get("client-id")).To(Equal("iac-signalr-test"))
+			Eventually(broker.subscribes).Should(Receive(&subscribe))
+			Expect(subscribe.Header.Get(subscriptionNameHeader)).To(Equal("signalr-events"))
+
+			broker.disconnectAll()
+			Eventually(func() bool { return bridge.Status().Connected }).Should(BeFalse())
+			broker.deliver("/topic/iac.events", "while disconnected")
+			Eventually(broker.subscribes, 2*time.Second).Should(Receive())
+			Eventually(bus).Should(Receive(Equal(busMessage{topic: "plant1/events", message: "while disconnected"})))
+			Eventually(broker.acks).Should(Receive())
+			Expect(bridge.Status().Connected).To(BeTrue())
+		})
+	})
+
+	Context("outbound", func() {
+		It("should send the messages of the bus topics to the rewritten destinations", func() {
+			start(Options{Outbound: []Rule{{Filter: "plant1/+/orders", Destination: "/queue/iac.{1}.orders",
+				Headers: map[string]string{"persistent": "true"}}}})
+			bridge.Forward("plant1/line3/orders", "order 1")
+			var send *frame.Frame
+			Eventually(broker.sends).Should(Receive(&send))
+			Expect(send.Header.Get(frame.Destination)).To(Equal("/queue/iac.line3.orders"))
+			Expect(send.Header.Get("persistent")).To(Equal("true"))
+			Expect(send.Header.Get(frame.ContentType)).To(Equal("text/plain"))
+			Expect(string(send.Body)).To(Equal("order 1"))
+			bridge.Forward("plant2/line3/orders", "order 2")
+			Consistently(broker.sends, 100*time.Millisecond).ShouldNot(Receive())
+			Expect(bridge.Status().Outbound).To(BeEquivalentTo(1))
+		})
+
+		It("should unpack envelopes and map their headers", func() {
+			start(Options{Outbound: []Rule{{Filter: "plant1/#", Destination: "/topic/iac.events",
+				HeaderMap: map[string]string{"correlationId": "correlation-id", "contentType": "content-type"}}}})
+			bridge.Forward("plant1/events", `{"headers":{"correlationId":"c1","contentType":"application/json","other":"x"},"body":"{\"a\":1}"}`)
+			var send *frame.Frame
+			Eventually(broker.sends).Should(Receive(&send))
+			Expect(send.Header.Get("correlation-id")).To(Equal("c1"))
+			Expect(send.Header.Get(frame.ContentType)).To(Equal("application/json"))
+			_, ok := send.Header.Contains("other")
+			Expect(ok).To(BeFalse())
+			Expect(string(send.Body)).To(Equal(`{"a":1}`))
+
+			bridge.Forward("plant1/events", "plain text")
+			Eventually(broker.sends).Should(Receive(&send))
+			Expect(string(send.Body)).To(Equal("plain text"))
+		})
+
+		It("should send a message again after the connection failed before its receipt", func() {
+			start(Options{Outbound: []Rule{{Filter: "plant1/#", Destination: "/queue/iac.orders"}}})
+			broker.failNextSend()
+			bridge.Forward("plant1/orders", "order 1")
+			var send *frame.Frame
+			Eventually(broker.sends, 2*time.Second).Should(Receive(&send))
+			Expect(string(send.Body)).To(Equal("order 1"))
+			Expect(bridge.Status().LastError).NotTo(BeEmpty())
+		})
+
+		It("should do nothing without bridge", func() {
+			var none *Bridge
+			none.Forward("plant1/orders", "order 1")
+			none.Close()
+		})
+	})
+
+	It("should keep trying to connect until the broker is reachable", func() {
+		address := broker.address()
+		broker.close()
+		var err error
+		bridge, err = New(Options{Address: address, MaxReconnectInterval: 20 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		bridge.Start()
+		Eventually(func() string { return bridge.Status().LastError }).ShouldNot(BeEmpty())
+		Expect(bridge.Status().Connected).To(BeFalse())
+	})
+
+	It("should reject invalid rules", func() {
+		_, err := New(Options{Address: "localhost:61613", Inbound: []Rule{{Destination: "/queue/a"}}})
+		Expect(err).To(HaveOccurred())
+		_, err = New(Options{Address: "localhost:61613", Inbound: []Rule{{Destination: "/topic/a", Topic: "a", Durable: "a"}}})
+		Expect(err).To(MatchError("inbound rule /topic/a: durable subscription a needs a client id"))
+		_, err = New(Options{Address: "localhost:61613", Outbound: []Rule{{Filter: "plant1/+", Destination: "/queue/{2}"}}})
+		Expect(err).To(HaveOccurred())
+		_, err = New(Options{})
+		Expect(err).To(HaveOccurred())
+	})
+})
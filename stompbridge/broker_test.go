@@ -0,0 +1,202 @@
+package stompbridge
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/go-stomp/stomp/v3/frame"
+	. "github.com/onsi/gomega"
+)
+
+// standIn is a minimal STOMP 1.2 broker for the tests. It delivers the messages of deliver to the subscriptions
+// of their destination, keeps them for durable subscriptions while their client is disconnected, and passes the
+// frames it receives to its channels.
+type standIn struct {
+	listener   net.Listener
+	connects   chan *frame.Frame
+	subscribes chan *frame.Frame
+	sends      chan *frame.Frame // SEND frames which were acknowledged with a receipt
+	acks       chan *frame.Frame // ACK and NACK frames
+
+	mx        sync.Mutex
+	sessions  map[*standInSession]bool
+	durable   map[string]string // destination of the durable subscriptions by name
+	backlog   map[string][]*frame.Frame
+	messageID int
+	failSend  bool // drop the connection on the next SEND instead of sending the receipt
+}
+
+type standInSession struct {
+	conn   net.Conn
+	writer *frame.Writer
+	subs   map[string]*frame.Frame // SUBSCRIBE frames by id
+}
+
+func newStandIn() *standIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	s := &standIn{
+		listener:   listener,
+		connects:   make(chan *frame.Frame, 10),
+		subscribes: make(chan *frame.Frame, 10),
+		sends:      make(chan *frame.Frame, 10),
+		acks:       make(chan *frame.Frame, 10),
+		sessions:   make(map[*standInSession]bool),
+		durable:    make(map[string]string),
+		backlog:    make(map[string][]*frame.Frame),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *standIn) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *standIn) serve(conn net.Conn) {
+	session := &standInSession{conn: conn, writer: frame.NewWriter(conn), subs: make(map[string]*frame.Frame)}
+	defer s.drop(session)
+	reader := frame.NewReader(conn)
+	connect, err := reader.Read()
+	if err != nil || (connect.Command != frame.CONNECT && connect.Command != frame.STOMP) {
+		return
+	}
+	s.connects <- connect
+	s.mx.Lock()
+	s.sessions[session] = true
+	err = session.writer.Write(frame.New(frame.CONNECTED, frame.Version, "1.2", frame.HeartBeat, "0,0"))
+	s.mx.Unlock()
+	if err != nil {
+		return
+	}
+	for {
+		f, err := reader.Read()
+		if err != nil {
+			return
+		}
+		if f == nil {
+			continue // heart-beat
+		}
+		switch f.Command {
+		case frame.SUBSCRIBE:
+			s.subscribe(session, f)
+			s.subscribes <- f
+		case frame.SEND:
+			s.mx.Lock()
+			fail := s.failSend
+			s.failSend = false
+			s.mx.Unlock()
+			if fail {
+				return
+			}
+			s.sends <- f
+			s.receipt(session, f)
+		case frame.ACK, frame.NACK:
+			s.acks <- f
+		case frame.DISCONNECT:
+			s.receipt(session, f)
+			return
+		}
+	}
+}
+
+func (s *standIn) subscribe(session *standInSession, f *frame.Frame) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	session.subs[f.Header.Get(frame.Id)] = f
+	name := f.Header.Get(subscriptionNameHeader)
+	if name == "" {
+		return
+	}
+	s.durable[name] = f.Header.Get(frame.Destination)
+	for _, message := range s.backlog[name] {
+		s.write(session, f, message)
+	}
+	delete(s.backlog, name)
+}
+
+func (s *standIn) receipt(session *standInSession, f *frame.Frame) {
+	if receipt, ok := f.Header.Contains(frame.Receipt); ok {
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		_ = session.writer.Write(frame.New(frame.RECEIPT, frame.ReceiptId, receipt))
+	}
+}
+
+// deliver sends a message to the subscriptions of the destination, or keeps it for the durable subscriptions
+// of the destination without connection. It returns the id of the message.
+func (s *standIn) deliver(destination string, body string, headers ...string) string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.messageID++
+	message := frame.New(frame.MESSAGE, headers...)
+	message.Header.Set(frame.Destination, destination)
+	message.Header.Set(frame.MessageId, strconv.Itoa(s.messageID))
+	message.Body = []byte(body)
+	live := make(map[string]bool)
+	for session := range s.sessions {
+		for _, sub := range session.subs {
+			if sub.Header.Get(frame.Destination) == destination {
+				s.write(session, sub, message)
+				live[sub.Header.Get(subscriptionNameHeader)] = true
+			}
+		}
+	}
+	for name, durableDestination := range s.durable {
+		if durableDestination == destination && !live[name] {
+			s.backlog[name] = append(s.backlog[name], message)
+		}
+	}
+	return message.Header.Get(frame.MessageId)
+}
+
+// write sends the message to the subscription, with the message id as ack id
+func (s *standIn) write(session *standInSession, sub *frame.Frame, message *frame.Frame) {
+	f := message.Clone()
+	f.Header.Set(frame.Subscription, sub.Header.Get(frame.Id))
+	f.Header.Set(frame.Ack, message.Header.Get(frame.MessageId))
+	_ = session.writer.Write(f)
+}
+
+func (s *standIn) drop(session *standInSession) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.sessions, session)
+	_ = session.conn.Close()
+}
+
+// disconnectAll closes the connections of the clients, like a network failure
+func (s *standIn) disconnectAll() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for session := range s.sessions {
+		delete(s.sessions, session)
+		_ = session.conn.Close()
+	}
+}
+
+func (s *standIn) failNextSend() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.failSend = true
+}
+
+func (s *standIn) connected() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return len(s.sessions)
+}
+
+func (s *standIn) close() {
+	_ = s.listener.Close()
+	s.disconnectAll()
+}
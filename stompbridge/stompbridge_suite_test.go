@@ -0,0 +1,13 @@
+package stompbridge
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestStompbridge(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Stompbridge Suite")
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig configures native TLS serving. TLS is enabled when both CertFile and KeyFile are set.
+// When ClientCAFile is set, clients have to present a certificate signed by one of its CAs (mutual TLS).
+// Certificate, key and client CA files are reloaded from disk when they change.
+type TLSConfig struct {
+	CertFile       string   `json:"certFile"`
+	KeyFile        string   `json:"keyFile"`
+	MinVersion     string   `json:"minVersion"`     // "1.2" or "1.3", default "1.2"
+	CipherSuites   []string `json:"cipherSuites"`   // IANA names, only used for TLS 1.2
+	ClientCAFile   string   `json:"clientCAFile"`   // enables mutual TLS
+	ClientAuth     string   `json:"clientAuth"`     // "require" (default) or "verifyIfGiven"
+	ReloadInterval int      `json:"reloadInterval"` // in seconds, default 30
+}
+
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// ClientTLSConfig configures the TLS connections of the bridges to their brokers. CAFile replaces the system roots,
+// CertFile and KeyFile are the client certificate for brokers which require one.
+type ClientTLSConfig struct {
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	ServerName         string `json:"serverName"` // default the host of the broker
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// newClientTLSConfig builds the tls.Config of a bridge from the ClientTLSConfig.
+func newClientTLSConfig(config ClientTLSConfig) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", config.CAFile)
+		}
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// newServerTLSConfig builds the tls.Config for the http.Server from the TLSConfig.
+func newServerTLSConfig(config TLSConfig) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(config.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth := tls.NoClientCert
+	if config.ClientCAFile != "" {
+		switch strings.ToLower(config.ClientAuth) {
+		case "", "require":
+			clientAuth = tls.RequireAndVerifyClientCert
+		case "verifyifgiven":
+			clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unsupported tls clientAuth %q", config.ClientAuth)
+		}
+	}
+	reloadInterval := time.Duration(config.ReloadInterval) * time.Second
+	if reloadInterval <= 0 {
+		reloadInterval = 30 * time.Second
+	}
+	reloader := &certReloader{
+		certFile:       config.CertFile,
+		keyFile:        config.KeyFile,
+		clientCAFile:   config.ClientCAFile,
+		reloadInterval: reloadInterval,
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	base := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.GetCertificate,
+	}
+	// The client CA pool can not be exchanged by a callback like the certificate,
+	// so a fresh config with the current pool is handed out for every handshake.
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		reloader.maybeReload()
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = reloader.clientCAs()
+		return cfg, nil
+	}
+	return base, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls minVersion %q", version)
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure tls cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// certReloader serves the server certificate and client CA pool and reloads them
+// when the modification time of one of the files has changed.
+type certReloader struct {
+	certFile       string
+	keyFile        string
+	clientCAFile   string
+	reloadInterval time.Duration
+
+	mx        sync.RWMutex
+	cert      *tls.Certificate
+	caPool    *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) clientCAs() *x509.CertPool {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	return r.caPool
+}
+
+// maybeReload checks the files at most once per reloadInterval. Failed reloads keep the last good state.
+func (r *certReloader) maybeReload() {
+	r.mx.Lock()
+	if time.Since(r.lastCheck) < r.reloadInterval {
+		r.mx.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	changed := false
+	for file, modTime := range r.modTimes {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(modTime) {
+			changed = true
+			break
+		}
+	}
+	r.mx.Unlock()
+	if changed {
+		if err := r.load(); err != nil {
+			ilog.Error(fmt.Sprintf("Failed to reload TLS certificates, keeping the current ones: %v", err))
+			return
+		}
+		ilog.Info(fmt.Sprintf("Reloaded TLS certificate %s", r.certFile))
+	}
+}
+
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading tls key pair: %w", err)
+	}
+	var caPool *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in tls clientCAFile " + r.clientCAFile)
+		}
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.cert = &cert
+	r.caPool = caPool
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	return nil
+}
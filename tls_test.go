@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testCert is a certificate with its key, signed by parent or self-signed if parent is nil
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+func newTestCert(commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return &testCert{cert: cert, key: key, tls: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+// write writes the certificate and the key as PEM files and sets their modification time
+func (c *testCert) write(certFile string, keyFile string, modTime time.Time) {
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600)).To(Succeed())
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+	Expect(os.Chtimes(certFile, modTime, modTime)).To(Succeed())
+	Expect(os.Chtimes(keyFile, modTime, modTime)).To(Succeed())
+}
+
+var _ = Describe("newServerTLSConfig", func() {
+	var dir, certFile, keyFile, caFile string
+	var ca *testCert
+	var roots *x509.CertPool
+	var httpServer *http.Server
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "signalr-server-tls")
+		Expect(err).NotTo(HaveOccurred())
+		certFile = filepath.Join(dir, "server.crt")
+		keyFile = filepath.Join(dir, "server.key")
+		caFile = filepath.Join(dir, "ca.crt")
+		ca = newTestCert("test ca", nil)
+		ca.write(caFile, filepath.Join(dir, "ca.key"), time.Now())
+		roots = x509.NewCertPool()
+		roots.AddCert(ca.cert)
+	})
+
+	AfterEach(func() {
+		if httpServer != nil {
+			_ = httpServer.Close()
+		}
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	// serve serves https with the tls.Config of config and returns the address
+	serve := func(config TLSConfig) string {
+		tlsConfig, err := newServerTLSConfig(config)
+		Expect(err).NotTo(HaveOccurred())
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		httpServer = &http.Server{
+			Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			TLSConfig: tlsConfig,
+		}
+		go func() { _ = httpServer.ServeTLS(listener, "", "") }()
+		return listener.Addr().String()
+	}
+
+	// serverCert does a new handshake and returns the common name of the certificate the server presented
+	serverCert := func(address string) string {
+		conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: roots})
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	It("should present the new certificate after the files have been replaced", func() {
+		newTestCert("server 1", ca).write(certFile, keyFile, time.Now().Add(-time.Minute))
+		address := serve(TLSConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 1})
+		Expect(serverCert(address)).To(Equal("server 1"))
+
+		newTestCert("server 2", ca).write(certFile, keyFile, time.Now())
+		Eventually(func() string { return serverCert(address) }, 5*time.Second, 100*time.Millisecond).Should(Equal("server 2"))
+	})
+
+	It("should reject clients without a certificate when a client CA is set", func() {
+		newTestCert("server", ca).write(certFile, keyFile, time.Now())
+		url := "https://" + serve(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+
+		anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		_, err := anonymous.Get(url)
+		Expect(err).To(HaveOccurred())
+
+		client := newTestCert("client", ca)
+		authenticated := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{client.tls},
+		}}}
+		response, err := authenticated.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,69 @@
+package topic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rewrite maps a topic matching the filter to the template, for bridges whose topics are named differently.
+// The template refers to the levels matched by the wildcards of the filter as {1}, {2} and so on, in their order.
+// "#" matches the remaining levels as one value, empty levels left by an empty "#" are removed.
+// An empty template keeps the topic. It returns false if the
+// filter does not match the topic.
+func Rewrite(filter string, template string, topic string) (string, bool) {
+	if !Match(filter, topic) {
+		return "", false
+	}
+	if template == "" {
+		return topic, true
+	}
+	topicLevels := strings.Split(topic, separator)
+	var values []string
+	for i, level := range strings.Split(filter, separator) {
+		switch level {
+		case singleLevel:
+			values = append(values, topicLevels[i])
+		case multiLevel:
+			if i < len(topicLevels) {
+				values = append(values, strings.Join(topicLevels[i:], separator))
+			} else {
+				values = append(values, "")
+			}
+		}
+	}
+	rewritten := template
+	for i := len(values); i > 0; i-- {
+		rewritten = strings.ReplaceAll(rewritten, "{"+strconv.Itoa(i)+"}", values[i-1])
+	}
+	return strings.Trim(strings.ReplaceAll(rewritten, separator+separator, separator), separator), true
+}
+
+// ValidateRewrite checks that the template only refers to wildcards of the filter
+func ValidateRewrite(filter string, template string) error {
+	if err := ValidateFilter(filter); err != nil {
+		return err
+	}
+	wildcards := 0
+	for _, level := range strings.Split(filter, separator) {
+		if level == singleLevel || level == multiLevel {
+			wildcards++
+		}
+	}
+	for rest := template; ; {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(rest[open:], "}")
+		if end < 0 {
+			return fmt.Errorf("topic template %s: { is not closed", template)
+		}
+		n, err := strconv.Atoi(rest[open+1 : open+end])
+		if err != nil || n < 1 || n > wildcards {
+			return fmt.Errorf("topic template %s: %s does not refer to a wildcard of %s", template, rest[open:open+end+1], filter)
+		}
+		rest = rest[open+end+1:]
+	}
+	return nil
+}
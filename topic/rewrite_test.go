@@ -0,0 +1,37 @@
+package topic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rewrite", func() {
+	rewrite := func(filter, template, topic string) string {
+		rewritten, ok := Rewrite(filter, template, topic)
+		Expect(ok).To(BeTrue())
+		return rewritten
+	}
+
+	It("should replace the references to the wildcards", func() {
+		Expect(rewrite("factory/+/temp", "plant1/{1}/temperature", "factory/line3/temp")).To(Equal("plant1/line3/temperature"))
+		Expect(rewrite("devices/+/+/#", "plant1/{2}/{1}/{3}", "devices/m7/line3/a/b")).To(Equal("plant1/line3/m7/a/b"))
+		Expect(rewrite("devices/#", "bus/{1}/raw", "devices")).To(Equal("bus/raw"))
+	})
+
+	It("should keep the topic without template", func() {
+		Expect(rewrite("plant1/#", "", "plant1/line3")).To(Equal("plant1/line3"))
+	})
+
+	It("should not rewrite topics which do not match", func() {
+		_, ok := Rewrite("factory/+/temp", "x/{1}", "factory/line3/pressure")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should reject references to missing wildcards", func() {
+		Expect(ValidateRewrite("factory/+/temp", "plant1/{1}")).To(Succeed())
+		Expect(ValidateRewrite("factory/+/temp", "plant1/{2}")).To(HaveOccurred())
+		Expect(ValidateRewrite("factory/+/temp", "plant1/{x}")).To(HaveOccurred())
+		Expect(ValidateRewrite("factory/+/temp", "plant1/{1")).To(HaveOccurred())
+		Expect(ValidateRewrite("factory/+x", "")).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,224 @@
+// Package topic keeps the topic subscriptions of the message bus connections.
+//
+// Topics are hierarchical with levels separated by "/", like "plant1/line3/machine7/status".
+// Subscriptions are topic filters with MQTT wildcards: "+" matches exactly one level and "#", which must be
+// the last level, matches any number of levels including none, so "plant1/#" also matches "plant1".
+package topic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	separator      = "/"
+	singleLevel    = "+"
+	multiLevel     = "#"
+	wildcardLevels = singleLevel + multiLevel
+)
+
+// ValidateFilter checks that filter is a valid topic filter
+func ValidateFilter(filter string) error {
+	if filter == "" {
+		return errors.New("topic filter is empty")
+	}
+	levels := strings.Split(filter, separator)
+	for i, level := range levels {
+		switch {
+		case level == multiLevel && i != len(levels)-1:
+			return fmt.Errorf("topic filter %s: %s must be the last level", filter, multiLevel)
+		case level != singleLevel && level != multiLevel && strings.ContainsAny(level, wildcardLevels):
+			return fmt.Errorf("topic filter %s: wildcards must occupy a whole level", filter)
+		}
+	}
+	return nil
+}
+
+// ValidateTopic checks that topic is a valid topic to publish to, which is not empty and has no wildcards
+func ValidateTopic(topic string) error {
+	if topic == "" {
+		return errors.New("topic is empty")
+	}
+	if strings.ContainsAny(topic, wildcardLevels) {
+		return fmt.Errorf("topic %s: wildcards are only allowed in subscriptions", topic)
+	}
+	return nil
+}
+
+// Match reports whether the topic filter matches the topic
+func Match(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, separator)
+	topicLevels := strings.Split(topic, separator)
+	for i, level := range filterLevels {
+		switch {
+		case level == multiLevel:
+			return true
+		case i == len(topicLevels):
+			return false
+		case level != singleLevel && level != topicLevels[i]:
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// node is a level of the subscription trie
+type node struct {
+	children    map[string]*node
+	subscribers map[string]struct{} // connections whose filter ends at this level
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node), subscribers: make(map[string]struct{})}
+}
+
+func (n *node) empty() bool {
+	return len(n.children) == 0 && len(n.subscribers) == 0
+}
+
+// Subscriptions maps topic filters to the connections which subscribed them, and connections to their filters,
+// so the subscriptions of a connection can be removed when it disconnects. The filters are kept in a trie
+// of their levels, so the cost of matching a topic depends on its depth and not on the number of subscriptions.
+// It is safe for concurrent use.
+type Subscriptions struct {
+	mx          sync.RWMutex
+	root        *node
+	connections map[string]map[string]struct{} // connection id -> filters
+}
+
+// NewSubscriptions creates an empty set of subscriptions
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{
+		root:        newNode(),
+		connections: make(map[string]map[string]struct{}),
+	}
+}
+
+// Subscribe adds the subscription of the connection to the topic filter.
+// It returns false if the connection had already subscribed the filter.
+func (s *Subscriptions) Subscribe(filter string, connectionID string) (bool, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return false, err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	n := s.root
+	for _, level := range strings.Split(filter, separator) {
+		child, ok := n.children[level]
+		if !ok {
+			child = newNode()
+			n.children[level] = child
+		}
+		n = child
+	}
+	if _, ok := n.subscribers[connectionID]; ok {
+		return false, nil
+	}
+	n.subscribers[connectionID] = struct{}{}
+	filters, ok := s.connections[connectionID]
+	if !ok {
+		filters = make(map[string]struct{})
+		s.connections[connectionID] = filters
+	}
+	filters[filter] = struct{}{}
+	return true, nil
+}
+
+// Unsubscribe removes the subscription of the connection to the topic filter.
+// It returns false if the connection had not subscribed the filter.
+func (s *Subscriptions) Unsubscribe(filter string, connectionID string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	filters := s.connections[connectionID]
+	if _, ok := filters[filter]; !ok {
+		return false
+	}
+	s.remove(filter, connectionID)
+	delete(filters, filter)
+	if len(filters) == 0 {
+		delete(s.connections, connectionID)
+	}
+	return true
+}
+
+// RemoveConnection removes all subscriptions of the connection and returns their filters
+func (s *Subscriptions) RemoveConnection(connectionID string) []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	filters := sortedKeys(s.connections[connectionID])
+	for _, filter := range filters {
+		s.remove(filter, connectionID)
+	}
+	delete(s.connections, connectionID)
+	return filters
+}
+
+// remove deletes the connection from the node of the filter and prunes the nodes which became empty
+func (s *Subscriptions) remove(filter string, connectionID string) {
+	levels := strings.Split(filter, separator)
+	path := make([]*node, 0, len(levels)+1)
+	n := s.root
+	path = append(path, n)
+	for _, level := range levels {
+		if n = n.children[level]; n == nil {
+			return
+		}
+		path = append(path, n)
+	}
+	delete(n.subscribers, connectionID)
+	for i := len(levels) - 1; i >= 0 && path[i+1].empty(); i-- {
+		delete(path[i].children, levels[i])
+	}
+}
+
+// Topics returns the sorted topic filters the connection has subscribed
+func (s *Subscriptions) Topics(connectionID string) []string {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return sortedKeys(s.connections[connectionID])
+}
+
+// Subscribers returns the sorted ids of the connections with a filter which matches the topic.
+// A connection is returned once, even if several of its filters match.
+func (s *Subscriptions) Subscribers(topic string) []string {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	subscribers := make(map[string]struct{})
+	match(s.root, strings.Split(topic, separator), subscribers)
+	return sortedKeys(subscribers)
+}
+
+// match adds the subscribers of the filters below n which match the remaining levels of a topic
+func match(n *node, levels []string, subscribers map[string]struct{}) {
+	if all, ok := n.children[multiLevel]; ok {
+		addAll(subscribers, all.subscribers)
+	}
+	if len(levels) == 0 {
+		addAll(subscribers, n.subscribers)
+		return
+	}
+	if child, ok := n.children[levels[0]]; ok {
+		match(child, levels[1:], subscribers)
+	}
+	if child, ok := n.children[singleLevel]; ok {
+		match(child, levels[1:], subscribers)
+	}
+}
+
+func addAll(to map[string]struct{}, from map[string]struct{}) {
+	for key := range from {
+		to[key] = struct{}{}
+	}
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+package topic
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subscriptions", func() {
+	var subscriptions *Subscriptions
+
+	BeforeEach(func() {
+		subscriptions = NewSubscriptions()
+	})
+
+	subscribe := func(filter, connectionID string) bool {
+		added, err := subscriptions.Subscribe(filter, connectionID)
+		Expect(err).NotTo(HaveOccurred())
+		return added
+	}
+
+	It("should map topics to their subscribers", func() {
+		Expect(subscribe("plant1/status", "c1")).To(BeTrue())
+		Expect(subscribe("plant1/status", "c1")).To(BeFalse())
+		Expect(subscribe("plant1/status", "c2")).To(BeTrue())
+		Expect(subscribe("plant2/status", "c1")).To(BeTrue())
+		Expect(subscriptions.Subscribers("plant1/status")).To(Equal([]string{"c1", "c2"}))
+		Expect(subscriptions.Subscribers("plant3/status")).To(BeEmpty())
+		Expect(subscriptions.Subscribers("plant1")).To(BeEmpty())
+		Expect(subscriptions.Topics("c1")).To(Equal([]string{"plant1/status", "plant2/status"}))
+	})
+
+	It("should unsubscribe", func() {
+		subscribe("plant1/status", "c1")
+		Expect(subscriptions.Unsubscribe("plant1/status", "c1")).To(BeTrue())
+		Expect(subscriptions.Unsubscribe("plant1/status", "c1")).To(BeFalse())
+		Expect(subscriptions.Subscribers("plant1/status")).To(BeEmpty())
+		Expect(subscriptions.Topics("c1")).To(BeEmpty())
+		Expect(subscriptions.root.empty()).To(BeTrue())
+	})
+
+	It("should remove all subscriptions of a connection", func() {
+		subscribe("plant1/status", "c1")
+		subscribe("plant2/#", "c1")
+		subscribe("plant2/status", "c2")
+		Expect(subscriptions.RemoveConnection("c1")).To(Equal([]string{"plant1/status", "plant2/#"}))
+		Expect(subscriptions.Subscribers("plant1/status")).To(BeEmpty())
+		Expect(subscriptions.Subscribers("plant2/status")).To(Equal([]string{"c2"}))
+		Expect(subscriptions.RemoveConnection("c1")).To(BeEmpty())
+		Expect(subscriptions.RemoveConnection("c2")).To(Equal([]string{"plant2/status"}))
+		Expect(subscriptions.root.empty()).To(BeTrue())
+	})
+
+	It("should match wildcard filters", func() {
+		for _, c := range []struct {
+			filter  string
+			topic   string
+			matches bool
+		}{
+			{"plant1/+/machine7/status", "plant1/line3/machine7/status", true},
+			{"plant1/+/machine7/status", "plant1/line3/machine8/status", false},
+			{"plant1/+/status", "plant1/line3/machine7/status", false},
+			{"plant1/+", "plant1", false},
+			{"plant1/+/status", "plant1//status", true},
+			{"plant1/#", "plant1/line3/machine7/status", true},
+			{"plant1/#", "plant1", true},
+			{"plant1/#", "plant2/line3", false},
+			{"#", "plant1/line3", true},
+			{"plant1/+/machine7/#", "plant1/line3/machine7/status/temperature", true},
+			{"plant1/+/machine7/#", "plant1/line3/machine8/status", false},
+		} {
+			Expect(Match(c.filter, c.topic)).To(Equal(c.matches), c.filter+" "+c.topic)
+			subscriptions = NewSubscriptions()
+			subscribe(c.filter, "c1")
+			if c.matches {
+				Expect(subscriptions.Subscribers(c.topic)).To(Equal([]string{"c1"}), c.filter+" "+c.topic)
+			} else {
+				Expect(subscriptions.Subscribers(c.topic)).To(BeEmpty(), c.filter+" "+c.topic)
+			}
+		}
+	})
+
+	It("should deliver to a connection once if several of its filters overlap", func() {
+		for _, filter := range []string{"plant1/#", "plant1/+/machine7/#", "plant1/line3/machine7/status", "+/+/+/status", "#"} {
+			subscribe(filter, "c1")
+		}
+		subscribe("plant1/+/machine7/#", "c2")
+		subscribe("plant1/line3/+/status", "c2")
+		subscribe("plant2/#", "c3")
+		Expect(subscriptions.Subscribers("plant1/line3/machine7/status")).To(Equal([]string{"c1", "c2"}))
+		Expect(subscriptions.Subscribers("plant2/line1")).To(Equal([]string{"c1", "c3"}))
+		Expect(subscriptions.Unsubscribe("#", "c1")).To(BeTrue())
+		Expect(subscriptions.Subscribers("plant2/line1")).To(Equal([]string{"c3"}))
+	})
+
+	It("should reject invalid filters", func() {
+		for _, filter := range []string{"", "plant1/#/status", "plant1/line+", "plant1/#3"} {
+			_, err := subscriptions.Subscribe(filter, "c1")
+			Expect(err).To(HaveOccurred(), filter)
+		}
+		Expect(subscriptions.Topics("c1")).To(BeEmpty())
+		Expect(subscriptions.root.empty()).To(BeTrue())
+	})
+
+	It("should reject wildcards in published topics", func() {
+		Expect(ValidateTopic("plant1/line3/status")).To(Succeed())
+		Expect(ValidateTopic("plant1/+/status")).NotTo(Succeed())
+		Expect(ValidateTopic("plant1/#")).NotTo(Succeed())
+		Expect(ValidateTopic("")).NotTo(Succeed())
+	})
+
+	It("should match among many subscriptions", func() {
+		for i := 0; i < 10000; i++ {
+			subscribe(fmt.Sprintf("plant%d/+/machine%d/#", i%100, i), fmt.Sprintf("c%d", i))
+		}
+		Expect(subscriptions.Subscribers("plant7/line1/machine7/status")).To(Equal([]string{"c7"}))
+		Expect(subscriptions.Subscribers("plant7/line1/machine8/status")).To(BeEmpty())
+	})
+})
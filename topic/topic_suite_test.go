@@ -0,0 +1,13 @@
+package topic
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTopic(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Topic Suite")
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// The states of a circuit breaker
+const (
+	StateClosed   = "closed"    // requests are sent
+	StateOpen     = "open"      // requests are not sent until the cooldown has passed
+	StateHalfOpen = "half-open" // one trial request is sent, which closes or opens the breaker again
+)
+
+// breaker stops the requests to an endpoint after threshold consecutive failures, for cooldown.
+// It is safe for concurrent use.
+type breaker struct {
+	mx        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time // zero if the breaker is closed
+	probing   bool      // a trial request of the half-open breaker is running
+	now       func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a request may be sent. After the cooldown, only one trial request is allowed
+// until its result is reported.
+func (b *breaker) allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// probeWait is the wait for the result of the trial request of another delivery
+const probeWait = 100 * time.Millisecond
+
+// wait returns the time until allow may return true again
+func (b *breaker) wait() time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if b.openUntil.IsZero() {
+		return 0
+	}
+	if wait := b.openUntil.Sub(b.now()); wait > 0 {
+		return wait
+	}
+	return probeWait
+}
+
+// success closes the breaker
+func (b *breaker) success() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// failure counts a failed request and opens the breaker at the threshold or when the trial request failed
+func (b *breaker) failure() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+		b.probing = false
+	}
+}
+
+func (b *breaker) state() string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return StateClosed
+	case b.probing || !b.now().Before(b.openUntil):
+		return StateHalfOpen
+	default:
+		return StateOpen
+	}
+}
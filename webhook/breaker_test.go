@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("breaker", func() {
+	var b *breaker
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		b = newBreaker(3, time.Minute)
+		b.now = func() time.Time { return now }
+	})
+
+	It("should open after the threshold of consecutive failures", func() {
+		b.failure()
+		b.failure()
+		b.success()
+		b.failure()
+		b.failure()
+		Expect(b.allow()).To(BeTrue())
+		b.failure()
+		Expect(b.state()).To(Equal(StateOpen))
+		Expect(b.allow()).To(BeFalse())
+	})
+
+	It("should allow one trial request after the cooldown", func() {
+		for i := 0; i < 3; i++ {
+			b.failure()
+		}
+		now = now.Add(time.Minute)
+		Expect(b.state()).To(Equal(StateHalfOpen))
+		Expect(b.allow()).To(BeTrue())
+		Expect(b.allow()).To(BeFalse())
+		b.failure()
+		Expect(b.state()).To(Equal(StateOpen))
+		now = now.Add(time.Minute)
+		Expect(b.allow()).To(BeTrue())
+		b.success()
+		Expect(b.state()).To(Equal(StateClosed))
+		Expect(b.allow()).To(BeTrue())
+		Expect(b.allow()).To(BeTrue())
+	})
+})
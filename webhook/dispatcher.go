@@ -0,0 +1,369 @@
+// Package webhook delivers the messages of message bus topics to HTTP endpoints, for systems which only accept
+// HTTP callbacks. Every endpoint has its own queue and a limited number of concurrent requests. Failed requests
+// are retried with exponential backoff, and a circuit breaker stops the requests to an endpoint which keeps failing.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mdaxf/iac-signalr/topic"
+)
+
+// Defaults of the Endpoint options which are not given
+const (
+	DefaultTimeout          = 10 * time.Second
+	DefaultConcurrency      = 4
+	DefaultQueueSize        = 1000
+	DefaultMaxAttempts      = 5
+	DefaultBackoff          = time.Second
+	DefaultMaxBackoff       = time.Minute
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+	DefaultLogSize          = 1000
+)
+
+// The headers of the webhook requests
+const (
+	HeaderID        = "X-IAC-Webhook-Id"
+	HeaderTimestamp = "X-IAC-Webhook-Timestamp"
+	// HeaderSignature is "sha256=" followed by the hex HMAC-SHA256 of the timestamp, a dot and the body,
+	// keyed with the secret of the endpoint. Receivers should also reject old timestamps to prevent replays.
+	HeaderSignature = "X-IAC-Signature"
+)
+
+// Endpoint is a webhook subscription
+type Endpoint struct {
+	Name string
+	URL  string
+	// Topics are the topic filters whose messages are delivered
+	Topics []string
+	// Secret signs the requests in HeaderSignature, they are not signed if it is empty
+	Secret string
+	// Headers are added to the requests, like an Authorization of the receiver
+	Headers map[string]string
+	// Timeout of a request
+	Timeout time.Duration
+	// Concurrency is the number of concurrent requests to the endpoint. Messages are delivered in order
+	// only with a Concurrency of 1.
+	Concurrency int
+	// QueueSize is the number of messages waiting for delivery, further messages are dropped
+	QueueSize int
+	// MaxAttempts is the number of requests for a message before it fails
+	MaxAttempts int
+	// Backoff is the wait before the first retry, it doubles with every retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// BreakerThreshold is the number of consecutive failed requests which open the circuit breaker
+	BreakerThreshold int
+	// BreakerCooldown is the time the open breaker stops the requests, before a trial request is sent
+	BreakerCooldown time.Duration
+}
+
+// Payload is the JSON body of a webhook request
+type Payload struct {
+	ID      string    `json:"id"`
+	Topic   string    `json:"topic"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Options configure a Dispatcher
+type Options struct {
+	// Client sends the requests, default http.DefaultClient with the Timeout of each endpoint
+	Client *http.Client
+	// LogSize is the number of results kept in the delivery log
+	LogSize int
+	// OnResult is called with the final result of every message, like for logging failures
+	OnResult func(entry LogEntry)
+}
+
+// Dispatcher delivers the messages of the matching topics to the endpoints. It is safe for concurrent use.
+type Dispatcher struct {
+	options   Options
+	endpoints []*endpoint
+	log       *deliveryLog
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// endpoint is an Endpoint with its queue and breaker
+type endpoint struct {
+	Endpoint
+	queue   chan Payload
+	breaker *breaker
+	mx      sync.Mutex
+	active  int // messages being delivered
+}
+
+// New starts the workers of the endpoints
+func New(endpoints []Endpoint, options Options) (*Dispatcher, error) {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.LogSize <= 0 {
+		options.LogSize = DefaultLogSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{options: options, log: newDeliveryLog(options.LogSize), ctx: ctx, cancel: cancel}
+	for _, e := range endpoints {
+		if e.URL == "" {
+			cancel()
+			return nil, fmt.Errorf("webhook %s has no url", e.Name)
+		}
+		for _, filter := range e.Topics {
+			if err := topic.ValidateFilter(filter); err != nil {
+				cancel()
+				return nil, fmt.Errorf("webhook %s: %w", e.Name, err)
+			}
+		}
+		if e.Name == "" {
+			e.Name = e.URL
+		}
+		setDefaults(&e)
+		ep := &endpoint{Endpoint: e, queue: make(chan Payload, e.QueueSize), breaker: newBreaker(e.BreakerThreshold, e.BreakerCooldown)}
+		d.endpoints = append(d.endpoints, ep)
+		for i := 0; i < e.Concurrency; i++ {
+			d.wg.Add(1)
+			go d.work(ep)
+		}
+	}
+	return d, nil
+}
+
+func setDefaults(e *Endpoint) {
+	if e.Timeout <= 0 {
+		e.Timeout = DefaultTimeout
+	}
+	if e.Concurrency <= 0 {
+		e.Concurrency = DefaultConcurrency
+	}
+	if e.QueueSize <= 0 {
+		e.QueueSize = DefaultQueueSize
+	}
+	if e.MaxAttempts <= 0 {
+		e.MaxAttempts = DefaultMaxAttempts
+	}
+	if e.Backoff <= 0 {
+		e.Backoff = DefaultBackoff
+	}
+	if e.MaxBackoff <= 0 {
+		e.MaxBackoff = DefaultMaxBackoff
+	}
+	if e.BreakerThreshold <= 0 {
+		e.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if e.BreakerCooldown <= 0 {
+		e.BreakerCooldown = DefaultBreakerCooldown
+	}
+}
+
+// Dispatch queues the message for the endpoints whose topic filters match the topic.
+// A nil *Dispatcher has no endpoints.
+func (d *Dispatcher) Dispatch(topicName string, message string) {
+	if d == nil || d.ctx.Err() != nil {
+		return
+	}
+	for _, ep := range d.endpoints {
+		if !ep.matches(topicName) {
+			continue
+		}
+		payload := Payload{ID: uuid.NewString(), Topic: topicName, Message: message, Time: time.Now().UTC()}
+		select {
+		case ep.queue <- payload:
+		default:
+			d.result(LogEntry{ID: payload.ID, Endpoint: ep.Name, Topic: topicName, Time: payload.Time,
+				Status: StatusDropped, Error: "queue is full"})
+		}
+	}
+}
+
+func (ep *endpoint) matches(topicName string) bool {
+	for _, filter := range ep.Topics {
+		if topic.Match(filter, topicName) {
+			return true
+		}
+	}
+	return false
+}
+
+// work delivers the messages of the queue of the endpoint until the dispatcher is closed
+func (d *Dispatcher) work(ep *endpoint) {
+	defer d.wg.Done()
+	for {
+		select {
+		case payload := <-ep.queue:
+			ep.setActive(1)
+			d.deliver(ep, payload)
+			ep.setActive(-1)
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+func (ep *endpoint) setActive(delta int) {
+	ep.mx.Lock()
+	defer ep.mx.Unlock()
+	ep.active += delta
+}
+
+// deliver sends the message until it is accepted, fails permanently or MaxAttempts is reached
+func (d *Dispatcher) deliver(ep *endpoint, payload Payload) {
+	entry := LogEntry{ID: payload.ID, Endpoint: ep.Name, Topic: payload.Topic, Time: payload.Time}
+	start := time.Now()
+	backoff := ep.Backoff
+	for {
+		// While the breaker is open, the message waits without using up its attempts
+		for !ep.breaker.allow() {
+			select {
+			case <-time.After(ep.breaker.wait()):
+			case <-d.ctx.Done():
+				entry.Status = StatusFailed
+				entry.Error = "webhooks closed: circuit breaker is open"
+				entry.Duration = time.Since(start)
+				d.result(entry)
+				return
+			}
+		}
+		entry.Attempts++
+		var err error
+		var retry bool
+		entry.StatusCode, retry, err = d.send(ep, payload)
+		if err == nil {
+			ep.breaker.success()
+			entry.Status = StatusDelivered
+			entry.Error = ""
+			break
+		}
+		if retry {
+			ep.breaker.failure()
+		} else {
+			// the endpoint is reachable, but rejects the message
+			ep.breaker.success()
+		}
+		entry.Error = err.Error()
+		if !retry || entry.Attempts >= ep.MaxAttempts {
+			entry.Status = StatusFailed
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-d.ctx.Done():
+			entry.Status = StatusFailed
+			entry.Error = "webhooks closed: " + entry.Error
+			entry.Duration = time.Since(start)
+			d.result(entry)
+			return
+		}
+		backoff *= 2
+		if backoff > ep.MaxBackoff {
+			backoff = ep.MaxBackoff
+		}
+	}
+	entry.Duration = time.Since(start)
+	d.result(entry)
+}
+
+// send makes one request. retry reports whether a failed request may succeed when it is repeated,
+// which is not the case for client errors other than timeouts and rate limits.
+func (d *Dispatcher) send(ep *endpoint, payload Payload) (statusCode int, retry bool, err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, false, err
+	}
+	ctx, cancel := context.WithTimeout(d.ctx, ep.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	for name, value := range ep.Headers {
+		request.Header.Set(name, value)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderID, payload.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	if ep.Secret != "" {
+		request.Header.Set(HeaderSignature, Sign(ep.Secret, timestamp, body))
+	}
+	response, err := d.options.Client.Do(request)
+	if err != nil {
+		return 0, true, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response.StatusCode, false, nil
+	}
+	retry = response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode == http.StatusTooManyRequests
+	return response.StatusCode, retry, fmt.Errorf("endpoint responded %s", response.Status)
+}
+
+// Sign returns the value of HeaderSignature for the timestamp and body
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) result(entry LogEntry) {
+	d.log.add(entry)
+	if d.options.OnResult != nil {
+		d.options.OnResult(entry)
+	}
+}
+
+// EndpointStatus is the state of an endpoint
+type EndpointStatus struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Topics   []string `json:"topics"`
+	Breaker  string   `json:"breaker"`
+	Queued   int      `json:"queued"`
+	Active   int      `json:"active"`
+	Capacity int      `json:"capacity"`
+}
+
+// Endpoints returns the state of the endpoints
+func (d *Dispatcher) Endpoints() []EndpointStatus {
+	statuses := make([]EndpointStatus, 0, len(d.endpoints))
+	for _, ep := range d.endpoints {
+		ep.mx.Lock()
+		active := ep.active
+		ep.mx.Unlock()
+		statuses = append(statuses, EndpointStatus{Name: ep.Name, URL: ep.URL, Topics: ep.Topics,
+			Breaker: ep.breaker.state(), Queued: len(ep.queue), Active: active, Capacity: ep.QueueSize})
+	}
+	return statuses
+}
+
+// Log returns the results in the delivery log, oldest first
+func (d *Dispatcher) Log() []LogEntry {
+	return d.log.entries()
+}
+
+// Close stops the workers. Messages in the queues or waiting for a retry are not delivered.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.cancel()
+	d.wg.Wait()
+}
@@ -0,0 +1,253 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// receiver is a webhook endpoint which answers with the status of respond
+type receiver struct {
+	server   *httptest.Server
+	requests chan *http.Request
+	bodies   chan []byte
+	respond  func(n int) int // status of the n-th request, starting at 1
+	count    int32
+	active   int32
+	peak     int32
+	delay    time.Duration
+}
+
+func newReceiver(respond func(n int) int) *receiver {
+	r := &receiver{requests: make(chan *http.Request, 100), bodies: make(chan []byte, 100), respond: respond}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&r.count, 1)
+		active := atomic.AddInt32(&r.active, 1)
+		defer atomic.AddInt32(&r.active, -1)
+		for {
+			peak := atomic.LoadInt32(&r.peak)
+			if active <= peak || atomic.CompareAndSwapInt32(&r.peak, peak, active) {
+				break
+			}
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.requests <- req
+		r.bodies <- body
+		time.Sleep(r.delay)
+		w.WriteHeader(r.respond(int(n)))
+	}))
+	return r
+}
+
+func status(code int) func(int) int {
+	return func(int) int { return code }
+}
+
+var _ = Describe("Dispatcher", func() {
+	var dispatcher *Dispatcher
+	var rec *receiver
+	var results chan LogEntry
+
+	endpoint := func(e Endpoint) Endpoint {
+		e.URL = rec.server.URL
+		if e.Topics == nil {
+			e.Topics = []string{"plant1/#"}
+		}
+		if e.Backoff == 0 {
+			e.Backoff = 5 * time.Millisecond
+		}
+		return e
+	}
+
+	start := func(endpoints ...Endpoint) {
+		var err error
+		dispatcher, err = New(endpoints, Options{OnResult: func(entry LogEntry) { results <- entry }})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		results = make(chan LogEntry, 100)
+		rec = newReceiver(status(http.StatusOK))
+	})
+
+	AfterEach(func() {
+		dispatcher.Close()
+		rec.server.Close()
+	})
+
+	It("should deliver the messages of matching topics with a signature", func() {
+		start(endpoint(Endpoint{Name: "mes", Secret: "s3cret", Headers: map[string]string{"Authorization": "Bearer t"}}))
+		dispatcher.Dispatch("plant2/line1", "ignored")
+		dispatcher.Dispatch("plant1/line3/status", "running")
+		var req *http.Request
+		Eventually(rec.requests).Should(Receive(&req))
+		var body []byte
+		Eventually(rec.bodies).Should(Receive(&body))
+		var payload Payload
+		Expect(json.Unmarshal(body, &payload)).To(Succeed())
+		Expect(payload.Topic).To(Equal("plant1/line3/status"))
+		Expect(payload.Message).To(Equal("running"))
+		Expect(req.Header.Get(HeaderID)).To(Equal(payload.ID))
+		Expect(req.Header.Get("Authorization")).To(Equal("Bearer t"))
+		Expect(req.Header.Get(HeaderSignature)).To(Equal(Sign("s3cret", req.Header.Get(HeaderTimestamp), body)))
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusDelivered))
+		Expect(entry.Endpoint).To(Equal("mes"))
+		Expect(entry.Attempts).To(Equal(1))
+		Consistently(rec.requests, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should retry server errors with backoff", func() {
+		rec.respond = func(n int) int {
+			if n < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusNoContent
+		}
+		start(endpoint(Endpoint{}))
+		dispatcher.Dispatch("plant1/a", "x")
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusDelivered))
+		Expect(entry.Attempts).To(Equal(3))
+		Expect(entry.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(entry.Duration).To(BeNumerically(">=", 15*time.Millisecond))
+	})
+
+	It("should fail after the maximum attempts", func() {
+		rec.respond = status(http.StatusInternalServerError)
+		start(endpoint(Endpoint{MaxAttempts: 2}))
+		dispatcher.Dispatch("plant1/a", "x")
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusFailed))
+		Expect(entry.Attempts).To(Equal(2))
+		Expect(entry.Error).To(ContainSubstring("500"))
+		Expect(dispatcher.Log()).To(Equal([]LogEntry{entry}))
+	})
+
+	It("should not retry client errors", func() {
+		rec.respond = status(http.StatusBadRequest)
+		start(endpoint(Endpoint{}))
+		dispatcher.Dispatch("plant1/a", "x")
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusFailed))
+		Expect(entry.Attempts).To(Equal(1))
+		Expect(dispatcher.Endpoints()[0].Breaker).To(Equal(StateClosed))
+	})
+
+	It("should stop sending while the circuit breaker is open without using up the attempts", func() {
+		rec.respond = status(http.StatusBadGateway)
+		start(endpoint(Endpoint{MaxAttempts: 3, BreakerThreshold: 2, BreakerCooldown: time.Hour, Concurrency: 1}))
+		dispatcher.Dispatch("plant1/a", "x")
+		Eventually(func() string { return dispatcher.Endpoints()[0].Breaker }).Should(Equal(StateOpen))
+		Consistently(results, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(atomic.LoadInt32(&rec.count)).To(Equal(int32(2)))
+		dispatcher.Close()
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusFailed))
+		Expect(entry.Attempts).To(Equal(2))
+		Expect(entry.Error).To(Equal("webhooks closed: circuit breaker is open"))
+	})
+
+	It("should send again after the cooldown of the circuit breaker", func() {
+		rec.respond = func(n int) int {
+			if n <= 2 {
+				return http.StatusBadGateway
+			}
+			return http.StatusOK
+		}
+		start(endpoint(Endpoint{MaxAttempts: 3, BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond, Concurrency: 1}))
+		dispatcher.Dispatch("plant1/a", "x")
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusDelivered))
+		Expect(entry.Attempts).To(Equal(3))
+		Expect(entry.Duration).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(dispatcher.Endpoints()[0].Breaker).To(Equal(StateClosed))
+	})
+
+	It("should limit the concurrent requests per endpoint", func() {
+		rec.delay = 20 * time.Millisecond
+		start(endpoint(Endpoint{Concurrency: 2}))
+		for i := 0; i < 6; i++ {
+			dispatcher.Dispatch("plant1/a", "x")
+		}
+		for i := 0; i < 6; i++ {
+			Eventually(results).Should(Receive())
+		}
+		Expect(atomic.LoadInt32(&rec.peak)).To(Equal(int32(2)))
+	})
+
+	It("should drop messages when the queue is full", func() {
+		block := make(chan struct{})
+		var once sync.Once
+		rec.respond = func(int) int {
+			<-block
+			return http.StatusOK
+		}
+		start(endpoint(Endpoint{Concurrency: 1, QueueSize: 1}))
+		defer once.Do(func() { close(block) })
+		dispatcher.Dispatch("plant1/a", "1")
+		Eventually(rec.requests).Should(Receive())
+		dispatcher.Dispatch("plant1/a", "2")
+		dispatcher.Dispatch("plant1/a", "3")
+		var entry LogEntry
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusDropped))
+		once.Do(func() { close(block) })
+		Eventually(results).Should(Receive(&entry))
+		Eventually(results).Should(Receive(&entry))
+		Expect(entry.Status).To(Equal(StatusDelivered))
+	})
+
+	It("should serve the endpoints and the delivery log", func() {
+		start(endpoint(Endpoint{Name: "mes"}))
+		dispatcher.Dispatch("plant1/a", "x")
+		Eventually(results).Should(Receive())
+		handler := dispatcher.Handler("/webhooks/")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/webhooks/log?status=delivered", nil))
+		var entries []LogEntry
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &entries)).To(Succeed())
+		Expect(entries).To(HaveLen(1))
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/webhooks/endpoints", nil))
+		var endpoints []EndpointStatus
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &endpoints)).To(Succeed())
+		Expect(endpoints[0].Name).To(Equal("mes"))
+		Expect(endpoints[0].Breaker).To(Equal(StateClosed))
+	})
+
+	It("should reject endpoints without url or with invalid topic filters", func() {
+		_, err := New([]Endpoint{{Name: "a"}}, Options{})
+		Expect(err).To(HaveOccurred())
+		_, err = New([]Endpoint{{Name: "a", URL: "http://x", Topics: []string{"a/#/b"}}}, Options{})
+		Expect(err).To(HaveOccurred())
+		start(endpoint(Endpoint{}))
+	})
+})
+
+var _ = Describe("deliveryLog", func() {
+	It("should keep the latest entries, oldest first", func() {
+		l := newDeliveryLog(3)
+		for _, id := range []string{"a", "b", "c", "d"} {
+			l.add(LogEntry{ID: id})
+		}
+		var ids []string
+		for _, entry := range l.entries() {
+			ids = append(ids, entry.ID)
+		}
+		Expect(ids).To(Equal([]string{"b", "c", "d"}))
+	})
+})
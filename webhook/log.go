@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The statuses of a LogEntry
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+	StatusDropped   = "dropped" // the queue of the endpoint was full
+)
+
+// LogEntry is the result of the delivery of a message to an endpoint
+type LogEntry struct {
+	ID         string        `json:"id"`
+	Endpoint   string        `json:"endpoint"`
+	Topic      string        `json:"topic"`
+	Time       time.Time     `json:"time"`
+	Status     string        `json:"status"`
+	Attempts   int           `json:"attempts"`
+	StatusCode int           `json:"statusCode,omitempty"` // of the last request
+	Error      string        `json:"error,omitempty"`      // of the last request
+	Duration   time.Duration `json:"duration"`             // from the first request to the result
+}
+
+// deliveryLog keeps the latest entries in a ring buffer
+type deliveryLog struct {
+	mx    sync.Mutex
+	ring  []LogEntry
+	next  int
+	count int
+}
+
+func newDeliveryLog(size int) *deliveryLog {
+	return &deliveryLog{ring: make([]LogEntry, size)}
+}
+
+func (l *deliveryLog) add(entry LogEntry) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.ring[l.next] = entry
+	l.next = (l.next + 1) % len(l.ring)
+	if l.count < len(l.ring) {
+		l.count++
+	}
+}
+
+func (l *deliveryLog) entries() []LogEntry {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	entries := make([]LogEntry, 0, l.count)
+	start := (l.next - l.count + len(l.ring)) % len(l.ring)
+	for i := 0; i < l.count; i++ {
+		entries = append(entries, l.ring[(start+i)%len(l.ring)])
+	}
+	return entries
+}
+
+// Handler serves the state of the endpoints and the delivery log below prefix:
+//
+//	GET {prefix}/endpoints    the endpoints with their breaker state and queue length
+//	GET {prefix}/log          the delivery log, oldest first, optionally only ?endpoint=name and ?status=failed
+func (d *Dispatcher) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "/endpoints":
+			writeJSON(w, d.Endpoints())
+		case "/log":
+			endpointName, status := r.URL.Query().Get("endpoint"), r.URL.Query().Get("status")
+			entries := []LogEntry{}
+			for _, entry := range d.Log() {
+				if (endpointName == "" || entry.Endpoint == endpointName) && (status == "" || entry.Status == status) {
+					entries = append(entries, entry)
+				}
+			}
+			writeJSON(w, entries)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}